@@ -6,7 +6,6 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
-	"io"
 	"os"
 	"regexp"
 )
@@ -178,7 +177,9 @@ func wipeHeuristic(data []byte, threshold float64) ([]byte, int, error) {
 		if bytes.Contains(body, []byte("/FlateDecode")) {
 			r, err := zlib.NewReader(bytes.NewReader(streamRaw))
 			if err == nil {
-				contentForHash, _ = io.ReadAll(r)
+				if contentForHash, err = readAllLimited(r); err != nil {
+					contentForHash = streamRaw
+				}
 				r.Close()
 			} else {
 				contentForHash = streamRaw
@@ -6,7 +6,6 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
-	"io"
 	"os"
 	"regexp"
 )
@@ -77,7 +76,9 @@ func HeuristicClean(filePath string, threshold float64) (string, int, error) {
 		if bytes.Contains(body, []byte("/FlateDecode")) {
 			r, err := zlib.NewReader(bytes.NewReader(streamRaw))
 			if err == nil {
-				contentForHash, _ = io.ReadAll(r)
+				if contentForHash, err = readAllLimited(r); err != nil {
+					contentForHash = streamRaw
+				}
 				r.Close()
 			} else {
 				contentForHash = streamRaw
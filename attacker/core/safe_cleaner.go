@@ -3,6 +3,7 @@ package core
 import (
 	"bytes"
 	"compress/flate"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -10,12 +11,30 @@ import (
 	"strings"
 )
 
+// maxDecodedStreamSize caps how much one decompressed stream may grow, so a
+// decompression bomb cannot exhaust memory
+const maxDecodedStreamSize = 64 << 20
+
+var errStreamTooLarge = errors.New("decompressed stream too large")
+
+// readAllLimited reads a decompressor to the end, failing past maxDecodedStreamSize
+func readAllLimited(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxDecodedStreamSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxDecodedStreamSize {
+		return nil, errStreamTooLarge
+	}
+	return data, nil
+}
+
 // flateDecode decompresses flate-encoded data
 func flateDecode(data []byte) ([]byte, error) {
 	r := flate.NewReader(bytes.NewReader(data))
 	defer r.Close()
 
-	result, err := io.ReadAll(r)
+	result, err := readAllLimited(r)
 	if err != nil {
 		return nil, err
 	}
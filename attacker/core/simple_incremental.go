@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"compress/flate"
 	"fmt"
-	"io"
 	"os"
 	"regexp"
 	"strings"
@@ -40,7 +39,7 @@ func SimpleIncrementalClean(filePath string) (string, error) {
 	reader := flate.NewReader(strings.NewReader(streamContent))
 	defer reader.Close()
 
-	decompressed, err := io.ReadAll(reader)
+	decompressed, err := readAllLimited(reader)
 	if err == nil {
 		fmt.Printf("[!] Original content: %q\n", string(decompressed))
 	}
@@ -5,7 +5,6 @@ import (
 	"compress/flate"
 	"compress/zlib"
 	"fmt"
-	"io"
 	"os"
 	"regexp"
 	"strconv"
@@ -42,7 +41,7 @@ func CleanObjectStreamInContent(content []byte, objID int) ([]byte, error) {
 		reader := flate.NewReader(bytes.NewReader(streamContent))
 		defer reader.Close()
 
-		decompressed, err := io.ReadAll(reader)
+		decompressed, err := readAllLimited(reader)
 		if err == nil {
 			// Limit output for log readability
 			preview := string(decompressed)
@@ -172,14 +171,14 @@ func SanitizeImageStreamInContent(content []byte, objID int) ([]byte, error) {
 	var decompressed []byte
 	rc, err := zlib.NewReader(bytes.NewReader(streamContent))
 	if err == nil {
-		decompressed, err = io.ReadAll(rc)
+		decompressed, err = readAllLimited(rc)
 		rc.Close()
 	}
 
 	// If zlib fails, try flate (raw)
 	if err != nil || len(decompressed) == 0 {
 		fr := flate.NewReader(bytes.NewReader(streamContent))
-		decompressed, err = io.ReadAll(fr)
+		decompressed, err = readAllLimited(fr)
 		fr.Close()
 	}
 
@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"compress/zlib"
 	"fmt"
-	"io"
 	"os"
 	"regexp"
 )
@@ -68,7 +67,7 @@ func RemoveSpecificWatermark(filePath string) (string, int, error) {
 			r, err := zlib.NewReader(bytes.NewReader(streamRaw))
 			if err == nil {
 
-				decompressed, _ := io.ReadAll(r)
+				decompressed, _ := readAllLimited(r)
 				r.Close()
 				contentToCheck = decompressed
 			} else {
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"defender/injector"
+	"defender/ledger"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	recipientsPath string
+	outDir         string
+	manifestPath   string
+	signBatchJobs  int
+	signBatchForce bool
+)
+
+// batchRecipient is one row of the recipients file
+type batchRecipient struct {
+	Recipient string `json:"recipient"` // Label recorded in the manifest (defaults to Message)
+	Message   string `json:"message"`   // Tracking message to embed (required)
+	Output    string `json:"output"`    // Output file name inside the output directory (optional)
+	Profile   string `json:"profile"`   // Anchor profile or anchor list (optional)
+}
+
+// batchManifest records every copy produced by a sign-batch run
+type batchManifest struct {
+	Version      string          `json:"version"`
+	CreatedAt    time.Time       `json:"created_at"`
+	Source       string          `json:"source"`
+	SourceSHA256 string          `json:"source_sha256"`
+	Entries      []manifestEntry `json:"entries"`
+}
+
+// manifestEntry describes one signed copy
+type manifestEntry struct {
+	Recipient string   `json:"recipient"`
+	Message   string   `json:"message"`
+	File      string   `json:"file"`
+	SHA256    string   `json:"sha256,omitempty"`
+	Anchors   []string `json:"anchors,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+var signBatchCmd = &cobra.Command{
+	Use:   "sign-batch",
+	Short: "Sign one PDF for many recipients and write a manifest",
+	Long: `The sign-batch command produces one uniquely signed copy of a source PDF
+per recipient listed in a CSV or JSON file, plus a JSON manifest recording
+file, SHA-256, recipient and anchors used for every copy.
+
+CSV files need a header row. Recognised columns (case-insensitive):
+  recipient  Label recorded in the manifest (defaults to message)
+  message    Tracking message to embed (required)
+  output     Output file name (defaults to <source>_<recipient>.pdf)
+  profile    Anchor profile (all|invisible|visual) or anchor list
+             such as "Attachment+Visual" (defaults to the sign defaults)
+
+JSON files contain an array of objects with the same keys.
+
+Existing output files are refused before anything is signed unless --force
+is set.
+
+Example:
+  defender sign-batch -f deck.pdf -r recipients.csv -d out/ -k "MySecretKey32BytesLongString!!"`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if filePath == "" {
+			return fmt.Errorf("required flag --file is missing")
+		}
+		if recipientsPath == "" {
+			return fmt.Errorf("required flag --recipients is missing")
+		}
+
+		resolvedKey, err := resolveKey(key)
+		if err != nil {
+			return err
+		}
+
+		recipients, err := loadRecipients(recipientsPath)
+		if err != nil {
+			return fmt.Errorf("failed to load recipients: %w", err)
+		}
+
+		dir := outDir
+		if dir == "" {
+			dir = filepath.Dir(filePath)
+		}
+		manifest := manifestPath
+		if manifest == "" {
+			manifest = filepath.Join(dir, "manifest.json")
+		}
+
+		fmt.Printf("🛡️  Defender Batch Sign Operation\n")
+		fmt.Printf("   File: %s\n", filePath)
+		fmt.Printf("   Recipients: %d\n", len(recipients))
+		fmt.Printf("   Output Dir: %s\n", dir)
+		fmt.Printf("   Workers: %d\n", workerCount(signBatchJobs, len(recipients)))
+		fmt.Println()
+
+		failed, err := runSignBatch(filePath, recipients, dir, manifest, resolvedKey, signBatchJobs, signBatchForce)
+		if err != nil {
+			return fmt.Errorf("batch sign failed: %w", err)
+		}
+
+		fmt.Printf("\n📋 Manifest written: %s\n", manifest)
+		if failed > 0 {
+			return fmt.Errorf("batch sign finished with %d of %d copies failed", failed, len(recipients))
+		}
+		fmt.Printf("✅ Batch sign completed: %d copies\n", len(recipients))
+		return nil
+	},
+}
+
+// runSignBatch signs source once per recipient into dir and writes the manifest.
+// Up to jobs copies are signed concurrently. Individual failures are recorded
+// in the manifest and counted, not fatal. Existing outputs are replaced only
+// with overwrite.
+func runSignBatch(source string, recipients []batchRecipient, dir, manifest, key string, jobs int, overwrite bool) (failed int, err error) {
+	plans, err := planBatchOutputs(source, recipients, dir, overwrite)
+	if err != nil {
+		return 0, err
+	}
+
+	sourceHash, err := ledger.FileSHA256(source)
+	if err != nil {
+		return 0, fmt.Errorf("failed to hash source: %w", err)
+	}
+
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return 0, fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	issuance, err := openLedger()
+	if err != nil {
+		return 0, fmt.Errorf("failed to open ledger: %w", err)
+	}
+
+	m := batchManifest{
+		Version:      version,
+		CreatedAt:    time.Now().UTC(),
+		Source:       source,
+		SourceSHA256: sourceHash,
+		Entries:      make([]manifestEntry, len(recipients)),
+	}
+
+	// Each worker only touches its own entry, so manifest order matches the input
+	runPool(jobs, len(recipients), func(i int) {
+		r := recipients[i]
+		entry := &m.Entries[i]
+		*entry = manifestEntry{Recipient: r.Recipient, Message: r.Message, File: plans[i]}
+		fmt.Printf("[*] (%d/%d) Signing for %s -> %s\n", i+1, len(recipients), r.Recipient, plans[i])
+
+		if err := signBatchEntry(source, key, r, entry, issuance, overwrite); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠ Warning: %s failed: %v\n", r.Recipient, err)
+			entry.Error = err.Error()
+		}
+	})
+
+	for _, entry := range m.Entries {
+		if entry.Error != "" {
+			failed++
+		}
+	}
+
+	if err := writeManifest(manifest, &m); err != nil {
+		return failed, fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return failed, nil
+}
+
+// signBatchEntry signs one copy, fills in the entry's anchors and hash and
+// records the copy in the issuance ledger
+func signBatchEntry(source, key string, r batchRecipient, entry *manifestEntry, issuance *ledger.Ledger, overwrite bool) error {
+	anchors, err := injector.ParseAnchorProfile(r.Profile)
+	if err != nil {
+		return err
+	}
+
+	opts := injector.SignOptions{
+		Anchors:   anchors,
+		Overwrite: overwrite,
+		Ledger:    issuance,
+		Issuance:  ledger.Record{Operator: currentOperator(), Recipient: r.Recipient},
+	}
+	result, err := injector.SignWithOptions(source, entry.File, r.Message, key, opts)
+	if err != nil {
+		return err
+	}
+	entry.Anchors = result.Anchors
+
+	entry.SHA256, err = ledger.FileSHA256(result.OutputPath)
+	if err != nil {
+		return fmt.Errorf("failed to hash output: %w", err)
+	}
+	return nil
+}
+
+// planBatchOutputs computes each recipient's output path and rejects
+// duplicates, path traversal, overwriting the source and, unless overwrite is
+// set, existing outputs before anything is signed.
+func planBatchOutputs(source string, recipients []batchRecipient, dir string, overwrite bool) ([]string, error) {
+	base := strings.TrimSuffix(filepath.Base(source), filepath.Ext(source))
+	sourceAbs, _ := filepath.Abs(source)
+
+	plans := make([]string, len(recipients))
+	seen := make(map[string]int, len(recipients))
+	for i, r := range recipients {
+		name := r.Output
+		if name == "" {
+			name = base + "_" + safeFileComponent(r.Recipient)
+		}
+		if name != filepath.Base(name) || name == "." || name == ".." {
+			return nil, fmt.Errorf("recipient %d (%s): output %q must be a plain file name", i+1, r.Recipient, r.Output)
+		}
+		if !strings.EqualFold(filepath.Ext(name), ".pdf") {
+			name += ".pdf"
+		}
+
+		out := filepath.Join(dir, name)
+		if outAbs, _ := filepath.Abs(out); outAbs == sourceAbs {
+			return nil, fmt.Errorf("recipient %d (%s): output would overwrite the source file", i+1, r.Recipient)
+		}
+		if _, err := os.Lstat(out); err == nil && !overwrite {
+			return nil, fmt.Errorf("recipient %d (%s): output %s already exists; use --force to replace it", i+1, r.Recipient, out)
+		}
+		if prev, dup := seen[strings.ToLower(out)]; dup {
+			return nil, fmt.Errorf("recipients %d and %d resolve to the same output %s", prev+1, i+1, out)
+		}
+		seen[strings.ToLower(out)] = i
+		plans[i] = out
+	}
+	return plans, nil
+}
+
+// loadRecipients reads recipients from a .json file or, otherwise, a CSV file
+func loadRecipients(path string) ([]batchRecipient, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var recipients []batchRecipient
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		if err := json.NewDecoder(f).Decode(&recipients); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+	} else {
+		recipients, err = parseRecipientsCSV(f)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(recipients) == 0 {
+		return nil, errors.New("no recipients found")
+	}
+	for i := range recipients {
+		r := &recipients[i]
+		r.Recipient = strings.TrimSpace(r.Recipient)
+		r.Message = strings.TrimSpace(r.Message)
+		r.Output = strings.TrimSpace(r.Output)
+		if r.Message == "" {
+			return nil, fmt.Errorf("recipient %d: message is empty", i+1)
+		}
+		if r.Recipient == "" {
+			r.Recipient = r.Message
+		}
+	}
+	return recipients, nil
+}
+
+// parseRecipientsCSV reads a CSV file with a header row naming the columns
+func parseRecipientsCSV(r io.Reader) ([]batchRecipient, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, h := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))] = i
+	}
+	if _, ok := columns["message"]; !ok {
+		return nil, errors.New("CSV header must contain a 'message' column")
+	}
+
+	field := func(row []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+
+	var recipients []batchRecipient
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		if len(row) == 1 && strings.TrimSpace(row[0]) == "" {
+			continue // Blank line
+		}
+		recipients = append(recipients, batchRecipient{
+			Recipient: field(row, "recipient"),
+			Message:   field(row, "message"),
+			Output:    field(row, "output"),
+			Profile:   field(row, "profile"),
+		})
+	}
+	return recipients, nil
+}
+
+// writeManifest writes the manifest as indented JSON
+func writeManifest(path string, m *batchManifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// safeFileComponent turns a recipient label into a file-name-safe string
+func safeFileComponent(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r), r == '-', r == '.':
+			sb.WriteRune(r)
+		default:
+			sb.WriteRune('_')
+		}
+	}
+	out := strings.Trim(sb.String(), "._")
+	if out == "" {
+		out = "recipient"
+	}
+	return out
+}
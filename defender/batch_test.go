@@ -0,0 +1,269 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestParseRecipientsCSV tests header handling and row parsing of CSV recipients
+func TestParseRecipientsCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		csv     string
+		want    []batchRecipient
+		wantErr string
+	}{
+		{
+			name: "all columns",
+			csv:  "recipient,message,output,profile\nAlice,UserID:1,alice.pdf,stealth\n",
+			want: []batchRecipient{{Recipient: "Alice", Message: "UserID:1", Output: "alice.pdf", Profile: "stealth"}},
+		},
+		{
+			name: "columns in any order and case",
+			csv:  "Message, Recipient\nUserID:1,Alice\nUserID:2,Bob\n",
+			want: []batchRecipient{{Recipient: "Alice", Message: "UserID:1"}, {Recipient: "Bob", Message: "UserID:2"}},
+		},
+		{
+			name: "byte order mark",
+			csv:  "\ufeffmessage\nUserID:1\n",
+			want: []batchRecipient{{Message: "UserID:1"}},
+		},
+		{
+			name: "short rows and blank lines",
+			csv:  "recipient,message,output\nAlice,UserID:1\n\nBob,UserID:2,bob.pdf\n",
+			want: []batchRecipient{{Recipient: "Alice", Message: "UserID:1"}, {Recipient: "Bob", Message: "UserID:2", Output: "bob.pdf"}},
+		},
+		{
+			name: "quoted comma",
+			csv:  "recipient,message\n\"Doe, Jane\",\"Dept:A,B\"\n",
+			want: []batchRecipient{{Recipient: "Doe, Jane", Message: "Dept:A,B"}},
+		},
+		{
+			name:    "no message column",
+			csv:     "recipient,output\nAlice,alice.pdf\n",
+			wantErr: "'message' column",
+		},
+		{
+			name:    "empty file",
+			csv:     "",
+			wantErr: "CSV header",
+		},
+		{
+			name:    "unterminated quote",
+			csv:     "message\n\"UserID:1\n",
+			wantErr: "invalid CSV",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRecipientsCSV(strings.NewReader(tt.csv))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestLoadRecipients tests reading CSV and JSON files and normalizing rows
+func TestLoadRecipients(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    []batchRecipient
+		wantErr string
+	}{
+		{
+			name:    "csv",
+			file:    "recipients.csv",
+			content: "recipient,message\n Alice , UserID:1 \n",
+			want:    []batchRecipient{{Recipient: "Alice", Message: "UserID:1"}},
+		},
+		{
+			name:    "json",
+			file:    "recipients.json",
+			content: `[{"recipient":"Alice","message":"UserID:1","output":" alice.pdf ","profile":"stealth"}]`,
+			want:    []batchRecipient{{Recipient: "Alice", Message: "UserID:1", Output: "alice.pdf", Profile: "stealth"}},
+		},
+		{
+			name:    "json extension in upper case",
+			file:    "RECIPIENTS.JSON",
+			content: `[{"message":"UserID:1"}]`,
+			want:    []batchRecipient{{Recipient: "UserID:1", Message: "UserID:1"}},
+		},
+		{
+			name:    "recipient defaults to the message",
+			file:    "recipients.txt",
+			content: "message\nUserID:1\n",
+			want:    []batchRecipient{{Recipient: "UserID:1", Message: "UserID:1"}},
+		},
+		{
+			name:    "invalid json",
+			file:    "recipients.json",
+			content: `{"message":"UserID:1"}`,
+			wantErr: "invalid JSON",
+		},
+		{
+			name:    "empty message",
+			file:    "recipients.csv",
+			content: "recipient,message\nAlice,UserID:1\nBob, \n",
+			wantErr: "recipient 2: message is empty",
+		},
+		{
+			name:    "no rows",
+			file:    "recipients.csv",
+			content: "recipient,message\n",
+			wantErr: "no recipients found",
+		},
+		{
+			name:    "empty json array",
+			file:    "recipients.json",
+			content: `[]`,
+			wantErr: "no recipients found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := loadRecipients(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := loadRecipients(filepath.Join(t.TempDir(), "missing.csv")); !os.IsNotExist(err) {
+		t.Errorf("missing file: error = %v", err)
+	}
+}
+
+// TestPlanBatchOutputs tests output naming and the checks made before signing
+func TestPlanBatchOutputs(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "report.pdf")
+	out := filepath.Join(dir, "out")
+	if err := os.WriteFile(filepath.Join(dir, "report_Dave.pdf"), []byte("%PDF"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		dir        string
+		recipients []batchRecipient
+		overwrite  bool
+		want       []string
+		wantErr    string
+	}{
+		{
+			name:       "named after the recipient",
+			dir:        out,
+			recipients: []batchRecipient{{Recipient: "Alice Smith"}, {Recipient: "../bob"}},
+			want:       []string{filepath.Join(out, "report_Alice_Smith.pdf"), filepath.Join(out, "report_bob.pdf")},
+		},
+		{
+			name:       "explicit output gets a .pdf extension",
+			dir:        out,
+			recipients: []batchRecipient{{Recipient: "Alice", Output: "alice"}, {Recipient: "Bob", Output: "bob.PDF"}},
+			want:       []string{filepath.Join(out, "alice.pdf"), filepath.Join(out, "bob.PDF")},
+		},
+		{
+			name:       "path traversal",
+			dir:        out,
+			recipients: []batchRecipient{{Recipient: "Alice", Output: "../alice.pdf"}},
+			wantErr:    "must be a plain file name",
+		},
+		{
+			name:       "subdirectory",
+			dir:        out,
+			recipients: []batchRecipient{{Recipient: "Alice", Output: "sub/alice.pdf"}},
+			wantErr:    "must be a plain file name",
+		},
+		{
+			name:       "dot dot",
+			dir:        out,
+			recipients: []batchRecipient{{Recipient: "Alice", Output: ".."}},
+			wantErr:    "must be a plain file name",
+		},
+		{
+			name:       "duplicate output",
+			dir:        out,
+			recipients: []batchRecipient{{Recipient: "Alice", Output: "copy.pdf"}, {Recipient: "Bob"}, {Recipient: "Carol", Output: "copy"}},
+			wantErr:    "recipients 1 and 3 resolve to the same output",
+		},
+		{
+			name:       "duplicate differing in case",
+			dir:        out,
+			recipients: []batchRecipient{{Recipient: "alice"}, {Recipient: "ALICE"}},
+			wantErr:    "recipients 1 and 2",
+		},
+		{
+			name:       "overwrites the source",
+			dir:        dir,
+			recipients: []batchRecipient{{Recipient: "Alice", Output: "report.pdf"}},
+			wantErr:    "would overwrite the source file",
+		},
+		{
+			name:       "source directory with other names",
+			dir:        dir,
+			recipients: []batchRecipient{{Recipient: "Alice"}},
+			want:       []string{filepath.Join(dir, "report_Alice.pdf")},
+		},
+		{
+			name:       "existing output",
+			dir:        dir,
+			recipients: []batchRecipient{{Recipient: "Alice"}, {Recipient: "Dave"}},
+			wantErr:    "recipient 2 (Dave): output " + filepath.Join(dir, "report_Dave.pdf") + " already exists",
+		},
+		{
+			name:       "existing output with --force",
+			dir:        dir,
+			recipients: []batchRecipient{{Recipient: "Dave"}},
+			overwrite:  true,
+			want:       []string{filepath.Join(dir, "report_Dave.pdf")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := planBatchOutputs(source, tt.recipients, tt.dir, tt.overwrite)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
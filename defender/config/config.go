@@ -0,0 +1,428 @@
+// Package config loads the declarative configuration file: named signing
+// profiles that bundle anchors, Visual watermark style, a key reference and
+// output naming.
+//
+//	default_profile: deterrent
+//	keys:
+//	  main:  {env: DEFAULT_KEY}
+//	  legal: {file: ~/.defender/legal.key}
+//	profiles:
+//	  contract:
+//	    description: Signed contracts sent to counterparties
+//	    anchors: all
+//	    visual: {opacity: 0.15, color: "#1F3A93"}
+//	    key: legal
+//	    output: "{name}_{date}_signed.pdf"
+//
+// The built-in profiles stealth, deterrent and contract are always available
+// and may be overridden by profiles of the same name.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"defender/injector"
+
+	"gopkg.in/yaml.v2"
+)
+
+// FileName is the name of the configuration file in the user config directory
+const FileName = "config.yaml"
+
+// DefaultProfile is used when neither --profile nor default_profile is set
+const DefaultProfile = "deterrent"
+
+// DefaultOutput is the output naming template of profiles that set none
+const DefaultOutput = "{name}_signed.pdf"
+
+// Config is the parsed configuration file
+type Config struct {
+	DefaultProfile string             `yaml:"default_profile"`
+	Keys           map[string]KeyRef  `yaml:"keys"`
+	Profiles       map[string]Profile `yaml:"profiles"`
+
+	// Path is the file the configuration was loaded from ("" for built-ins only)
+	Path string `yaml:"-"`
+}
+
+// KeyRef points at a key without storing it in the configuration file
+type KeyRef struct {
+	// Env names an environment variable holding the key
+	Env string `yaml:"env"`
+	// File is a file whose first non-comment line is the key
+	File string `yaml:"file"`
+}
+
+// Profile is a named set of signing choices
+type Profile struct {
+	Description string `yaml:"description"`
+	// Anchors is an anchor profile (all|invisible|visual) or an anchor list
+	Anchors string `yaml:"anchors"`
+	// Visual overrides the Visual watermark style
+	Visual *Visual `yaml:"visual"`
+	// Key names an entry of keys
+	Key string `yaml:"key"`
+	// Output is the output naming template, relative to the source directory
+	Output string `yaml:"output"`
+	// TamperEvidence seals page digests into the payload so verify reports altered pages
+	TamperEvidence bool `yaml:"tamper_evidence"`
+	// Incremental appends the anchors as an incremental update, keeping digital signatures valid
+	Incremental bool `yaml:"incremental"`
+}
+
+// Visual is the Visual watermark style of a profile
+type Visual struct {
+	// Opacity from 0 to 1
+	Opacity *float64 `yaml:"opacity"`
+	// Color as "#RRGGBB" or three 0..1 components ("0.5 0.5 0.5")
+	Color string `yaml:"color"`
+}
+
+// BuiltinProfiles are available without a configuration file. They match the
+// interactive protection levels.
+var BuiltinProfiles = map[string]Profile{
+	"deterrent": {
+		Description: "Invisible anchors plus a visible watermark",
+		Anchors:     "all",
+	},
+	"stealth": {
+		Description: "Invisible anchors only, no visible change",
+		Anchors:     "invisible",
+	},
+	"contract": {
+		Description:    "All anchors with a faint watermark that keeps the text legible, tamper-evident",
+		Anchors:        "all",
+		Visual:         &Visual{Opacity: floatPtr(0.15)},
+		Output:         "{name}_{date}_signed.pdf",
+		TamperEvidence: true,
+	},
+}
+
+// builtinOrder is the listing order of the built-in profiles
+var builtinOrder = []string{"deterrent", "stealth", "contract"}
+
+// Resolved is a validated profile ready for signing
+type Resolved struct {
+	Name        string
+	Description string
+	// Anchors is nil for DefaultAnchors
+	Anchors []string
+	// Visual is nil for DefaultVisualStyle
+	Visual *injector.VisualStyle
+	// KeyName is the name of the profile's key reference ("" if none)
+	KeyName string
+	Output  string
+	// TamperEvidence seals page digests into the payload
+	TamperEvidence bool
+	// Incremental appends the anchors as an incremental update
+	Incremental bool
+
+	key *KeyRef
+}
+
+// DefaultPath returns $DEFENDER_CONFIG if set, otherwise
+// <user config dir>/defender/config.yaml.
+func DefaultPath() (string, error) {
+	if p := os.Getenv("DEFENDER_CONFIG"); p != "" {
+		return p, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate user config dir: %w", err)
+	}
+	return filepath.Join(dir, "defender", FileName), nil
+}
+
+// Load reads and validates the configuration at path. With an empty path the
+// default location is used, and a missing default file yields the built-in
+// profiles only; an explicitly given file must exist.
+func Load(path string) (*Config, error) {
+	explicit := path != ""
+	if !explicit {
+		var err error
+		if path, err = DefaultPath(); err != nil {
+			return nil, err
+		}
+		explicit = os.Getenv("DEFENDER_CONFIG") != ""
+	}
+
+	cfg := &Config{}
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+			return nil, fmt.Errorf("invalid config %s: %w", path, err)
+		}
+		cfg.Path = path
+	case errors.Is(err, os.ErrNotExist) && !explicit:
+	default:
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	if err := cfg.validate(); err != nil {
+		if cfg.Path != "" {
+			return nil, fmt.Errorf("invalid config %s: %w", cfg.Path, err)
+		}
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// validate resolves every profile once so mistakes surface at load time
+func (c *Config) validate() error {
+	for name, ref := range c.Keys {
+		if (ref.Env == "") == (ref.File == "") {
+			return fmt.Errorf("key %q: exactly one of env or file is required", name)
+		}
+	}
+	for _, name := range c.ProfileNames() {
+		if _, err := c.Profile(name); err != nil {
+			return err
+		}
+	}
+	if c.DefaultProfile != "" {
+		if _, ok := c.lookup(c.DefaultProfile); !ok {
+			return fmt.Errorf("default_profile %q is not defined", c.DefaultProfile)
+		}
+	}
+	return nil
+}
+
+// ProfileNames lists the built-in profiles followed by the configured ones
+func (c *Config) ProfileNames() []string {
+	names := append([]string(nil), builtinOrder...)
+	var custom []string
+	for name := range c.Profiles {
+		if _, ok := BuiltinProfiles[name]; !ok {
+			custom = append(custom, name)
+		}
+	}
+	sort.Strings(custom)
+	return append(names, custom...)
+}
+
+// DefaultProfileName returns default_profile, or DefaultProfile when unset
+func (c *Config) DefaultProfileName() string {
+	if c.DefaultProfile != "" {
+		return c.DefaultProfile
+	}
+	return DefaultProfile
+}
+
+func (c *Config) lookup(name string) (Profile, bool) {
+	if p, ok := c.Profiles[name]; ok {
+		return p, true
+	}
+	p, ok := BuiltinProfiles[name]
+	return p, ok
+}
+
+// Profile resolves a profile by name; an empty name selects the default profile
+func (c *Config) Profile(name string) (*Resolved, error) {
+	if name == "" {
+		name = c.DefaultProfileName()
+	}
+	p, ok := c.lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %q (available: %s)", name, strings.Join(c.ProfileNames(), ", "))
+	}
+
+	r := &Resolved{Name: name, Description: p.Description, KeyName: p.Key, Output: p.Output, TamperEvidence: p.TamperEvidence, Incremental: p.Incremental}
+	if r.Output == "" {
+		r.Output = DefaultOutput
+	}
+
+	var err error
+	if r.Anchors, err = injector.ParseAnchorProfile(p.Anchors); err != nil {
+		return nil, fmt.Errorf("profile %q: %w", name, err)
+	}
+	if p.Visual != nil {
+		if r.Visual, err = p.Visual.style(); err != nil {
+			return nil, fmt.Errorf("profile %q: %w", name, err)
+		}
+	}
+	if p.Key != "" {
+		ref, ok := c.Keys[p.Key]
+		if !ok {
+			return nil, fmt.Errorf("profile %q: key %q is not defined under keys", name, p.Key)
+		}
+		r.key = &ref
+	}
+	return r, nil
+}
+
+// style converts a Visual to an injector style, keeping defaults for unset fields
+func (v *Visual) style() (*injector.VisualStyle, error) {
+	s := injector.DefaultVisualStyle
+	if v.Opacity != nil {
+		s.Opacity = *v.Opacity
+	}
+	if v.Color != "" {
+		rgb, err := ParseColor(v.Color)
+		if err != nil {
+			return nil, err
+		}
+		s.Color = rgb
+	}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// ParseColor parses "#RRGGBB" or three 0..1 components separated by spaces or commas
+func ParseColor(s string) ([3]float64, error) {
+	var rgb [3]float64
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "#") {
+		if len(s) != 7 {
+			return rgb, fmt.Errorf("invalid color %q: expected #RRGGBB", s)
+		}
+		for i := range rgb {
+			b, err := strconv.ParseUint(s[1+2*i:3+2*i], 16, 8)
+			if err != nil {
+				return rgb, fmt.Errorf("invalid color %q: expected #RRGGBB", s)
+			}
+			rgb[i] = float64(b) / 255
+		}
+		return rgb, nil
+	}
+
+	parts := strings.FieldsFunc(s, func(r rune) bool { return r == ',' || unicode.IsSpace(r) })
+	if len(parts) != 3 {
+		return rgb, fmt.Errorf("invalid color %q: expected #RRGGBB or \"r g b\"", s)
+	}
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(p, 64)
+		if err != nil || f < 0 || f > 1 {
+			return rgb, fmt.Errorf("invalid color %q: components must be numbers in [0, 1]", s)
+		}
+		rgb[i] = f
+	}
+	return rgb, nil
+}
+
+// HasKey reports whether the profile references a key
+func (r *Resolved) HasKey() bool {
+	return r.key != nil
+}
+
+// Key reads the profile's key. It returns "" without error when the profile references none.
+func (r *Resolved) Key() (string, error) {
+	if r.key == nil {
+		return "", nil
+	}
+
+	var k, origin string
+	if r.key.Env != "" {
+		origin = "$" + r.key.Env
+		k = os.Getenv(r.key.Env)
+	} else {
+		origin = expandHome(r.key.File)
+		data, err := os.ReadFile(origin)
+		if err != nil {
+			return "", fmt.Errorf("profile %q: failed to read key %q: %w", r.Name, r.KeyName, err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "#") {
+				k = line
+				break
+			}
+		}
+	}
+
+	if k == "" {
+		return "", fmt.Errorf("profile %q: key %q (%s) is empty", r.Name, r.KeyName, origin)
+	}
+	if len(k) != 32 {
+		return "", fmt.Errorf("profile %q: key %q (%s) is %d bytes, must be 32", r.Name, r.KeyName, origin, len(k))
+	}
+	return k, nil
+}
+
+// SignOptions returns the injector options of the profile
+func (r *Resolved) SignOptions() injector.SignOptions {
+	return injector.SignOptions{Anchors: r.Anchors, Visual: r.Visual, TamperEvidence: r.TamperEvidence, Incremental: r.Incremental}
+}
+
+// OutputPath expands the output template for source. Placeholders: {name} (source
+// base name without extension), {profile}, {date} (YYYY-MM-DD), and any extra
+// vars such as {msg} or {recipient}. Values are made safe for file names; a
+// relative result is placed next to source.
+func (r *Resolved) OutputPath(source string, vars map[string]string) (string, error) {
+	base := filepath.Base(source)
+	values := map[string]string{
+		"name":    strings.TrimSuffix(base, filepath.Ext(base)),
+		"profile": r.Name,
+		"date":    time.Now().Format("2006-01-02"),
+	}
+	for k, v := range vars {
+		values[k] = v
+	}
+
+	var out strings.Builder
+	tmpl := r.Output
+	for {
+		open := strings.IndexByte(tmpl, '{')
+		if open < 0 {
+			out.WriteString(tmpl)
+			break
+		}
+		end := strings.IndexByte(tmpl[open:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("profile %q: unterminated placeholder in output %q", r.Name, r.Output)
+		}
+		name := tmpl[open+1 : open+end]
+		v, ok := values[name]
+		if !ok {
+			return "", fmt.Errorf("profile %q: unknown placeholder {%s} in output %q", r.Name, name, r.Output)
+		}
+		out.WriteString(tmpl[:open])
+		out.WriteString(fileSafe(v))
+		tmpl = tmpl[open+end+1:]
+	}
+
+	path := expandHome(out.String())
+	if !strings.EqualFold(filepath.Ext(path), ".pdf") {
+		path += ".pdf"
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(source), path)
+	}
+	if filepath.Clean(path) == filepath.Clean(source) {
+		return "", fmt.Errorf("profile %q: output %q would overwrite the source", r.Name, r.Output)
+	}
+	return path, nil
+}
+
+// fileSafe replaces characters that are not portable in file names
+func fileSafe(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '.' || r == '_' {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+func expandHome(p string) string {
+	if p == "~" || strings.HasPrefix(p, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, p[1:])
+		}
+	}
+	return p
+}
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
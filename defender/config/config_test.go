@@ -0,0 +1,197 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testKey32 = "12345678901234567890123456789012"
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), FileName)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestLoadBuiltins tests the profiles available without a configuration file
+func TestLoadBuiltins(t *testing.T) {
+	t.Setenv("DEFENDER_CONFIG", "")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Path != "" {
+		t.Errorf("Expected no config file, got %s", cfg.Path)
+	}
+
+	p, err := cfg.Profile("")
+	if err != nil || p.Name != DefaultProfile {
+		t.Fatalf("Default profile mismatch: %+v, %v", p, err)
+	}
+	if p.Visual != nil || p.HasKey() || p.Output != DefaultOutput {
+		t.Errorf("Default profile should keep defaults: %+v", p)
+	}
+
+	stealth, _ := cfg.Profile("stealth")
+	if !reflect.DeepEqual(stealth.Anchors, []string{"Attachment", "SMask", "Content"}) {
+		t.Errorf("stealth anchors mismatch: %v", stealth.Anchors)
+	}
+	contract, _ := cfg.Profile("contract")
+	if contract.Visual == nil || contract.Visual.Opacity != 0.15 {
+		t.Errorf("contract visual mismatch: %+v", contract.Visual)
+	}
+	if !contract.SignOptions().TamperEvidence || p.TamperEvidence {
+		t.Errorf("Only contract should be tamper-evident: %+v", contract)
+	}
+
+	if _, err := cfg.Profile("nope"); err == nil || !strings.Contains(err.Error(), "stealth") {
+		t.Errorf("Expected unknown profile error listing profiles, got %v", err)
+	}
+}
+
+// TestLoadFile tests custom profiles, overrides and key references
+func TestLoadFile(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "legal.key")
+	os.WriteFile(keyFile, []byte("# legal team key\n"+testKey32+"\n"), 0600)
+	t.Setenv("TEST_DEFENDER_KEY", testKey32)
+
+	path := writeConfig(t, `
+default_profile: board
+keys:
+  main: {env: TEST_DEFENDER_KEY}
+  legal: {file: `+keyFile+`}
+profiles:
+  board:
+    description: Board packs
+    anchors: Attachment+Visual
+    visual: {opacity: 0.5, color: "#FF0000"}
+    key: main
+    output: "{name}-{profile}-{msg}"
+    tamper_evidence: true
+    incremental: true
+  stealth:
+    anchors: Attachment
+    key: legal
+`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if got := cfg.ProfileNames(); !reflect.DeepEqual(got, []string{"deterrent", "stealth", "contract", "board"}) {
+		t.Errorf("ProfileNames mismatch: %v", got)
+	}
+
+	board, err := cfg.Profile("")
+	if err != nil || board.Name != "board" {
+		t.Fatalf("default_profile not applied: %+v, %v", board, err)
+	}
+	if board.Visual.Opacity != 0.5 || board.Visual.Color != [3]float64{1, 0, 0} {
+		t.Errorf("Visual style mismatch: %+v", board.Visual)
+	}
+	if !board.TamperEvidence {
+		t.Error("tamper_evidence not applied")
+	}
+	if !board.SignOptions().Incremental {
+		t.Error("incremental not applied")
+	}
+	if k, err := board.Key(); err != nil || k != testKey32 {
+		t.Errorf("Env key mismatch: %q, %v", k, err)
+	}
+	out, err := board.OutputPath("/docs/q3 report.pdf", map[string]string{"msg": "UserID:7"})
+	if err != nil || out != filepath.Join("/docs", "q3_report-board-UserID_7.pdf") {
+		t.Errorf("OutputPath mismatch: %q, %v", out, err)
+	}
+
+	stealth, _ := cfg.Profile("stealth")
+	if !reflect.DeepEqual(stealth.Anchors, []string{"Attachment"}) {
+		t.Errorf("Override not applied: %v", stealth.Anchors)
+	}
+	if k, err := stealth.Key(); err != nil || k != testKey32 {
+		t.Errorf("File key mismatch: %q, %v", k, err)
+	}
+}
+
+// TestLoadErrors tests that configuration mistakes are reported at load time
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"Unknown field", "profiles:\n  a: {anchor: all}\n", "anchor"},
+		{"Unknown anchor", "profiles:\n  a: {anchors: Bogus}\n", "Bogus"},
+		{"Undefined key", "profiles:\n  a: {key: missing}\n", "missing"},
+		{"Key without source", "keys:\n  k: {}\n", "exactly one"},
+		{"Bad opacity", "profiles:\n  a: {visual: {opacity: 2}}\n", "opacity"},
+		{"Bad color", "profiles:\n  a: {visual: {color: red}}\n", "color"},
+		{"Undefined default", "default_profile: nope\n", "nope"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(writeConfig(t, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected error mentioning %q, got %v", tt.want, err)
+			}
+		})
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("Expected error for a missing explicit config file")
+	}
+}
+
+// TestOutputPath tests output template expansion
+func TestOutputPath(t *testing.T) {
+	date := time.Now().Format("2006-01-02")
+	tests := []struct {
+		output string
+		want   string
+		err    bool
+	}{
+		{DefaultOutput, "/in/deck_signed.pdf", false},
+		{"{name}_{date}_signed.pdf", "/in/deck_" + date + "_signed.pdf", false},
+		{"out/{name}_{recipient}", "/in/out/deck_Jane_Doe.pdf", false},
+		{"/abs/{name}.pdf", "/abs/deck.pdf", false},
+		{"{name}.pdf", "", true}, // would overwrite the source
+		{"{nope}.pdf", "", true},
+		{"{name", "", true},
+	}
+	for _, tt := range tests {
+		r := &Resolved{Name: "t", Output: tt.output}
+		got, err := r.OutputPath("/in/deck.pdf", map[string]string{"recipient": "Jane Doe"})
+		if tt.err {
+			if err == nil {
+				t.Errorf("%q: expected error, got %q", tt.output, got)
+			}
+			continue
+		}
+		if err != nil || got != filepath.FromSlash(tt.want) {
+			t.Errorf("%q: got %q, %v; want %q", tt.output, got, err, tt.want)
+		}
+	}
+}
+
+// TestParseColor tests the accepted color notations
+func TestParseColor(t *testing.T) {
+	if rgb, err := ParseColor("#80FF00"); err != nil || rgb != [3]float64{128.0 / 255, 1, 0} {
+		t.Errorf("Hex color mismatch: %v, %v", rgb, err)
+	}
+	if rgb, err := ParseColor("0.2, 0.4 1"); err != nil || rgb != [3]float64{0.2, 0.4, 1} {
+		t.Errorf("Component color mismatch: %v, %v", rgb, err)
+	}
+	for _, bad := range []string{"#FFF", "1 2 3", "0.1 0.2", "#GG0000"} {
+		if _, err := ParseColor(bad); err == nil {
+			t.Errorf("ParseColor(%q): expected error", bad)
+		}
+	}
+}
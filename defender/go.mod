@@ -6,6 +6,7 @@ require (
 	github.com/pdfcpu/pdfcpu v0.11.1
 	github.com/spf13/cobra v1.10.2
 	golang.org/x/image v0.32.0
+	gopkg.in/yaml.v2 v2.4.0
 )
 
 require (
@@ -19,5 +20,4 @@ require (
 	github.com/spf13/pflag v1.0.9 // indirect
 	golang.org/x/crypto v0.43.0 // indirect
 	golang.org/x/text v0.30.0 // indirect
-	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
@@ -1,6 +1,16 @@
 package injector
 
-import "github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
 
 // Anchor defines the interface for signature embedding mechanisms
 // Each anchor type implements a different steganographic technique
@@ -21,6 +31,62 @@ type Anchor interface {
 	IsAvailable(ctx *model.Context) bool
 }
 
+// ReaderAnchor is an Anchor that also works on PDFs held in memory, so a
+// document never has to be written to disk. All built-in anchors implement it.
+type ReaderAnchor interface {
+	Anchor
+
+	// InjectReader reads the PDF from r, embeds the payload and writes the
+	// result to w. Nothing is written to w if injection fails or c is
+	// cancelled.
+	InjectReader(c context.Context, r io.ReadSeeker, w io.Writer, payload []byte) error
+
+	// ExtractReader retrieves the payload from the PDF in r
+	ExtractReader(c context.Context, r io.ReadSeeker) ([]byte, error)
+}
+
+// injectFile implements Anchor.Inject on top of InjectReader. The output file
+// is only created once injection has succeeded.
+func injectFile(a ReaderAnchor, inputPath, outputPath string, payload []byte) error {
+	in, err := os.Open(inputPath)
+	if err != nil {
+		return fmt.Errorf("failed to read context: %w", err)
+	}
+	defer in.Close()
+
+	var out bytes.Buffer
+	if err := a.InjectReader(context.Background(), in, &out, payload); err != nil {
+		return err
+	}
+	if err := os.WriteFile(outputPath, out.Bytes(), 0666); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	return nil
+}
+
+// writeContext writes a modified PDF to w in one piece, so a failed write
+// leaves nothing half written behind
+func writeContext(ctx *model.Context, w io.Writer) error {
+	data, err := writePDF(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+var pdfConfigOnce sync.Once
+
+// ensurePDFConfig loads pdfcpu's default configuration once per process.
+// pdfcpu caches it in an unsynchronised global on first use (creating its config
+// directory and core fonts on disk), so it must be loaded before anchors run
+// concurrently. Every anchor constructor calls it.
+func ensurePDFConfig() {
+	pdfConfigOnce.Do(func() {
+		_ = model.NewDefaultConfiguration()
+	})
+}
+
 // AnchorRegistry manages available anchor implementations
 type AnchorRegistry struct {
 	anchors []Anchor
@@ -57,3 +123,51 @@ func (r *AnchorRegistry) GetAnchorByName(name string) Anchor {
 func (r *AnchorRegistry) AddAnchor(anchor Anchor) {
 	r.anchors = append(r.anchors, anchor)
 }
+
+// AnchorProfiles maps profile names to anchor sets.
+// They mirror the interactive protection levels.
+var AnchorProfiles = map[string][]string{
+	"all":       {"Attachment", "SMask", "Content", "Visual"},
+	"invisible": {"Attachment", "SMask", "Content"},
+	"visual":    {"Visual"},
+}
+
+// ParseAnchorProfile resolves a profile name (e.g. "invisible") or an explicit
+// anchor list separated by ',' or '+' (e.g. "Attachment+Visual") into anchor names.
+// An empty spec returns nil, which selects DefaultAnchors.
+func ParseAnchorProfile(spec string) ([]string, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+	if anchors, ok := AnchorProfiles[strings.ToLower(spec)]; ok {
+		return append([]string(nil), anchors...), nil
+	}
+
+	registry := NewAnchorRegistry()
+	var anchors []string
+	for _, part := range strings.FieldsFunc(spec, func(r rune) bool { return r == ',' || r == '+' }) {
+		name := strings.TrimSpace(part)
+		if name == "" {
+			continue
+		}
+		anchor := registry.GetAnchorByName(name)
+		if anchor == nil {
+			// Accept case-insensitive anchor names
+			for _, a := range registry.GetAvailableAnchors() {
+				if strings.EqualFold(a.Name(), name) {
+					anchor = a
+					break
+				}
+			}
+		}
+		if anchor == nil {
+			return nil, fmt.Errorf("unknown anchor or profile %q", name)
+		}
+		anchors = append(anchors, anchor.Name())
+	}
+	if len(anchors) == 0 {
+		return nil, fmt.Errorf("empty anchor profile %q", spec)
+	}
+	return anchors, nil
+}
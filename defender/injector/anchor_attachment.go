@@ -1,19 +1,28 @@
 package injector
 
 import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
+	"io"
+	"time"
 
 	"github.com/pdfcpu/pdfcpu/pkg/api"
 	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
 )
 
 // AttachmentAnchor implements signature embedding via PDF attachments
-type AttachmentAnchor struct{}
+type AttachmentAnchor struct {
+	// modTime is the attachment's modification date, the current time if zero
+	modTime time.Time
+}
 
 // NewAttachmentAnchor creates a new attachment anchor
 func NewAttachmentAnchor() *AttachmentAnchor {
+	ensurePDFConfig()
 	return &AttachmentAnchor{}
 }
 
@@ -24,57 +33,207 @@ func (a *AttachmentAnchor) Name() string {
 
 // Inject embeds the payload as a PDF attachment
 func (a *AttachmentAnchor) Inject(inputPath, outputPath string, payload []byte) error {
-	// Create temporary directory for attachment
-	tmpDir, err := os.MkdirTemp("", "defender_attach_*")
+	return injectFile(a, inputPath, outputPath, payload)
+}
+
+// InjectReader embeds the payload as an attachment of the PDF in r
+func (a *AttachmentAnchor) InjectReader(c context.Context, r io.ReadSeeker, w io.Writer, payload []byte) error {
+	ctx, err := readContextWithPasswords(c, r, "", "")
 	if err != nil {
-		return fmt.Errorf("failed to create temp directory: %w", err)
+		return fmt.Errorf("failed to read context: %w", err)
+	}
+	if err := api.OptimizeContext(ctx); err != nil {
+		return fmt.Errorf("failed to optimize context: %w", err)
+	}
+
+	if err := a.injectContext(c, ctx, payload); err != nil {
+		return err
 	}
-	defer func() {
-		if cleanErr := os.RemoveAll(tmpDir); cleanErr != nil {
-			fmt.Fprintf(os.Stderr, "Warning: failed to clean temp directory: %v\n", cleanErr)
-		}
-	}()
 
-	// Write payload to temporary file
-	payloadPath := filepath.Join(tmpDir, attachName)
-	if err := os.WriteFile(payloadPath, payload, 0600); err != nil {
-		return fmt.Errorf("failed to write payload: %w", err)
+	if err := writeContext(ctx, w); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
 	}
+	return nil
+}
 
-	// Add attachment to PDF
-	conf := model.NewDefaultConfiguration()
-	if err := api.AddAttachmentsFile(inputPath, outputPath, []string{payloadPath}, true, conf); err != nil {
+// injectContext embeds the payload as an attachment of a parsed PDF: a font
+// license text file carrying the payload in its trailing whitespace
+func (a *AttachmentAnchor) injectContext(c context.Context, ctx *model.Context, payload []byte) error {
+	modTime := a.modTime
+	if modTime.IsZero() {
+		modTime = time.Now()
+	}
+	text, err := encodeLicense(payload)
+	if err != nil {
+		return err
+	}
+	date := attachmentDate(ctx, modTime)
+	attachment := model.Attachment{Reader: bytes.NewReader(text), ID: attachName, Desc: attachDesc, ModTime: &date}
+	if err := ctx.AddAttachment(attachment, true); err != nil {
 		return fmt.Errorf("failed to add attachment to PDF: %w", err)
 	}
 
+	// Describe the file the way authoring tools do: a MIME type, a creation
+	// date and an MD5 checksum of the text
+	_, _, sd, err := attachmentStream(ctx)
+	if err != nil {
+		return err
+	}
+	sd.Dict["Subtype"] = types.Name(attachMIMEType)
+	if params, ok := sd.Dict["Params"].(types.Dict); ok {
+		params["CreationDate"] = types.StringLiteral(types.DateString(date))
+		sum := md5.Sum(text)
+		params["CheckSum"] = types.NewHexLiteral(sum[:])
+	}
+
+	if level := detectPDFA(ctx); level != nil && level.embedsAnyFile() {
+		if err := associateAttachment(ctx); err != nil {
+			return fmt.Errorf("failed to associate attachment for %s: %w", level, err)
+		}
+	}
+	return nil
+}
+
+// attachmentStream returns the file specification of the attachment, its
+// reference and the embedded file stream
+func attachmentStream(ctx *model.Context) (types.Dict, types.IndirectRef, *types.StreamDict, error) {
+	tree := ctx.Names["EmbeddedFiles"]
+	if tree == nil {
+		return nil, types.IndirectRef{}, nil, ErrAttachmentNotFound
+	}
+	ref, found := tree.Value(attachName)
+	specRef, ok := ref.(types.IndirectRef)
+	if !found || !ok {
+		return nil, types.IndirectRef{}, nil, ErrAttachmentNotFound
+	}
+	spec, err := ctx.DereferenceDict(specRef)
+	if err != nil || spec == nil {
+		return nil, specRef, nil, fmt.Errorf("%w: invalid file specification", ErrAttachmentNotFound)
+	}
+	ef, err := ctx.DereferenceDict(spec["EF"])
+	if err != nil || ef == nil {
+		return nil, specRef, nil, fmt.Errorf("%w: no embedded file", ErrAttachmentNotFound)
+	}
+	sd, _, err := ctx.DereferenceStreamDict(ef["F"])
+	if err != nil || sd == nil {
+		return nil, specRef, nil, fmt.Errorf("%w: no embedded file stream", ErrAttachmentNotFound)
+	}
+	return spec, specRef, sd, nil
+}
+
+// associateAttachment declares the attachment the way PDF/A-3 requires of
+// embedded files: a relationship to the document and a reference from the
+// catalog's associated files (AF)
+func associateAttachment(ctx *model.Context) error {
+	spec, specRef, _, err := attachmentStream(ctx)
+	if err != nil {
+		return err
+	}
+	spec["AFRelationship"] = types.Name("Unspecified")
+
+	root, err := ctx.Catalog()
+	if err != nil {
+		return err
+	}
+	af, _ := ctx.DereferenceArray(root["AF"])
+	root["AF"] = append(af, specRef)
 	return nil
 }
 
-// Extract retrieves the payload from PDF attachment
+// attachmentOverhead approximates the file specification, embedded file stream
+// dict, name tree and xref entries added around the license text
+const attachmentOverhead = 920
+
+// licenseCompressedSize approximates the compressed license text without payload
+const licenseCompressedSize = 1980
+
+// estimateOverhead returns the license text, the payload bits in its
+// whitespace and the copies of the license holding them, which compress to
+// about three bytes per payload byte, and the attachment bookkeeping
+func (a *AttachmentAnchor) estimateOverhead(_ *model.Context, payloadLen int, _ string) int {
+	return licenseCompressedSize + payloadLen*3 + attachmentOverhead
+}
+
+// Extract retrieves the payload from PDF attachment within DefaultLimits
 func (a *AttachmentAnchor) Extract(filePath string) ([]byte, error) {
-	tmpDir, err := os.MkdirTemp("", "defender_verify_*")
+	return extractWithBudget(a, filePath, newBudget(DefaultLimits))
+}
+
+// ExtractReader retrieves the payload from the PDF in r within DefaultLimits
+func (a *AttachmentAnchor) ExtractReader(c context.Context, r io.ReadSeeker) ([]byte, error) {
+	return a.extractLimited(r, newBudget(DefaultLimits).withContext(c))
+}
+
+// extractLimited looks the attachment up in the EmbeddedFiles name tree (by key,
+// then by file name or description, as pdfcpu does) and decodes only its stream
+func (a *AttachmentAnchor) extractLimited(r io.ReadSeeker, b *budget) ([]byte, error) {
+	ctx, err := b.readContext(r)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create temp directory: %w", err)
+		return nil, err
+	}
+	if err := ctx.XRefTable.LocateNameTree("EmbeddedFiles", false); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAttachmentNotFound, err)
+	}
+	tree := ctx.Names["EmbeddedFiles"]
+	if tree == nil {
+		return nil, fmt.Errorf("%w: no attachments", ErrAttachmentNotFound)
 	}
-	defer func() {
-		if cleanErr := os.RemoveAll(tmpDir); cleanErr != nil {
-			fmt.Fprintf(os.Stderr, "Warning: failed to clean temp directory: %v\n", cleanErr)
-		}
-	}()
 
-	conf := model.NewDefaultConfiguration()
+	spec, found := tree.Value(attachName)
+	if !found {
+		errMatch := errors.New("match")
+		err := tree.Process(ctx.XRefTable, func(xRefTable *model.XRefTable, _ string, o *types.Object) error {
+			d, err := xRefTable.DereferenceDict(*o)
+			if err != nil || d == nil {
+				return nil
+			}
+			for _, key := range []string{"UF", "F", "Desc"} {
+				if v, ok := d.Find(key); ok {
+					if s, err := xRefTable.DereferenceStringOrHexLiteral(v, model.V10, nil); err == nil && s == attachName {
+						spec = *o
+						return errMatch
+					}
+				}
+			}
+			return nil
+		})
+		if !errors.Is(err, errMatch) {
+			return nil, fmt.Errorf("%w: %s", ErrAttachmentNotFound, attachName)
+		}
+	}
 
-	// Extract attachment from PDF
-	if extractErr := api.ExtractAttachmentsFile(filePath, tmpDir, []string{attachName}, conf); extractErr != nil {
-		return nil, fmt.Errorf("%w: %v", ErrAttachmentNotFound, extractErr)
+	specDict, err := ctx.DereferenceDict(spec)
+	if err != nil || specDict == nil {
+		return nil, fmt.Errorf("%w: invalid file specification", ErrAttachmentNotFound)
+	}
+	ef, err := ctx.DereferenceDict(specDict["EF"])
+	if err != nil || ef == nil {
+		return nil, fmt.Errorf("%w: no embedded file", ErrAttachmentNotFound)
+	}
+	sd, _, err := ctx.DereferenceStreamDict(ef["F"])
+	if err != nil || sd == nil {
+		return nil, fmt.Errorf("%w: no embedded file stream", ErrAttachmentNotFound)
+	}
+	objNr := 0
+	if ref, ok := ef["F"].(types.IndirectRef); ok {
+		objNr = ref.ObjectNumber.Value()
 	}
 
-	extractedPath := filepath.Join(tmpDir, attachName)
-	payload, err := os.ReadFile(extractedPath)
+	data, err := b.decodeStream(sd, objNr)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read extracted attachment: %w", err)
+		if errors.Is(err, ErrLimitExceeded) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to decode attachment: %w", err)
+	}
+	// Copies signed by earlier versions attach the raw payload
+	if bytes.HasPrefix(data, magicHeader) {
+		return data, nil
+	}
+	payload, err := decodeLicense(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAttachmentNotFound, err)
 	}
-
 	return payload, nil
 }
 
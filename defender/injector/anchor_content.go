@@ -3,12 +3,15 @@ package injector
 import (
 	"bytes"
 	"compress/zlib"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"strconv"
 	"strings"
 
 	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/filter"
 	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
 	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
 )
@@ -21,7 +24,11 @@ type ContentAnchor struct {
 // Magic header for content stream payload
 var contentMagicHeader = []byte{0xDE, 0xAD, 0xBE, 0xEF}
 
+// contentFontResName names the Helvetica font the payload text is shown with
+const contentFontResName = "PhantomHelv"
+
 func NewContentAnchor() *ContentAnchor {
+	ensurePDFConfig()
 	return &ContentAnchor{}
 }
 
@@ -36,8 +43,13 @@ func (a *ContentAnchor) IsAvailable(ctx *model.Context) bool {
 
 // Inject embeds the payload into page content streams using TJ operator
 func (a *ContentAnchor) Inject(inputPath, outputPath string, payload []byte) error {
+	return injectFile(a, inputPath, outputPath, payload)
+}
+
+// InjectReader embeds the payload into the page content streams of the PDF in r
+func (a *ContentAnchor) InjectReader(c context.Context, r io.ReadSeeker, w io.Writer, payload []byte) error {
 	// Read PDF context
-	ctx, err := api.ReadContextFile(inputPath)
+	ctx, err := readContextWithPasswords(c, r, "", "")
 	if err != nil {
 		return fmt.Errorf("failed to read context: %w", err)
 	}
@@ -47,32 +59,50 @@ func (a *ContentAnchor) Inject(inputPath, outputPath string, payload []byte) err
 		return fmt.Errorf("failed to optimize context: %w", err)
 	}
 
-	// Prepare payload with magic header
-	fullPayload := make([]byte, 0, len(contentMagicHeader)+len(payload))
-	fullPayload = append(fullPayload, contentMagicHeader...)
-	fullPayload = append(fullPayload, payload...)
-	fmt.Printf("[DEBUG] Content: Payload size %d bytes\n", len(fullPayload))
+	if err := a.injectContext(c, ctx, payload); err != nil {
+		return err
+	}
+
+	// Write output
+	if err := writeContext(ctx, w); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+
+	return nil
+}
+
+// injectContext appends a payload stream to every page of a parsed PDF
+func (a *ContentAnchor) injectContext(c context.Context, ctx *model.Context, payload []byte) error {
+	// Every page carries the whole payload unless it outgrows a page
+	k, _ := contentShards(len(payload), ctx.PageCount)
+	pagePayloads, err := distributePayload(payload, ctx.PageCount, k)
+	if err != nil {
+		return fmt.Errorf("failed to distribute payload: %w", err)
+	}
 
 	injectedCount := 0
 
 	// Iterate through all pages
 	for i := 1; i <= ctx.PageCount; i++ {
+		if err := c.Err(); err != nil {
+			return err
+		}
 		// Get page dictionary
 		pageDict, _, _, err := ctx.PageDict(i, false)
 		if err != nil {
-			fmt.Printf("[DEBUG] Content: Failed to get page dict for page %d: %v\n", i, err)
+			reporterFrom(c).warn("Content: page %d skipped: %v", i, err)
 			continue
 		}
 
 		// 1. Ensure a standard font (Helvetica) is available in Resources
-		fontName := "/PhantomHelv" // Unique name to avoid conflict
+		fontName := "/" + contentFontResName // Unique name to avoid conflict
 
 		// Dereference Resources dict
 		var resDict types.Dict
 		if resObj, ok := pageDict["Resources"]; ok {
 			resDict, err = ctx.XRefTable.DereferenceDict(resObj)
 			if err != nil {
-				fmt.Printf("[DEBUG] Content: Failed to dereference Resources for page %d: %v\n", i, err)
+				reporterFrom(c).warn("Content: page %d skipped, unreadable resources: %v", i, err)
 				continue
 			}
 		} else {
@@ -86,7 +116,7 @@ func (a *ContentAnchor) Inject(inputPath, outputPath string, payload []byte) err
 		if fontObj, ok := resDict["Font"]; ok {
 			fontDict, err = ctx.XRefTable.DereferenceDict(fontObj)
 			if err != nil {
-				fmt.Printf("[DEBUG] Content: Failed to dereference Font dict for page %d: %v\n", i, err)
+				reporterFrom(c).warn("Content: page %d skipped, unreadable font resources: %v", i, err)
 				continue
 			}
 		} else {
@@ -103,7 +133,7 @@ func (a *ContentAnchor) Inject(inputPath, outputPath string, payload []byte) err
 		// Add font object to XRefTable
 		fontIndRef, err := ctx.XRefTable.IndRefForNewObject(fontObj)
 		if err != nil {
-			fmt.Printf("[DEBUG] Content: Failed to create font object: %v\n", err)
+			reporterFrom(c).warn("Content: page %d skipped: %v", i, err)
 			continue
 		}
 
@@ -111,18 +141,14 @@ func (a *ContentAnchor) Inject(inputPath, outputPath string, payload []byte) err
 		fontDict[string(types.Name(fontName[1:]))] = *fontIndRef // Remove leading slash for key
 
 		// 2. Create a NEW content stream with our payload
-		var sb strings.Builder
-		// Save graphics state (q), Begin Text (BT), Set Font (Tf), Invisible Mode (3 Tr)
-		sb.WriteString(fmt.Sprintf("q\nBT\n%s 1 Tf\n3 Tr\n[", fontName))
-		for _, b := range fullPayload {
-			sb.WriteString(fmt.Sprintf(" ( ) %d", b))
-		}
-		sb.WriteString(" ] TJ\nET\nQ\n")
-
-		contentData := []byte(sb.String())
-
-		// Create stream dict
-		sd := types.NewStreamDict(types.NewDict(), 0, nil, nil, nil)
+		fullPayload := make([]byte, 0, len(contentMagicHeader)+len(pagePayloads[i-1]))
+		fullPayload = append(fullPayload, contentMagicHeader...)
+		fullPayload = append(fullPayload, pagePayloads[i-1]...)
+		contentData := pageMarksFrom(c).wrap(contentPayloadStream(fontName, fullPayload))
+
+		// Create stream dict; the filter pipeline lets later anchors working on
+		// the same parsed document decode and re-encode the stream
+		sd := types.NewStreamDict(types.NewDict(), 0, nil, nil, []types.PDFFilter{{Name: filter.Flate}})
 		sd.Content = contentData
 
 		// Compress
@@ -130,7 +156,7 @@ func (a *ContentAnchor) Inject(inputPath, outputPath string, payload []byte) err
 		w := zlib.NewWriter(&buf)
 		if _, writeErr := w.Write(contentData); writeErr != nil {
 			w.Close()
-			fmt.Printf("[DEBUG] Content: Failed to write to zlib writer: %v\n", writeErr)
+			reporterFrom(c).warn("Content: page %d skipped: %v", i, writeErr)
 			continue
 		}
 		w.Close()
@@ -146,7 +172,7 @@ func (a *ContentAnchor) Inject(inputPath, outputPath string, payload []byte) err
 		// Add stream to XRefTable
 		streamIndRef, err := ctx.XRefTable.IndRefForNewObject(sd)
 		if err != nil {
-			fmt.Printf("[DEBUG] Content: Failed to create stream object: %v\n", err)
+			reporterFrom(c).warn("Content: page %d skipped: %v", i, err)
 			continue
 		}
 
@@ -163,7 +189,7 @@ func (a *ContentAnchor) Inject(inputPath, outputPath string, payload []byte) err
 				pageDict["Contents"] = obj
 			default:
 				// Unknown type, overwrite (risky) or skip
-				fmt.Printf("[DEBUG] Content: Unknown Contents type for page %d\n", i)
+				reporterFrom(c).warn("Content: page %d skipped, unknown /Contents type", i)
 				continue
 			}
 		} else {
@@ -171,30 +197,75 @@ func (a *ContentAnchor) Inject(inputPath, outputPath string, payload []byte) err
 			pageDict["Contents"] = *streamIndRef
 		}
 
-		fmt.Printf("[DEBUG] Content: Injected new stream into page %d using font %s\n", i, fontName)
 		injectedCount++
+		if err := pageDone(c, i, ctx.PageCount); err != nil {
+			return err
+		}
 	}
 
 	if injectedCount == 0 {
 		return fmt.Errorf("failed to inject into any page")
 	}
+	return nil
+}
 
-	fmt.Printf("[DEBUG] Content: Injected into %d pages\n", injectedCount)
+// contentPageCapacity is the largest payload a page carries whole. Larger
+// payloads (tamper evidence on long documents) are split into the fewest
+// fragments that fit, so each page stays a few KB.
+const contentPageCapacity = 1024
 
-	// Write output
-	fmt.Printf("[DEBUG] Content: Writing output to %s\n", outputPath)
-	if err := api.WriteContextFile(ctx, outputPath); err != nil {
-		return fmt.Errorf("failed to write output: %w", err)
+// contentShards returns the split of a payload over a document's pages: any
+// single page carries it (k == 1) unless it exceeds contentPageCapacity
+func contentShards(payloadLen, pages int) (k, n int) {
+	return fragmentShardsWithin(payloadLen, pages, contentPageCapacity)
+}
+
+// contentPayloadStream returns the invisible text operators carrying fullPayload
+func contentPayloadStream(fontName string, fullPayload []byte) []byte {
+	var sb strings.Builder
+	// Save graphics state (q), Begin Text (BT), Set Font (Tf), Invisible Mode (3 Tr)
+	sb.WriteString(fmt.Sprintf("q\nBT\n%s 1 Tf\n3 Tr\n[", fontName))
+	for _, b := range fullPayload {
+		sb.WriteString(fmt.Sprintf(" ( ) %d", b))
 	}
+	sb.WriteString(" ] TJ\nET\nQ\n")
+	return []byte(sb.String())
+}
 
-	return nil
+// contentPageOverhead approximates the per-page objects besides the stream data:
+// the Helvetica font dict, the stream dict, resource entries and xref entries
+const contentPageOverhead = 250
+
+// estimateOverhead returns the size of one compressed payload stream per page
+func (a *ContentAnchor) estimateOverhead(ctx *model.Context, payloadLen int, _ string) int {
+	k, _ := contentShards(payloadLen, ctx.PageCount)
+	fullPayload := make([]byte, len(contentMagicHeader)+carrierPayloadSize(payloadLen, k))
+	copy(fullPayload, contentMagicHeader)
+	// Random payload bytes compress poorly; 0xFF keeps the decimal operands at full width
+	for i := len(contentMagicHeader); i < len(fullPayload); i++ {
+		fullPayload[i] = 0xFF
+	}
+	stream, err := compressFlate(contentPayloadStream("/"+contentFontResName, fullPayload))
+	if err != nil {
+		return -1
+	}
+	return ctx.PageCount * (len(stream) + contentPageOverhead)
 }
 
-// Extract retrieves the payload from content streams
+// Extract retrieves the payload from content streams within DefaultLimits
 func (a *ContentAnchor) Extract(filePath string) ([]byte, error) {
-	ctx, err := api.ReadContextFile(filePath)
+	return extractWithBudget(a, filePath, newBudget(DefaultLimits))
+}
+
+// ExtractReader retrieves the payload from the PDF in r within DefaultLimits
+func (a *ContentAnchor) ExtractReader(c context.Context, r io.ReadSeeker) ([]byte, error) {
+	return a.extractLimited(r, newBudget(DefaultLimits).withContext(c))
+}
+
+func (a *ContentAnchor) extractLimited(r io.ReadSeeker, b *budget) ([]byte, error) {
+	ctx, err := b.readContext(r)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read context: %w", err)
+		return nil, err
 	}
 
 	if err := api.OptimizeContext(ctx); err != nil {
@@ -205,7 +276,13 @@ func (a *ContentAnchor) Extract(filePath string) ([]byte, error) {
 	// Simplified: Look for brackets containing ( ) and numbers
 	// We look for the sequence that matches our encoding pattern
 
+	// A whole payload is returned at once; fragments are collected from every stream
+	var fragments fragmentSet
+	var limitErr error
 	for objNr := 1; objNr <= *ctx.XRefTable.Size; objNr++ {
+		if err := b.checkTime(); err != nil {
+			return nil, err
+		}
 		entry, found := ctx.Find(objNr)
 		if !found || entry.Free || entry.Object == nil {
 			continue
@@ -221,22 +298,40 @@ func (a *ContentAnchor) Extract(filePath string) ([]byte, error) {
 		}
 
 		// Decode the stream
-		if err := sd.Decode(); err != nil {
+		content, err := b.decodeStream(&sd, objNr)
+		if err != nil {
+			if errors.Is(err, ErrLimitExceeded) {
+				limitErr = err
+			}
 			continue
 		}
-
-		content := sd.Content
 		if len(content) == 0 {
 			continue
 		}
 
 		contentStr := string(content)
 		if payload, found := a.parseContentStreamForPayload(contentStr); found {
-			fmt.Printf("[DEBUG] Content: Found payload in object %d\n", objNr)
+			if isFragment(payload) {
+				fragments.add(payload)
+				continue
+			}
 			return payload, nil
 		}
 	}
 
+	if len(fragments.order) > 0 {
+		payload, err := fragments.payload()
+		if err == nil {
+			return payload, nil
+		}
+		if limitErr == nil {
+			return nil, fmt.Errorf("content payload not recoverable: %w", err)
+		}
+	}
+	if limitErr != nil {
+		// A stream too large to decode may have carried the payload
+		return nil, limitErr
+	}
 	return nil, fmt.Errorf("content payload not found")
 }
 
@@ -3,11 +3,12 @@ package injector
 import (
 	"bytes"
 	"compress/zlib"
+	"context"
+	"errors"
 	"fmt"
 	"io"
-	"os"
 
-	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/filter"
 	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
 	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
 )
@@ -17,6 +18,7 @@ type SMaskAnchor struct{}
 
 // NewSMaskAnchor creates a new SMask anchor
 func NewSMaskAnchor() *SMaskAnchor {
+	ensurePDFConfig()
 	return &SMaskAnchor{}
 }
 
@@ -27,38 +29,55 @@ func (a *SMaskAnchor) Name() string {
 
 // Inject embeds the payload into a PDF via image SMask
 func (a *SMaskAnchor) Inject(inputPath, outputPath string, payload []byte) error {
+	return injectFile(a, inputPath, outputPath, payload)
+}
+
+// InjectReader embeds the payload into the image masks of the PDF in r
+func (a *SMaskAnchor) InjectReader(c context.Context, r io.ReadSeeker, w io.Writer, payload []byte) error {
 	// Read and parse PDF
-	ctx, err := api.ReadContextFile(inputPath)
+	ctx, err := readContextWithPasswords(c, r, "", "")
 	if err != nil {
 		return fmt.Errorf("failed to read PDF context: %w", err)
 	}
 
-	// Create SMask injector
-	injector := &smaskInjector{payload: payload}
-
 	// Inject SMask
-	if err := injector.inject(ctx); err != nil {
+	if err := a.injectContext(c, ctx, payload); err != nil {
 		return err
 	}
 
 	// Write modified PDF
-	if err := api.WriteContextFile(ctx, outputPath); err != nil {
+	if err := writeContext(ctx, w); err != nil {
 		return fmt.Errorf("failed to write PDF: %w", err)
 	}
 
 	return nil
 }
 
-// Extract retrieves the payload from SMask anchor
+// injectContext hides the payload in the image masks of a parsed PDF
+func (a *SMaskAnchor) injectContext(c context.Context, ctx *model.Context, payload []byte) error {
+	injector := &smaskInjector{payload: payload}
+	return injector.inject(c, ctx)
+}
+
+// Extract retrieves the payload from SMask anchor within DefaultLimits
 func (a *SMaskAnchor) Extract(filePath string) ([]byte, error) {
+	return extractWithBudget(a, filePath, newBudget(DefaultLimits))
+}
+
+// ExtractReader retrieves the payload from the PDF in r within DefaultLimits
+func (a *SMaskAnchor) ExtractReader(c context.Context, r io.ReadSeeker) ([]byte, error) {
+	return a.extractLimited(r, newBudget(DefaultLimits).withContext(c))
+}
+
+func (a *SMaskAnchor) extractLimited(r io.ReadSeeker, b *budget) ([]byte, error) {
 	// Read and parse PDF
-	ctx, err := api.ReadContextFile(filePath)
+	ctx, err := b.readContext(r)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read PDF context: %w", err)
+		return nil, err
 	}
 
 	// Extract SMask payload
-	extractor := &smaskExtractor{}
+	extractor := &smaskExtractor{budget: b}
 	payload, err := extractor.extract(ctx)
 	if err != nil {
 		return nil, err
@@ -68,10 +87,32 @@ func (a *SMaskAnchor) Extract(filePath string) ([]byte, error) {
 }
 
 // IsAvailable checks if SMask anchor can be used
-// Requires at least one image in the PDF
+// Requires at least one image that can carry a soft mask
 func (a *SMaskAnchor) IsAvailable(ctx *model.Context) bool {
-	images := findImageXObjects(ctx)
-	return len(images) > 0
+	return len(smaskCarriers(ctx, findImageXObjects(ctx))) > 0
+}
+
+// smaskObjectOverhead approximates the mask stream dict, the /SMask entry and
+// the xref entry of a new mask
+const smaskObjectOverhead = 160
+
+// estimateOverhead returns the size of the masks written: an existing mask is
+// written again whole, and a new opaque one compresses to about a 200th of its
+// pixels. Each scattered payload pixel breaks a run and costs about half a
+// byte more.
+func (a *SMaskAnchor) estimateOverhead(ctx *model.Context, payloadLen int, _ string) int {
+	carriers, size := fitCarriers(smaskCarriers(ctx, findImageXObjects(ctx)), payloadLen)
+	total := 0
+	for _, c := range carriers {
+		total += lsbPixels(size) / 2
+		if c.mask == nil {
+			w, h := lsbMaskSize(c.width, c.height, size)
+			total += smaskObjectOverhead + w*h/200
+		} else if mask, err := getImageObject(ctx, *c.mask); err == nil && mask.StreamLength != nil {
+			total += int(*mask.StreamLength)
+		}
+	}
+	return total
 }
 
 // smaskInjector handles SMask injection logic
@@ -79,8 +120,9 @@ type smaskInjector struct {
 	payload []byte
 }
 
-// inject injects the payload into a PDF via image SMask
-func (s *smaskInjector) inject(ctx *model.Context) error {
+// inject hides the payload in the soft mask pixels of every image that can
+// carry one, or one fragment of it per image when there are many
+func (s *smaskInjector) inject(c context.Context, ctx *model.Context) error {
 	// Find all image XObjects in the PDF
 	images := findImageXObjects(ctx)
 
@@ -88,27 +130,182 @@ func (s *smaskInjector) inject(ctx *model.Context) error {
 		return fmt.Errorf("no images found in PDF (SMask anchor requires at least one image)")
 	}
 
-	// Use the first image as anchor
-	targetImgRef := images[0]
-	targetImg, err := getImageObject(ctx, targetImgRef)
+	carriers, _ := fitCarriers(smaskCarriers(ctx, images), len(s.payload))
+	if len(carriers) == 0 {
+		return fmt.Errorf("no image can carry a soft mask")
+	}
+	k, _ := fragmentShards(len(carriers))
+	payloads, err := distributePayload(s.payload, len(carriers), k)
+	if err != nil {
+		return fmt.Errorf("failed to distribute payload: %w", err)
+	}
+
+	for i, carrier := range carriers {
+		if err := c.Err(); err != nil {
+			return err
+		}
+		if carrier.mask != nil {
+			err = s.embedInSMask(ctx, *carrier.mask, payloads[i])
+		} else {
+			err = s.attachSMask(ctx, carrier, payloads[i])
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// smaskCarrier is an image that carries the payload in its soft mask
+type smaskCarrier struct {
+	image types.IndirectRef
+	// width and height are the image's size, or the mask's if it has one
+	width, height int
+	// mask is the image's own soft mask whose pixels carry the payload; nil if
+	// a new mask is attached
+	mask *types.IndirectRef
+}
+
+// losslessFilters are the filters a mask can be decoded from and written back
+// without changing its pixels
+var losslessFilters = map[string]bool{
+	filter.Flate: true, filter.LZW: true, filter.RunLength: true, filter.ASCIIHex: true, filter.ASCII85: true,
+}
+
+// smaskCarriers returns the images that can carry the payload in a soft mask.
+// Images without any mask get a new, near-opaque one. Existing 8-bit masks
+// that decode losslessly carry it in their own pixels and keep their
+// transparency; a mask shared by several images is used once. Stencil masks,
+// masks themselves and images with a /Mask are left alone.
+func smaskCarriers(ctx *model.Context, images []types.IndirectRef) []smaskCarrier {
+	isMask := make(map[types.Integer]bool)
+	for _, ref := range images {
+		if img, err := getImageObject(ctx, ref); err == nil {
+			if maskRef := img.IndirectRefEntry("SMask"); maskRef != nil {
+				isMask[maskRef.ObjectNumber] = true
+			}
+		}
+	}
+
+	var carriers []smaskCarrier
+	used := make(map[types.Integer]bool)
+	for _, ref := range images {
+		img, err := getImageObject(ctx, ref)
+		if err != nil || isMask[ref.ObjectNumber] {
+			continue
+		}
+		if stencil := img.BooleanEntry("ImageMask"); stencil != nil && *stencil {
+			continue
+		}
+		maskRef := img.IndirectRefEntry("SMask")
+		if maskRef == nil {
+			if _, found := img.Find("Mask"); found {
+				continue
+			}
+			if w, h, err := getImageDimensions(&img); err == nil {
+				carriers = append(carriers, smaskCarrier{image: ref, width: w, height: h})
+			}
+			continue
+		}
+		if used[maskRef.ObjectNumber] {
+			continue
+		}
+		if w, h, ok := lsbMask(ctx, *maskRef); ok {
+			used[maskRef.ObjectNumber] = true
+			carriers = append(carriers, smaskCarrier{image: ref, width: w, height: h, mask: maskRef})
+		}
+	}
+	return carriers
+}
+
+// lsbMask reports whether a mask's pixels can carry payload bits: 8 bits per
+// pixel behind lossless filters only. It returns the mask's size.
+func lsbMask(ctx *model.Context, ref types.IndirectRef) (width, height int, ok bool) {
+	mask, err := getImageObject(ctx, ref)
+	if err != nil {
+		return 0, 0, false
+	}
+	if bpc := mask.IntEntry("BitsPerComponent"); bpc == nil || *bpc != 8 {
+		return 0, 0, false
+	}
+	for _, f := range filterPipeline(mask.Dict) {
+		if !losslessFilters[f.Name] {
+			return 0, 0, false
+		}
+	}
+	width, height, err = getImageDimensions(&mask)
+	return width, height, err == nil && width > 0 && height > 0
+}
+
+// fitCarriers drops existing masks with too few pixels for their share of the
+// payload and returns the rest with the size of that share. New masks are
+// always made large enough.
+func fitCarriers(carriers []smaskCarrier, payloadLen int) ([]smaskCarrier, int) {
+	for {
+		k, _ := fragmentShards(len(carriers))
+		size := carrierPayloadSize(payloadLen, k)
+		fit := carriers[:0:0]
+		for _, c := range carriers {
+			if c.mask == nil || c.width*c.height >= lsbPixels(size) {
+				fit = append(fit, c)
+			}
+		}
+		if len(fit) == len(carriers) {
+			return fit, size
+		}
+		// Fewer carriers mean larger fragments
+		carriers = fit
+	}
+}
+
+// embedInSMask writes the payload into the pixels of an existing mask
+func (s *smaskInjector) embedInSMask(ctx *model.Context, maskRef types.IndirectRef, payload []byte) error {
+	entry, found := ctx.Find(int(maskRef.ObjectNumber))
+	if !found || entry.Object == nil {
+		return fmt.Errorf("SMask object %d not found", maskRef.ObjectNumber)
+	}
+	mask, ok := entry.Object.(types.StreamDict)
+	if !ok {
+		return fmt.Errorf("SMask object %d is not a stream", maskRef.ObjectNumber)
+	}
+	width, height, err := getImageDimensions(&mask)
 	if err != nil {
-		return fmt.Errorf("failed to get image object: %w", err)
+		return err
+	}
+	pixels, err := newBudget(DefaultLimits).decodeStream(&mask, int(maskRef.ObjectNumber))
+	if err != nil {
+		return fmt.Errorf("failed to decode SMask: %w", err)
+	}
+	if err := embedLSB(pixels, width, height, payload); err != nil {
+		return fmt.Errorf("SMask object %d: %w", maskRef.ObjectNumber, err)
 	}
 
-	// Get image dimensions
-	width, height, err := getImageDimensions(&targetImg)
+	compressedData, err := compressFlate(pixels)
 	if err != nil {
-		return fmt.Errorf("failed to get image dimensions: %w", err)
+		return fmt.Errorf("failed to compress mask data: %w", err)
 	}
+	streamLength := int64(len(compressedData))
+	mask.Raw = compressedData
+	mask.Content = pixels
+	mask.StreamLength = &streamLength
+	mask.FilterPipeline = []types.PDFFilter{{Name: filter.Flate}}
+	mask.Update("Length", types.Integer(streamLength))
+	mask.Update("Filter", types.Name("FlateDecode"))
+	mask.Delete("DecodeParms")
+	entry.Object = mask
+	return nil
+}
 
+// attachSMask sets a new mask carrying payload as the soft mask of an image
+func (s *smaskInjector) attachSMask(ctx *model.Context, c smaskCarrier, payload []byte) error {
 	// Create SMask object
-	smaskRef, err := s.createSMaskObject(ctx, width, height)
+	smaskRef, err := s.createSMaskObject(ctx, c.width, c.height, payload)
 	if err != nil {
 		return fmt.Errorf("failed to create SMask object: %w", err)
 	}
 
 	// Update the image object in xRefTable
-	entry, found := ctx.Find(int(targetImgRef.ObjectNumber))
+	entry, found := ctx.Find(int(c.image.ObjectNumber))
 	if !found {
 		return fmt.Errorf("image object not found in xRefTable")
 	}
@@ -151,37 +348,18 @@ func (s *smaskInjector) inject(ctx *model.Context) error {
 	return nil
 }
 
-// createSMaskObject creates a new SMask stream object with embedded payload
-func (s *smaskInjector) createSMaskObject(ctx *model.Context, _, _ int) (*types.IndirectRef, error) {
-	// Optimization: Use a small, fixed-size mask (16x16) regardless of target image size.
-	// This ensures:
-	// 1. Minimal file size overhead (small mask vs potential megapixel mask).
-	// 2. Minimal memory usage during processing.
-	// 3. No visual corruption: Payload is appended *after* valid pixel data, so it shouldn't be rendered.
-	// 4. Robustness: PDF viewers scale the SMask to fit the target image. 16x16 of all-255 is safe.
-	width := 16
-	height := 16
-	maskSize := width * height
-
-	maskData := make([]byte, maskSize)
-	for i := range maskData {
-		maskData[i] = 255 // Opaque
-	}
-
-	// Prepare payload with magic header
-	fullPayload := make([]byte, 0, len(magicHeader)+len(s.payload))
-	fullPayload = append(fullPayload, magicHeader...)
-	fullPayload = append(fullPayload, s.payload...)
-
-	// Append payload AFTER the valid pixel data
-	// The PDF reader expects Width*Height bytes. Extra bytes at the end of the stream are generally ignored by renderers
-	// but preserved in the file and retrievable by our extractor.
-	finalData := make([]byte, 0, len(maskData)+len(fullPayload))
-	finalData = append(finalData, maskData...)
-	finalData = append(finalData, fullPayload...)
+// createSMaskObject creates an opaque mask the size of the image with the
+// payload in its pixels' low bits. Payload pixels are 254 instead of 255
+// where a bit is 0, a difference no viewer shows.
+func (s *smaskInjector) createSMaskObject(ctx *model.Context, imgWidth, imgHeight int, payload []byte) (*types.IndirectRef, error) {
+	width, height := lsbMaskSize(imgWidth, imgHeight, len(payload))
+	maskData := bytes.Repeat([]byte{255}, width*height)
+	if err := embedLSB(maskData, width, height, payload); err != nil {
+		return nil, err
+	}
 
 	// Compress mask data with Flate (zlib)
-	compressedData, err := compressFlate(finalData)
+	compressedData, err := compressFlate(maskData)
 	if err != nil {
 		return nil, fmt.Errorf("failed to compress mask data: %w", err)
 	}
@@ -193,12 +371,12 @@ func (s *smaskInjector) createSMaskObject(ctx *model.Context, _, _ int) (*types.
 		0,
 		&streamLength,
 		nil,
-		[]types.PDFFilter{},
+		[]types.PDFFilter{{Name: filter.Flate}},
 	)
 
 	// Set raw content (compressed)
 	smaskDict.Raw = compressedData
-	smaskDict.Content = finalData // Need to set this so pdfcpu knows the uncompressed content if needed
+	smaskDict.Content = maskData
 
 	smaskDict.InsertName("Type", "XObject")
 	smaskDict.InsertName("Subtype", "Image")
@@ -219,75 +397,94 @@ func (s *smaskInjector) createSMaskObject(ctx *model.Context, _, _ int) (*types.
 }
 
 // smaskExtractor handles SMask extraction logic
-type smaskExtractor struct{}
+type smaskExtractor struct {
+	budget *budget
+}
 
 // extract extracts payload from SMask anchor
 func (e *smaskExtractor) extract(ctx *model.Context) ([]byte, error) {
 	// Find all image XObjects
 	images := findImageXObjects(ctx)
 
-	fmt.Fprintf(os.Stderr, "[DEBUG] SMask: Found %d images\n", len(images))
-
-	// Search for SMask in images
-	for idx, imgRef := range images {
-		fmt.Fprintf(os.Stderr, "[DEBUG] SMask: Checking image %d (object %d)\n", idx+1, imgRef.ObjectNumber)
+	// Search for SMask in images; a whole payload is returned at once, fragments
+	// are collected from every mask
+	var fragments fragmentSet
+	var limitErr error
+	for _, imgRef := range images {
+		if err := e.budget.checkTime(); err != nil {
+			return nil, err
+		}
 		obj, err := ctx.Dereference(imgRef)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "[DEBUG] SMask: Dereference failed: %v\n", err)
 			continue
 		}
 
 		streamDict, ok := obj.(types.StreamDict)
 		if !ok {
-			fmt.Fprintf(os.Stderr, "[DEBUG] SMask: Not a StreamDict\n")
 			continue
 		}
 
 		// Check if image has SMask
 		smaskRef := streamDict.IndirectRefEntry("SMask")
 		if smaskRef == nil {
-			fmt.Fprintf(os.Stderr, "[DEBUG] SMask: No SMask ref\n")
 			continue
 		}
 
-		fmt.Fprintf(os.Stderr, "[DEBUG] SMask: Found SMask ref -> object %d\n", smaskRef.ObjectNumber)
-
 		// Get SMask object
 		smaskObj, err := ctx.Dereference(*smaskRef)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "[DEBUG] SMask: Dereference SMask failed: %v\n", err)
 			continue
 		}
 
 		smaskStream, ok := smaskObj.(types.StreamDict)
 		if !ok {
-			fmt.Fprintf(os.Stderr, "[DEBUG] SMask: SMask not a StreamDict\n")
 			continue
 		}
 
 		// Decode SMask stream
-		maskData, err := decodeSMask(&smaskStream)
+		maskData, err := e.budget.decodeStream(&smaskStream, int(smaskRef.ObjectNumber))
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "[DEBUG] SMask: Decode failed: %v\n", err)
+			if errors.Is(err, ErrLimitExceeded) {
+				limitErr = err
+			}
 			continue
 		}
 
-		fmt.Fprintf(os.Stderr, "[DEBUG] SMask: Decoded %d bytes\n", len(maskData))
-
-		// Extract payload from end of mask data
-		payload, err := e.findPayloadInMaskData(maskData)
+		// Extract payload from the mask pixels, or from the end of the mask
+		// data where copies signed by earlier versions carry it
+		width, height, _ := getImageDimensions(&smaskStream)
+		payload, err := extractLSB(maskData, width, height)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "[DEBUG] SMask: %v\n", err)
-			continue
+			if payload, err = e.findPayloadInMaskData(maskData); err != nil {
+				continue
+			}
 		}
 
+		if isFragment(payload) {
+			fragments.add(payload)
+			continue
+		}
 		return payload, nil
 	}
 
+	if len(fragments.order) > 0 {
+		payload, err := fragments.payload()
+		if err == nil {
+			return payload, nil
+		}
+		if limitErr == nil {
+			return nil, fmt.Errorf("SMask payload not recoverable: %w", err)
+		}
+	}
+	if limitErr != nil {
+		// A mask too large to decode may have carried the payload
+		return nil, limitErr
+	}
 	return nil, fmt.Errorf("SMask payload not found")
 }
 
-// findPayloadInMaskData scans mask data for payload (magic header)
+// findPayloadInMaskData scans mask data for a payload appended after the
+// pixels (copies signed before payloads moved into the pixels)
 func (e *smaskExtractor) findPayloadInMaskData(maskData []byte) ([]byte, error) {
 	// Scan backwards for magic header
 	maxScanSize := 500
@@ -303,8 +500,6 @@ func (e *smaskExtractor) findPayloadInMaskData(maskData []byte) ([]byte, error)
 		if bytes.Equal(scanData[i:i+len(magicHeader)], magicHeader) {
 			payloadStart := scanStart + i + len(magicHeader) // Skip magic header
 			payload := maskData[payloadStart:]
-			fmt.Fprintf(os.Stderr, "[DEBUG] SMask: Found magic header at offset %d, payload size %d\n",
-				payloadStart-len(magicHeader), len(payload))
 			return payload, nil
 		}
 	}
@@ -369,10 +564,11 @@ func getImageDimensions(img *types.StreamDict) (width, height int, err error) {
 	return *widthObj, *heightObj, nil
 }
 
-// compressFlate compresses data using zlib (Flate)
+// compressFlate compresses data using zlib (Flate). Rewritten masks would
+// otherwise grow well past the encoder that made them.
 func compressFlate(data []byte) ([]byte, error) {
 	var buf bytes.Buffer
-	w := zlib.NewWriter(&buf)
+	w, _ := zlib.NewWriterLevel(&buf, zlib.BestCompression)
 
 	if _, err := w.Write(data); err != nil {
 		return nil, err
@@ -384,29 +580,3 @@ func compressFlate(data []byte) ([]byte, error) {
 
 	return buf.Bytes(), nil
 }
-
-// decodeSMask decodes SMask stream data (internal helper)
-func decodeSMask(stream *types.StreamDict) ([]byte, error) {
-	rawData := stream.Raw
-
-	// Check if compressed with Flate
-	filterName := stream.NameEntry("Filter")
-	if filterName != nil && *filterName == "FlateDecode" {
-		// Decompress
-		reader, err := zlib.NewReader(bytes.NewReader(rawData))
-		if err != nil {
-			return nil, fmt.Errorf("failed to create zlib reader: %w", err)
-		}
-		defer reader.Close()
-
-		decompressed, err := io.ReadAll(reader)
-		if err != nil {
-			return nil, fmt.Errorf("failed to decompress: %w", err)
-		}
-
-		return decompressed, nil
-	}
-
-	// Not compressed
-	return rawData, nil
-}
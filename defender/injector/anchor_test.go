@@ -0,0 +1,66 @@
+package injector
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestParseAnchorProfile tests profile names and explicit anchor lists
+func TestParseAnchorProfile(t *testing.T) {
+	tests := []struct {
+		name      string
+		spec      string
+		expected  []string
+		expectErr bool
+	}{
+		{name: "Empty selects defaults", spec: "", expected: nil},
+		{name: "Profile name", spec: "invisible", expected: []string{"Attachment", "SMask", "Content"}},
+		{name: "Profile name is case-insensitive", spec: " Visual ", expected: []string{"Visual"}},
+		{name: "Plus-separated list", spec: "Attachment+Visual", expected: []string{"Attachment", "Visual"}},
+		{name: "Comma-separated lower-case list", spec: "smask, content", expected: []string{"SMask", "Content"}},
+		{name: "Unknown anchor", spec: "Attachment+Bogus", expectErr: true},
+		{name: "Only separators", spec: "+,", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			anchors, err := ParseAnchorProfile(tt.spec)
+			if tt.expectErr {
+				if err == nil {
+					t.Fatalf("Expected error for %q, got %v", tt.spec, anchors)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(anchors, tt.expected) {
+				t.Errorf("Anchors mismatch: got %v, want %v", anchors, tt.expected)
+			}
+		})
+	}
+
+	// Returned profile slices must not alias the shared table
+	anchors, _ := ParseAnchorProfile("all")
+	anchors[0] = "Mutated"
+	if AnchorProfiles["all"][0] != "Attachment" {
+		t.Error("ParseAnchorProfile returned a slice aliasing AnchorProfiles")
+	}
+}
+
+// TestVisualStyleValidate tests the accepted Visual style ranges
+func TestVisualStyleValidate(t *testing.T) {
+	if err := DefaultVisualStyle.Validate(); err != nil {
+		t.Errorf("DefaultVisualStyle invalid: %v", err)
+	}
+	for _, s := range []VisualStyle{
+		{Opacity: 0, Color: [3]float64{0.5, 0.5, 0.5}},
+		{Opacity: 1.5, Color: [3]float64{0.5, 0.5, 0.5}},
+		{Opacity: 0.3, Color: [3]float64{0.5, -0.1, 0.5}},
+		{Opacity: 0.3, Color: [3]float64{0.5, 0.5, 2}},
+	} {
+		if err := s.Validate(); err == nil {
+			t.Errorf("Expected error for %+v", s)
+		}
+	}
+}
@@ -1,10 +1,14 @@
 package injector
 
 import (
+	"bytes"
+	"context"
 	"fmt"
-	"os"
+	"io"
 
 	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/font"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
 	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
 	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
 )
@@ -14,13 +18,40 @@ const (
 	AnchorNameVisual = "Visual"
 )
 
+// VisualStyle controls how the visible watermark is drawn
+type VisualStyle struct {
+	// Opacity of the watermark, 0 (invisible) to 1 (opaque)
+	Opacity float64
+	// Color is the RGB fill color, each component 0 to 1
+	Color [3]float64
+}
+
+// DefaultVisualStyle is a light grey stamp that keeps the page readable
+var DefaultVisualStyle = VisualStyle{Opacity: 0.3, Color: [3]float64{0.5, 0.5, 0.5}}
+
+// Validate checks that every component is within 0..1
+func (s VisualStyle) Validate() error {
+	if s.Opacity <= 0 || s.Opacity > 1 {
+		return fmt.Errorf("visual opacity must be in (0, 1], got %g", s.Opacity)
+	}
+	for _, c := range s.Color {
+		if c < 0 || c > 1 {
+			return fmt.Errorf("visual color components must be in [0, 1], got %g", c)
+		}
+	}
+	return nil
+}
+
 // VisualAnchor implements the Phase 9 strategy: Visual Watermarks
 // It adds a visible watermark to the PDF pages to deter leaks and increase cleaning cost.
 type VisualAnchor struct {
+	// Style is the look of the stamp (DefaultVisualStyle for NewVisualAnchor)
+	Style VisualStyle
 }
 
 func NewVisualAnchor() *VisualAnchor {
-	return &VisualAnchor{}
+	ensurePDFConfig()
+	return &VisualAnchor{Style: DefaultVisualStyle}
 }
 
 func (a *VisualAnchor) Name() string {
@@ -34,29 +65,52 @@ func (a *VisualAnchor) IsAvailable(ctx *model.Context) bool {
 
 // Inject adds a visible watermark to the PDF
 // Supports full Unicode character range including CJK, Arabic, Cyrillic, etc.
+// The message is wrapped and sized per page from the page's CropBox and /Rotate,
+// so landscape slides and small handouts both get a stamp that fits.
 func (a *VisualAnchor) Inject(inputPath, outputPath string, payload []byte) error {
-	// Use plaintext payload as watermark content (deterrence, no encryption)
-	message := string(payload)
+	if err := a.Style.Validate(); err != nil {
+		return err
+	}
+	return injectFile(a, inputPath, outputPath, payload)
+}
 
-	// Create a watermark configuration
-	// Use plaintext message directly as watermark text
-	watermarkText := message
+// InjectReader adds a visible watermark to the PDF in r
+func (a *VisualAnchor) InjectReader(c context.Context, r io.ReadSeeker, w io.Writer, payload []byte) error {
+	if err := a.Style.Validate(); err != nil {
+		return err
+	}
 
-	// Adaptive font size calculation
-	runes := []rune(watermarkText)
-	charCount := len(runes)
-	baseSize := 48.0
-	targetWidth := 800.0 // Effective diagonal space usually available
+	ctx, err := readContextWithPasswords(c, r, "", "")
+	if err != nil {
+		return fmt.Errorf("failed to read context: %w", err)
+	}
+	if err := api.OptimizeContext(ctx); err != nil {
+		return fmt.Errorf("failed to optimize context: %w", err)
+	}
 
-	fontSize := baseSize
-	if float64(charCount)*baseSize > targetWidth {
-		fontSize = targetWidth / float64(charCount)
+	if err := a.injectContext(c, ctx, payload); err != nil {
+		return err
 	}
-	// Clamp min size
-	if fontSize < 20.0 {
-		fontSize = 20.0
+
+	if err := writeContext(ctx, w); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
 	}
 
+	return nil
+}
+
+// injectContext stamps the watermark onto every page of a parsed PDF,
+// reporting progress after each group of pages
+func (a *VisualAnchor) injectContext(c context.Context, ctx *model.Context, payload []byte) error {
+	if err := a.Style.Validate(); err != nil {
+		return err
+	}
+
+	// Use plaintext payload as watermark content (deterrence, no encryption)
+	watermarkText := string(payload)
+
+	var err error
+
 	// Detect if message contains non-ASCII characters (Unicode)
 	isASCII := true
 	for _, r := range watermarkText {
@@ -66,73 +120,269 @@ func (a *VisualAnchor) Inject(inputPath, outputPath string, payload []byte) erro
 		}
 	}
 
-	var wmConf *model.Watermark
-	var err error
+	// PDF/A needs an embedded font for visible text and, in PDF/A-1, an opaque stamp
+	style, fill := a.Style, rgbFill(a.Style.Color)
+	pdfa := detectPDFA(ctx)
+	if pdfa != nil {
+		style, fill = pdfaVisual(ctx, pdfa, style)
+		reporterFrom(c).note("Visual: %s document, drawing with an embedded font (%s)", pdfa, fill)
+	}
 
-	if isASCII {
+	var measure textMeasurer
+	var vf *vectorFont
+	if pdfa != nil {
+		if vf, err = embedVectorFont(ctx, watermarkText); err != nil {
+			return fmt.Errorf("failed to embed watermark font for %s: %w", pdfa, err)
+		}
+		measure = vf.measurer()
+	} else if isASCII {
 		// Optimization: Use standard PDF font (Helvetica) for ASCII-only text.
-		// This avoids embedding the ~1MB Unicode font, resulting in zero file size overhead.
-		desc := fmt.Sprintf("font:Helvetica, points:%.1f, rot:45, op:0.3, col:0.5 0.5 0.5", fontSize)
-		wmConf, err = api.TextWatermark(watermarkText,
-			desc,
-			true, false, types.POINTS)
-		if err != nil {
-			return fmt.Errorf("failed to configure ASCII watermark: %w", err)
+		// This avoids embedding any font, resulting in zero file size overhead.
+		measure = func(s string, fontSize int) float64 {
+			return font.TextWidth(s, "Helvetica", fontSize)
+		}
+	} else {
+		// Non-ASCII: embed only the glyphs the message uses as a Type0 font,
+		// giving crisp, searchable vector text for a few KB.
+		vf, err = embedVectorFont(ctx, watermarkText)
+		if err == nil {
+			measure = vf.measurer()
+		} else {
+			// Fall back to rasterizing the text to an image watermark
+			reporterFrom(c).warn("Visual: vector font unavailable, rasterizing the watermark: %v", err)
+			measure, err = embeddedFontMeasurer()
+			if err != nil {
+				return fmt.Errorf("failed to load Unicode font metrics: %w", err)
+			}
+		}
+	}
+
+	// Group pages by geometry so each distinct page shape gets one layout
+	// (and one shared watermark resource).
+	pagesByGeometry := make(map[pageGeometry]types.IntSet)
+	var geometries []pageGeometry
+	for i := 1; i <= ctx.PageCount; i++ {
+		geom, geomErr := readPageGeometry(ctx, i)
+		if geomErr != nil {
+			return geomErr
+		}
+		if _, ok := pagesByGeometry[geom]; !ok {
+			pagesByGeometry[geom] = types.IntSet{}
+			geometries = append(geometries, geom)
+		}
+		pagesByGeometry[geom][i] = true
+	}
+
+	layouts := make([]watermarkLayout, len(geometries))
+	for i, geom := range geometries {
+		layouts[i] = layoutWatermark(watermarkText, geom.Viewport(), measure)
+	}
+
+	marks := pageMarksFrom(c)
+	stamped := 0
+	if vf != nil {
+		for i, geom := range geometries {
+			if err := stampVectorWatermark(ctx, pagesByGeometry[geom], geom, layouts[i], vf, style, fill, marks); err != nil {
+				return fmt.Errorf("failed to add watermark: %w", err)
+			}
+			stamped += len(pagesByGeometry[geom])
+			if err := pageDone(c, stamped, ctx.PageCount); err != nil {
+				return err
+			}
 		}
 	} else {
-		// Non-ASCII characters present: Use Image Rasterization optimization.
-		// Instead of embedding the full ~14MB (compressed ~1MB) Unicode font,
-		// we render the text to a small transparent PNG on the fly and inject that.
-		// Overhead becomes negligible (< 50KB).
-
-		// 1. Render text to PNG
-		var pngBytes []byte
-		var renderErr error
-		pngBytes, renderErr = renderTextToPNG(watermarkText, fontSize)
-		if renderErr != nil {
-			return fmt.Errorf("failed to render non-ASCII watermark to image: %w", renderErr)
-		}
-
-		// 2. Create temp file for the image
-		tmpFile, tmpErr := os.CreateTemp("", "phantom_wm_*.png")
-		if tmpErr != nil {
-			return fmt.Errorf("failed to create temp image file: %w", tmpErr)
-		}
-		// Scale is 1.0 abs because the image is already created with the correct pixel size for the font size
-		// However, pdfcpu treats image watermark size based on actual image dimensions.
-		// If we rendered at 72 DPI, 1 pixel = 1 point.
-		// So scale:1.0 abs is correct.
-		imgParams := "rot:45, op:0.3, scale:1.0 abs"
-
-		defer func() {
-			tmpFile.Close()
-			os.Remove(tmpFile.Name())
-		}()
-
-		if _, writeErr := tmpFile.Write(pngBytes); writeErr != nil {
-			return fmt.Errorf("failed to write temp image file: %w", writeErr)
-		}
-		// Close explicitly before using in pdfcpu
-		tmpFile.Close()
-
-		// 3. Create Image Watermark configuration
-		wmConf, err = api.ImageWatermark(tmpFile.Name(), imgParams, true, false, types.POINTS)
+		// Build every watermark before touching the context: pdfcpu internalizes
+		// page rotation while stamping, which would change later geometry reads.
+		watermarks := make([]*model.Watermark, len(geometries))
+		for i := range geometries {
+			if isASCII {
+				watermarks[i], err = newTextWatermark(layouts[i], a.Style)
+			} else {
+				watermarks[i], err = newImageWatermark(layouts[i], a.Style)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		// Apply watermarks page group by page group
+		for i, geom := range geometries {
+			var before map[int]int
+			if marks != nil {
+				before = countWatermarks(ctx, pagesByGeometry[geom])
+			}
+			if err := pdfcpu.AddWatermarks(ctx, pagesByGeometry[geom], watermarks[i]); err != nil {
+				return fmt.Errorf("failed to add watermark: %w", err)
+			}
+			if marks != nil {
+				if err := markWatermarks(ctx, pagesByGeometry[geom], before, marks); err != nil {
+					return fmt.Errorf("failed to mark watermark: %w", err)
+				}
+			}
+			stamped += len(pagesByGeometry[geom])
+			if err := pageDone(c, stamped, ctx.PageCount); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// wmArtifact opens the watermark pdfcpu appends to a page's last content stream
+var wmArtifact = []byte("/Artifact <</Subtype /Watermark /Type /Pagination >>BDC")
+
+// lastContentStream returns the xref entry of a page's last content stream
+func lastContentStream(ctx *model.Context, pageNr int) (int, *model.XRefTableEntry) {
+	pageDict, _, _, err := ctx.PageDict(pageNr, false)
+	if err != nil || pageDict == nil {
+		return 0, nil
+	}
+	o, found := pageDict.Find("Contents")
+	if !found {
+		return 0, nil
+	}
+	if arr, err := ctx.DereferenceArray(o); err == nil && len(arr) > 0 {
+		o = arr[len(arr)-1]
+	}
+	ref, ok := o.(types.IndirectRef)
+	if !ok {
+		return 0, nil
+	}
+	entry, ok := ctx.FindTableEntryForIndRef(&ref)
+	if !ok || entry == nil {
+		return 0, nil
+	}
+	if _, ok := entry.Object.(types.StreamDict); !ok {
+		return 0, nil
+	}
+	return ref.ObjectNumber.Value(), entry
+}
+
+// countWatermarks counts the watermark artifacts in the last content stream of
+// each page, keyed by stream object number
+func countWatermarks(ctx *model.Context, pages types.IntSet) map[int]int {
+	counts := make(map[int]int)
+	for pageNr, ok := range pages {
+		if !ok {
+			continue
+		}
+		objNr, entry := lastContentStream(ctx, pageNr)
+		if entry == nil {
+			continue
+		}
+		sd := entry.Object.(types.StreamDict)
+		if err := sd.Decode(); err != nil {
+			continue
+		}
+		counts[objNr] = bytes.Count(sd.Content, wmArtifact)
+	}
+	return counts
+}
+
+// markWatermarks wraps the watermark pdfcpu just appended to each page's last
+// content stream in a page mark. A stream counts as stamped only when it holds
+// one more artifact than before, so watermarks already in the source stay content.
+func markWatermarks(ctx *model.Context, pages types.IntSet, before map[int]int, marks *pageMarks) error {
+	done := make(map[int]bool)
+	for pageNr, ok := range pages {
+		if !ok {
+			continue
+		}
+		objNr, entry := lastContentStream(ctx, pageNr)
+		if entry == nil || done[objNr] {
+			continue
+		}
+		done[objNr] = true
+		sd := entry.Object.(types.StreamDict)
+		if err := sd.Decode(); err != nil {
+			continue
+		}
+		if bytes.Count(sd.Content, wmArtifact) != before[objNr]+1 {
+			continue
+		}
+		at := bytes.LastIndex(sd.Content, wmArtifact)
+		sd.Content = append(append([]byte{}, sd.Content[:at]...), marks.wrap(sd.Content[at:])...)
+		if err := sd.Encode(); err != nil {
+			return fmt.Errorf("page %d: %w", pageNr, err)
+		}
+		entry.Object = sd
+	}
+	return nil
+}
+
+// Visual overhead estimates: the shared stamp objects per distinct page geometry
+// (a Form XObject for Helvetica, a content stream for the vector font), the
+// per-page resource and content entries, and the Type0 font dictionaries
+// around the embedded subset.
+const (
+	visualGeometryOverhead = 700
+	visualPageOverhead     = 200
+	visualFontOverhead     = 300
+)
+
+// estimateOverhead returns the size of the stamps plus, for non-ASCII text and
+// PDF/A documents, the compressed font subset
+func (a *VisualAnchor) estimateOverhead(ctx *model.Context, _ int, message string) int {
+	geometries := make(map[pageGeometry]bool)
+	for i := 1; i <= ctx.PageCount; i++ {
+		geom, err := readPageGeometry(ctx, i)
 		if err != nil {
-			return fmt.Errorf("failed to configure image watermark: %w", err)
+			return -1
+		}
+		geometries[geom] = true
+	}
+	size := len(geometries)*(visualGeometryOverhead+len(message)) + ctx.PageCount*visualPageOverhead
+
+	// PDF/A documents always get the font subset
+	pdfa := detectPDFA(ctx) != nil
+	for _, r := range message {
+		if r > 127 || pdfa {
+			subset, err := subsetTTF(goNotoCurrentTTF, []rune(message))
+			if err != nil {
+				return -1
+			}
+			compressed, err := compressFlate(subset.Data)
+			if err != nil {
+				return -1
+			}
+			size += len(compressed) + visualFontOverhead
+			break
 		}
 	}
+	return size
+}
 
+// newTextWatermark configures a Helvetica text watermark for an ASCII layout.
+// "scale:1 abs" makes pdfcpu honour the computed point size instead of rescaling
+// the text relative to the page.
+func newTextWatermark(layout watermarkLayout, style VisualStyle) (*model.Watermark, error) {
+	desc := fmt.Sprintf("font:Helvetica, points:%d, rot:%.1f, op:%g, col:%g %g %g, scale:1 abs, al:c",
+		layout.FontSize, layout.Rotation, style.Opacity, style.Color[0], style.Color[1], style.Color[2])
+	wmConf, err := api.TextWatermark(layout.Text(), desc, true, false, types.POINTS)
 	if err != nil {
-		return fmt.Errorf("failed to configure watermark: %w", err)
+		return nil, fmt.Errorf("failed to configure ASCII watermark: %w", err)
 	}
+	return wmConf, nil
+}
 
-	// Apply watermark to all pages
-	// We use api.AddWatermarksFile which handles reading and writing
-	if err := api.AddWatermarksFile(inputPath, outputPath, nil, wmConf, nil); err != nil {
-		return fmt.Errorf("failed to add watermark: %w", err)
+// newImageWatermark configures a rasterized watermark for a non-ASCII layout.
+// It is the fallback when the vector font cannot be built: the text is rendered
+// to a small transparent PNG on the fly (< 50KB overhead).
+func newImageWatermark(layout watermarkLayout, style VisualStyle) (*model.Watermark, error) {
+	pngBytes, err := renderTextToPNG(layout.Lines, float64(layout.FontSize), style.Color)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render non-ASCII watermark to image: %w", err)
 	}
 
-	return nil
+	// The image is rendered at 72 DPI, so 1 pixel = 1 point and scale:1.0 abs
+	// reproduces the computed font size exactly.
+	imgParams := fmt.Sprintf("rot:%.1f, op:%g, scale:1.0 abs", layout.Rotation, style.Opacity)
+	wmConf, err := api.ImageWatermarkForReader(bytes.NewReader(pngBytes), imgParams, true, false, types.POINTS)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure image watermark: %w", err)
+	}
+	return wmConf, nil
 }
 
 // Extract for VisualAnchor is a no-op or requires OCR (which we don't do).
@@ -144,3 +394,8 @@ func (a *VisualAnchor) Extract(filePath string) ([]byte, error) {
 	// We don't implement extraction here as it's not a hidden channel.
 	return nil, fmt.Errorf("visual watermark extraction not supported")
 }
+
+// ExtractReader is not supported either, see Extract
+func (a *VisualAnchor) ExtractReader(c context.Context, r io.ReadSeeker) ([]byte, error) {
+	return nil, fmt.Errorf("visual watermark extraction not supported")
+}
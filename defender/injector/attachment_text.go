@@ -0,0 +1,133 @@
+package injector
+
+import (
+	_ "embed"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// The Attachment anchor's file reads as the license of the embedded font. The
+// payload hides in trailing whitespace: after each line of the license, a
+// space is a 0 bit and a tab a 1 bit, which no viewer shows and which keeps
+// the file plain ASCII text of ordinary entropy. No line ends in more than
+// maxTrailingWhitespace of them: longer payloads repeat the license, as
+// bundles of several fonts do, until the lines hold every bit.
+
+//go:embed font_license.txt
+var fontLicenseText string
+
+// attachDesc is the description viewers show for the attachment
+const attachDesc = "SIL Open Font License 1.1"
+
+// attachMIMEType is the attachment's /Subtype
+const attachMIMEType = "text/plain"
+
+// maxTrailingWhitespace is the most whitespace one line of the license ends in
+const maxTrailingWhitespace = 16
+
+var errNoTextPayload = errors.New("no payload in the license text")
+
+// licenseLines returns the lines of the license text without their newlines
+func licenseLines() []string {
+	return strings.Split(strings.TrimSuffix(fontLicenseText, "\n"), "\n")
+}
+
+// carrierLines returns the lines of as few copies of the license, separated
+// by a blank line, as carry bits with at most maxTrailingWhitespace per line
+func carrierLines(bits int) []string {
+	license := licenseLines()
+	need := (bits + maxTrailingWhitespace - 1) / maxTrailingWhitespace
+	copies := max(1, (need+len(license))/(len(license)+1))
+	lines := make([]string, 0, copies*(len(license)+1))
+	for i := 0; i < copies; i++ {
+		if i > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, license...)
+	}
+	return lines
+}
+
+// encodeLicense returns the license text carrying payload: a 16-bit length
+// and the payload, spread evenly over the trailing whitespace of all lines of
+// as few copies of the license as hold it
+func encodeLicense(payload []byte) ([]byte, error) {
+	if len(payload) > 0xFFFF {
+		return nil, errors.New("payload too large for the license text")
+	}
+	frame := binary.BigEndian.AppendUint16(nil, uint16(len(payload)))
+	frame = append(frame, payload...)
+
+	bits := len(frame) * 8
+	lines := carrierLines(bits)
+	perLine := (bits + len(lines) - 1) / len(lines)
+
+	var b strings.Builder
+	b.Grow(len(fontLicenseText) + bits)
+	next := 0
+	for _, line := range lines {
+		b.WriteString(line)
+		for i := 0; i < perLine && next < bits; i, next = i+1, next+1 {
+			if frame[next/8]>>(7-next%8)&1 == 1 {
+				b.WriteByte('\t')
+			} else {
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteByte('\n')
+	}
+	return []byte(b.String()), nil
+}
+
+// decodeLicense reads the payload written by encodeLicense
+func decodeLicense(text []byte) ([]byte, error) {
+	var frame []byte
+	n := 0
+	for _, line := range strings.Split(string(text), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		trimmed := strings.TrimRight(line, " \t")
+		for _, c := range line[len(trimmed):] {
+			if n%8 == 0 {
+				frame = append(frame, 0)
+			}
+			if c == '\t' {
+				frame[n/8] |= 1 << (7 - n%8)
+			}
+			n++
+		}
+	}
+	if n < 16 {
+		return nil, errNoTextPayload
+	}
+	size := int(binary.BigEndian.Uint16(frame))
+	if size == 0 || n < (2+size)*8 {
+		return nil, errNoTextPayload
+	}
+	return frame[2 : 2+size], nil
+}
+
+// attachmentDate returns when the license was bundled: the document's
+// creation date if it has one, so the attachment is as old as the document
+func attachmentDate(ctx *model.Context, fallback time.Time) time.Time {
+	if ctx.Info == nil {
+		return fallback
+	}
+	info, err := ctx.DereferenceDict(*ctx.Info)
+	if err != nil || info == nil {
+		return fallback
+	}
+	s, err := ctx.DereferenceStringOrHexLiteral(info["CreationDate"], model.V10, nil)
+	if err != nil || s == "" {
+		return fallback
+	}
+	t, ok := types.DateTime(s, true)
+	if !ok || t.After(fallback) {
+		return fallback
+	}
+	return t
+}
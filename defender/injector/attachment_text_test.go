@@ -0,0 +1,152 @@
+package injector
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// TestLicenseRoundTrip tests that payloads of any size survive in the license
+// text, which still reads as copies of the license
+func TestLicenseRoundTrip(t *testing.T) {
+	for _, n := range []int{1, 44, 300, 4096, 0xFFFF} {
+		payload := make([]byte, n)
+		for i := range payload {
+			payload[i] = byte(i*151 + 7)
+		}
+		text, err := encodeLicense(payload)
+		if err != nil {
+			t.Fatalf("encodeLicense(%d bytes): %v", n, err)
+		}
+		got, err := decodeLicense(text)
+		if err != nil || !bytes.Equal(got, payload) {
+			t.Errorf("%d bytes: round trip failed: %v", n, err)
+		}
+
+		var visible []string
+		for _, line := range strings.Split(string(text), "\n") {
+			visible = append(visible, strings.TrimRight(line, " \t"))
+		}
+		copies := strings.Count(strings.Join(visible, "\n"), fontLicenseText)
+		if copies == 0 || strings.Join(visible, "\n") != strings.Repeat(fontLicenseText+"\n", copies-1)+fontLicenseText {
+			t.Errorf("%d bytes: visible text is not copies of the license", n)
+		}
+		if run := maxTrailingRun(text); run > maxTrailingWhitespace {
+			t.Errorf("%d bytes: a line ends in %d whitespace characters", n, run)
+		}
+		for _, c := range text {
+			if c > 0x7E || (c < 0x20 && c != '\n' && c != '\t') {
+				t.Fatalf("%d bytes: non-text byte %#x", n, c)
+			}
+		}
+		if e := textEntropy(text); e > 5.5 {
+			t.Errorf("%d bytes: entropy %.2f bits per byte", n, e)
+		}
+	}
+
+	if _, err := encodeLicense(make([]byte, 0x10000)); err == nil {
+		t.Error("Expected a 64 KiB payload to be refused")
+	}
+}
+
+// maxTrailingRun returns the longest trailing whitespace of a line in text
+func maxTrailingRun(text []byte) int {
+	longest := 0
+	for _, line := range strings.Split(string(text), "\n") {
+		longest = max(longest, len(line)-len(strings.TrimRight(line, " \t")))
+	}
+	return longest
+}
+
+// TestLicenseMultiPagePayload tests the whitespace carrying the payload of a
+// long tamper-evident document
+func TestLicenseMultiPagePayload(t *testing.T) {
+	cm, err := NewCryptoManager([]byte(testKey32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pages := range []int{10, 300, maxDigestPages} {
+		payload, err := cm.seal(sealPageDigests("UserID:1", make([]pageDigest, pages)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		text, err := encodeLicense(payload)
+		if err != nil {
+			t.Fatalf("%d pages: %v", pages, err)
+		}
+		if run := maxTrailingRun(text); run > maxTrailingWhitespace {
+			t.Errorf("%d pages: a line ends in %d whitespace characters", pages, run)
+		}
+		if got, err := decodeLicense(text); err != nil || !bytes.Equal(got, payload) {
+			t.Errorf("%d pages: round trip failed: %v", pages, err)
+		}
+	}
+}
+
+// TestDecodeLicense tests line ending conversion and stripped whitespace
+func TestDecodeLicense(t *testing.T) {
+	payload := []byte("payload")
+	text, err := encodeLicense(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crlf := bytes.ReplaceAll(text, []byte("\n"), []byte("\r\n"))
+	if got, err := decodeLicense(crlf); err != nil || !bytes.Equal(got, payload) {
+		t.Errorf("CRLF line endings: %q, %v", got, err)
+	}
+	if _, err := decodeLicense([]byte(fontLicenseText)); !errors.Is(err, errNoTextPayload) {
+		t.Errorf("Plain license: %v", err)
+	}
+	if _, err := decodeLicense(text[:len(text)/3]); !errors.Is(err, errNoTextPayload) {
+		t.Errorf("Truncated text: %v", err)
+	}
+}
+
+// TestAttachmentDate tests that the attachment takes the document's creation date
+func TestAttachmentDate(t *testing.T) {
+	ctx, err := pdfcpu.CreateContextWithXRefTable(nil, types.PaperSize["A4"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	if got := attachmentDate(ctx, now); !got.Equal(now) {
+		t.Errorf("No document information: %v", got)
+	}
+
+	created := time.Date(2024, 5, 1, 8, 30, 0, 0, time.UTC)
+	info := types.Dict{"CreationDate": types.StringLiteral(types.DateString(created))}
+	ref, err := ctx.IndRefForNewObject(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx.Info = ref
+	if got := attachmentDate(ctx, now); !got.Equal(created) {
+		t.Errorf("Creation date: got %v, want %v", got, created)
+	}
+	// A creation date after signing is not believable
+	if got := attachmentDate(ctx, created.Add(-time.Hour)); !got.Equal(created.Add(-time.Hour)) {
+		t.Errorf("Future creation date: %v", got)
+	}
+}
+
+// textEntropy returns the Shannon entropy of data in bits per byte
+func textEntropy(data []byte) float64 {
+	var freq [256]int
+	for _, b := range data {
+		freq[b]++
+	}
+	var e float64
+	for _, c := range freq {
+		if c > 0 {
+			p := float64(c) / float64(len(data))
+			e -= p * math.Log2(p)
+		}
+	}
+	return e
+}
@@ -0,0 +1,199 @@
+package injector
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// Full-rewrite copies are written out a final time in a canonical form.
+// pdfcpu's writer emits objects in map iteration order, merges duplicates
+// differently from run to run and stamps the document information and file ID
+// with the current time, so two rewrites of the same content never match.
+// The canonical form depends only on the objects, the dates and the file ID
+// key, which is what lets SignOptions.DeterministicSeed reproduce a copy byte
+// for byte: a seeded copy goes through the same writer as any other and only
+// its nonce, dates and file ID are fixed.
+
+// deterministicTime stands in for the current time when signing deterministically
+var deterministicTime = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// fileStamp is what varies between two copies of the same content: the time
+// written into the document information and the key the file ID is derived from
+type fileStamp struct {
+	now   time.Time
+	idKey []byte
+}
+
+// newFileStamp returns the current time and a random file ID key, or the fixed
+// time and the seed when signing deterministically
+func newFileStamp(seed []byte) (fileStamp, error) {
+	if seed != nil {
+		return fileStamp{now: deterministicTime, idKey: seed}, nil
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{now: time.Now(), idKey: key}, nil
+}
+
+// canonicalize rewrites signed so that it depends only on its content and the
+// stamp: the objects are renumbered in the order they are reached from the
+// catalog and written with a cross-reference table, the file ID is derived
+// from the stamp's key and the objects, and the dates pdfcpu stamped are
+// replaced: the creation date is taken from src, the modification date is the
+// stamp's time. keepInfo leaves the document information as it is (PDF/A
+// copies, whose information already matches their XMP metadata).
+func canonicalize(signed, src []byte, stamp fileStamp, keepInfo bool) ([]byte, error) {
+	ctx, err := readPDF(signed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signed copy: %w", err)
+	}
+	sourceCtx, err := readPDF(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read context: %w", err)
+	}
+
+	if ctx.Info != nil && !keepInfo {
+		info, err := ctx.DereferenceDict(*ctx.Info)
+		if err != nil {
+			return nil, err
+		}
+		var sourceInfo types.Dict
+		if sourceCtx.Info != nil {
+			if sourceInfo, err = sourceCtx.DereferenceDict(*sourceCtx.Info); err != nil {
+				return nil, err
+			}
+		}
+		now := types.Object(types.StringLiteral(types.DateString(stamp.now)))
+		created := now
+		if v, ok := sourceInfo.Find("CreationDate"); ok {
+			if created, err = sourceCtx.Dereference(v); err != nil {
+				return nil, err
+			}
+		}
+		if info != nil {
+			info["CreationDate"] = created
+			info["ModDate"] = now
+		}
+	}
+
+	// Objects are numbered in the order they are reached from the catalog,
+	// which also drops the duplicates pdfcpu leaves behind when it merges them
+	r := &renumbering{nrs: make(map[int]int)}
+	root := r.ref(*ctx.Root)
+	var info types.Object
+	if ctx.Info != nil {
+		info = r.ref(*ctx.Info)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%%PDF-%s\n%%\xe2\xe3\xcf\xd3\n", ctx.HeaderVersion.String())
+	offsets := []int{0}
+	for i := 0; i < len(r.order); i++ {
+		objNr := r.order[i]
+		o, err := ctx.Dereference(*types.NewIndirectRef(objNr, 0))
+		if err != nil {
+			return nil, fmt.Errorf("object %d: %w", objNr, err)
+		}
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n", i+1)
+		switch o := o.(type) {
+		case types.StreamDict:
+			if o.Raw == nil {
+				if err := o.Encode(); err != nil {
+					return nil, fmt.Errorf("object %d: %w", objNr, err)
+				}
+			}
+			d := o.Dict.Clone().(types.Dict)
+			delete(d, "Length")
+			d = r.rewrite(d).(types.Dict)
+			d["Length"] = types.Integer(len(o.Raw))
+			fmt.Fprintf(&buf, "%s\nstream\n", d.PDFString())
+			buf.Write(o.Raw)
+			buf.WriteString("\nendstream")
+		case nil:
+			buf.WriteString("null")
+		default:
+			buf.WriteString(r.rewrite(o).PDFString())
+		}
+		buf.WriteString("\nendobj\n")
+	}
+
+	// The file ID depends on the stamp and everything written so far
+	mac := hmac.New(sha256.New, stamp.idKey)
+	mac.Write(buf.Bytes())
+	id := types.Object(types.HexLiteral(fmt.Sprintf("%X", mac.Sum(nil)[:16])))
+	firstID := id
+	if len(sourceCtx.ID) == 2 {
+		firstID = sourceCtx.ID[0]
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f\r\n", len(offsets))
+	for _, offset := range offsets[1:] {
+		fmt.Fprintf(&buf, "%010d 00000 n\r\n", offset)
+	}
+	trailer := types.Dict{
+		"Size": types.Integer(len(offsets)),
+		"Root": root,
+		"ID":   types.Array{firstID, id},
+	}
+	if info != nil {
+		trailer["Info"] = info
+	}
+	fmt.Fprintf(&buf, "trailer\n%s\nstartxref\n%d\n%%%%EOF\n", trailer.PDFString(), xref)
+	return buf.Bytes(), nil
+}
+
+// renumbering assigns new object numbers in the order objects are referenced
+type renumbering struct {
+	nrs   map[int]int
+	order []int
+}
+
+// ref returns the renumbered reference to the object ir refers to
+func (r *renumbering) ref(ir types.IndirectRef) types.IndirectRef {
+	objNr := ir.ObjectNumber.Value()
+	nr, ok := r.nrs[objNr]
+	if !ok {
+		r.order = append(r.order, objNr)
+		nr = len(r.order)
+		r.nrs[objNr] = nr
+	}
+	return *types.NewIndirectRef(nr, 0)
+}
+
+// rewrite returns a copy of o referring to the renumbered objects. Dictionary
+// entries are visited in key order so the numbering does not depend on map order.
+func (r *renumbering) rewrite(o types.Object) types.Object {
+	switch o := o.(type) {
+	case types.IndirectRef:
+		return r.ref(o)
+	case types.Dict:
+		keys := make([]string, 0, len(o))
+		for k := range o {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		d := types.NewDict()
+		for _, k := range keys {
+			d[k] = r.rewrite(o[k])
+		}
+		return d
+	case types.Array:
+		a := make(types.Array, len(o))
+		for i, v := range o {
+			a[i] = r.rewrite(v)
+		}
+		return a
+	}
+	return o
+}
@@ -100,7 +100,7 @@ func TestComprehensiveDefenseStrategy(t *testing.T) {
 	for _, tt := range scenarios {
 		t.Run(tt.name, func(t *testing.T) {
 			// 1. Sign
-			err := Sign(testPDFPath, testMessage, testKey, tt.signAnchors)
+			_, err := Sign(testPDFPath, testMessage, testKey, tt.signAnchors)
 			if err != nil {
 				// If SMask fails due to no images, skip if that was the only one
 				if len(tt.signAnchors) == 1 && tt.signAnchors[0] == "SMask" && err.Error() == "no images found in PDF (SMask anchor requires at least one image)" {
@@ -211,7 +211,7 @@ func TestNegativeScenarios(t *testing.T) {
 
 	// 1. Sign with Key A, Verify with Key B
 	t.Run("Wrong Key", func(t *testing.T) {
-		err := Sign(testPDFPath, testMessage, testKey, nil)
+		_, err := Sign(testPDFPath, testMessage, testKey, nil)
 		if err != nil {
 			t.Fatalf("Sign failed: %v", err)
 		}
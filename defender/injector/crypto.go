@@ -3,7 +3,10 @@ package injector
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 )
@@ -11,6 +14,8 @@ import (
 // CryptoManager handles encryption and decryption operations
 type CryptoManager struct {
 	key []byte
+	// nonceSeed derives nonces from the plaintext instead of crypto/rand (deterministic signing)
+	nonceSeed []byte
 }
 
 // NewCryptoManager creates a new crypto manager with the given key
@@ -21,9 +26,21 @@ func NewCryptoManager(key []byte) (*CryptoManager, error) {
 	return &CryptoManager{key: key}, nil
 }
 
+// KeyID returns a short, non-reversible identifier for a key, suitable for
+// recording which key signed a copy without storing the key itself.
+func KeyID(key []byte) string {
+	sum := sha256.Sum256(append([]byte("defender-key-id:"), key...))
+	return hex.EncodeToString(sum[:8])
+}
+
 // Encrypt encrypts a message and returns the encrypted payload
 // Payload format: magic header + nonce + encrypted message
 func (c *CryptoManager) Encrypt(message string) ([]byte, error) {
+	return c.seal([]byte(message))
+}
+
+// seal encrypts a plaintext into a payload
+func (c *CryptoManager) seal(plaintext []byte) ([]byte, error) {
 	block, err := aes.NewCipher(c.key)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create cipher: %w", err)
@@ -35,11 +52,17 @@ func (c *CryptoManager) Encrypt(message string) ([]byte, error) {
 	}
 
 	nonce := make([]byte, nonceSize)
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+	if c.nonceSeed != nil {
+		// The same plaintext gets the same nonce, so the nonce is never reused
+		// for a different message
+		mac := hmac.New(sha256.New, c.nonceSeed)
+		mac.Write(plaintext)
+		copy(nonce, mac.Sum(nil))
+	} else if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
 		return nil, fmt.Errorf("failed to generate nonce: %w", err)
 	}
 
-	encryptedMessage := gcm.Seal(nil, nonce, []byte(message), nil)
+	encryptedMessage := gcm.Seal(nil, nonce, plaintext, nil)
 
 	// Build payload: magic header + nonce + encrypted message
 	payload := make([]byte, 0, len(magicHeader)+len(nonce)+len(encryptedMessage))
@@ -50,18 +73,29 @@ func (c *CryptoManager) Encrypt(message string) ([]byte, error) {
 	return payload, nil
 }
 
-// Decrypt decrypts a payload and returns the original message
+// Decrypt decrypts a payload and returns the original message. Page digests
+// recorded for tamper evidence are not part of the message.
 func (c *CryptoManager) Decrypt(payload []byte) (string, error) {
+	plaintext, err := c.open(payload)
+	if err != nil {
+		return "", err
+	}
+	message, _ := splitPageDigests(plaintext)
+	return message, nil
+}
+
+// open decrypts a payload into its plaintext
+func (c *CryptoManager) open(payload []byte) ([]byte, error) {
 	// Validate payload structure
 	minSize := len(magicHeader) + nonceSize
 	if len(payload) < minSize {
-		return "", ErrShortPayload
+		return nil, ErrShortPayload
 	}
 
 	// Verify magic header
 	for i := range magicHeader {
 		if payload[i] != magicHeader[i] {
-			return "", ErrMagicHeaderMismatch
+			return nil, ErrMagicHeaderMismatch
 		}
 	}
 
@@ -72,18 +106,18 @@ func (c *CryptoManager) Decrypt(payload []byte) (string, error) {
 	// Decrypt
 	block, err := aes.NewCipher(c.key)
 	if err != nil {
-		return "", fmt.Errorf("failed to create cipher: %w", err)
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
 	}
 
 	gcm, err := cipher.NewGCM(block)
 	if err != nil {
-		return "", fmt.Errorf("failed to create GCM: %w", err)
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
 	}
 
 	decrypted, err := gcm.Open(nil, nonce, encryptedMessage, nil)
 	if err != nil {
-		return "", fmt.Errorf("decryption failed (wrong key or corrupted data): %w", err)
+		return nil, fmt.Errorf("decryption failed (wrong key or corrupted data): %w", err)
 	}
 
-	return string(decrypted), nil
+	return decrypted, nil
 }
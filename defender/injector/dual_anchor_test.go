@@ -45,7 +45,7 @@ func TestWatermarkDualAnchorSign(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// Test signing
-			err := Sign(testPDFPath, tt.message, tt.key, nil)
+			_, err := Sign(testPDFPath, tt.message, tt.key, nil)
 
 			if tt.expectError {
 				if err == nil {
@@ -81,7 +81,7 @@ func TestWatermarkDualAnchorVerify(t *testing.T) {
 	testMessage := "WatermarkDualAnchor:Verify-Test"
 
 	// Create signed PDF
-	err := Sign(testPDFPath, testMessage, testKey32, nil)
+	_, err := Sign(testPDFPath, testMessage, testKey32, nil)
 	if err != nil {
 		t.Fatalf("Failed to create test signed PDF: %v", err)
 	}
@@ -140,7 +140,7 @@ func TestWatermarkDualAnchorSMaskAnchorFallback(t *testing.T) {
 	testMessage := "WatermarkDualAnchor:SMask-Fallback-Test"
 
 	// Create signed PDF
-	err := Sign(testPDFPath, testMessage, testKey32, nil)
+	_, err := Sign(testPDFPath, testMessage, testKey32, nil)
 	if err != nil {
 		t.Fatalf("Failed to create test signed PDF: %v", err)
 	}
@@ -178,7 +178,7 @@ func TestWatermarkDualAnchorAttachmentAnchorOnly(t *testing.T) {
 	testMessage := "WatermarkDualAnchor:Attachment-Only-Test"
 
 	// Create signed PDF
-	err := Sign(testPDFPath, testMessage, testKey32, nil)
+	_, err := Sign(testPDFPath, testMessage, testKey32, nil)
 	if err != nil {
 		t.Fatalf("Failed to create test signed PDF: %v", err)
 	}
@@ -260,7 +260,7 @@ func TestWatermarkDualAnchorFileSizeImpact(t *testing.T) {
 
 	// Create signed PDF with lightweight anchors (Attachment + Content)
 	// to test reasonable file size impact
-	err = Sign(testPDFPath, "WatermarkDualAnchor:Size-Test", testKey32, []string{"Attachment", "Content"})
+	_, err = Sign(testPDFPath, "WatermarkDualAnchor:Size-Test", testKey32, []string{"Attachment", "Content"})
 	if err != nil {
 		t.Fatalf("Failed to sign PDF: %v", err)
 	}
@@ -301,7 +301,7 @@ func BenchmarkWatermarkDualAnchorSign(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		err := Sign(testPDFPath, testMessage, testKey32, nil)
+		_, err := Sign(testPDFPath, testMessage, testKey32, nil)
 		if err != nil {
 			b.Fatalf("Sign failed: %v", err)
 		}
@@ -322,7 +322,7 @@ func BenchmarkWatermarkDualAnchorVerify(b *testing.B) {
 	testMessage := "WatermarkDualAnchor:Benchmark-Verify-Test"
 
 	// Create signed PDF once
-	err := Sign(testPDFPath, testMessage, testKey32, nil)
+	_, err := Sign(testPDFPath, testMessage, testKey32, nil)
 	if err != nil {
 		b.Fatalf("Failed to create test signed PDF: %v", err)
 	}
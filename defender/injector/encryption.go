@@ -0,0 +1,129 @@
+package injector
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/validate"
+)
+
+// ErrWrongPassword indicates an encrypted PDF could not be opened with the given passwords
+var ErrWrongPassword = errors.New("encrypted PDF: wrong or missing password")
+
+// Encrypted sources are signed on a decrypted copy in memory: the anchors work on plain
+// PDFs and never see the passwords. The signed copy is then encrypted again
+// with the source's own encryption dictionary and file key, so the algorithm,
+// key length, permission flags and both passwords stay exactly as they were.
+
+// readContextWithPasswords reads and validates a PDF from the start of r,
+// opening it with either password. Parsing stops once c is done.
+func readContextWithPasswords(c context.Context, r io.ReadSeeker, userPW, ownerPW string) (*model.Context, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	conf := model.NewDefaultConfiguration()
+	conf.UserPW, conf.OwnerPW = userPW, ownerPW
+	ctx, err := pdfcpu.ReadWithContext(c, r, conf)
+	if errors.Is(err, pdfcpu.ErrWrongPassword) {
+		return nil, ErrWrongPassword
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := validate.XRefTable(ctx); err != nil {
+		return nil, err
+	}
+	return ctx, nil
+}
+
+// readPDF reads and validates an unencrypted PDF held in memory
+func readPDF(data []byte) (*model.Context, error) {
+	return readContextWithPasswords(context.Background(), bytes.NewReader(data), "", "")
+}
+
+// writePDF writes ctx out and returns the bytes
+func writePDF(ctx *model.Context) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := api.WriteContext(ctx, &buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// sourceEncryption is the encryption of a source PDF, restored on the signed copy
+type sourceEncryption struct {
+	dict                types.Dict
+	enc                 *model.Enc
+	key                 []byte
+	id                  types.Array
+	aes4Strings         bool
+	aes4Streams         bool
+	aes4EmbeddedStreams bool
+}
+
+// decryptSource returns a decrypted copy of src and the encryption to
+// restore. Plain sources are returned as they are, with nil encryption.
+func decryptSource(src []byte, userPW, ownerPW string) ([]byte, *sourceEncryption, error) {
+	ctx, err := readContextWithPasswords(context.Background(), bytes.NewReader(src), userPW, ownerPW)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open source PDF: %w", err)
+	}
+	if ctx.Encrypt == nil || ctx.EncKey == nil {
+		return src, nil, nil
+	}
+
+	dict, err := ctx.EncryptDict()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read encryption dictionary: %w", err)
+	}
+	se := &sourceEncryption{
+		dict:                dict.Clone().(types.Dict),
+		enc:                 ctx.E,
+		key:                 append([]byte(nil), ctx.EncKey...),
+		id:                  ctx.ID.Clone().(types.Array),
+		aes4Strings:         ctx.AES4Strings,
+		aes4Streams:         ctx.AES4Streams,
+		aes4EmbeddedStreams: ctx.AES4EmbeddedStreams,
+	}
+
+	ctx.Cmd = model.DECRYPT
+	decrypted, err := writePDF(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decrypt source PDF: %w", err)
+	}
+	return decrypted, se, nil
+}
+
+// apply returns the signed copy encrypted like the source
+func (se *sourceEncryption) apply(signed []byte) ([]byte, error) {
+	ctx, err := readPDF(signed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signed copy: %w", err)
+	}
+
+	ref, err := ctx.IndRefForNewObject(se.dict.Clone())
+	if err != nil {
+		return nil, fmt.Errorf("failed to add encryption dictionary: %w", err)
+	}
+	ctx.Encrypt = ref
+	ctx.E = se.enc
+	ctx.EncKey = se.key
+	// The file key of older revisions derives from the first ID element
+	ctx.ID = se.id.Clone().(types.Array)
+	ctx.AES4Strings = se.aes4Strings
+	ctx.AES4Streams = se.aes4Streams
+	ctx.AES4EmbeddedStreams = se.aes4EmbeddedStreams
+
+	encrypted, err := writePDF(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt signed copy: %w", err)
+	}
+	return encrypted, nil
+}
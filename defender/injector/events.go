@@ -0,0 +1,160 @@
+package injector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// EventType identifies what an Event reports
+type EventType int
+
+const (
+	// EventAnchorStarted: an anchor starts injecting (Sign) or extracting (Verify)
+	EventAnchorStarted EventType = iota + 1
+	// EventAnchorFinished: the anchor was embedded, or verified the message
+	EventAnchorFinished
+	// EventAnchorFailed: the anchor could not be embedded or verified; Err tells why
+	EventAnchorFailed
+	// EventPageProgress: Page of Pages is done
+	EventPageProgress
+	// EventBytesWritten: the signed copy of Bytes bytes was written out
+	EventBytesWritten
+	// EventNote: an informational message or, with Warning, a warning
+	EventNote
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventAnchorStarted:
+		return "anchor_started"
+	case EventAnchorFinished:
+		return "anchor_finished"
+	case EventAnchorFailed:
+		return "anchor_failed"
+	case EventPageProgress:
+		return "page_progress"
+	case EventBytesWritten:
+		return "bytes_written"
+	case EventNote:
+		return "note"
+	}
+	return fmt.Sprintf("EventType(%d)", int(t))
+}
+
+// Event reports the progress of a Sign or Verify call
+type Event struct {
+	Type EventType
+	// Verify is set for the events of a verification
+	Verify bool
+	// Anchor is the anchor the event concerns. Page progress outside an
+	// anchor comes from digesting the pages for tamper evidence.
+	Anchor string
+	// Index and Total place the anchor in the chain, counting from 1
+	Index, Total int
+	// Page and Pages report EventPageProgress
+	Page, Pages int
+	// Bytes is the size of the signed copy (EventBytesWritten)
+	Bytes int64
+	// Err is why the anchor failed (EventAnchorFailed)
+	Err error
+	// Message is the text of EventNote
+	Message string
+	// Warning marks an EventNote that deserves attention
+	Warning bool
+}
+
+// EventHandler receives the progress events of Sign and Verify. Events are
+// delivered in order on the goroutine making the call, so a slow handler
+// slows the call down.
+type EventHandler interface {
+	HandleEvent(Event)
+}
+
+// EventFunc adapts an ordinary function to EventHandler
+type EventFunc func(Event)
+
+// HandleEvent calls f(e)
+func (f EventFunc) HandleEvent(e Event) {
+	f(e)
+}
+
+// reporter sends the events of one call. It travels in the context.Context
+// passed to the anchors, so they can report page progress.
+type reporter struct {
+	handler EventHandler
+	verify  bool
+	// anchor is the anchor running, named in its page progress
+	anchor string
+}
+
+type reporterKey struct{}
+
+// withEvents returns a context whose calls report to h
+func withEvents(c context.Context, h EventHandler, verify bool) context.Context {
+	if h == nil {
+		return c
+	}
+	return context.WithValue(c, reporterKey{}, &reporter{handler: h, verify: verify})
+}
+
+// reporterFrom returns the reporter of c; a nil reporter discards events
+func reporterFrom(c context.Context) *reporter {
+	r, _ := c.Value(reporterKey{}).(*reporter)
+	return r
+}
+
+func (r *reporter) emit(e Event) {
+	if r == nil {
+		return
+	}
+	e.Verify = r.verify
+	r.handler.HandleEvent(e)
+}
+
+func (r *reporter) started(anchor string, index, total int) {
+	if r != nil {
+		r.anchor = anchor
+	}
+	r.emit(Event{Type: EventAnchorStarted, Anchor: anchor, Index: index, Total: total})
+}
+
+func (r *reporter) finished(anchor string, index, total int) {
+	if r != nil {
+		r.anchor = ""
+	}
+	r.emit(Event{Type: EventAnchorFinished, Anchor: anchor, Index: index, Total: total})
+}
+
+func (r *reporter) failed(anchor string, index, total int, err error) {
+	if r != nil {
+		r.anchor = ""
+	}
+	r.emit(Event{Type: EventAnchorFailed, Anchor: anchor, Index: index, Total: total, Err: err})
+}
+
+func (r *reporter) note(format string, args ...interface{}) {
+	r.emit(Event{Type: EventNote, Message: fmt.Sprintf(format, args...)})
+}
+
+func (r *reporter) warn(format string, args ...interface{}) {
+	r.emit(Event{Type: EventNote, Message: fmt.Sprintf(format, args...), Warning: true})
+}
+
+func (r *reporter) written(n int) {
+	r.emit(Event{Type: EventBytesWritten, Bytes: int64(n)})
+}
+
+// pageDone reports that page of pages is done and returns the context's
+// error once the call is cancelled, so page loops stop there
+func pageDone(c context.Context, page, pages int) error {
+	if r := reporterFrom(c); r != nil {
+		r.emit(Event{Type: EventPageProgress, Anchor: r.anchor, Page: page, Pages: pages})
+	}
+	return c.Err()
+}
+
+// isCancellation reports whether err comes from a cancelled or expired context
+func isCancellation(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
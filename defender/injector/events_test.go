@@ -0,0 +1,149 @@
+package injector
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// recordEvents returns a handler recording events as short strings
+func recordEvents(got *[]string) EventHandler {
+	return EventFunc(func(e Event) {
+		s := e.Type.String()
+		switch e.Type {
+		case EventAnchorStarted, EventAnchorFinished, EventAnchorFailed:
+			s += fmt.Sprintf(" %s %d/%d", e.Anchor, e.Index, e.Total)
+		case EventPageProgress:
+			s += fmt.Sprintf(" %s %d/%d", e.Anchor, e.Page, e.Pages)
+		case EventBytesWritten:
+			s += fmt.Sprintf(" %d", e.Bytes)
+		case EventNote:
+			s += " " + e.Message
+		}
+		if e.Verify {
+			s = "verify " + s
+		}
+		*got = append(*got, s)
+	})
+}
+
+// generatedPDF returns a PDF without pages, which only the attachment can sign
+func generatedPDF(t *testing.T) []byte {
+	ctx, err := pdfcpu.CreateContextWithXRefTable(nil, types.PaperSize["A4"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := writePDF(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return src
+}
+
+// TestSignEvents tests the events of signing and verifying in memory
+func TestSignEvents(t *testing.T) {
+	src := generatedPDF(t)
+
+	var got []string
+	var signed bytes.Buffer
+	opts := SignOptions{Anchors: []string{"Attachment"}, Events: recordEvents(&got)}
+	if _, err := SignReader(context.Background(), bytes.NewReader(src), &signed, testMessage, testKey32, opts); err != nil {
+		t.Fatalf("SignReader failed: %v", err)
+	}
+	want := []string{
+		"anchor_started Attachment 1/1",
+		"anchor_finished Attachment 1/1",
+		"note Signature mode: 1-anchor strategy (Attachment)",
+		fmt.Sprintf("bytes_written %d", signed.Len()),
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Sign events:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	got = nil
+	vopts := VerifyOptions{Anchors: []string{"Content", "Attachment"}, Events: recordEvents(&got)}
+	if _, err := VerifyBytes(context.Background(), signed.Bytes(), testKey32, vopts); err != nil {
+		t.Fatalf("VerifyBytes failed: %v", err)
+	}
+	want = []string{
+		"verify anchor_started Content 1/2",
+		"verify anchor_failed Content 1/2",
+		"verify anchor_started Attachment 2/2",
+		"verify anchor_finished Attachment 2/2",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Verify events:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// Without a handler nothing is reported, and signing still works
+	if _, _, err := SignBytes(context.Background(), src, testMessage, testKey32, SignOptions{Anchors: []string{"Attachment"}}); err != nil {
+		t.Errorf("SignBytes without events failed: %v", err)
+	}
+}
+
+// TestSignCancelled tests that a cancelled call stops with the context's error
+// and writes nothing
+func TestSignCancelled(t *testing.T) {
+	src := generatedPDF(t)
+	c, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var out bytes.Buffer
+	_, err := SignReader(c, bytes.NewReader(src), &out, testMessage, testKey32, SignOptions{Anchors: []string{"Attachment"}})
+	if !errors.Is(err, context.Canceled) || out.Len() != 0 {
+		t.Errorf("SignReader = %v, wrote %d bytes", err, out.Len())
+	}
+
+	signed, _, err := SignBytes(context.Background(), src, testMessage, testKey32, SignOptions{Anchors: []string{"Attachment"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyBytes(c, signed, testKey32, VerifyOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("VerifyBytes = %v, want context.Canceled", err)
+	}
+	if _, err := NewAttachmentAnchor().ExtractReader(c, bytes.NewReader(signed)); !errors.Is(err, context.Canceled) {
+		t.Errorf("ExtractReader = %v, want context.Canceled", err)
+	}
+
+	// An expired deadline is reported as such
+	expired, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	if _, _, err := SignBytes(expired, src, testMessage, testKey32, SignOptions{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("SignBytes = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+// TestPageDone tests that page progress names the running anchor and stops
+// page loops once the call is cancelled
+func TestPageDone(t *testing.T) {
+	var got []string
+	c, cancel := context.WithCancel(withEvents(context.Background(), recordEvents(&got), false))
+	r := reporterFrom(c)
+
+	if err := pageDone(c, 1, 3); err != nil {
+		t.Fatal(err)
+	}
+	r.started("Content", 2, 3)
+	if err := pageDone(c, 2, 3); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if err := pageDone(c, 3, 3); !errors.Is(err, context.Canceled) {
+		t.Errorf("pageDone after cancel = %v", err)
+	}
+	want := "page_progress  1/3|anchor_started Content 2/3|page_progress Content 2/3|page_progress Content 3/3"
+	if strings.Join(got, "|") != want {
+		t.Errorf("events = %s", strings.Join(got, "|"))
+	}
+
+	// Without a reporter pageDone only checks for cancellation
+	if err := pageDone(context.Background(), 1, 1); err != nil {
+		t.Error(err)
+	}
+}
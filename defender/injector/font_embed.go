@@ -8,23 +8,29 @@ import (
 	"github.com/pdfcpu/pdfcpu/pkg/api"
 )
 
-//go:embed assets/GoNotoCurrent-Regular.ttf
-var goNotoCurrentTTF []byte
-
-// InstallEmbeddedUnicodeFont installs the embedded pan-Unicode font into pdfcpu's user font registry.
-// It writes the embedded TTF to a temporary location and calls api.InstallFonts.
+// goNotoCurrentTTF is the embedded pan-Unicode font used for non-ASCII Visual watermarks.
 //
 // IMPORTANT NOTES:
 //  1. The font file "GoNotoCurrent-Regular.ttf" is from Go Noto Universal project (v7.0)
 //     Source: https://github.com/satbyy/go-noto-universal
-//  2. After installation, pdfcpu registers the font with name: "GoNotoCurrent-Regular-Regular"
-//     (The double "Regular" comes from TTF internal metadata, see anchor_visual.go for details)
-//  3. This font supports the entire Unicode BMP + supplementary planes, covering:
+//  2. This font supports the entire Unicode BMP + supplementary planes, covering:
 //     - CJK (Chinese, Japanese, Korean)
 //     - Arabic, Cyrillic, Hebrew, Thai, etc.
 //     - Emoji and symbols
-//  4. Font size: ~14MB embedded in binary
-//  5. Installation happens once per program run (protected by fontMutex in anchor_visual.go)
+//  3. Font size: ~14MB embedded in binary
+//  4. The font is never installed into pdfcpu's user font registry (process-global
+//     state shared by concurrent signs). It is parsed once in memory and either
+//     subset into each PDF (vector_renderer.go) or rasterized (image_renderer.go).
+//
+//go:embed assets/GoNotoCurrent-Regular.ttf
+var goNotoCurrentTTF []byte
+
+// InstallEmbeddedUnicodeFont installs the embedded pan-Unicode font into pdfcpu's
+// user font registry, where pdfcpu registers it as "GoNotoCurrent-Regular-Regular".
+//
+// Deprecated: the Visual anchor no longer uses the registry, which is
+// process-global state shared by concurrent signs. Kept for callers that draw
+// with pdfcpu directly.
 func InstallEmbeddedUnicodeFont() error {
 	tmpDir, err := os.MkdirTemp("", "phantom-unicode-font")
 	if err != nil {
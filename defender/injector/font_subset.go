@@ -0,0 +1,552 @@
+package injector
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// TrueType subsetting for the Visual anchor's vector watermark.
+//
+// The subsetter keeps only the glyphs a message actually uses (plus .notdef and
+// any composite-glyph components) and renumbers them densely from 0, so the
+// resulting font is a few KB instead of the ~14MB embedded GoNotoCurrent font.
+// Only the tables a PDF CIDFontType2 needs are emitted:
+// cmap, head, hhea, maxp, hmtx, loca, glyf, post (+ cvt/fpgm/prep for hinting, if present).
+
+var (
+	// ErrFontNotTrueType indicates the font has no glyf/loca outlines (e.g. CFF-based OpenType)
+	ErrFontNotTrueType = errors.New("font is not a TrueType (glyf) font")
+	// ErrFontMalformed indicates a required table is missing or truncated
+	ErrFontMalformed = errors.New("malformed TrueType font")
+)
+
+// Composite glyph component flags (OpenType spec, 'glyf' table)
+const (
+	glyfArg1And2AreWords   = 0x0001
+	glyfWeHaveAScale       = 0x0008
+	glyfMoreComponents     = 0x0020
+	glyfWeHaveAnXAndYScale = 0x0040
+	glyfWeHaveATwoByTwo    = 0x0080
+)
+
+// ttfFont is a parsed TrueType font: its raw tables plus the metrics needed for subsetting
+type ttfFont struct {
+	tables          map[string][]byte
+	unitsPerEm      int
+	numGlyphs       int
+	numberOfHMetric int
+	glyphOffsets    []uint32 // numGlyphs+1 entries into glyf
+	cmap            func(r rune) uint16
+}
+
+// fontSubset is the result of subsetting: the new font program plus the mapping
+// from the message's runes to the new (dense) glyph IDs.
+type fontSubset struct {
+	Data       []byte
+	UnitsPerEm int
+	GIDs       map[rune]uint16 // Rune -> new glyph ID (== CID with Identity mapping)
+	Advances   []int           // Advance width per new glyph ID, in font units
+	BBox       [4]int          // head.xMin, yMin, xMax, yMax in font units
+	Ascent     int             // hhea.ascender in font units
+	Descent    int             // hhea.descender in font units
+}
+
+// parseTTF parses the table directory and the tables needed for subsetting
+func parseTTF(data []byte) (*ttfFont, error) {
+	if len(data) < 12 {
+		return nil, ErrFontMalformed
+	}
+	numTables := int(binary.BigEndian.Uint16(data[4:6]))
+	if len(data) < 12+numTables*16 {
+		return nil, ErrFontMalformed
+	}
+
+	f := &ttfFont{tables: make(map[string][]byte, numTables)}
+	for i := 0; i < numTables; i++ {
+		rec := data[12+i*16 : 12+(i+1)*16]
+		tag := string(rec[0:4])
+		off := binary.BigEndian.Uint32(rec[8:12])
+		length := binary.BigEndian.Uint32(rec[12:16])
+		if uint64(off)+uint64(length) > uint64(len(data)) {
+			return nil, fmt.Errorf("%w: table %q out of bounds", ErrFontMalformed, tag)
+		}
+		f.tables[tag] = data[off : off+length]
+	}
+
+	for _, tag := range []string{"head", "hhea", "maxp", "hmtx", "cmap"} {
+		if _, ok := f.tables[tag]; !ok {
+			return nil, fmt.Errorf("%w: missing %q table", ErrFontMalformed, tag)
+		}
+	}
+	if _, ok := f.tables["glyf"]; !ok {
+		return nil, ErrFontNotTrueType
+	}
+	if _, ok := f.tables["loca"]; !ok {
+		return nil, ErrFontNotTrueType
+	}
+
+	head, hhea, maxp := f.tables["head"], f.tables["hhea"], f.tables["maxp"]
+	if len(head) < 54 || len(hhea) < 36 || len(maxp) < 6 {
+		return nil, ErrFontMalformed
+	}
+	f.unitsPerEm = int(binary.BigEndian.Uint16(head[18:20]))
+	f.numGlyphs = int(binary.BigEndian.Uint16(maxp[4:6]))
+	f.numberOfHMetric = int(binary.BigEndian.Uint16(hhea[34:36]))
+	if f.unitsPerEm == 0 || f.numberOfHMetric == 0 || f.numberOfHMetric > f.numGlyphs ||
+		len(f.tables["hmtx"]) < f.numberOfHMetric*4 {
+		return nil, ErrFontMalformed
+	}
+
+	// loca: short (offset/2, uint16) or long (uint32) depending on head.indexToLocFormat
+	loca := f.tables["loca"]
+	f.glyphOffsets = make([]uint32, f.numGlyphs+1)
+	longLoca := binary.BigEndian.Uint16(head[50:52]) == 1
+	for i := 0; i <= f.numGlyphs; i++ {
+		if longLoca {
+			if len(loca) < (i+1)*4 {
+				return nil, fmt.Errorf("%w: loca truncated", ErrFontMalformed)
+			}
+			f.glyphOffsets[i] = binary.BigEndian.Uint32(loca[i*4:])
+		} else {
+			if len(loca) < (i+1)*2 {
+				return nil, fmt.Errorf("%w: loca truncated", ErrFontMalformed)
+			}
+			f.glyphOffsets[i] = uint32(binary.BigEndian.Uint16(loca[i*2:])) * 2
+		}
+	}
+
+	cmap, err := parseCmap(f.tables["cmap"])
+	if err != nil {
+		return nil, err
+	}
+	f.cmap = cmap
+	return f, nil
+}
+
+// parseCmap returns a rune lookup from the best Unicode subtable (format 12 preferred, then 4)
+func parseCmap(cmap []byte) (func(rune) uint16, error) {
+	if len(cmap) < 4 {
+		return nil, ErrFontMalformed
+	}
+	numSub := int(binary.BigEndian.Uint16(cmap[2:4]))
+	var fmt4, fmt12 []byte
+	for i := 0; i < numSub; i++ {
+		if len(cmap) < 4+(i+1)*8 {
+			return nil, ErrFontMalformed
+		}
+		rec := cmap[4+i*8:]
+		platform := binary.BigEndian.Uint16(rec[0:2])
+		encoding := binary.BigEndian.Uint16(rec[2:4])
+		off := binary.BigEndian.Uint32(rec[4:8])
+		if uint64(off)+4 > uint64(len(cmap)) {
+			continue
+		}
+		// Unicode platform (0) or Windows Unicode BMP (3,1) / full repertoire (3,10)
+		if platform != 0 && !(platform == 3 && (encoding == 1 || encoding == 10)) {
+			continue
+		}
+		sub := cmap[off:]
+		switch binary.BigEndian.Uint16(sub[0:2]) {
+		case 4:
+			fmt4 = sub
+		case 12:
+			fmt12 = sub
+		}
+	}
+
+	if fmt12 != nil && len(fmt12) >= 16 {
+		nGroups := int(binary.BigEndian.Uint32(fmt12[12:16]))
+		if len(fmt12) >= 16+nGroups*12 {
+			groups := fmt12[16 : 16+nGroups*12]
+			return func(r rune) uint16 {
+				lo, hi := 0, nGroups
+				for lo < hi {
+					mid := (lo + hi) / 2
+					g := groups[mid*12:]
+					start, end := binary.BigEndian.Uint32(g[0:4]), binary.BigEndian.Uint32(g[4:8])
+					switch {
+					case uint32(r) < start:
+						hi = mid
+					case uint32(r) > end:
+						lo = mid + 1
+					default:
+						return uint16(binary.BigEndian.Uint32(g[8:12]) + uint32(r) - start)
+					}
+				}
+				return 0
+			}, nil
+		}
+	}
+
+	if fmt4 != nil && len(fmt4) >= 14 {
+		segX2 := int(binary.BigEndian.Uint16(fmt4[6:8]))
+		if len(fmt4) >= 16+segX2*4 {
+			endCodes := fmt4[14:]
+			startCodes := fmt4[16+segX2:]
+			idDeltas := fmt4[16+segX2*2:]
+			idRangeOffsets := fmt4[16+segX2*3:]
+			return func(r rune) uint16 {
+				if r > 0xFFFF {
+					return 0
+				}
+				c := uint16(r)
+				for i := 0; i < segX2; i += 2 {
+					if c > binary.BigEndian.Uint16(endCodes[i:]) {
+						continue
+					}
+					start := binary.BigEndian.Uint16(startCodes[i:])
+					if c < start {
+						return 0
+					}
+					delta := binary.BigEndian.Uint16(idDeltas[i:])
+					ro := int(binary.BigEndian.Uint16(idRangeOffsets[i:]))
+					if ro == 0 {
+						return c + delta
+					}
+					pos := 16 + segX2*3 + i + ro + int(c-start)*2
+					if pos+2 > len(fmt4) {
+						return 0
+					}
+					g := binary.BigEndian.Uint16(fmt4[pos:])
+					if g == 0 {
+						return 0
+					}
+					return g + delta
+				}
+				return 0
+			}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: no usable Unicode cmap subtable", ErrFontMalformed)
+}
+
+// glyph returns the raw glyf data of an original glyph ID
+func (f *ttfFont) glyph(gid int) []byte {
+	if gid < 0 || gid >= f.numGlyphs {
+		return nil
+	}
+	start, end := f.glyphOffsets[gid], f.glyphOffsets[gid+1]
+	glyf := f.tables["glyf"]
+	if start >= end || uint64(end) > uint64(len(glyf)) {
+		return nil
+	}
+	return glyf[start:end]
+}
+
+// advance returns the advance width of an original glyph ID in font units
+func (f *ttfFont) advance(gid int) int {
+	hmtx := f.tables["hmtx"]
+	if gid >= f.numberOfHMetric {
+		gid = f.numberOfHMetric - 1
+	}
+	return int(binary.BigEndian.Uint16(hmtx[gid*4:]))
+}
+
+// lsb returns the left side bearing of an original glyph ID in font units
+func (f *ttfFont) lsb(gid int) int16 {
+	hmtx := f.tables["hmtx"]
+	if gid < f.numberOfHMetric {
+		return int16(binary.BigEndian.Uint16(hmtx[gid*4+2:]))
+	}
+	off := f.numberOfHMetric*4 + (gid-f.numberOfHMetric)*2
+	if off+2 > len(hmtx) {
+		return 0
+	}
+	return int16(binary.BigEndian.Uint16(hmtx[off:]))
+}
+
+// forEachComponent walks the components of a composite glyph, calling fn with the
+// byte offset of each component's glyphIndex field. It returns false if the
+// glyph is not composite or is truncated.
+func forEachComponent(g []byte, fn func(indexOffset int)) bool {
+	if len(g) < 10 || int16(binary.BigEndian.Uint16(g[0:2])) >= 0 {
+		return false
+	}
+	off := 10
+	for {
+		if off+4 > len(g) {
+			return false
+		}
+		flags := binary.BigEndian.Uint16(g[off:])
+		fn(off + 2)
+		off += 4
+		if flags&glyfArg1And2AreWords != 0 {
+			off += 4
+		} else {
+			off += 2
+		}
+		switch {
+		case flags&glyfWeHaveAScale != 0:
+			off += 2
+		case flags&glyfWeHaveAnXAndYScale != 0:
+			off += 4
+		case flags&glyfWeHaveATwoByTwo != 0:
+			off += 8
+		}
+		if flags&glyfMoreComponents == 0 {
+			return true
+		}
+	}
+}
+
+// subsetTTF builds a subset font containing .notdef plus the glyphs for runes.
+// New glyph IDs are assigned in order of first appearance, so identical text
+// always produces byte-identical output.
+func subsetTTF(data []byte, runes []rune) (*fontSubset, error) {
+	f, err := parseTTF(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Collect original glyph IDs: .notdef, each rune's glyph, then composite closure
+	oldToNew := map[int]uint16{0: 0}
+	order := []int{0}
+	add := func(gid int) uint16 {
+		if n, ok := oldToNew[gid]; ok {
+			return n
+		}
+		n := uint16(len(order))
+		oldToNew[gid] = n
+		order = append(order, gid)
+		return n
+	}
+
+	gids := make(map[rune]uint16)
+	for _, r := range runes {
+		if _, ok := gids[r]; ok {
+			continue
+		}
+		gid := int(f.cmap(r))
+		if gid >= f.numGlyphs {
+			gid = 0
+		}
+		gids[r] = add(gid)
+	}
+	for i := 0; i < len(order); i++ { // order grows while we walk it
+		forEachComponent(f.glyph(order[i]), func(indexOffset int) {
+			g := f.glyph(order[i])
+			if comp := int(binary.BigEndian.Uint16(g[indexOffset:])); comp < f.numGlyphs {
+				add(comp)
+			}
+		})
+	}
+	if len(order) > 0xFFFF {
+		return nil, fmt.Errorf("%w: too many glyphs", ErrFontMalformed)
+	}
+
+	// glyf + loca (long format), remapping composite component indices
+	var glyf []byte
+	loca := make([]byte, 0, (len(order)+1)*4)
+	for _, oldGID := range order {
+		loca = binary.BigEndian.AppendUint32(loca, uint32(len(glyf)))
+		g := append([]byte(nil), f.glyph(oldGID)...)
+		forEachComponent(g, func(indexOffset int) {
+			comp := int(binary.BigEndian.Uint16(g[indexOffset:]))
+			binary.BigEndian.PutUint16(g[indexOffset:], oldToNew[comp])
+		})
+		glyf = append(glyf, g...)
+		for len(glyf)%4 != 0 {
+			glyf = append(glyf, 0)
+		}
+	}
+	loca = binary.BigEndian.AppendUint32(loca, uint32(len(glyf)))
+
+	// hmtx with a long metric for every glyph
+	hmtx := make([]byte, 0, len(order)*4)
+	advances := make([]int, len(order))
+	for i, oldGID := range order {
+		advances[i] = f.advance(oldGID)
+		hmtx = binary.BigEndian.AppendUint16(hmtx, uint16(advances[i]))
+		hmtx = binary.BigEndian.AppendUint16(hmtx, uint16(f.lsb(oldGID)))
+	}
+
+	head := append([]byte(nil), f.tables["head"]...)
+	binary.BigEndian.PutUint32(head[8:12], 0) // checkSumAdjustment, fixed up below
+	binary.BigEndian.PutUint16(head[50:52], 1)
+	hhea := append([]byte(nil), f.tables["hhea"]...)
+	binary.BigEndian.PutUint16(hhea[34:36], uint16(len(order)))
+	maxp := append([]byte(nil), f.tables["maxp"]...)
+	binary.BigEndian.PutUint16(maxp[4:6], uint16(len(order)))
+
+	tables := map[string][]byte{
+		"cmap": buildCmap(gids),
+		"glyf": glyf,
+		"head": head,
+		"hhea": hhea,
+		"hmtx": hmtx,
+		"loca": loca,
+		"maxp": maxp,
+	}
+	// post version 3.0: keep italic angle/underline metrics, drop glyph names
+	post := make([]byte, 32)
+	if orig, ok := f.tables["post"]; ok && len(orig) >= 32 {
+		copy(post, orig[:32])
+	}
+	binary.BigEndian.PutUint32(post[0:4], 0x00030000)
+	tables["post"] = post
+
+	for _, tag := range []string{"cvt ", "fpgm", "prep"} {
+		if t, ok := f.tables[tag]; ok {
+			tables[tag] = t
+		}
+	}
+
+	subset := &fontSubset{
+		Data:       assembleTTF(tables),
+		UnitsPerEm: f.unitsPerEm,
+		GIDs:       gids,
+		Advances:   advances,
+		BBox: [4]int{
+			int(int16(binary.BigEndian.Uint16(head[36:38]))),
+			int(int16(binary.BigEndian.Uint16(head[38:40]))),
+			int(int16(binary.BigEndian.Uint16(head[40:42]))),
+			int(int16(binary.BigEndian.Uint16(head[42:44]))),
+		},
+		Ascent:  int(int16(binary.BigEndian.Uint16(hhea[4:6]))),
+		Descent: int(int16(binary.BigEndian.Uint16(hhea[6:8]))),
+	}
+	return subset, nil
+}
+
+// buildCmap builds a cmap with a Windows BMP (format 4) subtable and, when
+// needed, a full-repertoire (format 12) subtable mapping runes to new glyph IDs.
+func buildCmap(gids map[rune]uint16) []byte {
+	runes := make([]rune, 0, len(gids))
+	for r, gid := range gids {
+		if gid != 0 && r >= 0 && r <= 0x10FFFF {
+			runes = append(runes, r)
+		}
+	}
+	sort.Slice(runes, func(i, j int) bool { return runes[i] < runes[j] })
+
+	// Format 4: one single-character segment per BMP rune plus the 0xFFFF terminator
+	var bmp []rune
+	for _, r := range runes {
+		if r < 0xFFFF {
+			bmp = append(bmp, r)
+		}
+	}
+	segCount := len(bmp) + 1
+	entrySelector := 0
+	for 1<<(entrySelector+1) <= segCount {
+		entrySelector++
+	}
+	searchRange := 2 << entrySelector
+	fmt4 := make([]byte, 0, 16+segCount*8)
+	fmt4 = binary.BigEndian.AppendUint16(fmt4, 4)
+	fmt4 = binary.BigEndian.AppendUint16(fmt4, uint16(16+segCount*8))
+	fmt4 = binary.BigEndian.AppendUint16(fmt4, 0) // language
+	fmt4 = binary.BigEndian.AppendUint16(fmt4, uint16(segCount*2))
+	fmt4 = binary.BigEndian.AppendUint16(fmt4, uint16(searchRange))
+	fmt4 = binary.BigEndian.AppendUint16(fmt4, uint16(entrySelector))
+	fmt4 = binary.BigEndian.AppendUint16(fmt4, uint16(segCount*2-searchRange))
+	for _, r := range bmp { // endCode
+		fmt4 = binary.BigEndian.AppendUint16(fmt4, uint16(r))
+	}
+	fmt4 = binary.BigEndian.AppendUint16(fmt4, 0xFFFF)
+	fmt4 = binary.BigEndian.AppendUint16(fmt4, 0) // reservedPad
+	for _, r := range bmp {                       // startCode
+		fmt4 = binary.BigEndian.AppendUint16(fmt4, uint16(r))
+	}
+	fmt4 = binary.BigEndian.AppendUint16(fmt4, 0xFFFF)
+	for _, r := range bmp { // idDelta (mod 65536)
+		fmt4 = binary.BigEndian.AppendUint16(fmt4, gids[r]-uint16(r))
+	}
+	fmt4 = binary.BigEndian.AppendUint16(fmt4, 1)
+	for i := 0; i < segCount; i++ { // idRangeOffset
+		fmt4 = binary.BigEndian.AppendUint16(fmt4, 0)
+	}
+
+	subtables := [][]byte{fmt4}
+	if len(bmp) < len(runes) {
+		fmt12 := make([]byte, 0, 16+len(runes)*12)
+		fmt12 = binary.BigEndian.AppendUint16(fmt12, 12)
+		fmt12 = binary.BigEndian.AppendUint16(fmt12, 0)
+		fmt12 = binary.BigEndian.AppendUint32(fmt12, uint32(16+len(runes)*12))
+		fmt12 = binary.BigEndian.AppendUint32(fmt12, 0) // language
+		fmt12 = binary.BigEndian.AppendUint32(fmt12, uint32(len(runes)))
+		for _, r := range runes {
+			fmt12 = binary.BigEndian.AppendUint32(fmt12, uint32(r))
+			fmt12 = binary.BigEndian.AppendUint32(fmt12, uint32(r))
+			fmt12 = binary.BigEndian.AppendUint32(fmt12, uint32(gids[r]))
+		}
+		subtables = append(subtables, fmt12)
+	}
+
+	out := make([]byte, 0, 4+len(subtables)*8)
+	out = binary.BigEndian.AppendUint16(out, 0)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(subtables)))
+	offset := 4 + len(subtables)*8
+	for i, sub := range subtables {
+		encoding := uint16(1) // Windows Unicode BMP
+		if i == 1 {
+			encoding = 10 // Windows Unicode full repertoire
+		}
+		out = binary.BigEndian.AppendUint16(out, 3)
+		out = binary.BigEndian.AppendUint16(out, encoding)
+		out = binary.BigEndian.AppendUint32(out, uint32(offset))
+		offset += len(sub)
+	}
+	for _, sub := range subtables {
+		out = append(out, sub...)
+	}
+	return out
+}
+
+// assembleTTF serializes tables into a TrueType file with a valid table directory,
+// table checksums and head.checkSumAdjustment.
+func assembleTTF(tables map[string][]byte) []byte {
+	tags := make([]string, 0, len(tables))
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	numTables := len(tags)
+	entrySelector := 0
+	for 1<<(entrySelector+1) <= numTables {
+		entrySelector++
+	}
+	searchRange := (1 << entrySelector) * 16
+
+	out := make([]byte, 12+numTables*16)
+	binary.BigEndian.PutUint32(out[0:4], 0x00010000)
+	binary.BigEndian.PutUint16(out[4:6], uint16(numTables))
+	binary.BigEndian.PutUint16(out[6:8], uint16(searchRange))
+	binary.BigEndian.PutUint16(out[8:10], uint16(entrySelector))
+	binary.BigEndian.PutUint16(out[10:12], uint16(numTables*16-searchRange))
+
+	headOffset := 0
+	for i, tag := range tags {
+		t := tables[tag]
+		rec := out[12+i*16:]
+		copy(rec[0:4], tag)
+		binary.BigEndian.PutUint32(rec[4:8], ttfChecksum(t))
+		binary.BigEndian.PutUint32(rec[8:12], uint32(len(out)))
+		binary.BigEndian.PutUint32(rec[12:16], uint32(len(t)))
+		if tag == "head" {
+			headOffset = len(out)
+		}
+		out = append(out, t...)
+		for len(out)%4 != 0 {
+			out = append(out, 0)
+		}
+	}
+
+	binary.BigEndian.PutUint32(out[headOffset+8:], 0xB1B0AFBA-ttfChecksum(out))
+	return out
+}
+
+// ttfChecksum is the TrueType table checksum: the sum of big-endian uint32 words
+func ttfChecksum(b []byte) uint32 {
+	var sum uint32
+	for i := 0; i < len(b); i += 4 {
+		var word [4]byte
+		copy(word[:], b[i:])
+		sum += binary.BigEndian.Uint32(word[:])
+	}
+	return sum
+}
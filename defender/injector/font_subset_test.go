@@ -0,0 +1,91 @@
+package injector
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// TestSubsetTTF tests that subset glyphs match the original font's outlines and advances
+func TestSubsetTTF(t *testing.T) {
+	text := "Leak-Trace: Ωmega Привет é"
+
+	orig, err := sfnt.Parse(goNotoCurrentTTF)
+	if err != nil {
+		t.Fatalf("Failed to parse embedded font: %v", err)
+	}
+
+	subset, err := subsetTTF(goNotoCurrentTTF, []rune(text))
+	if err != nil {
+		t.Fatalf("subsetTTF failed: %v", err)
+	}
+
+	if len(subset.Data) > 64*1024 {
+		t.Errorf("Subset too large: %d bytes", len(subset.Data))
+	}
+
+	sub, err := sfnt.Parse(subset.Data)
+	if err != nil {
+		t.Fatalf("Subset is not a valid font: %v", err)
+	}
+	if sub.NumGlyphs() != len(subset.Advances) {
+		t.Errorf("Glyph count mismatch: font has %d, subset reports %d", sub.NumGlyphs(), len(subset.Advances))
+	}
+
+	var origBuf, subBuf sfnt.Buffer
+	ppem := fixed.I(int(orig.UnitsPerEm()))
+	for _, r := range text {
+		origGID, err := orig.GlyphIndex(&origBuf, r)
+		if err != nil {
+			t.Fatalf("GlyphIndex(%q) failed: %v", r, err)
+		}
+		subGID := sfnt.GlyphIndex(subset.GIDs[r])
+		if cmapGID, err := sub.GlyphIndex(&subBuf, r); err != nil || cmapGID != subGID {
+			t.Errorf("Subset cmap maps %q to %d (err %v), want %d", r, cmapGID, err, subGID)
+		}
+
+		origSegs, err := orig.LoadGlyph(&origBuf, origGID, ppem, nil)
+		if err != nil {
+			t.Fatalf("LoadGlyph(%q) in original failed: %v", r, err)
+		}
+		subSegs, err := sub.LoadGlyph(&subBuf, subGID, ppem, nil)
+		if err != nil {
+			t.Fatalf("LoadGlyph(%q) in subset failed: %v", r, err)
+		}
+		if !reflect.DeepEqual(origSegs, subSegs) {
+			t.Errorf("Outline mismatch for %q", r)
+		}
+
+		origAdv, _ := orig.GlyphAdvance(&origBuf, origGID, ppem, font.HintingNone)
+		subAdv, _ := sub.GlyphAdvance(&subBuf, subGID, ppem, font.HintingNone)
+		if origAdv != subAdv {
+			t.Errorf("Advance mismatch for %q: got %v, want %v", r, subAdv, origAdv)
+		}
+	}
+
+	// Same text must produce byte-identical subsets
+	again, err := subsetTTF(goNotoCurrentTTF, []rune(text))
+	if err != nil {
+		t.Fatalf("Second subsetTTF failed: %v", err)
+	}
+	if !reflect.DeepEqual(subset.Data, again.Data) {
+		t.Error("Subsetting is not deterministic")
+	}
+}
+
+// TestSubsetTTFMalformed tests that invalid font data is rejected without panicking
+func TestSubsetTTFMalformed(t *testing.T) {
+	inputs := [][]byte{
+		nil,
+		[]byte("not a font"),
+		goNotoCurrentTTF[:64],
+	}
+	for _, data := range inputs {
+		if _, err := subsetTTF(data, []rune("abc")); err == nil {
+			t.Errorf("Expected error for %d-byte input, got nil", len(data))
+		}
+	}
+}
@@ -0,0 +1,348 @@
+package injector
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// Fragments spread one payload over several carriers (pages, images) of an
+// anchor. The payload is Reed-Solomon coded into n fragments, one per carrier,
+// any k of which reconstruct it, so stripping some pages or images still leaves
+// the document traceable. Carriers with room for the whole payload hold it
+// instead (k == 1), so any single one of them is enough.
+//
+// Fragment format:
+//
+//	magic (2) | payload CRC-32 (4) | k (1) | n (1) | index (1) | payload length (2) | shard | CRC-32 (4)
+//
+// The payload CRC groups the fragments of one payload and checks the
+// reconstruction; the trailing CRC covers the fragment itself.
+var fragmentMagic = []byte{0xF7, 0x46}
+
+const (
+	fragmentHeaderSize = 2 + 4 + 1 + 1 + 1 + 2
+	fragmentCRCSize    = 4
+	// maxFragments is the number of distinct evaluation points in GF(256)
+	maxFragments = 255
+	// fragmentRedundancy: any 1/fragmentRedundancy of the carriers reconstructs the payload
+	fragmentRedundancy = 4
+)
+
+var errFragmentInvalid = errors.New("invalid fragment")
+
+// fragmentShards returns how many fragments (n) a payload is split into for a
+// number of carriers, and how many of them (k) reconstruct it. With k == 1
+// every carrier holds the whole payload and no fragments are needed.
+func fragmentShards(carriers int) (k, n int) {
+	n = carriers
+	if n > maxFragments {
+		n = maxFragments
+	}
+	if n < 1 {
+		n = 1
+	}
+	k = (n + fragmentRedundancy - 1) / fragmentRedundancy
+	return k, n
+}
+
+// fragmentShardsWithin returns the split for carriers that hold at most
+// capacity bytes each: k is the fewest fragments that fit, and 1 (the whole
+// payload on every carrier) whenever the payload itself fits
+func fragmentShardsWithin(payloadLen, carriers, capacity int) (k, n int) {
+	_, n = fragmentShards(carriers)
+	if payloadLen <= capacity {
+		return 1, n
+	}
+	for k = 2; k < n && fragmentSize(payloadLen, k) > capacity; k++ {
+	}
+	if k > n {
+		k = n
+	}
+	return k, n
+}
+
+// distributePayload returns what each of carriers holds: the whole payload
+// when k == 1, otherwise one of the fragments any k of which reconstruct it
+// (repeating after maxFragments)
+func distributePayload(payload []byte, carriers, k int) ([][]byte, error) {
+	pieces := [][]byte{payload}
+	if k > 1 {
+		_, n := fragmentShards(carriers)
+		var err error
+		if pieces, err = splitPayload(payload, k, n); err != nil {
+			return nil, err
+		}
+	}
+	out := make([][]byte, carriers)
+	for i := range out {
+		out[i] = pieces[i%len(pieces)]
+	}
+	return out, nil
+}
+
+// carrierPayloadSize returns the size of what each carrier holds for a split k of n
+func carrierPayloadSize(payloadLen, k int) int {
+	if k == 1 {
+		return payloadLen
+	}
+	return fragmentSize(payloadLen, k)
+}
+
+// fragmentSize returns the length of each fragment of a payloadLen payload split k of n
+func fragmentSize(payloadLen, k int) int {
+	return fragmentHeaderSize + (payloadLen+k-1)/k + fragmentCRCSize
+}
+
+// splitPayload encodes payload into n fragments, any k of which reconstruct it
+func splitPayload(payload []byte, k, n int) ([][]byte, error) {
+	if k < 1 || n < k || n > maxFragments {
+		return nil, fmt.Errorf("invalid fragment split %d of %d", k, n)
+	}
+	if len(payload) == 0 || len(payload) > 0xFFFF {
+		return nil, fmt.Errorf("cannot fragment a payload of %d bytes", len(payload))
+	}
+
+	shardLen := (len(payload) + k - 1) / k
+	padded := make([]byte, k*shardLen)
+	copy(padded, payload)
+	sum := crc32.ChecksumIEEE(payload)
+
+	fragments := make([][]byte, n)
+	for i := 0; i < n; i++ {
+		frag := make([]byte, 0, fragmentHeaderSize+shardLen+fragmentCRCSize)
+		frag = append(frag, fragmentMagic...)
+		frag = binary.BigEndian.AppendUint32(frag, sum)
+		frag = append(frag, byte(k), byte(n), byte(i))
+		frag = binary.BigEndian.AppendUint16(frag, uint16(len(payload)))
+
+		// Shard i evaluates the data polynomial at x = i+1: shard = Σ data_j · x^j
+		shard := make([]byte, shardLen)
+		x := byte(i + 1)
+		coef := byte(1)
+		for j := 0; j < k; j++ {
+			data := padded[j*shardLen : (j+1)*shardLen]
+			for b := range shard {
+				shard[b] ^= gfMul(data[b], coef)
+			}
+			coef = gfMul(coef, x)
+		}
+		frag = append(frag, shard...)
+		fragments[i] = binary.BigEndian.AppendUint32(frag, crc32.ChecksumIEEE(frag))
+	}
+	return fragments, nil
+}
+
+// fragment is a parsed fragment
+type fragment struct {
+	sum    uint32
+	k, n   int
+	index  int
+	length int
+	shard  []byte
+}
+
+// isFragment reports whether data starts like a fragment rather than a whole payload
+func isFragment(data []byte) bool {
+	return bytes.HasPrefix(data, fragmentMagic)
+}
+
+// parseFragment validates and parses one fragment
+func parseFragment(data []byte) (*fragment, error) {
+	if len(data) < fragmentHeaderSize+fragmentCRCSize || !isFragment(data) {
+		return nil, errFragmentInvalid
+	}
+	body := data[:len(data)-fragmentCRCSize]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(data[len(body):]) {
+		return nil, fmt.Errorf("%w: checksum mismatch", errFragmentInvalid)
+	}
+	f := &fragment{
+		sum:    binary.BigEndian.Uint32(body[2:6]),
+		k:      int(body[6]),
+		n:      int(body[7]),
+		index:  int(body[8]),
+		length: int(binary.BigEndian.Uint16(body[9:11])),
+		shard:  body[fragmentHeaderSize:],
+	}
+	if f.k < 1 || f.n < f.k || f.index >= f.n || f.length == 0 || len(f.shard) != (f.length+f.k-1)/f.k {
+		return nil, fmt.Errorf("%w: inconsistent header", errFragmentInvalid)
+	}
+	return f, nil
+}
+
+// fragmentSet collects the fragments an extractor finds, possibly of several payloads
+type fragmentSet struct {
+	groups map[uint32]map[int]*fragment
+	// order keeps the payloads in the order their first fragment was found
+	order []uint32
+}
+
+// add records a fragment; invalid and duplicate fragments are ignored
+func (s *fragmentSet) add(data []byte) bool {
+	f, err := parseFragment(data)
+	if err != nil {
+		return false
+	}
+	if s.groups == nil {
+		s.groups = make(map[uint32]map[int]*fragment)
+	}
+	group, ok := s.groups[f.sum]
+	if !ok {
+		group = make(map[int]*fragment)
+		s.groups[f.sum] = group
+		s.order = append(s.order, f.sum)
+	}
+	if prev, ok := group[f.index]; ok && (prev.k != f.k || prev.n != f.n) {
+		return false
+	}
+	group[f.index] = f
+	return true
+}
+
+// payload reconstructs the first payload with enough fragments
+func (s *fragmentSet) payload() ([]byte, error) {
+	if len(s.order) == 0 {
+		return nil, errors.New("no fragments found")
+	}
+	var lastErr error
+	for _, sum := range s.order {
+		payload, err := joinFragments(s.groups[sum])
+		if err == nil {
+			return payload, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// joinFragments reconstructs a payload from fragments of one split
+func joinFragments(group map[int]*fragment) ([]byte, error) {
+	var picked []*fragment
+	var first *fragment
+	for i := 0; i < maxFragments && (first == nil || len(picked) < first.k); i++ {
+		f, ok := group[i]
+		if !ok || (first != nil && (f.k != first.k || f.length != first.length)) {
+			continue
+		}
+		if first == nil {
+			first = f
+		}
+		picked = append(picked, f)
+	}
+	if first == nil {
+		return nil, errors.New("no fragments found")
+	}
+	k := first.k
+	if len(picked) < k {
+		return nil, fmt.Errorf("only %d of the %d fragments needed were found", len(picked), k)
+	}
+
+	// Solve V · data = shards for the Vandermonde rows of the picked fragments
+	matrix := make([][]byte, k)
+	for r, f := range picked {
+		row := make([]byte, k)
+		x := byte(f.index + 1)
+		coef := byte(1)
+		for j := range row {
+			row[j] = coef
+			coef = gfMul(coef, x)
+		}
+		matrix[r] = row
+	}
+	inv, err := gfInvert(matrix)
+	if err != nil {
+		return nil, err
+	}
+
+	shardLen := len(first.shard)
+	payload := make([]byte, k*shardLen)
+	for j := 0; j < k; j++ {
+		data := payload[j*shardLen : (j+1)*shardLen]
+		for r, f := range picked {
+			c := inv[j][r]
+			for b := range data {
+				data[b] ^= gfMul(f.shard[b], c)
+			}
+		}
+	}
+	payload = payload[:first.length]
+	if crc32.ChecksumIEEE(payload) != first.sum {
+		return nil, errors.New("reconstructed payload failed its checksum")
+	}
+	return payload, nil
+}
+
+// GF(256) arithmetic over the polynomial x^8 + x^4 + x^3 + x^2 + 1
+
+var gfExp, gfLog = gfTables()
+
+func gfTables() (exp [510]byte, log [256]byte) {
+	x := 1
+	for i := 0; i < 255; i++ {
+		exp[i] = byte(x)
+		log[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11D
+		}
+	}
+	for i := 255; i < len(exp); i++ {
+		exp[i] = exp[i-255]
+	}
+	return exp, log
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfInv(a byte) byte {
+	return gfExp[255-int(gfLog[a])]
+}
+
+// gfInvert inverts a square matrix by Gauss-Jordan elimination
+func gfInvert(m [][]byte) ([][]byte, error) {
+	n := len(m)
+	a := make([][]byte, n)
+	for i := range m {
+		a[i] = make([]byte, 2*n)
+		copy(a[i], m[i])
+		a[i][n+i] = 1
+	}
+	for col := 0; col < n; col++ {
+		pivot := -1
+		for r := col; r < n; r++ {
+			if a[r][col] != 0 {
+				pivot = r
+				break
+			}
+		}
+		if pivot < 0 {
+			return nil, errors.New("fragment matrix is singular")
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		scale := gfInv(a[col][col])
+		for c := range a[col] {
+			a[col][c] = gfMul(a[col][c], scale)
+		}
+		for r := 0; r < n; r++ {
+			if r == col || a[r][col] == 0 {
+				continue
+			}
+			factor := a[r][col]
+			for c := range a[r] {
+				a[r][c] ^= gfMul(factor, a[col][c])
+			}
+		}
+	}
+	inv := make([][]byte, n)
+	for i := range a {
+		inv[i] = a[i][n:]
+	}
+	return inv, nil
+}
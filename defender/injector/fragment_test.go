@@ -0,0 +1,148 @@
+package injector
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// TestFragmentShards tests how many fragments reconstruct a payload
+func TestFragmentShards(t *testing.T) {
+	tests := []struct {
+		carriers, k, n int
+	}{
+		{0, 1, 1},
+		{1, 1, 1},
+		{4, 1, 4},
+		{5, 2, 5},
+		{12, 3, 12},
+		{1000, 64, 255},
+	}
+	for _, tt := range tests {
+		if k, n := fragmentShards(tt.carriers); k != tt.k || n != tt.n {
+			t.Errorf("fragmentShards(%d) = %d of %d, want %d of %d", tt.carriers, k, n, tt.k, tt.n)
+		}
+	}
+}
+
+// TestFragmentRoundTrip tests that any k of n fragments reconstruct the payload
+func TestFragmentRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, tt := range []struct{ k, n, size int }{
+		{1, 3, 44}, {2, 5, 44}, {3, 12, 45}, {5, 7, 1}, {64, 255, 300},
+	} {
+		payload := make([]byte, tt.size)
+		rng.Read(payload)
+		fragments, err := splitPayload(payload, tt.k, tt.n)
+		if err != nil {
+			t.Fatalf("splitPayload(%d of %d) failed: %v", tt.k, tt.n, err)
+		}
+		if len(fragments) != tt.n || len(fragments[0]) != fragmentSize(tt.size, tt.k) {
+			t.Fatalf("Got %d fragments of %d bytes", len(fragments), len(fragments[0]))
+		}
+
+		for trial := 0; trial < 20; trial++ {
+			var set fragmentSet
+			for _, i := range rng.Perm(tt.n)[:tt.k] {
+				set.add(fragments[i])
+			}
+			got, err := set.payload()
+			if err != nil || !bytes.Equal(got, payload) {
+				t.Fatalf("%d of %d: reconstruction failed: %v", tt.k, tt.n, err)
+			}
+		}
+
+		if tt.k > 1 {
+			var set fragmentSet
+			for _, f := range fragments[:tt.k-1] {
+				set.add(f)
+			}
+			if _, err := set.payload(); err == nil {
+				t.Errorf("%d of %d: reconstructed from %d fragments", tt.k, tt.n, tt.k-1)
+			}
+		}
+	}
+}
+
+// TestFragmentSetRejects tests that corrupted and foreign fragments are ignored
+func TestFragmentSetRejects(t *testing.T) {
+	payload := []byte("encrypted payload bytes")
+	fragments, err := splitPayload(payload, 2, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := splitPayload([]byte("another payload"), 2, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var set fragmentSet
+	corrupted := append([]byte(nil), fragments[0]...)
+	corrupted[fragmentHeaderSize] ^= 0xFF
+	if set.add(corrupted) {
+		t.Error("Corrupted fragment accepted")
+	}
+	if set.add(fragments[0][:fragmentHeaderSize]) {
+		t.Error("Truncated fragment accepted")
+	}
+	set.add(other[0])
+	set.add(fragments[1])
+	if _, err := set.payload(); err == nil {
+		t.Error("Reconstructed from fragments of two payloads")
+	}
+	set.add(fragments[3])
+	if got, err := set.payload(); err != nil || !bytes.Equal(got, payload) {
+		t.Errorf("payload() = %q, %v", got, err)
+	}
+}
+
+// TestFragmentShardsWithin tests that carriers hold the whole payload while it
+// fits and the fewest fragments that fit otherwise
+func TestFragmentShardsWithin(t *testing.T) {
+	tests := []struct {
+		payloadLen, carriers, capacity, k, n int
+	}{
+		{50, 1, 1024, 1, 1},
+		{50, 10, 1024, 1, 10},
+		{1024, 300, 1024, 1, 255},
+		{2048, 10, 1024, 3, 10},
+		{40000, 4096, 1024, 40, 255},
+		{5000, 3, 1024, 3, 3},
+	}
+	for _, tt := range tests {
+		k, n := fragmentShardsWithin(tt.payloadLen, tt.carriers, tt.capacity)
+		if k != tt.k || n != tt.n {
+			t.Errorf("fragmentShardsWithin(%d, %d, %d) = %d of %d, want %d of %d", tt.payloadLen, tt.carriers, tt.capacity, k, n, tt.k, tt.n)
+		}
+		if k > 1 && k < n && carrierPayloadSize(tt.payloadLen, k) > tt.capacity {
+			t.Errorf("Fragments of %d bytes exceed the capacity %d", carrierPayloadSize(tt.payloadLen, k), tt.capacity)
+		}
+	}
+}
+
+// TestDistributePayload tests that carriers hold the whole payload for k == 1
+// and repeat the fragments otherwise
+func TestDistributePayload(t *testing.T) {
+	payload := []byte("payload")
+	pieces, err := distributePayload(payload, 300, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range pieces {
+		if !bytes.Equal(p, payload) {
+			t.Errorf("Carrier holds %q, want the whole payload", p)
+		}
+	}
+
+	k, _ := fragmentShards(300)
+	pieces, err = distributePayload(payload, 300, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pieces) != 300 || !isFragment(pieces[0]) || !bytes.Equal(pieces[0], pieces[maxFragments]) {
+		t.Errorf("Expected 300 carriers repeating %d fragments", maxFragments)
+	}
+	if len(pieces[0]) != carrierPayloadSize(len(payload), k) {
+		t.Errorf("Fragment of %d bytes, carrierPayloadSize %d", len(pieces[0]), carrierPayloadSize(len(payload), k))
+	}
+}
@@ -0,0 +1,223 @@
+package injector
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// The extractors parse attacker-controlled data from leaked files. Seeds in
+// testdata/fuzz come from real signed files (see TestWriteFuzzCorpus); run a
+// target with e.g. go test -fuzz FuzzDecrypt ./injector
+
+// FuzzParseContentStream tests the Content anchor parser on arbitrary content streams
+func FuzzParseContentStream(f *testing.F) {
+	f.Add("q\nBT\n/F1 1 Tf\n3 Tr\n[ ( ) 222 ( ) 173 ( ) 190 ( ) 239 ( ) 1 ] TJ\nET\nQ\n")
+	f.Add("BT 3 Tr [ ] TJ ET")
+	f.Add("BT 3 Tr [ 222 173 190 239 ET")
+	f.Add("ET 3 Tr [ ( ) -1 ( ) 256 ( ) 99999999999999999999 ] TJ BT")
+
+	a := NewContentAnchor()
+	f.Fuzz(func(t *testing.T, content string) {
+		payload, found := a.parseContentStreamForPayload(content)
+		if !found && payload != nil {
+			t.Errorf("Payload %x returned without a match", payload)
+		}
+		if len(payload) > len(content) {
+			t.Errorf("Payload of %d bytes from %d bytes of content", len(payload), len(content))
+		}
+	})
+}
+
+// FuzzContentRoundTrip tests that any payload survives the Content anchor encoding
+func FuzzContentRoundTrip(f *testing.F) {
+	f.Add([]byte("payload"))
+	f.Add([]byte{})
+	f.Add(contentMagicHeader)
+
+	a := NewContentAnchor()
+	f.Fuzz(func(t *testing.T, payload []byte) {
+		stream := contentPayloadStream("/PhantomHelv", append(append([]byte(nil), contentMagicHeader...), payload...))
+		got, found := a.parseContentStreamForPayload(string(stream))
+		if !found || !bytes.HasSuffix(payload, got) {
+			t.Fatalf("Round trip failed: %x -> %x (found %v)", payload, got, found)
+		}
+	})
+}
+
+// FuzzFindPayloadInMaskData tests the legacy SMask payload search on arbitrary mask data
+func FuzzFindPayloadInMaskData(f *testing.F) {
+	f.Add(append(bytes.Repeat([]byte{0xFF}, 256), append(append([]byte(nil), magicHeader...), "payload"...)...))
+	f.Add([]byte{})
+	f.Add(magicHeader[:3])
+
+	e := &smaskExtractor{}
+	f.Fuzz(func(t *testing.T, maskData []byte) {
+		payload, err := e.findPayloadInMaskData(maskData)
+		if err != nil {
+			return
+		}
+		if !bytes.HasSuffix(maskData, payload) || len(payload) > len(maskData)-len(magicHeader) {
+			t.Errorf("Payload %x is not a tail of the mask data", payload)
+		}
+	})
+}
+
+// FuzzExtractLSB tests reading a payload from the pixels of arbitrary masks
+func FuzzExtractLSB(f *testing.F) {
+	signed := bytes.Repeat([]byte{255}, 48*48)
+	if err := embedLSB(signed, 48, 48, []byte("payload")); err != nil {
+		f.Fatal(err)
+	}
+	f.Add(signed, 48, 48)
+	f.Add(signed, 48, 47)
+	f.Add([]byte{}, 0, 0)
+	f.Add([]byte{0xFF}, -1, -1)
+
+	f.Fuzz(func(t *testing.T, pixels []byte, width, height int) {
+		payload, err := extractLSB(pixels, width, height)
+		if err != nil {
+			return
+		}
+		if lsbPixels(len(payload)) > len(pixels) {
+			t.Errorf("Payload of %d bytes from %d pixels", len(payload), len(pixels))
+		}
+	})
+}
+
+// FuzzLSBRoundTrip tests that any payload survives a new mask of any image size
+func FuzzLSBRoundTrip(f *testing.F) {
+	f.Add([]byte("payload"), uint16(16), uint16(16))
+	f.Add([]byte{}, uint16(1), uint16(1))
+	f.Add(bytes.Repeat([]byte{0}, 300), uint16(4000), uint16(3))
+
+	f.Fuzz(func(t *testing.T, payload []byte, imgWidth, imgHeight uint16) {
+		width, height := lsbMaskSize(int(imgWidth), int(imgHeight), len(payload))
+		pixels := bytes.Repeat([]byte{255}, width*height)
+		if err := embedLSB(pixels, width, height, payload); err != nil {
+			t.Fatalf("%dx%d mask for %dx%d: %v", width, height, imgWidth, imgHeight, err)
+		}
+		got, err := extractLSB(pixels, width, height)
+		if err != nil || !bytes.Equal(got, payload) {
+			t.Errorf("Round trip failed: %x -> %x, %v", payload, got, err)
+		}
+	})
+}
+
+// FuzzDecodeLicense tests reading a payload from the whitespace of arbitrary text
+func FuzzDecodeLicense(f *testing.F) {
+	text, err := encodeLicense([]byte("payload"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(text)
+	f.Add([]byte(fontLicenseText))
+	f.Add([]byte("\t\t\t\t\t\t\t\t\t\t\t\t\t\t\t\t\n"))
+
+	f.Fuzz(func(t *testing.T, text []byte) {
+		payload, err := decodeLicense(text)
+		if err == nil && len(payload)*8 > len(text) {
+			t.Errorf("Payload of %d bytes from %d bytes of text", len(payload), len(text))
+		}
+	})
+}
+
+// FuzzDecodeStream tests limited stream decoding on arbitrary, possibly compressed data
+func FuzzDecodeStream(f *testing.F) {
+	compressed, err := compressFlate(bytes.Repeat([]byte{0xFF}, 256))
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(compressed, true)
+	f.Add([]byte("raw mask"), false)
+	f.Add([]byte{0x78, 0x9c}, true)
+
+	b := newBudget(Limits{MaxStreamSize: 1 << 20})
+	f.Fuzz(func(t *testing.T, raw []byte, flate bool) {
+		sd := types.StreamDict{Dict: types.NewDict(), Raw: raw}
+		if flate {
+			sd.InsertName("Filter", "FlateDecode")
+		}
+		data, err := b.decodeStream(&sd, 1)
+		if err != nil {
+			return
+		}
+		if int64(len(data)) > b.limits.MaxStreamSize {
+			t.Errorf("Decoded %d bytes, over the %d byte limit", len(data), b.limits.MaxStreamSize)
+		}
+		if !flate && !bytes.Equal(data, raw) {
+			t.Errorf("Uncompressed data was modified")
+		}
+	})
+}
+
+// FuzzFragmentSet tests fragment parsing and reconstruction on arbitrary fragments
+func FuzzFragmentSet(f *testing.F) {
+	fragments, err := splitPayload([]byte("encrypted payload bytes"), 2, 4)
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(fragments[0], fragments[1])
+	f.Add(fragments[2], fragments[2])
+	f.Add([]byte{}, fragmentMagic)
+
+	f.Fuzz(func(t *testing.T, a, b []byte) {
+		var set fragmentSet
+		set.add(a)
+		set.add(b)
+		payload, err := set.payload()
+		if err == nil && len(payload) > len(a)+len(b) {
+			t.Errorf("Reconstructed %d bytes from %d bytes of fragments", len(payload), len(a)+len(b))
+		}
+	})
+}
+
+// FuzzDecrypt tests payload decryption on arbitrary payloads
+func FuzzDecrypt(f *testing.F) {
+	crypto, err := NewCryptoManager([]byte(testKey32))
+	if err != nil {
+		f.Fatal(err)
+	}
+	valid, err := crypto.Encrypt("UserID:12345")
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(valid)
+	f.Add(valid[:len(magicHeader)+nonceSize])
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, payload []byte) {
+		msg, err := crypto.Decrypt(payload)
+		if err == nil && !bytes.Equal(payload, valid) && !strings.HasPrefix(string(payload), string(magicHeader)) {
+			t.Errorf("Decrypted %q from a payload without the magic header", msg)
+		}
+	})
+}
+
+// FuzzCryptoRoundTrip tests that every message decrypts to itself
+func FuzzCryptoRoundTrip(f *testing.F) {
+	f.Add("UserID:12345")
+	f.Add("")
+	f.Add("机密文件 — Отдел продаж")
+
+	crypto, err := NewCryptoManager([]byte(testKey32))
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Fuzz(func(t *testing.T, message string) {
+		if !utf8.ValidString(message) {
+			return
+		}
+		payload, err := crypto.Encrypt(message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := crypto.Decrypt(payload)
+		if err != nil || got != message {
+			t.Errorf("Round trip failed: %q -> %q, %v", message, got, err)
+		}
+	})
+}
@@ -6,23 +6,80 @@ import (
 	"image"
 	"image/color"
 	"image/png"
+	"math"
+	"sync"
 
 	"golang.org/x/image/font"
 	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
 	"golang.org/x/image/math/fixed"
 )
 
-// renderTextToPNG renders the given text to a transparent PNG using the embedded Unicode font.
-// It returns the PNG bytes or an error.
-func renderTextToPNG(text string, fontSize float64) ([]byte, error) {
-	if len(goNotoCurrentTTF) == 0 {
-		return nil, fmt.Errorf("embedded font data is empty")
+var (
+	embeddedFontOnce sync.Once
+	embeddedFont     *opentype.Font
+	embeddedFontErr  error
+)
+
+// parsedEmbeddedFont parses the embedded Unicode font once per process.
+// The parsed font is read-only and safe for concurrent use.
+func parsedEmbeddedFont() (*opentype.Font, error) {
+	embeddedFontOnce.Do(func() {
+		if len(goNotoCurrentTTF) == 0 {
+			embeddedFontErr = fmt.Errorf("embedded font data is empty")
+			return
+		}
+		embeddedFont, embeddedFontErr = opentype.Parse(goNotoCurrentTTF)
+		if embeddedFontErr != nil {
+			embeddedFontErr = fmt.Errorf("failed to parse embedded font: %w", embeddedFontErr)
+		}
+	})
+	return embeddedFont, embeddedFontErr
+}
+
+// embeddedFontMeasurer returns a textMeasurer backed by the embedded Unicode font's
+// horizontal metrics. Glyph advances are cached per rune in font units.
+func embeddedFontMeasurer() (textMeasurer, error) {
+	f, err := parsedEmbeddedFont()
+	if err != nil {
+		return nil, err
 	}
 
-	// Parse the embedded font
-	f, err := opentype.Parse(goNotoCurrentTTF)
+	unitsPerEm := float64(f.UnitsPerEm())
+	ppem := fixed.I(int(f.UnitsPerEm()))
+	var buf sfnt.Buffer
+	advances := make(map[rune]float64)
+
+	advance := func(r rune) float64 {
+		if adv, ok := advances[r]; ok {
+			return adv
+		}
+		var adv float64
+		if idx, err := f.GlyphIndex(&buf, r); err == nil {
+			if a, err := f.GlyphAdvance(&buf, idx, ppem, font.HintingNone); err == nil {
+				adv = float64(a) / 64
+			}
+		}
+		advances[r] = adv
+		return adv
+	}
+
+	return func(s string, fontSize int) float64 {
+		var total float64
+		for _, r := range s {
+			total += advance(r)
+		}
+		return total / unitsPerEm * float64(fontSize)
+	}, nil
+}
+
+// renderTextToPNG renders the given lines to a transparent PNG using the embedded Unicode font.
+// Lines are centred horizontally and spaced wmLineSpacing × fontSize apart.
+// It returns the PNG bytes or an error.
+func renderTextToPNG(lines []string, fontSize float64, rgb [3]float64) ([]byte, error) {
+	f, err := parsedEmbeddedFont()
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse embedded font: %w", err)
+		return nil, err
 	}
 
 	const (
@@ -40,51 +97,51 @@ func renderTextToPNG(text string, fontSize float64) ([]byte, error) {
 	}
 	defer face.Close()
 
-	// Measure string to determine image dimensions
 	drawer := &font.Drawer{
 		Face: face,
 	}
 
-	// Measurement
-	bounds, advance := drawer.BoundString(text)
-
-	// Convert fixed.Int26_6 to int (ceil)
-	// bounds.Max.Y is usually baseline to bottom descent, Min.Y is baseline to top ascent (negative)
-	// Height = (Max.Y - Min.Y)
-	// Width = advance
-
-	h := (bounds.Max.Y - bounds.Min.Y).Ceil()
-	w := advance.Ceil()
+	// Measure every line: the image is as wide as the widest line and tall enough
+	// for all lines at the configured spacing plus the last line's descent.
+	metrics := face.Metrics()
+	lineHeight := fixed.Int26_6(math.Round(fontSize * wmLineSpacing * 64))
+	widths := make([]fixed.Int26_6, len(lines))
+	var maxWidth fixed.Int26_6
+	for i, line := range lines {
+		widths[i] = drawer.MeasureString(line)
+		if widths[i] > maxWidth {
+			maxWidth = widths[i]
+		}
+	}
+	if len(lines) == 0 || maxWidth == 0 {
+		return nil, fmt.Errorf("nothing to render")
+	}
 
 	// Add some padding
 	padding := 10
-	width := w + padding*2
-	height := h + padding*2
+	textHeight := metrics.Ascent + lineHeight*fixed.Int26_6(len(lines)-1) + metrics.Descent
+	width := maxWidth.Ceil() + padding*2
+	height := textHeight.Ceil() + padding*2
 
 	// Create RGBA image (transparent background)
 	img := image.NewRGBA(image.Rect(0, 0, width, height))
 
 	// Setup drawer
 	drawer.Dst = img
-	drawer.Src = image.NewUniform(color.RGBA{128, 128, 128, 77}) // Color: Grey (0.5), Alpha 0.3 (~77/255)
-	// Note: api.TextWatermark uses "col:0.5 0.5 0.5, op:0.3".
-	// image/draw handles alpha premultiplication.
-	// Actually, pdfcpu handles opacity ('op:0.3') separately for images if we pass it in configuration.
-	// If we bake alpha into the pixel, and THEN pdfcpu applies opacity, it might be double-faded.
-	// Current plan: Generate fully opaque grey text (0.5, 0.5, 0.5) and let pdfcpu handle "op:0.3".
-	drawer.Src = image.NewUniform(color.RGBA{128, 128, 128, 255})
-
-	// Set dot position (baseline)
-	// Text starts at padding, and baseline is roughly -Min.Y + padding
-	baselineY := -bounds.Min.Y + fixed.I(padding)
-	drawer.Dot = fixed.Point26_6{
-		X: fixed.I(padding),
-		Y: baselineY,
+	// Generate fully opaque text and let pdfcpu handle the opacity ("op:"),
+	// baking alpha into the pixels as well would double-fade the watermark.
+	drawer.Src = image.NewUniform(color.RGBA{colorByte(rgb[0]), colorByte(rgb[1]), colorByte(rgb[2]), 255})
+
+	// Draw each line centred, baselines lineHeight apart
+	baselineY := metrics.Ascent + fixed.I(padding)
+	for i, line := range lines {
+		drawer.Dot = fixed.Point26_6{
+			X: fixed.I(padding) + (maxWidth-widths[i])/2,
+			Y: baselineY + lineHeight*fixed.Int26_6(i),
+		}
+		drawer.DrawString(line)
 	}
 
-	// Draw
-	drawer.DrawString(text)
-
 	// Encode to PNG
 	var buf bytes.Buffer
 	if err := png.Encode(&buf, img); err != nil {
@@ -93,3 +150,8 @@ func renderTextToPNG(text string, fontSize float64) ([]byte, error) {
 
 	return buf.Bytes(), nil
 }
+
+// colorByte converts a 0..1 color component to 0..255
+func colorByte(c float64) uint8 {
+	return uint8(math.Round(math.Max(0, math.Min(1, c)) * 255))
+}
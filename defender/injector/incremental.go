@@ -0,0 +1,252 @@
+package injector
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// Incremental signing appends the anchors as a PDF incremental update: the
+// original bytes stay as they are, followed by the new and changed objects and
+// a new xref section. A digital signature covers a byte range of the original
+// file, so it stays intact; a full rewrite through pdfcpu's writer moves every
+// object and invalidates it.
+
+// ErrNoChangesAllowed indicates a document certified with DocMDP P=1, which
+// allows no change at all, not even an incremental update
+var ErrNoChangesAllowed = errors.New("document is certified with no changes allowed")
+
+// contextInjector is implemented by anchors that can inject into an already
+// parsed PDF. Only these can sign incrementally: all anchors work on the same
+// parsed document, whose changes are then appended in one update.
+type contextInjector interface {
+	injectContext(c context.Context, ctx *model.Context, payload []byte) error
+}
+
+// notIncrementalReason explains why an anchor is unavailable when signing incrementally
+const notIncrementalReason = "cannot be applied incrementally"
+
+// injection is one anchor applied to the parsed document
+type injection struct {
+	anchor  contextInjector
+	payload []byte
+}
+
+// executeIncrementalChain injects every anchor into one parsed copy of src and
+// returns the signed copy: the original bytes plus an incremental update
+func executeIncrementalChain(c context.Context, src []byte, message string, payload []byte, anchorsToUse []Anchor) ([]byte, []string, error) {
+	ctx, digests, err := readForIncrement(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	// pdfcpu raises the version in memory while stamping; keep the declared one
+	version := ctx.XRefTable.Version()
+	events := reporterFrom(c)
+	switch p := certificationLevel(ctx); {
+	case p == 1:
+		return nil, nil, fmt.Errorf("%w (DocMDP P=1)", ErrNoChangesAllowed)
+	case p > 1:
+		events.warn("document is certified (DocMDP P=%d); the signatures stay intact, but validators will list the anchors as changes the certification does not allow", p)
+	}
+
+	var applied []injection
+	var anchorNames []string
+	for i, anchor := range anchorsToUse {
+		if err := c.Err(); err != nil {
+			return nil, nil, err
+		}
+		events.started(anchor.Name(), i+1, len(anchorsToUse))
+
+		ci, ok := anchor.(contextInjector)
+		if !ok {
+			events.failed(anchor.Name(), i+1, len(anchorsToUse), errors.New(notIncrementalReason))
+			continue
+		}
+		// Visual anchor displays plaintext; others use encrypted payload
+		inj := injection{anchor: ci, payload: payload}
+		if anchor.Name() == AnchorNameVisual {
+			inj.payload = []byte(message)
+		}
+
+		if err := ci.injectContext(c, ctx, inj.payload); err != nil {
+			if isCancellation(err) {
+				return nil, nil, err
+			}
+			events.failed(anchor.Name(), i+1, len(anchorsToUse), err)
+			// The failed anchor may have changed the document halfway: start
+			// over from the source with the anchors that succeeded
+			if ctx, digests, err = replayInjections(c, src, applied); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		applied = append(applied, inj)
+		anchorNames = append(anchorNames, anchor.Name())
+		events.finished(anchor.Name(), i+1, len(anchorsToUse))
+	}
+
+	if len(applied) == 0 {
+		if len(anchorsToUse) == 1 {
+			return nil, nil, fmt.Errorf("failed to inject %s and it was the only anchor", anchorsToUse[0].Name())
+		}
+		return nil, nil, fmt.Errorf("failed to inject any anchors")
+	}
+
+	// Attachments live in the name tree cache until it is written back
+	if err := ctx.BindNameTrees(); err != nil {
+		return nil, nil, fmt.Errorf("failed to update name trees: %w", err)
+	}
+	// The header is part of the original bytes: declare the version the anchors
+	// may need (PDF 1.7 for attachment collection items) in the catalog instead
+	if version < model.V17 {
+		root, err := ctx.Catalog()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read catalog: %w", err)
+		}
+		root["Version"] = types.Name(model.V17.String())
+	}
+	changed := changedObjects(ctx, digests)
+	var output bytes.Buffer
+	if err := writeIncrement(ctx, src, &output, changed); err != nil {
+		return nil, nil, err
+	}
+
+	events.note("Signature mode: %d-anchor strategy (%s), incremental update of %d objects", len(anchorNames), strings.Join(anchorNames, ", "), len(changed))
+	return output.Bytes(), anchorNames, nil
+}
+
+// readForIncrement parses src and digests every object, so the objects the
+// anchors add or change can be told apart from the untouched ones
+func readForIncrement(src []byte) (*model.Context, map[int][sha256.Size]byte, error) {
+	ctx, err := readPDF(src)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read context: %w", err)
+	}
+
+	// Objects in object streams are parsed on first use; parse them all now
+	// so an object read later does not look changed
+	for _, e := range ctx.Table {
+		if e == nil {
+			continue
+		}
+		if lazy, ok := e.Object.(types.LazyObjectStreamObject); ok {
+			o, err := lazy.DecodedObject(context.Background())
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to parse object stream: %w", err)
+			}
+			e.Object = o
+		}
+	}
+
+	digests := make(map[int][sha256.Size]byte, len(ctx.Table))
+	for nr, e := range ctx.Table {
+		if e != nil && !e.Free && e.Object != nil {
+			digests[nr] = objectDigest(e.Object)
+		}
+	}
+	return ctx, digests, nil
+}
+
+// replayInjections re-reads src and applies the given injections again
+func replayInjections(c context.Context, src []byte, injections []injection) (*model.Context, map[int][sha256.Size]byte, error) {
+	ctx, digests, err := readForIncrement(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, inj := range injections {
+		if err := inj.anchor.injectContext(c, ctx, inj.payload); err != nil {
+			return nil, nil, fmt.Errorf("failed to re-apply anchor: %w", err)
+		}
+	}
+	return ctx, digests, nil
+}
+
+// objectDigest hashes an object's serialized form, including stream data
+func objectDigest(o types.Object) [sha256.Size]byte {
+	h := sha256.New()
+	io.WriteString(h, o.PDFString())
+	if sd, ok := o.(types.StreamDict); ok {
+		h.Write(sd.Raw)
+	}
+	var sum [sha256.Size]byte
+	h.Sum(sum[:0])
+	return sum
+}
+
+// changedObjects returns the numbers of the objects added or changed since digests were taken
+func changedObjects(ctx *model.Context, digests map[int][sha256.Size]byte) []int {
+	var changed []int
+	for nr, e := range ctx.Table {
+		if nr == 0 || e == nil || e.Free || e.Object == nil {
+			continue
+		}
+		if d, ok := digests[nr]; !ok || d != objectDigest(e.Object) {
+			changed = append(changed, nr)
+		}
+	}
+	sort.Ints(changed)
+	return changed
+}
+
+// writeIncrement writes src followed by an incremental update holding
+// objNrs. The update uses an xref stream if the source does.
+func writeIncrement(ctx *model.Context, src []byte, w io.Writer, objNrs []int) error {
+	var buf bytes.Buffer
+	buf.Write(src)
+	if n := len(src); n > 0 && src[n-1] != '\n' && src[n-1] != '\r' {
+		// The update must start on a new line after %%EOF
+		buf.WriteByte('\n')
+	}
+
+	ctx.Write.Increment = true
+	ctx.Write.Offset = int64(buf.Len())
+	ctx.Write.ObjNrs = objNrs
+	ctx.WriteObjectStream = false
+	ctx.WriteXRefStream = ctx.Read.UsingXRefStreams
+	if err := api.WriteIncrement(ctx, &buf); err != nil {
+		return fmt.Errorf("failed to write incremental update: %w", err)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// certificationLevel returns the DocMDP permission level of a certified
+// document: 1 allows no changes, 2 form filling and signing, 3 also
+// annotations. It returns 0 for documents that are not certified.
+func certificationLevel(ctx *model.Context) int {
+	root, err := ctx.Catalog()
+	if err != nil {
+		return 0
+	}
+	perms, err := ctx.DereferenceDict(root["Perms"])
+	if err != nil || perms == nil {
+		return 0
+	}
+	sig, err := ctx.DereferenceDict(perms["DocMDP"])
+	if err != nil || sig == nil {
+		return 0
+	}
+	refs, _ := ctx.DereferenceArray(sig["Reference"])
+	for _, o := range refs {
+		ref, err := ctx.DereferenceDict(o)
+		if err != nil || ref == nil || ref.NameEntry("TransformMethod") == nil || *ref.NameEntry("TransformMethod") != "DocMDP" {
+			continue
+		}
+		params, _ := ctx.DereferenceDict(ref["TransformParams"])
+		if p := params.IntEntry("P"); p != nil {
+			return *p
+		}
+	}
+	// P defaults to 2
+	return 2
+}
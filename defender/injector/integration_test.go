@@ -4,9 +4,25 @@
 package injector
 
 import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"errors"
+	"flag"
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
 )
 
 const (
@@ -76,7 +92,7 @@ func TestAnchorCombinations(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// 1. Sign
-			err := Sign(testPDFPath, testMessage, testKey, tt.selectedAnchors)
+			_, err := Sign(testPDFPath, testMessage, testKey, tt.selectedAnchors)
 			if err != nil {
 				t.Fatalf("Sign failed: %v", err)
 			}
@@ -111,3 +127,1262 @@ func TestAnchorCombinations(t *testing.T) {
 		})
 	}
 }
+
+// TestConcurrentSignVerify signs the same source for several recipients in
+// parallel and verifies every copy in parallel. Run with -race.
+func TestConcurrentSignVerify(t *testing.T) {
+	// Skip if test PDF doesn't exist
+	if _, err := os.Stat(testPDFPath); os.IsNotExist(err) {
+		t.Skip("Test PDF not found, skipping integration test")
+	}
+
+	const copies = 6
+	outDir := t.TempDir()
+	anchors := []string{"Attachment", "Content", "Visual"}
+
+	outputs := make([]string, copies)
+	errs := make([]error, copies)
+	var wg sync.WaitGroup
+	for i := 0; i < copies; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			outputs[i] = filepath.Join(outDir, fmt.Sprintf("copy_%d.pdf", i))
+			_, errs[i] = SignTo(testPDFPath, outputs[i], fmt.Sprintf("UserID:%d", i), testKey32, anchors)
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("Concurrent sign %d failed: %v", i, err)
+		}
+	}
+
+	messages := make([]string, copies)
+	for i := 0; i < copies; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			messages[i], _, errs[i] = Verify(outputs[i], testKey32, nil)
+		}(i)
+	}
+	wg.Wait()
+	for i := 0; i < copies; i++ {
+		if errs[i] != nil {
+			t.Fatalf("Concurrent verify %d failed: %v", i, errs[i])
+		}
+		if want := fmt.Sprintf("UserID:%d", i); messages[i] != want {
+			t.Errorf("Copy %d message mismatch: got '%s', want '%s'", i, messages[i], want)
+		}
+	}
+
+	// No intermediate files may be left behind
+	entries, err := os.ReadDir(outDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != copies {
+		t.Errorf("Expected %d files in output dir, found %d", copies, len(entries))
+	}
+}
+
+// TestExtractShownTextVisual tests that both Visual watermark paths can be read back
+func TestExtractShownTextVisual(t *testing.T) {
+	// Skip if test PDF doesn't exist
+	if _, err := os.Stat(testPDFPath); os.IsNotExist(err) {
+		t.Skip("Test PDF not found, skipping integration test")
+	}
+
+	for _, msg := range []string{"UserID:12345 alice@example.com", "Конфиденциально Иванов UserID:42"} {
+		t.Run(msg, func(t *testing.T) {
+			output := filepath.Join(t.TempDir(), "visual.pdf")
+			if _, err := SignTo(testPDFPath, output, msg, testKey32, []string{"Visual"}); err != nil {
+				t.Fatalf("Sign failed: %v", err)
+			}
+
+			texts, err := ExtractShownText(output)
+			if err != nil {
+				t.Fatalf("ExtractShownText failed: %v", err)
+			}
+			want := strings.Join(strings.Fields(msg), "")
+			for _, text := range texts {
+				if strings.Contains(strings.Join(strings.Fields(text), ""), want) {
+					return
+				}
+			}
+			t.Errorf("Watermark text %q not found in %d text blocks", msg, len(texts))
+		})
+	}
+}
+
+// TestPlanSign tests the plan for the sample PDF and that Sign follows it
+func TestPlanSign(t *testing.T) {
+	if _, err := os.Stat(testPDFPath); os.IsNotExist(err) {
+		t.Skip("Test PDF not found, skipping integration test")
+	}
+
+	plan, err := PlanSign(testPDFPath, "UserID:12345", nil)
+	if err != nil {
+		t.Fatalf("PlanSign failed: %v", err)
+	}
+	if plan.PageCount == 0 || plan.ImageCount == 0 {
+		t.Fatalf("Unexpected document stats: %+v", plan)
+	}
+	if !reflect.DeepEqual(plan.Anchors, DefaultAnchors) || len(plan.Notes()) != 0 {
+		t.Errorf("Expected every default anchor to be usable: %v %v", plan.Anchors, plan.Notes())
+	}
+	for _, e := range plan.Estimates {
+		if !e.Available || e.OverheadBytes <= 0 || e.Robustness == "" {
+			t.Errorf("Incomplete estimate: %+v", e)
+		}
+	}
+
+	out := filepath.Join(t.TempDir(), "planned.pdf")
+	result, err := SignTo(testPDFPath, out, "UserID:12345", "12345678901234567890123456789012", []string{"Attachment", "Bogus"})
+	if err != nil {
+		t.Fatalf("SignTo failed: %v", err)
+	}
+	if !reflect.DeepEqual(result.Anchors, []string{"Attachment"}) || !reflect.DeepEqual(result.Plan.Skipped, []string{"Bogus"}) {
+		t.Errorf("Sign did not follow the plan: %v, %+v", result.Anchors, result.Plan)
+	}
+}
+
+// TestSignOutputSafety tests overwrite protection and atomic in-place signing
+func TestSignOutputSafety(t *testing.T) {
+	if _, err := os.Stat(testPDFPath); os.IsNotExist(err) {
+		t.Skip("Test PDF not found, skipping integration test")
+	}
+	src, err := os.ReadFile(testPDFPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in.pdf")
+	if err := os.WriteFile(input, src, 0600); err != nil {
+		t.Fatal(err)
+	}
+	opts := SignOptions{Anchors: []string{"Attachment"}}
+
+	existing := filepath.Join(dir, "existing.pdf")
+	os.WriteFile(existing, []byte("keep me"), 0644)
+	if _, err := SignWithOptions(input, existing, "UserID:1", testKey32, opts); !errors.Is(err, ErrOutputExists) {
+		t.Errorf("Expected ErrOutputExists, got %v", err)
+	}
+	if data, _ := os.ReadFile(existing); string(data) != "keep me" {
+		t.Error("Existing output was modified")
+	}
+
+	// In place: the input is replaced atomically and keeps its permissions
+	opts.Overwrite = true
+	result, err := SignWithOptions(input, input, "UserID:2", testKey32, opts)
+	if err != nil {
+		t.Fatalf("In-place sign failed: %v", err)
+	}
+	if result.OutputPath != input {
+		t.Errorf("OutputPath = %s, want %s", result.OutputPath, input)
+	}
+	if info, _ := os.Stat(input); info.Mode().Perm() != 0600 {
+		t.Errorf("Mode not preserved: %v", info.Mode())
+	}
+	if msg, _, err := Verify(input, testKey32, nil); err != nil || msg != "UserID:2" {
+		t.Errorf("Verify after in-place sign: %q, %v", msg, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("Temp files left behind: %v", entries)
+	}
+}
+
+// TestVerifyErrors tests that verification failures are told apart
+func TestVerifyErrors(t *testing.T) {
+	if _, err := os.Stat(testPDFPath); os.IsNotExist(err) {
+		t.Skip("Test PDF not found, skipping integration test")
+	}
+	signed := filepath.Join(t.TempDir(), "signed.pdf")
+	if _, err := SignTo(testPDFPath, signed, "UserID:1", testKey32, []string{"Attachment"}); err != nil {
+		t.Fatalf("SignTo failed: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		file string
+		key  string
+		want error
+	}{
+		{"Unsigned", testPDFPath, testKey32, ErrNoPayload},
+		{"Wrong key", signed, "abcdefghijklmnopqrstuvwxyz123456", ErrDecryptFailed},
+		{"Missing file", filepath.Join(t.TempDir(), "missing.pdf"), testKey32, ErrFileNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := Verify(tt.file, tt.key, nil); !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+// TestFragmentedAnchors tests that anchors spread over pages and images survive
+// the removal of some of them
+func TestFragmentedAnchors(t *testing.T) {
+	if _, err := os.Stat(testPDFPath); os.IsNotExist(err) {
+		t.Skip("Test PDF not found, skipping integration test")
+	}
+	dir := t.TempDir()
+	signed := filepath.Join(dir, "signed.pdf")
+	if _, err := SignTo(testPDFPath, signed, "UserID:1", testKey32, []string{"SMask", "Content"}); err != nil {
+		t.Fatalf("SignTo failed: %v", err)
+	}
+
+	// Every image carries the SMask payload, not just the first
+	ctx, err := api.ReadContextFile(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	images := findImageXObjects(ctx)
+	carried := 0
+	for _, ref := range images {
+		img, err := getImageObject(ctx, ref)
+		if err != nil || img.IndirectRefEntry("SMask") == nil {
+			continue
+		}
+		mask, err := getImageObject(ctx, *img.IndirectRefEntry("SMask"))
+		if err != nil {
+			continue
+		}
+		data, err := newBudget(DefaultLimits).decodeStream(&mask, 0)
+		if err != nil {
+			continue
+		}
+		w, h, _ := getImageDimensions(&mask)
+		if _, err := extractLSB(data, w, h); err == nil {
+			carried++
+		}
+	}
+	if carried < 2 {
+		t.Errorf("SMask payload carried by %d images, want all masked images", carried)
+	}
+
+	if t.Failed() {
+		return
+	}
+
+	// Every page of a ten-page document carries the whole Content payload,
+	// so an excerpt of one page is still traceable
+	ten := filepath.Join(dir, "ten.pdf")
+	if err := api.MergeCreateFile([]string{testPDFPath, testPDFPath}, ten, false, nil); err != nil {
+		t.Fatalf("MergeCreateFile failed: %v", err)
+	}
+	signedTen := filepath.Join(dir, "signed-ten.pdf")
+	if _, err := SignTo(ten, signedTen, "UserID:1", testKey32, []string{"Content"}); err != nil {
+		t.Fatalf("SignTo failed: %v", err)
+	}
+	for _, page := range []string{"1", "7", "10"} {
+		excerpt := filepath.Join(dir, "page-"+page+".pdf")
+		if err := api.TrimFile(signedTen, excerpt, []string{page}, nil); err != nil {
+			t.Fatalf("TrimFile failed: %v", err)
+		}
+		if msg, _, err := Verify(excerpt, testKey32, []string{"Content"}); err != nil || msg != "UserID:1" {
+			t.Errorf("Page %s alone: %q, %v", page, msg, err)
+		}
+	}
+}
+
+// TestSMaskRecompression tests that the SMask payload survives a cleaner that
+// decodes every mask to its pixels and compresses it again, both in new masks
+// and in the sample's own
+func TestSMaskRecompression(t *testing.T) {
+	if _, err := os.Stat(testPDFPath); os.IsNotExist(err) {
+		t.Skip("Test PDF not found, skipping integration test")
+	}
+	dir := t.TempDir()
+
+	// A copy whose images have no masks gets new ones
+	ctx, err := api.ReadContextFile(testPDFPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ref := range findImageXObjects(ctx) {
+		if img, err := getImageObject(ctx, ref); err == nil {
+			img.Delete("SMask")
+		}
+	}
+	unmasked := filepath.Join(dir, "unmasked.pdf")
+	if err := api.WriteContextFile(ctx, unmasked); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, source := range []string{testPDFPath, unmasked} {
+		t.Run(filepath.Base(source), func(t *testing.T) {
+			signed := filepath.Join(dir, "signed-"+filepath.Base(source))
+			if _, err := SignTo(source, signed, "UserID:1", testKey32, []string{"SMask"}); err != nil {
+				t.Fatalf("SignTo failed: %v", err)
+			}
+
+			ctx, err := api.ReadContextFile(signed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			masks := 0
+			for _, ref := range findImageXObjects(ctx) {
+				img, err := getImageObject(ctx, ref)
+				if err != nil || img.IndirectRefEntry("SMask") == nil {
+					continue
+				}
+				maskRef := img.IndirectRefEntry("SMask")
+				entry, _ := ctx.Find(int(maskRef.ObjectNumber))
+				mask := entry.Object.(types.StreamDict)
+				width, height, err := getImageDimensions(&mask)
+				if err != nil {
+					t.Fatal(err)
+				}
+				pixels, err := newBudget(DefaultLimits).decodeStream(&mask, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				pixels = pixels[:width*height]
+				if source == unmasked && bytes.IndexFunc(pixels, func(r rune) bool { return r < 254 }) >= 0 {
+					t.Errorf("New mask of image %d is not opaque", ref.ObjectNumber)
+				}
+
+				// Canonicalize: exactly width*height pixels, recompressed
+				raw, err := compressFlate(pixels)
+				if err != nil {
+					t.Fatal(err)
+				}
+				length := int64(len(raw))
+				mask.Raw, mask.Content, mask.StreamLength = raw, pixels, &length
+				mask.Update("Length", types.Integer(length))
+				entry.Object = mask
+				masks++
+			}
+			if masks < 2 {
+				t.Fatalf("Only %d masks in the signed copy", masks)
+			}
+			cleaned := filepath.Join(dir, "cleaned-"+filepath.Base(source))
+			if err := api.WriteContextFile(ctx, cleaned); err != nil {
+				t.Fatal(err)
+			}
+
+			msg, _, err := Verify(cleaned, testKey32, []string{"SMask"})
+			if err != nil || msg != "UserID:1" {
+				t.Errorf("SMask after recompression: %q, %v", msg, err)
+			}
+		})
+	}
+}
+
+// TestAttachmentCamouflage tests that the attachment is described as a text
+// file and that copies attaching the raw payload still verify
+func TestAttachmentCamouflage(t *testing.T) {
+	if _, err := os.Stat(testPDFPath); os.IsNotExist(err) {
+		t.Skip("Test PDF not found, skipping integration test")
+	}
+	dir := t.TempDir()
+	signed := filepath.Join(dir, "signed.pdf")
+	if _, err := SignTo(testPDFPath, signed, "UserID:1", testKey32, []string{"Attachment"}); err != nil {
+		t.Fatalf("SignTo failed: %v", err)
+	}
+
+	ctx, err := api.ReadContextFile(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.XRefTable.LocateNameTree("EmbeddedFiles", false); err != nil {
+		t.Fatal(err)
+	}
+	spec, _, sd, err := attachmentStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc, err := ctx.DereferenceStringOrHexLiteral(spec["Desc"], model.V10, nil); err != nil || desc != attachDesc {
+		t.Errorf("Description %q, %v", desc, err)
+	}
+	if st := sd.Dict.NameEntry("Subtype"); st == nil || *st != attachMIMEType {
+		t.Errorf("MIME type %v", st)
+	}
+	text, err := newBudget(DefaultLimits).decodeStream(sd, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := sd.Dict.DictEntry("Params")
+	sum := md5.Sum(text)
+	if params == nil || params["CreationDate"] == nil {
+		t.Fatalf("Params %s", params.PDFString())
+	}
+	if checksum, _ := params["CheckSum"].(types.HexLiteral); !strings.EqualFold(checksum.Value(), fmt.Sprintf("%x", sum)) {
+		t.Errorf("CheckSum %s, want MD5 %x", params.PDFString(), sum)
+	}
+	if !strings.HasPrefix(string(text), "Copyright") || textEntropy(text) > 5.5 {
+		t.Errorf("Attachment does not read as the license (entropy %.2f)", textEntropy(text))
+	}
+
+	// Earlier versions attached the encrypted payload itself
+	crypto, err := NewCryptoManager([]byte(testKey32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := crypto.Encrypt("UserID:legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, err = api.ReadContextFile(testPDFPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.AddAttachment(model.Attachment{Reader: bytes.NewReader(payload), ID: attachName}, true); err != nil {
+		t.Fatal(err)
+	}
+	legacy := filepath.Join(dir, "legacy.pdf")
+	if err := api.WriteContextFile(ctx, legacy); err != nil {
+		t.Fatal(err)
+	}
+	if msg, _, err := Verify(legacy, testKey32, []string{"Attachment"}); err != nil || msg != "UserID:legacy" {
+		t.Errorf("Legacy attachment: %q, %v", msg, err)
+	}
+}
+
+// TestTamperEvidence tests that our own anchors leave the page digests intact
+// and that removed and altered pages are reported
+func TestTamperEvidence(t *testing.T) {
+	if _, err := os.Stat(testPDFPath); os.IsNotExist(err) {
+		t.Skip("Test PDF not found, skipping integration test")
+	}
+	dir := t.TempDir()
+	signed := filepath.Join(dir, "signed.pdf")
+	res, err := SignWithOptions(testPDFPath, signed, "UserID:1", testKey32, SignOptions{TamperEvidence: true})
+	if err != nil {
+		t.Fatalf("SignWithOptions failed: %v", err)
+	}
+	if len(res.Anchors) != len(DefaultAnchors) || res.DigestedPages == 0 {
+		t.Fatalf("Signed with %v, %d page digests", res.Anchors, res.DigestedPages)
+	}
+	pages := res.DigestedPages
+
+	// Append text to page 2, disguised as a watermark shown with our font
+	ctx, err := api.ReadContextFile(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pageDict, _, _, err := ctx.PageDict(2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sd, _ := ctx.XRefTable.NewStreamDictForBuf([]byte("/Artifact <</Subtype /Watermark>> BDC BT /" + contentFontResName + " 12 Tf 72 72 Td (Approved) Tj ET EMC"))
+	if err := sd.Encode(); err != nil {
+		t.Fatal(err)
+	}
+	ref, err := ctx.XRefTable.IndRefForNewObject(*sd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, _ := ctx.DereferenceArray(pageDict["Contents"])
+	pageDict["Contents"] = append(contents, *ref)
+	altered := filepath.Join(dir, "altered.pdf")
+	if err := api.WriteContextFile(ctx, altered); err != nil {
+		t.Fatal(err)
+	}
+
+	removed := filepath.Join(dir, "removed.pdf")
+	if err := api.RemovePagesFile(signed, removed, []string{"3"}, nil); err != nil {
+		t.Fatalf("RemovePagesFile failed: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		file string
+		want IntegrityReport
+	}{
+		{"Intact", signed, IntegrityReport{SignedPages: pages, CurrentPages: pages}},
+		{"Altered", altered, IntegrityReport{SignedPages: pages, CurrentPages: pages,
+			Modified: []PageChange{{SignedPage: 2, CurrentPage: 2, Text: true}}}},
+		{"Removed", removed, IntegrityReport{SignedPages: pages, CurrentPages: pages - 1, Removed: []int{3}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := VerifyDetailed(tt.file, testKey32, VerifyOptions{})
+			if err != nil {
+				t.Fatalf("VerifyDetailed failed: %v", err)
+			}
+			if res.Message != "UserID:1" || res.Integrity == nil {
+				t.Fatalf("Got %q, integrity %v", res.Message, res.Integrity)
+			}
+			if !reflect.DeepEqual(*res.Integrity, tt.want) {
+				t.Errorf("Integrity = %+v, want %+v", *res.Integrity, tt.want)
+			}
+		})
+	}
+
+	// The page digests lengthen the payload, not the whitespace of a line
+	ctx, err = api.ReadContextFile(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.XRefTable.LocateNameTree("EmbeddedFiles", false); err != nil {
+		t.Fatal(err)
+	}
+	_, _, sd, err = attachmentStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := newBudget(DefaultLimits).decodeStream(sd, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run := maxTrailingRun(text); run > maxTrailingWhitespace {
+		t.Errorf("A line of the %d-page license ends in %d whitespace characters", pages, run)
+	}
+
+	// Copies signed without tamper evidence carry no digests
+	plain := filepath.Join(dir, "plain.pdf")
+	if _, err := SignTo(testPDFPath, plain, "UserID:1", testKey32, []string{"Attachment"}); err != nil {
+		t.Fatal(err)
+	}
+	if res, err := VerifyDetailed(plain, testKey32, VerifyOptions{}); err != nil || res.Integrity != nil {
+		t.Errorf("Plain copy: %+v, %v", res, err)
+	}
+}
+
+// TestEncryptedInput tests signing and verifying password-protected PDFs
+func TestEncryptedInput(t *testing.T) {
+	if _, err := os.Stat(testPDFPath); os.IsNotExist(err) {
+		t.Skip("Test PDF not found, skipping integration test")
+	}
+
+	tests := []struct {
+		name string
+		conf *model.Configuration
+	}{
+		{"AES-256", model.NewAESConfiguration("reader", "owner", 256)},
+		{"AES-128", model.NewAESConfiguration("reader", "owner", 128)},
+		{"RC4-128", model.NewRC4Configuration("reader", "owner", 128)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			encrypted := filepath.Join(dir, "encrypted.pdf")
+			tt.conf.Permissions = model.PermissionsNone
+			if err := api.EncryptFile(testPDFPath, encrypted, tt.conf); err != nil {
+				t.Fatalf("EncryptFile failed: %v", err)
+			}
+			before, err := readFileWithPasswords(encrypted, "", "owner")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			signed := filepath.Join(dir, "signed.pdf")
+			if _, err := SignWithOptions(encrypted, signed, "UserID:1", testKey32, SignOptions{}); !errors.Is(err, ErrWrongPassword) {
+				t.Fatalf("Sign without password: expected ErrWrongPassword, got %v", err)
+			}
+			res, err := SignWithOptions(encrypted, signed, "UserID:1", testKey32, SignOptions{UserPassword: "reader", TamperEvidence: true})
+			if err != nil {
+				t.Fatalf("SignWithOptions failed: %v", err)
+			}
+			if len(res.Anchors) != len(DefaultAnchors) {
+				t.Errorf("Signed with %v", res.Anchors)
+			}
+
+			// Same algorithm, permissions and passwords as the source
+			after, err := readFileWithPasswords(signed, "", "owner")
+			if err != nil {
+				t.Fatalf("Owner password no longer opens the signed copy: %v", err)
+			}
+			if after.E == nil || after.E.R != before.E.R || after.E.V != before.E.V || after.E.L != before.E.L || after.E.P != before.E.P {
+				t.Errorf("Encryption changed: %+v, want %+v", after.E, before.E)
+			}
+			if after.AES4Streams != before.AES4Streams {
+				t.Errorf("AES4Streams = %v, want %v", after.AES4Streams, before.AES4Streams)
+			}
+
+			if _, _, err := VerifyWithOptions(signed, testKey32, VerifyOptions{}); !errors.Is(err, ErrWrongPassword) {
+				t.Errorf("Verify without password: expected ErrWrongPassword, got %v", err)
+			}
+			for _, opts := range []VerifyOptions{{UserPassword: "reader"}, {OwnerPassword: "owner"}} {
+				res, err := VerifyDetailed(signed, testKey32, opts)
+				if err != nil {
+					t.Fatalf("VerifyDetailed failed: %v", err)
+				}
+				if res.Message != "UserID:1" || res.Integrity == nil || !res.Integrity.Intact() {
+					t.Errorf("Got %q, integrity %+v", res.Message, res.Integrity)
+				}
+			}
+			for _, name := range DefaultAnchors {
+				if name == AnchorNameVisual {
+					continue
+				}
+				anchor := NewAnchorRegistry().GetAnchorByName(name)
+				if _, err := ExtractWithOptions(anchor, signed, VerifyOptions{UserPassword: "reader"}); err != nil {
+					t.Errorf("%s: %v", name, err)
+				}
+			}
+		})
+	}
+}
+
+// TestIncrementalSign tests that incremental signing keeps the source bytes as
+// they are and refuses documents certified with no changes allowed
+func TestIncrementalSign(t *testing.T) {
+	if _, err := os.Stat(testPDFPath); os.IsNotExist(err) {
+		t.Skip("Test PDF not found, skipping integration test")
+	}
+	dir := t.TempDir()
+	src, err := os.ReadFile(testPDFPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed := filepath.Join(dir, "signed.pdf")
+	res, err := SignWithOptions(testPDFPath, signed, "UserID:1", testKey32, SignOptions{Incremental: true, TamperEvidence: true})
+	if err != nil {
+		t.Fatalf("SignWithOptions failed: %v", err)
+	}
+	if len(res.Anchors) != len(DefaultAnchors) {
+		t.Errorf("Signed with %v", res.Anchors)
+	}
+	out, err := os.ReadFile(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) <= len(src) || !bytes.Equal(out[:len(src)], src) {
+		t.Fatal("Signed copy does not start with the source bytes")
+	}
+
+	vres, err := VerifyDetailed(signed, testKey32, VerifyOptions{})
+	if err != nil {
+		t.Fatalf("VerifyDetailed failed: %v", err)
+	}
+	if vres.Message != "UserID:1" || vres.Integrity == nil || !vres.Integrity.Intact() {
+		t.Errorf("Got %q, integrity %+v", vres.Message, vres.Integrity)
+	}
+	for _, name := range DefaultAnchors {
+		if name == AnchorNameVisual {
+			continue
+		}
+		anchor := NewAnchorRegistry().GetAnchorByName(name)
+		if _, err := anchor.Extract(signed); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	// Certify the source: P=1 allows no changes, P=2 allows signing
+	for _, p := range []int{1, 2} {
+		ctx, err := api.ReadContextFile(testPDFPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig, err := ctx.IndRefForNewObject(types.Dict{
+			"Type": types.Name("Sig"),
+			"Reference": types.Array{types.Dict{
+				"Type":            types.Name("SigRef"),
+				"TransformMethod": types.Name("DocMDP"),
+				"TransformParams": types.Dict{"Type": types.Name("TransformParams"), "P": types.Integer(p)},
+			}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		root, err := ctx.Catalog()
+		if err != nil {
+			t.Fatal(err)
+		}
+		root["Perms"] = types.Dict{"DocMDP": *sig}
+		certified := filepath.Join(dir, fmt.Sprintf("certified%d.pdf", p))
+		if err := api.WriteContextFile(ctx, certified); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = SignWithOptions(certified, filepath.Join(dir, fmt.Sprintf("signed%d.pdf", p)), "UserID:1", testKey32, SignOptions{Incremental: true})
+		if p == 1 && !errors.Is(err, ErrNoChangesAllowed) {
+			t.Errorf("P=1: expected ErrNoChangesAllowed, got %v", err)
+		}
+		if p == 2 && err != nil {
+			t.Errorf("P=2: %v", err)
+		}
+	}
+
+	encrypted := filepath.Join(dir, "encrypted.pdf")
+	if err := api.EncryptFile(testPDFPath, encrypted, model.NewAESConfiguration("reader", "owner", 256)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SignWithOptions(encrypted, filepath.Join(dir, "signed-encrypted.pdf"), "UserID:1", testKey32, SignOptions{UserPassword: "reader", Incremental: true}); err == nil {
+		t.Error("Expected incremental signing of an encrypted PDF to fail")
+	}
+}
+
+// makePDFA writes a copy of the test PDF that claims PDF/A conformance: XMP
+// metadata matching its document information and an RGB output intent
+func makePDFA(t *testing.T, dst string, level PDFALevel) {
+	t.Helper()
+	ctx, err := api.ReadContextFile(testPDFPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx.WriteObjectStream = false
+	ctx.WriteXRefStream = false
+	plain, err := writePDF(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The writer stamped its own producer and dates: describe those in XMP
+	ctx, digests, err := readForIncrement(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := ctx.DereferenceDict(*ctx.Info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	props := fmt.Sprintf(`pdfaid:part="%d" pdfaid:conformance="%s"`, level.Part, level.Conformance)
+	for _, k := range infoXMPKeys {
+		v, err := ctx.DereferenceStringOrHexLiteral(info[k.info], model.V10, nil)
+		if err != nil || v == "" {
+			continue
+		}
+		if d, ok := types.DateTime(v, true); ok {
+			v = d.Format(time.RFC3339)
+		}
+		props += fmt.Sprintf(` %s="%s"`, k.xmp, v)
+	}
+	xmp := `<?xpacket begin="" id="W5M0MpCehiHzreSzNTczkc9d"?><x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` +
+		`<rdf:Description rdf:about="" xmlns:pdfaid="http://www.aiim.org/pdfa/ns/id/" xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmlns:pdf="http://ns.adobe.com/pdf/1.3/" ` +
+		props + `/></rdf:RDF></x:xmpmeta><?xpacket end="w"?>`
+
+	metadata := types.NewStreamDict(types.Dict{"Type": types.Name("Metadata"), "Subtype": types.Name("XML")}, 0, nil, nil, nil)
+	metadata.Content = []byte(xmp)
+	if err := metadata.Encode(); err != nil {
+		t.Fatal(err)
+	}
+	profile, err := ctx.NewStreamDictForBuf([]byte("placeholder ICC profile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile.InsertInt("N", 3)
+	if err := profile.Encode(); err != nil {
+		t.Fatal(err)
+	}
+	metadataRef, err := ctx.IndRefForNewObject(metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	profileRef, err := ctx.IndRefForNewObject(*profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := ctx.Catalog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	root["Metadata"] = *metadataRef
+	root["OutputIntents"] = types.Array{types.Dict{
+		"Type":                      types.Name("OutputIntent"),
+		"S":                         types.Name("GTS_PDFA1"),
+		"OutputConditionIdentifier": types.StringLiteral("sRGB"),
+		"DestOutputProfile":         *profileRef,
+	}}
+	var out bytes.Buffer
+	if err := writeIncrement(ctx, plain, &out, changedObjects(ctx, digests)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dst, out.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readFileWithPasswords is readContextWithPasswords for the PDF at filePath
+func readFileWithPasswords(filePath, userPW, ownerPW string) (*model.Context, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return readContextWithPasswords(context.Background(), bytes.NewReader(data), userPW, ownerPW)
+}
+
+// TestPDFASign tests that signing keeps a PDF/A claim: anchors the level
+// forbids are substituted and the copy breaks no rule the source kept
+func TestPDFASign(t *testing.T) {
+	if _, err := os.Stat(testPDFPath); os.IsNotExist(err) {
+		t.Skip("Test PDF not found, skipping integration test")
+	}
+	dir := t.TempDir()
+
+	tests := []struct {
+		level       PDFALevel
+		incremental bool
+		want        []string
+	}{
+		{PDFALevel{1, "B"}, false, []string{"Content", "Visual"}},
+		{PDFALevel{2, "B"}, false, []string{"SMask", "Content", "Visual"}},
+		{PDFALevel{2, "B"}, true, []string{"SMask", "Content", "Visual"}},
+		{PDFALevel{3, "B"}, false, DefaultAnchors},
+	}
+	for _, tt := range tests {
+		name := tt.level.String()
+		if tt.incremental {
+			name += " incremental"
+		}
+		t.Run(name, func(t *testing.T) {
+			src := filepath.Join(dir, fmt.Sprintf("pdfa%d%s-%v.pdf", tt.level.Part, tt.level.Conformance, tt.incremental))
+			makePDFA(t, src, tt.level)
+			before, err := CheckPDFA(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if before.Level == nil || *before.Level != tt.level {
+				t.Fatalf("Fixture claims %v", before.Level)
+			}
+
+			signed := filepath.Join(dir, "signed-"+filepath.Base(src))
+			res, err := SignWithOptions(src, signed, "UserID:1", testKey32, SignOptions{Incremental: tt.incremental})
+			if err != nil {
+				t.Fatalf("SignWithOptions failed: %v", err)
+			}
+			if res.PDFA != tt.level.String() {
+				t.Errorf("PDFA = %q", res.PDFA)
+			}
+			got := append([]string(nil), res.Anchors...)
+			want := append([]string(nil), tt.want...)
+			sort.Strings(got)
+			sort.Strings(want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Signed with %v, want %v", res.Anchors, tt.want)
+			}
+
+			after, err := CheckPDFA(signed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			old := make(map[string]bool)
+			for _, v := range before.Violations {
+				old[v] = true
+			}
+			for _, v := range after.Violations {
+				if !old[v] {
+					t.Errorf("New violation: %s", v)
+				}
+			}
+			if msg, _, err := Verify(signed, testKey32, nil); err != nil || msg != "UserID:1" {
+				t.Errorf("Verify = %q, %v", msg, err)
+			}
+		})
+	}
+
+	// An attachment injected regardless of the plan breaks PDF/A-1
+	src := filepath.Join(dir, "pdfa1B-false.pdf")
+	forced := filepath.Join(dir, "forced.pdf")
+	if err := NewAnchorRegistry().GetAnchorByName("Attachment").Inject(src, forced, []byte("payload")); err != nil {
+		t.Fatal(err)
+	}
+	report, err := CheckPDFA(forced)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(strings.Join(report.Violations, "\n"), "PDF/A-1 forbids embedded files") {
+		t.Errorf("Attachment not reported: %q", report.Violations)
+	}
+}
+
+// TestDeterministicSign tests that a seed gives byte-identical copies, both
+// when rewriting the file and when signing incrementally
+func TestDeterministicSign(t *testing.T) {
+	if _, err := os.Stat(testPDFPath); os.IsNotExist(err) {
+		t.Skip("Test PDF not found, skipping integration test")
+	}
+	for _, incremental := range []bool{false, true} {
+		t.Run(fmt.Sprintf("incremental=%v", incremental), func(t *testing.T) {
+			dir := t.TempDir()
+			var anchors []string
+			sign := func(name, seed string) []byte {
+				out := filepath.Join(dir, name)
+				opts := SignOptions{TamperEvidence: true, Incremental: incremental, DeterministicSeed: []byte(seed)}
+				result, err := SignWithOptions(testPDFPath, out, "UserID:1", testKey32, opts)
+				if err != nil {
+					t.Fatalf("SignWithOptions failed: %v", err)
+				}
+				anchors = result.Anchors
+				data, err := os.ReadFile(out)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return data
+			}
+
+			first := sign("first.pdf", "golden")
+			if !bytes.Equal(first, sign("second.pdf", "golden")) {
+				t.Errorf("Same seed gave different copies (anchors %v)", anchors)
+			}
+			if bytes.Equal(first, sign("other.pdf", "other")) {
+				t.Error("Different seeds gave the same copy")
+			}
+			if !incremental && len(anchors) != len(DefaultAnchors) {
+				t.Errorf("Full rewrite embedded %v, want %v", anchors, DefaultAnchors)
+			}
+			// A seed only fixes the nonce, dates and file ID: the copy is laid
+			// out exactly like one signed without it
+			if !incremental {
+				unseeded := filepath.Join(dir, "unseeded.pdf")
+				opts := SignOptions{TamperEvidence: true}
+				if _, err := SignWithOptions(testPDFPath, unseeded, "UserID:1", testKey32, opts); err != nil {
+					t.Fatalf("SignWithOptions failed: %v", err)
+				}
+				data, err := os.ReadFile(unseeded)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got, want := objectLayout(t, first), objectLayout(t, data); !reflect.DeepEqual(got, want) {
+					t.Errorf("Seeded copy laid out differently:\n%v\nwant\n%v", got, want)
+				}
+			}
+			vres, err := VerifyDetailed(filepath.Join(dir, "first.pdf"), testKey32, VerifyOptions{})
+			if err != nil || vres.Message != "UserID:1" || !vres.Integrity.Intact() {
+				t.Errorf("VerifyDetailed = %+v, %v", vres, err)
+			}
+		})
+	}
+
+	// The canonical rewrite keeps a PDF/A source conforming
+	dir := t.TempDir()
+	pdfa := filepath.Join(dir, "pdfa.pdf")
+	makePDFA(t, pdfa, PDFALevel{1, "B"})
+	signed := filepath.Join(dir, "signed-pdfa.pdf")
+	if _, err := SignWithOptions(pdfa, signed, "UserID:1", testKey32, SignOptions{DeterministicSeed: []byte("golden")}); err != nil {
+		t.Fatalf("SignWithOptions failed: %v", err)
+	}
+	before, err := CheckPDFA(pdfa)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := CheckPDFA(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after.Violations) > len(before.Violations) {
+		t.Errorf("Violations after signing: %q", after.Violations)
+	}
+
+	encrypted := filepath.Join(dir, "encrypted.pdf")
+	if err := api.EncryptFile(testPDFPath, encrypted, model.NewAESConfiguration("reader", "owner", 256)); err != nil {
+		t.Fatal(err)
+	}
+	opts := SignOptions{UserPassword: "reader", DeterministicSeed: []byte("golden")}
+	if _, err := SignWithOptions(encrypted, filepath.Join(dir, "signed-encrypted.pdf"), "UserID:1", testKey32, opts); err == nil {
+		t.Error("Expected deterministic signing of an encrypted PDF to fail")
+	}
+}
+
+// objectLayout describes every object of a PDF by number: its kind and its
+// dictionary keys, leaving out the values
+func objectLayout(t *testing.T, data []byte) []string {
+	t.Helper()
+	ctx, err := readPDF(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var layout []string
+	for objNr := 1; objNr < *ctx.Size; objNr++ {
+		o, err := ctx.Dereference(*types.NewIndirectRef(objNr, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var d types.Dict
+		switch o := o.(type) {
+		case types.Dict:
+			d = o
+		case types.StreamDict:
+			d = o.Dict
+		}
+		keys := make([]string, 0, len(d))
+		for k := range d {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		layout = append(layout, fmt.Sprintf("%d %T %v", objNr, o, keys))
+	}
+	return layout
+}
+
+// TestSignBytes tests signing and verifying in memory: the results match the
+// file API and no copy of the document is written to disk
+func TestSignBytes(t *testing.T) {
+	src, err := os.ReadFile(testPDFPath)
+	if os.IsNotExist(err) {
+		t.Skip("Test PDF not found, skipping integration test")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	encrypted := func() []byte {
+		var buf bytes.Buffer
+		if err := api.Encrypt(bytes.NewReader(src), &buf, model.NewAESConfiguration("reader", "owner", 256)); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}()
+
+	tests := []struct {
+		name string
+		src  []byte
+		opts SignOptions
+	}{
+		{"full rewrite", src, SignOptions{TamperEvidence: true}},
+		{"incremental", src, SignOptions{Anchors: []string{"Attachment", "SMask", "Content"}, Incremental: true}},
+		{"encrypted", encrypted, SignOptions{Anchors: []string{"Attachment", "Content"}, UserPassword: "reader"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signed, res, err := SignBytes(context.Background(), tt.src, "UserID:1", testKey32, tt.opts)
+			if err != nil {
+				t.Fatalf("SignBytes failed: %v", err)
+			}
+			// Encrypted sources are planned on their decrypted copy
+			if res.OutputPath != "" || res.Plan.File != "" || (tt.opts.UserPassword == "" && res.Plan.FileSize != int64(len(tt.src))) {
+				t.Errorf("Result = %+v, plan %+v", res, res.Plan)
+			}
+			if tt.opts.Incremental && !bytes.HasPrefix(signed, tt.src) {
+				t.Error("Incremental copy does not start with the source")
+			}
+			vres, err := VerifyBytes(context.Background(), signed, testKey32, VerifyOptions{UserPassword: tt.opts.UserPassword})
+			if err != nil || vres.Message != "UserID:1" {
+				t.Fatalf("VerifyBytes = %+v, %v", vres, err)
+			}
+			if tt.opts.TamperEvidence && !vres.Integrity.Intact() {
+				t.Errorf("Integrity = %+v", vres.Integrity)
+			}
+			for _, name := range res.Anchors {
+				anchor := NewAnchorRegistry().GetAnchorByName(name).(ReaderAnchor)
+				if name == AnchorNameVisual || tt.opts.UserPassword != "" {
+					continue
+				}
+				if _, err := anchor.ExtractReader(context.Background(), bytes.NewReader(signed)); err != nil {
+					t.Errorf("%s ExtractReader failed: %v", name, err)
+				}
+			}
+		})
+	}
+
+	// The same seed gives the same copy through the file and the memory API
+	opts := SignOptions{DeterministicSeed: []byte("golden")}
+	var out bytes.Buffer
+	if _, err := SignReader(context.Background(), bytes.NewReader(src), &out, "UserID:1", testKey32, opts); err != nil {
+		t.Fatalf("SignReader failed: %v", err)
+	}
+	if entries, err := os.ReadDir(tmp); err != nil || len(entries) != 0 {
+		t.Fatalf("Signing in memory wrote %d files to the temp directory: %v", len(entries), err)
+	}
+	file := filepath.Join(t.TempDir(), "signed.pdf")
+	if _, err := SignWithOptions(testPDFPath, file, "UserID:1", testKey32, opts); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(file); err != nil || !bytes.Equal(data, out.Bytes()) {
+		t.Errorf("SignReader and SignWithOptions differ: %v", err)
+	}
+
+	if _, err := VerifyBytes(context.Background(), src, testKey32, VerifyOptions{}); !errors.Is(err, ErrNoPayload) {
+		t.Errorf("Unsigned source: expected ErrNoPayload, got %v", err)
+	}
+	if _, err := VerifyReader(context.Background(), bytes.NewReader(out.Bytes()), "short", VerifyOptions{}); !errors.Is(err, ErrInvalidKeySize) {
+		t.Errorf("Short key: expected ErrInvalidKeySize, got %v", err)
+	}
+	if _, _, err := SignBytes(context.Background(), nil, "UserID:1", testKey32, SignOptions{}); err == nil {
+		t.Error("Expected an empty source to be refused")
+	}
+}
+
+// TestSignProgress tests the page progress of signing the sample and that
+// cancelling in the middle of an anchor leaves no output behind
+func TestSignProgress(t *testing.T) {
+	if _, err := os.Stat(testPDFPath); os.IsNotExist(err) {
+		t.Skip("Test PDF not found, skipping integration test")
+	}
+	outputPath := filepath.Join(t.TempDir(), "signed.pdf")
+
+	pages := map[string]int{}
+	var last Event
+	handler := EventFunc(func(e Event) {
+		if e.Type == EventPageProgress {
+			if e.Page < 1 || e.Page > e.Pages {
+				t.Errorf("page progress %d/%d", e.Page, e.Pages)
+			}
+			pages[e.Anchor] = e.Page
+		}
+		last = e
+	})
+	opts := SignOptions{Anchors: []string{"Visual", "Content"}, TamperEvidence: true, Events: handler}
+	if _, err := SignContext(context.Background(), testPDFPath, outputPath, "UserID:1", testKey32, opts); err != nil {
+		t.Fatalf("SignContext failed: %v", err)
+	}
+	// Digests, Visual and Content each go through every page
+	if len(pages) != 3 || pages[""] != pages["Visual"] || pages[""] != pages["Content"] || pages[""] == 0 {
+		t.Errorf("last page reported per anchor = %v", pages)
+	}
+	info, err := os.Stat(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last.Type != EventBytesWritten || last.Bytes != info.Size() {
+		t.Errorf("last event = %+v, want %d bytes written", last, info.Size())
+	}
+
+	// Cancel on the Content anchor's first page
+	c, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cancelled := filepath.Join(t.TempDir(), "cancelled.pdf")
+	opts.Events = EventFunc(func(e Event) {
+		if e.Type == EventPageProgress && e.Anchor == "Content" {
+			cancel()
+		}
+	})
+	if _, err := SignContext(c, testPDFPath, cancelled, "UserID:1", testKey32, opts); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled SignContext = %v", err)
+	}
+	if _, err := os.Stat(cancelled); !os.IsNotExist(err) {
+		t.Errorf("cancelled sign left output: %v", err)
+	}
+
+	// Verification reports the integrity check's pages and can be cancelled there
+	vc, vcancel := context.WithCancel(context.Background())
+	defer vcancel()
+	vopts := VerifyOptions{Events: EventFunc(func(e Event) {
+		if e.Type == EventPageProgress {
+			vcancel()
+		}
+	})}
+	if _, err := VerifyContext(vc, outputPath, testKey32, vopts); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled VerifyContext = %v", err)
+	}
+}
+
+// TestLibraryQuiet tests that signing and verifying print nothing; progress
+// only goes to SignOptions.Events and VerifyOptions.Events
+func TestLibraryQuiet(t *testing.T) {
+	src, err := os.ReadFile(testPDFPath)
+	if err != nil {
+		t.Skip("Test PDF not found, skipping integration test")
+	}
+	out, err := os.Create(filepath.Join(t.TempDir(), "output.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = out, out
+	defer func() { os.Stdout, os.Stderr = stdout, stderr }()
+
+	signed, _, err := SignBytes(context.Background(), src, "UserID:1", testKey32, SignOptions{Anchors: []string{"Attachment", "SMask", "Content", "Visual"}})
+	if err == nil {
+		// Extract SMask, the anchor with the most diagnostics
+		_, err = VerifyBytes(context.Background(), signed, testKey32, VerifyOptions{Anchors: []string{"SMask", "Content", "Attachment"}})
+	}
+	os.Stdout, os.Stderr = stdout, stderr
+	if err != nil {
+		t.Fatal(err)
+	}
+	printed, err := os.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(printed) > 0 {
+		t.Errorf("library printed:\n%s", printed)
+	}
+}
+
+var writeFuzzCorpus = flag.Bool("update-fuzz-seeds", false, "regenerate the fuzz seed corpus in testdata/fuzz from a signed copy of the test PDF")
+
+// TestWriteFuzzCorpus signs the test PDF and stores what each extractor parses
+// as fuzz seeds: go test -tags integration -run TestWriteFuzzCorpus ./injector -args -update-fuzz-seeds
+func TestWriteFuzzCorpus(t *testing.T) {
+	if !*writeFuzzCorpus {
+		t.Skip("run with -update-fuzz-seeds to regenerate the fuzz seed corpus")
+	}
+	signed := filepath.Join(t.TempDir(), "signed.pdf")
+	if _, err := SignTo(testPDFPath, signed, "UserID:12345", testKey32, []string{"Attachment", "SMask", "Content"}); err != nil {
+		t.Fatalf("SignTo failed: %v", err)
+	}
+	ctx, err := api.ReadContextFile(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, a := range []Anchor{NewAttachmentAnchor(), NewSMaskAnchor(), NewContentAnchor()} {
+		payload, err := a.Extract(signed)
+		if err != nil {
+			t.Fatalf("%s extract failed: %v", a.Name(), err)
+		}
+		writeFuzzSeed(t, "FuzzDecrypt", "signed-"+strings.ToLower(a.Name()), payload)
+		writeFuzzSeed(t, "FuzzContentRoundTrip", "signed-"+strings.ToLower(a.Name()), payload)
+	}
+
+	if err := ctx.XRefTable.LocateNameTree("EmbeddedFiles", false); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, sd, err := attachmentStream(ctx); err == nil {
+		text, err := newBudget(DefaultLimits).decodeStream(sd, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeFuzzSeed(t, "FuzzDecodeLicense", "signed", text)
+	}
+
+	for _, img := range findImageXObjects(ctx) {
+		sd, err := getImageObject(ctx, img)
+		if err != nil || sd.IndirectRefEntry("SMask") == nil {
+			continue
+		}
+		obj, err := ctx.Dereference(*sd.IndirectRefEntry("SMask"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		mask := obj.(types.StreamDict)
+		// Decoded masks now carry the payload in megabytes of pixels; the
+		// FuzzFindPayloadInMaskData seed stays from a copy with an appended
+		// payload
+		writeFuzzSeed(t, "FuzzDecodeStream", "signed", mask.Raw, true)
+		break
+	}
+
+	if err := api.OptimizeContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	content := NewContentAnchor()
+	for objNr := 1; objNr <= *ctx.XRefTable.Size; objNr++ {
+		entry, found := ctx.Find(objNr)
+		if !found || entry.Free || entry.Object == nil {
+			continue
+		}
+		sd, ok := entry.Object.(types.StreamDict)
+		if !ok || sd.Subtype() != nil || sd.Decode() != nil {
+			continue
+		}
+		if _, found := content.parseContentStreamForPayload(string(sd.Content)); found {
+			writeFuzzSeed(t, "FuzzParseContentStream", "signed", string(sd.Content))
+			break
+		}
+	}
+}
+
+// writeFuzzSeed writes one seed in the go test fuzz v1 corpus format
+func writeFuzzSeed(t *testing.T, target, name string, args ...interface{}) {
+	t.Helper()
+	var b strings.Builder
+	b.WriteString("go test fuzz v1\n")
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case []byte:
+			fmt.Fprintf(&b, "[]byte(%s)\n", strconv.Quote(string(v)))
+		case string:
+			fmt.Fprintf(&b, "string(%s)\n", strconv.Quote(v))
+		case bool:
+			fmt.Fprintf(&b, "bool(%t)\n", v)
+		default:
+			t.Fatalf("unsupported seed type %T", arg)
+		}
+	}
+	dir := filepath.Join("testdata", "fuzz", target)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(b.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
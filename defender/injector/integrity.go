@@ -0,0 +1,464 @@
+package injector
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// Tamper evidence: with SignOptions.TamperEvidence the encrypted payload also
+// records a digest of every page's normalized content, so verification can
+// tell which pages were modified, added or removed after signing.
+//
+// A page's content is normalized to what it shows, independent of how the
+// file is written: the text its text operators show (decoded through the
+// fonts' ToUnicode CMaps) in content order, and the decoded data of the image
+// XObjects it paints, form XObjects included. Inline images are not covered.
+//
+// Digests are HMAC-SHA256 under a key derived from the signing key, cut to
+// 64 bits each, so a page cannot be edited to keep its digest without the key.
+//
+// Our own marks are left out, and only them: while signing, every operator
+// range an anchor adds to a page (the Content anchor's invisible text, the
+// Visual watermark) is wrapped in a /PhantomMark marked-content sequence whose
+// /MAC authenticates the exact bytes it encloses under a key derived from the
+// signing key and the payload. A sequence is skipped only when its MAC
+// verifies, so forged marks, look-alike font names and watermark artifacts
+// added later all count as content.
+//
+// Sealed plaintext:
+//
+//	message | pageDigestMarker | page count (2) | per page: text digest (8) | image digest (8)
+var pageDigestMarker = []byte{0x00, 'P', 'D', '2'}
+
+const (
+	pageDigestSize = 16
+	// maxDigestPages keeps the sealed payload (32 KiB of digests) well within
+	// the 64 KiB payload limit of fragments and the attachment text
+	maxDigestPages = 2048
+)
+
+// ErrTooManyPages indicates a document is too long for tamper evidence
+var ErrTooManyPages = fmt.Errorf("tamper evidence supports at most %d pages", maxDigestPages)
+
+// pageDigest is the truncated keyed digest of one page's normalized content
+type pageDigest struct {
+	text   uint64
+	images uint64
+}
+
+// sealPageDigests appends page digests to a message
+func sealPageDigests(message string, digests []pageDigest) []byte {
+	out := make([]byte, 0, len(message)+len(pageDigestMarker)+2+pageDigestSize*len(digests))
+	out = append(out, message...)
+	out = append(out, pageDigestMarker...)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(digests)))
+	for _, d := range digests {
+		out = binary.BigEndian.AppendUint64(out, d.text)
+		out = binary.BigEndian.AppendUint64(out, d.images)
+	}
+	return out
+}
+
+// splitPageDigests separates a plaintext into the message and its page digests,
+// nil when the copy was signed without tamper evidence
+func splitPageDigests(plaintext []byte) (string, []pageDigest) {
+	at := bytes.LastIndex(plaintext, pageDigestMarker)
+	if at < 0 {
+		return string(plaintext), nil
+	}
+	rest := plaintext[at+len(pageDigestMarker):]
+	if len(rest) < 2 {
+		return string(plaintext), nil
+	}
+	n := int(binary.BigEndian.Uint16(rest))
+	rest = rest[2:]
+	if len(rest) != n*pageDigestSize {
+		return string(plaintext), nil
+	}
+	digests := make([]pageDigest, n)
+	for i := range digests {
+		digests[i].text = binary.BigEndian.Uint64(rest[i*pageDigestSize:])
+		digests[i].images = binary.BigEndian.Uint64(rest[i*pageDigestSize+8:])
+	}
+	return string(plaintext[:at]), digests
+}
+
+// pageDigestKey derives the key of the page digests from the signing key
+func (c *CryptoManager) pageDigestKey() []byte {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte("page digests"))
+	return mac.Sum(nil)
+}
+
+// pageMarkTag names the marked-content sequences wrapping our marks
+const pageMarkTag = "PhantomMark"
+
+// pageMarkMACSize is the truncated MAC length in a page mark
+const pageMarkMACSize = 16
+
+// pageMarks wraps and recognizes the content our anchors add to pages
+type pageMarks struct {
+	key []byte
+}
+
+// pageMarks derives the mark key of one signed copy from its payload
+func (c *CryptoManager) pageMarks(payload []byte) *pageMarks {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte("page marks"))
+	mac.Write(payload)
+	return &pageMarks{key: mac.Sum(nil)}
+}
+
+// sum is the MAC of the content a mark encloses, surrounding whitespace excluded
+func (m *pageMarks) sum(content []byte) []byte {
+	mac := hmac.New(sha256.New, m.key)
+	mac.Write(bytes.TrimFunc(content, func(r rune) bool { return r < 0x80 && isPDFWhitespace(byte(r)) }))
+	return mac.Sum(nil)[:pageMarkMACSize]
+}
+
+// wrap returns content enclosed in a mark, or unchanged when m is nil
+func (m *pageMarks) wrap(content []byte) []byte {
+	if m == nil {
+		return content
+	}
+	return fmt.Appendf(nil, "/%s <</MAC <%x>>> BDC\n%s\nEMC\n", pageMarkTag, m.sum(content), content)
+}
+
+// valid reports whether mac authenticates the content of a mark
+func (m *pageMarks) valid(content, mac []byte) bool {
+	return m != nil && hmac.Equal(m.sum(content), mac)
+}
+
+type pageMarksKey struct{}
+
+// withPageMarks returns a context whose anchors wrap what they add to pages in m
+func withPageMarks(c context.Context, m *pageMarks) context.Context {
+	return context.WithValue(c, pageMarksKey{}, m)
+}
+
+// pageMarksFrom returns the page marks carried by c, nil when there are none
+func pageMarksFrom(c context.Context) *pageMarks {
+	m, _ := c.Value(pageMarksKey{}).(*pageMarks)
+	return m
+}
+
+// digestPages computes the page digests of the PDF in r under key within a
+// budget, leaving out the content enclosed in valid marks (none when marks is nil)
+func digestPages(r io.ReadSeeker, b *budget, key []byte, marks *pageMarks) ([]pageDigest, error) {
+	ctx, err := b.readContext(r)
+	if err != nil {
+		return nil, err
+	}
+	return digestContext(ctx, b, key, marks)
+}
+
+// digestContext computes the digest of every page of a parsed PDF, reporting
+// progress to the budget's context
+func digestContext(ctx *model.Context, b *budget, key []byte, marks *pageMarks) ([]pageDigest, error) {
+	if ctx.PageCount > maxDigestPages {
+		return nil, ErrTooManyPages
+	}
+	d := &pageDigester{
+		textExtractor: &textExtractor{ctx: ctx, budget: b, fonts: make(map[int]*shownFont)},
+		marks:         marks,
+	}
+	digests := make([]pageDigest, ctx.PageCount)
+	for pageNr := 1; pageNr <= ctx.PageCount; pageNr++ {
+		if err := b.checkTime(); err != nil {
+			return nil, err
+		}
+		pageDict, _, inhPAttrs, err := ctx.PageDict(pageNr, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read page %d: %w", pageNr, err)
+		}
+		if pageDict == nil {
+			continue
+		}
+		content, err := d.pageContent(pageDict)
+		if d.err != nil {
+			return nil, d.err
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode page %d: %w", pageNr, err)
+		}
+
+		d.text, d.images = newDigestHashes(key)
+		d.visited = make(map[int]bool)
+		d.walk(content, inhPAttrs.Resources, 0)
+		if d.err != nil {
+			return nil, d.err
+		}
+		digests[pageNr-1] = pageDigest{text: sum64(d.text), images: sum64(d.images)}
+		if err := pageDone(b.c, pageNr, ctx.PageCount); err != nil {
+			return nil, err
+		}
+	}
+	return digests, nil
+}
+
+// newDigestHashes returns the keyed hashes of one page's text and images
+func newDigestHashes(key []byte) (text, images hash.Hash) {
+	return hmac.New(sha256.New, key), hmac.New(sha256.New, key)
+}
+
+// sum64 truncates a digest to 64 bits
+func sum64(h hash.Hash) uint64 {
+	return binary.BigEndian.Uint64(h.Sum(nil))
+}
+
+// pageDigester hashes the normalized content of one page at a time
+type pageDigester struct {
+	*textExtractor
+	marks   *pageMarks
+	text    hash.Hash
+	images  hash.Hash
+	visited map[int]bool // Form XObjects already walked on this page
+}
+
+// walk hashes one content stream with the given resources
+func (d *pageDigester) walk(content []byte, resources types.Dict, depth int) {
+	var font *shownFont
+	var operands []contentToken
+	shown := func(s string) {
+		d.text.Write([]byte(s))
+		d.text.Write([]byte{'\n'})
+	}
+
+	toks := tokenizeContent(content)
+	for i := 0; i < len(toks); i++ {
+		if d.err != nil {
+			return
+		}
+		tok := toks[i]
+		if tok.kind != tokOperator {
+			operands = append(operands, tok)
+			continue
+		}
+		switch tok.text {
+		case "BDC":
+			if end, ok := d.markEnd(content, toks, i, operands); ok {
+				i = end
+			}
+		case "Tf":
+			if len(operands) >= 2 && operands[len(operands)-2].kind == tokName {
+				font = d.font(resources, operands[len(operands)-2].text)
+			}
+		case "Tj", "'", "\"":
+			if n := len(operands); n > 0 && operands[n-1].kind == tokString {
+				shown(d.show(font, operands[n-1].data))
+			}
+		case "TJ":
+			var sb bytes.Buffer
+			for _, op := range operands {
+				if op.kind == tokString {
+					sb.WriteString(d.show(font, op.data))
+				}
+			}
+			shown(sb.String())
+		case "Do":
+			if n := len(operands); n > 0 && operands[n-1].kind == tokName {
+				d.paint(resources, operands[n-1].text, depth)
+			}
+		}
+		operands = operands[:0]
+	}
+}
+
+// markEnd returns the index of the EMC closing the BDC at toks[at] when the
+// sequence is one of our marks and its MAC verifies
+func (d *pageDigester) markEnd(content []byte, toks []contentToken, at int, operands []contentToken) (int, bool) {
+	if d.marks == nil || len(operands) == 0 || operands[0].kind != tokName || operands[0].text != pageMarkTag {
+		return 0, false
+	}
+	var mac []byte
+	for k := 1; k+1 < len(operands); k++ {
+		if operands[k].kind == tokName && operands[k].text == "MAC" && operands[k+1].kind == tokString {
+			mac = operands[k+1].data
+			break
+		}
+	}
+	if mac == nil {
+		return 0, false
+	}
+
+	nesting := 0
+	for j := at + 1; j < len(toks); j++ {
+		if toks[j].kind != tokOperator {
+			continue
+		}
+		switch toks[j].text {
+		case "BMC", "BDC":
+			nesting++
+		case "EMC":
+			if nesting > 0 {
+				nesting--
+				continue
+			}
+			return j, d.marks.valid(content[toks[at].end:toks[j].start], mac)
+		}
+	}
+	return 0, false
+}
+
+// paint hashes an image XObject or walks a form XObject named in resources
+func (d *pageDigester) paint(resources types.Dict, name string, depth int) {
+	ref, ok := resourceRef(d.ctx, resources, "XObject", name)
+	if !ok {
+		return
+	}
+	sd, _, err := d.ctx.DereferenceStreamDict(ref)
+	if err != nil || sd == nil || sd.Subtype() == nil {
+		return
+	}
+
+	switch *sd.Subtype() {
+	case "Image":
+		data, err := d.decode(sd, ref)
+		if errors.Is(err, ErrLimitExceeded) {
+			return
+		}
+		if err != nil {
+			// Filters we cannot decode (DCT, JPX, ...) are hashed as stored
+			data = sd.Raw
+		}
+		sum := sha256.Sum256(data)
+		d.images.Write(sum[:])
+	case "Form":
+		if depth >= maxFormDepth || d.visited[ref.ObjectNumber.Value()] {
+			return
+		}
+		d.visited[ref.ObjectNumber.Value()] = true
+		content, err := d.decode(sd, ref)
+		if err != nil {
+			return
+		}
+		formResources := resources
+		if fr, err := d.ctx.DereferenceDict(sd.Dict["Resources"]); err == nil && fr != nil {
+			formResources = fr
+		}
+		d.walk(content, formResources, depth+1)
+	}
+}
+
+// IntegrityReport compares the pages of a signed copy with the digests
+// recorded when it was signed with tamper evidence
+type IntegrityReport struct {
+	SignedPages  int `json:"signed_pages"`
+	CurrentPages int `json:"current_pages"`
+	// Modified pairs pages whose content changed
+	Modified []PageChange `json:"modified,omitempty"`
+	// Added lists current page numbers with no counterpart in the signed copy
+	Added []int `json:"added,omitempty"`
+	// Removed lists signed page numbers missing from the current file
+	Removed []int `json:"removed,omitempty"`
+	// Error is set when the current pages could not be digested
+	Error string `json:"error,omitempty"`
+}
+
+// PageChange is a page whose content differs from what was signed
+type PageChange struct {
+	SignedPage  int `json:"signed_page"`
+	CurrentPage int `json:"current_page"`
+	// Text and Images tell which part of the page changed
+	Text   bool `json:"text"`
+	Images bool `json:"images"`
+}
+
+// Intact reports whether every page matches what was signed
+func (r *IntegrityReport) Intact() bool {
+	return r.Error == "" && len(r.Modified) == 0 && len(r.Added) == 0 && len(r.Removed) == 0
+}
+
+// maxAlignCells bounds the page alignment table; larger edits are compared page by page
+const maxAlignCells = 1 << 22
+
+// compareDigests aligns the signed and current pages and reports the differences.
+// Unchanged pages are matched by a longest common subsequence, so inserted and
+// deleted pages do not make every later page look modified; the pages left
+// between two matches are paired up as modified, the surplus reported as added
+// or removed.
+func compareDigests(signed, current []pageDigest) *IntegrityReport {
+	r := &IntegrityReport{SignedPages: len(signed), CurrentPages: len(current)}
+
+	// Unchanged prefix and suffix need no alignment
+	pre := 0
+	for pre < len(signed) && pre < len(current) && signed[pre] == current[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(signed)-pre && suf < len(current)-pre && signed[len(signed)-1-suf] == current[len(current)-1-suf] {
+		suf++
+	}
+	s := signed[pre : len(signed)-suf]
+	c := current[pre : len(current)-suf]
+
+	var matches [][2]int
+	if len(s)*len(c) <= maxAlignCells {
+		matches = alignPages(s, c)
+	}
+	matches = append(matches, [2]int{len(s), len(c)})
+
+	i, j := 0, 0
+	for _, m := range matches {
+		for ; i < m[0] && j < m[1]; i, j = i+1, j+1 {
+			r.Modified = append(r.Modified, PageChange{
+				SignedPage:  pre + i + 1,
+				CurrentPage: pre + j + 1,
+				Text:        s[i].text != c[j].text,
+				Images:      s[i].images != c[j].images,
+			})
+		}
+		for ; i < m[0]; i++ {
+			r.Removed = append(r.Removed, pre+i+1)
+		}
+		for ; j < m[1]; j++ {
+			r.Added = append(r.Added, pre+j+1)
+		}
+		i, j = m[0]+1, m[1]+1
+	}
+	return r
+}
+
+// alignPages returns the index pairs of a longest common subsequence of a and b
+func alignPages(a, b []pageDigest) [][2]int {
+	// lcs[i][j] is the LCS length of a[i:] and b[j:]
+	cols := len(b) + 1
+	lcs := make([]uint16, (len(a)+1)*cols)
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i*cols+j] = lcs[(i+1)*cols+j+1] + 1
+			case lcs[(i+1)*cols+j] >= lcs[i*cols+j+1]:
+				lcs[i*cols+j] = lcs[(i+1)*cols+j]
+			default:
+				lcs[i*cols+j] = lcs[i*cols+j+1]
+			}
+		}
+	}
+
+	var matches [][2]int
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] == b[j]:
+			matches = append(matches, [2]int{i, j})
+			i++
+			j++
+		case lcs[(i+1)*cols+j] >= lcs[i*cols+j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return matches
+}
@@ -0,0 +1,137 @@
+package injector
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestSealPageDigests tests that page digests round-trip and old payloads keep their message
+func TestSealPageDigests(t *testing.T) {
+	digests := []pageDigest{{1, 2}, {0xDEADBEEFCAFEF00D, 0}, {7, 7}}
+	msg, got := splitPageDigests(sealPageDigests("UserID:1", digests))
+	if msg != "UserID:1" || !reflect.DeepEqual(got, digests) {
+		t.Errorf("Round trip: %q %v", msg, got)
+	}
+
+	msg, got = splitPageDigests(sealPageDigests("UserID:1", []pageDigest{}))
+	if msg != "UserID:1" || got == nil || len(got) != 0 {
+		t.Errorf("Empty document: %q %v", msg, got)
+	}
+
+	for _, plain := range []string{"UserID:1", "a\x00PD2", "a\x00PD2\x00\x02abc"} {
+		if msg, got := splitPageDigests([]byte(plain)); msg != plain || got != nil {
+			t.Errorf("splitPageDigests(%q) = %q %v, want the message unchanged", plain, msg, got)
+		}
+	}
+
+	// Decrypt returns the message without the digests
+	cm, err := NewCryptoManager([]byte(testKey32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := cm.seal(sealPageDigests("UserID:1", digests))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg, err := cm.Decrypt(payload); err != nil || msg != "UserID:1" {
+		t.Errorf("Decrypt = %q, %v", msg, err)
+	}
+}
+
+// TestCompareDigests tests how page differences are attributed
+func TestCompareDigests(t *testing.T) {
+	p := func(n uint64) pageDigest { return pageDigest{text: n, images: n} }
+	signed := []pageDigest{p(1), p(2), p(3), p(4), p(5)}
+
+	tests := []struct {
+		name    string
+		current []pageDigest
+		want    IntegrityReport
+	}{
+		{"Intact", signed, IntegrityReport{}},
+		{"Removed", []pageDigest{p(1), p(3), p(4), p(5)}, IntegrityReport{Removed: []int{2}}},
+		{"Added", []pageDigest{p(1), p(2), p(9), p(3), p(4), p(5)}, IntegrityReport{Added: []int{3}}},
+		{"Text modified", []pageDigest{p(1), p(2), {text: 9, images: 3}, p(4), p(5)},
+			IntegrityReport{Modified: []PageChange{{SignedPage: 3, CurrentPage: 3, Text: true}}}},
+		{"Modified and removed", []pageDigest{p(1), {text: 2, images: 9}, p(5)},
+			IntegrityReport{Modified: []PageChange{{SignedPage: 2, CurrentPage: 2, Images: true}}, Removed: []int{3, 4}}},
+		{"Reordered", []pageDigest{p(2), p(1), p(3), p(4), p(5)},
+			IntegrityReport{Added: []int{2}, Removed: []int{1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := compareDigests(signed, tt.current)
+			tt.want.SignedPages, tt.want.CurrentPages = len(signed), len(tt.current)
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("compareDigests = %+v, want %+v", *got, tt.want)
+			}
+			if got.Intact() != (tt.name == "Intact") {
+				t.Errorf("Intact() = %v", got.Intact())
+			}
+		})
+	}
+}
+
+// TestPageDigestNormalization tests that only valid page marks are left out of a page's digest
+func TestPageDigestNormalization(t *testing.T) {
+	cm, err := NewCryptoManager([]byte(testKey32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	marks := cm.pageMarks([]byte("payload"))
+	digest := func(content string) pageDigest {
+		d := &pageDigester{textExtractor: &textExtractor{budget: newBudget(Limits{})}, marks: marks}
+		d.text, d.images = newDigestHashes(cm.pageDigestKey())
+		d.walk([]byte(content), nil, 0)
+		return pageDigest{text: sum64(d.text), images: sum64(d.images)}
+	}
+
+	page := "BT /F1 12 Tf 72 700 Td (Quarterly report) Tj ET"
+	base := digest(page)
+	stamp := "q /GS0 gs BT /F1 40 Tf (UserID:1) Tj ET Q"
+	marked := []string{
+		page + "\n" + string(marks.wrap([]byte(stamp))),
+		page + " Q " + string(marks.wrap([]byte("/Artifact <</Subtype /Watermark /Type /Pagination >>BDC "+stamp+" EMC "))),
+		string(marks.wrap([]byte("q BT /"+contentFontResName+" 1 Tf 3 Tr [ ( ) 202 ] TJ ET Q"))) + page,
+		"q 1 0 0 1 0 0 cm\n" + page + "\nQ",
+	}
+	for _, content := range marked {
+		if got := digest(content); got != base {
+			t.Errorf("Digest changed by our marks:\n%s", content)
+		}
+	}
+
+	other, err := NewCryptoManager([]byte("fedcba9876543210fedcba9876543210"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := string(marks.wrap([]byte(stamp)))
+	forged := []string{
+		page + "\n" + strings.Replace(valid, "UserID:1", "UserID:2", 1),
+		page + "\n" + string(other.pageMarks([]byte("payload")).wrap([]byte(stamp))),
+		page + "\n" + string(cm.pageMarks([]byte("other payload")).wrap([]byte(stamp))),
+		page + "\n/" + pageMarkTag + " <</MAC <00>>> BDC " + stamp + " EMC",
+		page + "\nq BT /" + contentFontResName + " 1 Tf 3 Tr [ (Added) ] TJ ET Q",
+		page + "\nBT /" + vectorFontResName + " 40 Tf (Added) Tj ET",
+		page + "\n/Artifact <</Subtype /Watermark /Type /Pagination >>BDC " + stamp + " EMC",
+		page + "\n/Span <</ActualText (x)>> BDC BT (Added) Tj ET EMC",
+	}
+	for _, content := range forged {
+		if got := digest(content); got.text == base.text {
+			t.Errorf("Digest kept for content outside a valid mark:\n%s", content)
+		}
+	}
+
+	if got := digest("BT /F1 12 Tf 72 700 Td (Quarterly rep0rt) Tj ET"); got.text == base.text {
+		t.Error("Changed text kept the digest")
+	}
+
+	// The digests are keyed: another signing key digests the same page differently
+	d := &pageDigester{textExtractor: &textExtractor{budget: newBudget(Limits{})}}
+	d.text, d.images = newDigestHashes(other.pageDigestKey())
+	d.walk([]byte(page), nil, 0)
+	if sum64(d.text) == base.text {
+		t.Error("Page digest does not depend on the signing key")
+	}
+}
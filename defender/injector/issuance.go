@@ -0,0 +1,41 @@
+package injector
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"defender/ledger"
+)
+
+// recordIssuance appends the ledger record of a signed copy when opts.Ledger
+// is set. sourceFile and outputFile are recorded unless opts.Issuance names
+// them.
+func recordIssuance(opts SignOptions, src, signed []byte, sourceFile, outputFile, message, key string, result *SignResult) error {
+	if opts.Ledger == nil {
+		return nil
+	}
+	rec := opts.Issuance
+	if rec.SourceFile == "" {
+		rec.SourceFile = sourceFile
+	}
+	if rec.OutputFile == "" {
+		rec.OutputFile = outputFile
+	}
+	rec.SourceSHA256 = ledger.SHA256(src)
+	rec.OutputSHA256 = ledger.SHA256(signed)
+	rec.Message = message
+	rec.KeyID = KeyID([]byte(key))
+	rec.Anchors = result.Anchors
+	if err := opts.Ledger.Append(rec); err != nil {
+		return fmt.Errorf("%w: %v", ErrLedgerRecord, err)
+	}
+	return nil
+}
+
+// absPath returns p as an absolute path, or p itself if that fails
+func absPath(p string) string {
+	if abs, err := filepath.Abs(p); err == nil {
+		return abs
+	}
+	return p
+}
@@ -0,0 +1,137 @@
+package injector
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"defender/ledger"
+)
+
+// TestSignLedger tests that every sign entry point records the copy it hands out
+func TestSignLedger(t *testing.T) {
+	src := generatedPDF(t)
+	dir := t.TempDir()
+	l, err := ledger.Open(filepath.Join(dir, ledger.FileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := SignOptions{
+		Anchors:  []string{"Attachment"},
+		Ledger:   l,
+		Issuance: ledger.Record{Operator: "ops", Recipient: "Alice", SourceFile: "upload.pdf", OutputFile: "upload_signed.pdf"},
+	}
+
+	signed, _, err := SignBytes(context.Background(), src, testMessage, testKey32, opts)
+	if err != nil {
+		t.Fatalf("SignBytes failed: %v", err)
+	}
+	var out bytes.Buffer
+	if _, err := SignReader(context.Background(), bytes.NewReader(src), &out, testMessage, testKey32, opts); err != nil {
+		t.Fatalf("SignReader failed: %v", err)
+	}
+
+	// Files are recorded under their absolute paths unless Issuance names them
+	input := filepath.Join(dir, "in.pdf")
+	output := filepath.Join(dir, "out.pdf")
+	if err := os.WriteFile(input, src, 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts.Issuance.SourceFile, opts.Issuance.OutputFile = "", ""
+	if _, err := SignContext(context.Background(), input, output, testMessage, testKey32, opts); err != nil {
+		t.Fatalf("SignContext failed: %v", err)
+	}
+	written, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := l.Records(ledger.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	copies := []struct {
+		source, output string
+		signed         []byte
+	}{
+		{"upload.pdf", "upload_signed.pdf", signed},
+		{"upload.pdf", "upload_signed.pdf", out.Bytes()},
+		{input, output, written},
+	}
+	if len(records) != len(copies) {
+		t.Fatalf("%d records, want %d", len(records), len(copies))
+	}
+	for i, want := range copies {
+		rec := records[i]
+		if rec.SourceFile != want.source || rec.OutputFile != want.output ||
+			rec.SourceSHA256 != ledger.SHA256(src) || rec.OutputSHA256 != ledger.SHA256(want.signed) {
+			t.Errorf("record %d files: %+v", i, rec)
+		}
+		if rec.Operator != "ops" || rec.Recipient != "Alice" || rec.Message != testMessage ||
+			rec.KeyID != KeyID([]byte(testKey32)) || !reflect.DeepEqual(rec.Anchors, []string{"Attachment"}) || rec.Time.IsZero() {
+			t.Errorf("record %d: %+v", i, rec)
+		}
+	}
+}
+
+// TestSignLedgerFailure tests that a copy the ledger cannot record is not handed out
+func TestSignLedgerFailure(t *testing.T) {
+	src := generatedPDF(t)
+	dir := t.TempDir()
+	// Appending to a directory fails
+	l, err := ledger.Open(filepath.Join(dir, "ledger"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(l.Path(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	opts := SignOptions{Anchors: []string{"Attachment"}, Ledger: l, Overwrite: true}
+
+	if signed, _, err := SignBytes(context.Background(), src, testMessage, testKey32, opts); !errors.Is(err, ErrLedgerRecord) || signed != nil {
+		t.Errorf("SignBytes = %v, %d bytes", err, len(signed))
+	}
+	var out bytes.Buffer
+	if _, err := SignReader(context.Background(), bytes.NewReader(src), &out, testMessage, testKey32, opts); !errors.Is(err, ErrLedgerRecord) || out.Len() != 0 {
+		t.Errorf("SignReader = %v, wrote %d bytes", err, out.Len())
+	}
+
+	input := filepath.Join(dir, "in.pdf")
+	if err := os.WriteFile(input, src, 0644); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "out.pdf")
+	if _, err := SignContext(context.Background(), input, output, testMessage, testKey32, opts); !errors.Is(err, ErrLedgerRecord) {
+		t.Errorf("SignContext = %v", err)
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Errorf("unrecorded copy left behind: %v", err)
+	}
+
+	// Signing in place leaves the source as it was
+	if _, err := SignContext(context.Background(), input, input, testMessage, testKey32, opts); !errors.Is(err, ErrLedgerRecord) {
+		t.Errorf("in-place SignContext = %v", err)
+	}
+	if got, err := os.ReadFile(input); err != nil || !bytes.Equal(got, src) {
+		t.Errorf("source changed: %v", err)
+	}
+
+	// An output signed over keeps its previous contents
+	previous := []byte("%PDF-1.7 earlier copy")
+	if err := os.WriteFile(output, previous, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SignContext(context.Background(), input, output, testMessage, testKey32, opts); !errors.Is(err, ErrLedgerRecord) {
+		t.Errorf("overwriting SignContext = %v", err)
+	}
+	if got, err := os.ReadFile(output); err != nil || !bytes.Equal(got, previous) {
+		t.Errorf("existing output lost: %q, %v", got, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 3 {
+		t.Errorf("temp files left behind: %v", entries)
+	}
+}
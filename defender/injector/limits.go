@@ -0,0 +1,396 @@
+package injector
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/filter"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// Limits bounds the resources extracting anchors from one file may use, so a
+// hostile "leaked" PDF cannot exhaust the memory or time of a verification
+// server with decompression bombs or huge object tables. Zero fields are unlimited.
+type Limits struct {
+	// MaxStreamSize caps the decoded size of any one stream in bytes
+	MaxStreamSize int64 `json:"max_stream_size"`
+	// MaxObjects caps the number of objects a file may have
+	MaxObjects int `json:"max_objects"`
+	// Timeout is the time budget for one file, checked between objects
+	Timeout time.Duration `json:"timeout"`
+}
+
+// DefaultLimits applies to every extraction that does not set its own limits
+var DefaultLimits = Limits{
+	MaxStreamSize: 64 << 20,
+	MaxObjects:    1_000_000,
+	Timeout:       60 * time.Second,
+}
+
+// Limit names reported in LimitError
+const (
+	LimitStreamSize = "stream_size"
+	LimitObjects    = "objects"
+	LimitTime       = "time"
+)
+
+// ErrLimitExceeded indicates a file exceeded a resource limit before it could be
+// fully examined; errors.As with *LimitError tells which one
+var ErrLimitExceeded = errors.New("resource limit exceeded")
+
+// LimitError reports the limit a file exceeded
+type LimitError struct {
+	// Limit is LimitStreamSize, LimitObjects or LimitTime
+	Limit string `json:"limit"`
+	// Max is the configured limit in bytes, objects or milliseconds
+	Max int64 `json:"max"`
+	// Object is the object being decoded, 0 if none
+	Object int `json:"object,omitempty"`
+}
+
+func (e *LimitError) Error() string {
+	switch e.Limit {
+	case LimitStreamSize:
+		if e.Object > 0 {
+			return fmt.Sprintf("%v: object %d decodes to more than %d bytes", ErrLimitExceeded, e.Object, e.Max)
+		}
+		return fmt.Sprintf("%v: stream decodes to more than %d bytes", ErrLimitExceeded, e.Max)
+	case LimitObjects:
+		return fmt.Sprintf("%v: more than %d objects", ErrLimitExceeded, e.Max)
+	default:
+		return fmt.Sprintf("%v: time budget of %v used up", ErrLimitExceeded, time.Duration(e.Max)*time.Millisecond)
+	}
+}
+
+// Is makes errors.Is(err, ErrLimitExceeded) match every LimitError
+func (e *LimitError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
+
+// budget tracks the limits of one file across its extractors
+type budget struct {
+	limits   Limits
+	deadline time.Time
+	// userPW and ownerPW open encrypted files
+	userPW, ownerPW string
+	// c cancels the call the file is read for
+	c context.Context
+}
+
+func newBudget(limits Limits) *budget {
+	b := &budget{limits: limits, c: context.Background()}
+	if limits.Timeout > 0 {
+		b.deadline = time.Now().Add(limits.Timeout)
+	}
+	return b
+}
+
+// withContext makes the budget fail once c is cancelled
+func (b *budget) withContext(c context.Context) *budget {
+	b.c = c
+	return b
+}
+
+// checkTime fails once the file's time budget is used up or its call is
+// cancelled
+func (b *budget) checkTime() error {
+	if err := b.c.Err(); err != nil {
+		return err
+	}
+	if !b.deadline.IsZero() && time.Now().After(b.deadline) {
+		return &LimitError{Limit: LimitTime, Max: b.limits.Timeout.Milliseconds()}
+	}
+	return nil
+}
+
+// readContext parses a PDF within the limits. What pdfcpu decodes while
+// parsing is checked before it parses (see preflight); parsing itself stops
+// once the time budget is used up.
+func (b *budget) readContext(r io.ReadSeeker) (*model.Context, error) {
+	if err := b.checkTime(); err != nil {
+		return nil, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to read context: %w", err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read context: %w", err)
+	}
+	if err := b.preflight(data); err != nil {
+		return nil, err
+	}
+
+	c := b.c
+	if !b.deadline.IsZero() {
+		var cancel context.CancelFunc
+		c, cancel = context.WithDeadline(b.c, b.deadline)
+		defer cancel()
+	}
+	ctx, err := readContextWithPasswords(c, bytes.NewReader(data), b.userPW, b.ownerPW)
+	if err != nil {
+		if c.Err() != nil {
+			// Cancellation wins over the time budget
+			if err := b.checkTime(); err != nil {
+				return nil, err
+			}
+			return nil, &LimitError{Limit: LimitTime, Max: b.limits.Timeout.Milliseconds()}
+		}
+		return nil, fmt.Errorf("failed to read context: %w", err)
+	}
+	if max := b.limits.MaxObjects; max > 0 && *ctx.XRefTable.Size > max {
+		return nil, &LimitError{Limit: LimitObjects, Max: int64(max)}
+	}
+	return ctx, b.checkTime()
+}
+
+// objectHeader finds the start of indirect objects
+var objectHeader = regexp.MustCompile(`(\d+)\s+\d+\s+obj\b`)
+
+// trailerSize finds the object count a trailer claims
+var trailerSize = regexp.MustCompile(`/Size\s+(\d+)`)
+
+// parsedStream finds the types of stream pdfcpu decodes while parsing
+var parsedStream = regexp.MustCompile(`/Type\s*/(ObjStm|XRef|Metadata)\b`)
+
+// preflight checks a PDF against the limits before pdfcpu parses it, since
+// pdfcpu parses in one call without limits: the object count its trailers and
+// cross-reference streams claim, and the decoded size of the streams pdfcpu
+// inflates while parsing (object streams, cross-reference streams and
+// metadata). Streams of encrypted files are only checked after decryption.
+func (b *budget) preflight(data []byte) error {
+	tooMany := func(dict []byte) error {
+		m := trailerSize.FindSubmatch(dict)
+		if m == nil || b.limits.MaxObjects <= 0 {
+			return nil
+		}
+		if n, err := strconv.ParseInt(string(m[1]), 10, 64); err != nil || n > int64(b.limits.MaxObjects) {
+			return &LimitError{Limit: LimitObjects, Max: int64(b.limits.MaxObjects)}
+		}
+		return nil
+	}
+
+	for rest := data; ; {
+		i := bytes.Index(rest, []byte("trailer"))
+		if i < 0 {
+			break
+		}
+		rest = rest[i+len("trailer"):]
+		dict := rest
+		if end := bytes.Index(dict, []byte("startxref")); end >= 0 {
+			dict = dict[:end]
+		}
+		if err := tooMany(dict); err != nil {
+			return err
+		}
+	}
+
+	for _, m := range objectHeader.FindAllSubmatchIndex(data, -1) {
+		if err := b.checkTime(); err != nil {
+			return err
+		}
+		body := data[m[1]:]
+		if end := bytes.Index(body, []byte("endobj")); end >= 0 {
+			body = body[:end]
+		}
+		start := bytes.Index(body, []byte("stream"))
+		if start < 0 {
+			continue
+		}
+		dict := body[:start]
+		t := parsedStream.FindSubmatch(dict)
+		if t == nil {
+			continue
+		}
+		if string(t[1]) == "XRef" {
+			if err := tooMany(dict); err != nil {
+				return err
+			}
+		}
+		if !bytes.Contains(dict, []byte("/FlateDecode")) {
+			continue
+		}
+		// zlib finds the end of the stream itself, so /Length is not needed
+		raw := bytes.TrimLeft(data[m[1]+start+len("stream"):], "\r\n")
+		if _, err := inflate(raw, b.limits.MaxStreamSize); errors.Is(err, ErrLimitExceeded) {
+			objNr, _ := strconv.Atoi(string(data[m[2]:m[3]]))
+			return &LimitError{Limit: LimitStreamSize, Max: b.limits.MaxStreamSize, Object: objNr}
+		}
+	}
+	return nil
+}
+
+// readFile is readContext for the PDF at filePath
+func (b *budget) readFile(filePath string) (*model.Context, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read context: %w", err)
+	}
+	defer f.Close()
+	return b.readContext(f)
+}
+
+// decodeStream decodes a stream without ever holding more than MaxStreamSize
+// decoded bytes. Flate and the ASCII filters are decoded with the limit applied
+// while inflating; other filters (LZW, RunLength, images) are decoded by pdfcpu
+// and checked afterwards.
+func (b *budget) decodeStream(sd *types.StreamDict, objNr int) ([]byte, error) {
+	max := b.limits.MaxStreamSize
+	tooBig := func(n int) error {
+		if max > 0 && int64(n) > max {
+			return &LimitError{Limit: LimitStreamSize, Max: max, Object: objNr}
+		}
+		return nil
+	}
+
+	data := sd.Raw
+	if err := tooBig(len(data)); err != nil {
+		return nil, err
+	}
+	pipeline := sd.FilterPipeline
+	if pipeline == nil {
+		pipeline = filterPipeline(sd.Dict)
+	}
+	for _, f := range pipeline {
+		var err error
+		switch {
+		case f.Name == filter.Flate && f.DecodeParms == nil:
+			data, err = inflate(data, max)
+		case f.Name == filter.ASCIIHex || f.Name == filter.ASCII85:
+			// At most four output bytes per input byte, checked below
+			var fi filter.Filter
+			if fi, err = filter.NewFilter(f.Name, nil); err == nil {
+				var r io.Reader
+				if r, err = fi.Decode(bytes.NewReader(data)); err == nil {
+					data, err = io.ReadAll(r)
+				}
+			}
+		default:
+			// Predictors never grow the inflated data: check its size before pdfcpu decodes it
+			if f.Name == filter.Flate {
+				if _, err = inflate(data, max); err != nil {
+					break
+				}
+			}
+			decoded := types.StreamDict{Dict: sd.Dict, Raw: data, FilterPipeline: []types.PDFFilter{f}}
+			err = decoded.Decode()
+			data = decoded.Content
+		}
+		if err != nil {
+			if errors.Is(err, ErrLimitExceeded) {
+				return nil, &LimitError{Limit: LimitStreamSize, Max: max, Object: objNr}
+			}
+			return nil, err
+		}
+		if err := tooBig(len(data)); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// filterPipeline reads the filters of a stream built in memory, which pdfcpu
+// has not parsed into StreamDict.FilterPipeline
+func filterPipeline(d types.Dict) []types.PDFFilter {
+	parms := d.DictEntry("DecodeParms")
+	switch f := d["Filter"].(type) {
+	case types.Name:
+		return []types.PDFFilter{{Name: f.Value(), DecodeParms: parms}}
+	case types.Array:
+		var pipeline []types.PDFFilter
+		for _, o := range f {
+			if name, ok := o.(types.Name); ok {
+				pipeline = append(pipeline, types.PDFFilter{Name: name.Value()})
+			}
+		}
+		return pipeline
+	}
+	return nil
+}
+
+// inflate decompresses zlib data, failing with ErrLimitExceeded past max bytes
+func inflate(raw []byte, max int64) ([]byte, error) {
+	reader, err := zlib.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zlib reader: %w", err)
+	}
+	defer reader.Close()
+
+	var r io.Reader = reader
+	if max > 0 {
+		r = io.LimitReader(reader, max+1)
+	}
+	data, err := io.ReadAll(r)
+	// Like pdfcpu, accept streams truncated without a final flush or checksum
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, zlib.ErrChecksum) {
+		return nil, fmt.Errorf("failed to decompress: %w", err)
+	}
+	if max > 0 && int64(len(data)) > max {
+		return nil, &LimitError{Limit: LimitStreamSize, Max: max}
+	}
+	return data, nil
+}
+
+// limitedExtractor is implemented by anchors that honour Limits while extracting
+type limitedExtractor interface {
+	extractLimited(r io.ReadSeeker, b *budget) ([]byte, error)
+}
+
+// ExtractWithLimits extracts an anchor's payload within limits. Built-in
+// anchors apply every limit; other anchors are only held to the time budget.
+func ExtractWithLimits(anchor Anchor, filePath string, limits Limits) ([]byte, error) {
+	return extractWithBudget(anchor, filePath, newBudget(limits))
+}
+
+// ExtractWithOptions is ExtractWithLimits with the limits and passwords of
+// opts; opts.Anchors is ignored.
+func ExtractWithOptions(anchor Anchor, filePath string, opts VerifyOptions) ([]byte, error) {
+	return extractWithBudget(anchor, filePath, opts.budget(context.Background()))
+}
+
+func extractWithBudget(anchor Anchor, filePath string, b *budget) ([]byte, error) {
+	if _, ok := anchor.(limitedExtractor); !ok {
+		if err := b.checkTime(); err != nil {
+			return nil, err
+		}
+		payload, err := anchor.Extract(filePath)
+		if err != nil {
+			return nil, err
+		}
+		return payload, b.checkTime()
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read context: %w", err)
+	}
+	defer f.Close()
+	return extractReaderWithBudget(anchor, f, b)
+}
+
+// extractReaderWithBudget extracts an anchor's payload from a PDF held in r.
+// Anchors that only read files cannot extract from a reader.
+func extractReaderWithBudget(anchor Anchor, r io.ReadSeeker, b *budget) ([]byte, error) {
+	if err := b.checkTime(); err != nil {
+		return nil, err
+	}
+	switch a := anchor.(type) {
+	case limitedExtractor:
+		return a.extractLimited(r, b)
+	case ReaderAnchor:
+		payload, err := a.ExtractReader(b.c, r)
+		if err != nil {
+			return nil, err
+		}
+		return payload, b.checkTime()
+	}
+	return nil, fmt.Errorf("%s cannot extract from memory", anchor.Name())
+}
@@ -0,0 +1,220 @@
+package injector
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// flateStream returns a FlateDecode stream dict holding n zero bytes
+func flateStream(t *testing.T, n int) *types.StreamDict {
+	t.Helper()
+	raw, err := compressFlate(make([]byte, n))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sd := types.StreamDict{Dict: types.NewDict(), Raw: raw}
+	sd.InsertName("Filter", "FlateDecode")
+	return &sd
+}
+
+// TestDecodeStreamLimit tests that decoding stops at MaxStreamSize
+func TestDecodeStreamLimit(t *testing.T) {
+	b := newBudget(Limits{MaxStreamSize: 1 << 20})
+
+	data, err := b.decodeStream(flateStream(t, 1<<20), 7)
+	if err != nil || len(data) != 1<<20 {
+		t.Fatalf("Stream at the limit: %d bytes, %v", len(data), err)
+	}
+
+	_, err = b.decodeStream(flateStream(t, 1<<20+1), 7)
+	var le *LimitError
+	if !errors.Is(err, ErrLimitExceeded) || !errors.As(err, &le) {
+		t.Fatalf("Expected a LimitError, got %v", err)
+	}
+	if le.Limit != LimitStreamSize || le.Max != 1<<20 || le.Object != 7 {
+		t.Errorf("Unexpected LimitError %+v", le)
+	}
+
+	// Every stage of a filter pipeline is checked
+	hex := types.StreamDict{Dict: types.NewDict(), Raw: bytes.Repeat([]byte("00"), 1<<20+1)}
+	hex.InsertName("Filter", "ASCIIHexDecode")
+	if _, err := b.decodeStream(&hex, 0); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("ASCIIHex stream over the limit: %v", err)
+	}
+
+	if _, err := newBudget(Limits{}).decodeStream(flateStream(t, 4<<20), 0); err != nil {
+		t.Errorf("Zero MaxStreamSize should be unlimited: %v", err)
+	}
+}
+
+// TestBudgetTime tests the per-file time budget
+func TestBudgetTime(t *testing.T) {
+	b := newBudget(Limits{Timeout: time.Millisecond})
+	time.Sleep(5 * time.Millisecond)
+	var le *LimitError
+	if err := b.checkTime(); !errors.As(err, &le) || le.Limit != LimitTime {
+		t.Errorf("Expected a time LimitError, got %v", err)
+	}
+	if err := newBudget(Limits{}).checkTime(); err != nil {
+		t.Errorf("Zero Timeout should be unlimited: %v", err)
+	}
+}
+
+// writeBombPDF writes a one-page PDF whose content stream inflates to size bytes
+func writeBombPDF(t *testing.T, size int) string {
+	t.Helper()
+	stream, err := compressFlate(make([]byte, size))
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R >>",
+		fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", len(stream), stream),
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.7\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	path := filepath.Join(t.TempDir(), "bomb.pdf")
+	if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestVerifyLimits tests that a decompression bomb is reported as a limit, not a missing payload
+func TestVerifyLimits(t *testing.T) {
+	bomb := writeBombPDF(t, 8<<20)
+	limits := Limits{MaxStreamSize: 1 << 20, MaxObjects: 100, Timeout: time.Minute}
+
+	_, _, err := VerifyWithOptions(bomb, testKey32, VerifyOptions{Limits: &limits})
+	var le *LimitError
+	if !errors.As(err, &le) || le.Limit != LimitStreamSize || le.Object != 4 {
+		t.Fatalf("Expected a stream size LimitError for object 4, got %v", err)
+	}
+	if _, err := ExtractShownTextWithLimits(bomb, limits); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("ExtractShownTextWithLimits: expected ErrLimitExceeded, got %v", err)
+	}
+
+	limits = Limits{MaxObjects: 3}
+	if _, err := ExtractWithLimits(NewContentAnchor(), bomb, limits); !errors.As(err, &le) || le.Limit != LimitObjects {
+		t.Errorf("Expected an object LimitError, got %v", err)
+	}
+
+	// Within the limits the file is merely unsigned
+	if _, _, err := Verify(bomb, testKey32, nil); !errors.Is(err, ErrNoPayload) {
+		t.Errorf("Expected ErrNoPayload within DefaultLimits, got %v", err)
+	}
+}
+
+// writeObjStmPDF writes a one-page PDF with a cross-reference stream and an
+// object stream that inflates to size bytes, and returns its bytes
+func writeObjStmPDF(t *testing.T, size int) []byte {
+	t.Helper()
+	objStm := append([]byte("5 0 <<>>"), bytes.Repeat([]byte(" "), size)...)
+	stream, err := compressFlate(objStm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] >>",
+		fmt.Sprintf("<< /Type /ObjStm /N 1 /First 4 /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", len(stream), stream),
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.7\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+
+	// Entries of /W [1 4 2]: type, offset or object stream, generation or index
+	xref := buf.Len()
+	var entries bytes.Buffer
+	entry := func(typ byte, field2, field3 int) {
+		entries.Write([]byte{typ, byte(field2 >> 24), byte(field2 >> 16), byte(field2 >> 8), byte(field2), byte(field3 >> 8), byte(field3)})
+	}
+	entry(0, 0, 0xffff)
+	for _, off := range offsets {
+		entry(1, off, 0)
+	}
+	entry(2, 4, 0)
+	entry(1, xref, 0)
+	fmt.Fprintf(&buf, "6 0 obj\n<< /Type /XRef /Size 7 /W [1 4 2] /Root 1 0 R /Length %d >>\nstream\n%s\nendstream\nendobj\n", entries.Len(), entries.Bytes())
+	fmt.Fprintf(&buf, "startxref\n%d\n%%%%EOF\n", xref)
+	return buf.Bytes()
+}
+
+// TestParseLimits tests that the limits apply to what pdfcpu decodes while parsing
+func TestParseLimits(t *testing.T) {
+	limits := Limits{MaxStreamSize: 1 << 20, MaxObjects: 100, Timeout: time.Minute}
+	var le *LimitError
+
+	// An object stream is checked before pdfcpu inflates it
+	bomb := writeObjStmPDF(t, 8<<20)
+	_, err := VerifyBytes(context.Background(), bomb, testKey32, VerifyOptions{Limits: &limits})
+	if !errors.As(err, &le) || le.Limit != LimitStreamSize || le.Object != 4 {
+		t.Fatalf("Expected a stream size LimitError for object 4, got %v", err)
+	}
+	small := writeObjStmPDF(t, 1<<10)
+	if _, err := VerifyBytes(context.Background(), small, testKey32, VerifyOptions{Limits: &limits}); !errors.Is(err, ErrNoPayload) {
+		t.Errorf("Small object stream: expected ErrNoPayload, got %v", err)
+	}
+
+	// The object count a trailer claims is checked before parsing
+	huge := bytes.Replace(readTestFile(t, writeBombPDF(t, 16)), []byte("/Size 5"), []byte("/Size 50000000"), 1)
+	_, err = VerifyBytes(context.Background(), huge, testKey32, VerifyOptions{Limits: &limits})
+	if !errors.As(err, &le) || le.Limit != LimitObjects {
+		t.Errorf("Expected an object LimitError, got %v", err)
+	}
+	huge = bytes.Replace(small, []byte("/Size 7"), []byte("/Size 50000000"), 1)
+	_, err = VerifyBytes(context.Background(), huge, testKey32, VerifyOptions{Limits: &limits})
+	if !errors.As(err, &le) || le.Limit != LimitObjects {
+		t.Errorf("Cross-reference stream: expected an object LimitError, got %v", err)
+	}
+
+	// Parsing stops when the time budget is used up
+	b := newBudget(Limits{Timeout: time.Nanosecond})
+	time.Sleep(time.Millisecond)
+	if _, err := b.readContext(bytes.NewReader(bomb)); !errors.As(err, &le) || le.Limit != LimitTime {
+		t.Errorf("Expected a time LimitError, got %v", err)
+	}
+	c, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := newBudget(limits).withContext(c).readContext(bytes.NewReader(bomb)); !errors.Is(err, context.Canceled) {
+		t.Errorf("Cancelled: expected context.Canceled, got %v", err)
+	}
+}
+
+func readTestFile(t *testing.T, path string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
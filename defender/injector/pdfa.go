@@ -0,0 +1,729 @@
+package injector
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// PDF/A (ISO 19005) archival copies must stay PDF/A after signing. A source
+// claiming conformance in its XMP metadata restricts the anchors: PDF/A-1
+// forbids embedded files and transparency, PDF/A-2 only embeds PDF/A files.
+// The Visual stamp is adapted instead of dropped: it is drawn with an embedded
+// font, in a colour space the output intent allows and, for PDF/A-1, opaque.
+//
+// The signed copy is then checked against the claimed level. The check covers
+// the rules the anchors and pdfcpu's writer can break; it is not a full
+// validator, and rules the source already broke are not held against the copy.
+
+// ErrPDFAViolation indicates the signed copy would break the source's PDF/A conformance
+var ErrPDFAViolation = errors.New("signed copy violates the source's PDF/A conformance")
+
+// PDFALevel is a PDF/A conformance claim, such as PDF/A-2b
+type PDFALevel struct {
+	// Part is the ISO 19005 part, 1 to 4
+	Part int
+	// Conformance is the level letter in upper case (A, B, U, E, F), empty for plain PDF/A-4
+	Conformance string
+}
+
+func (l PDFALevel) String() string {
+	return fmt.Sprintf("PDF/A-%d%s", l.Part, strings.ToLower(l.Conformance))
+}
+
+// embedsAnyFile reports whether the level allows embedded files that are not PDF/A
+func (l PDFALevel) embedsAnyFile() bool {
+	return l.Part == 3 || l.Part == 4 && l.Conformance == "F"
+}
+
+// XMP namespaces of the properties we read, with their usual prefixes
+var xmpNamespaces = map[string]string{
+	"http://www.aiim.org/pdfa/ns/id/": "pdfaid",
+	"http://ns.adobe.com/xap/1.0/":    "xmp",
+	"http://ns.adobe.com/pdf/1.3/":    "pdf",
+}
+
+// parseXMP returns the simple pdfaid, xmp and pdf properties of an XMP packet,
+// keyed as "prefix:Name". Properties may be attributes or elements.
+func parseXMP(data []byte) map[string]string {
+	props := make(map[string]string)
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = false
+	var open []string // Property elements being read, "" for others
+	var text strings.Builder
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return props
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			for _, attr := range t.Attr {
+				if prefix, ok := xmpNamespaces[attr.Name.Space]; ok {
+					props[prefix+":"+attr.Name.Local] = strings.TrimSpace(attr.Value)
+				}
+			}
+			key := ""
+			if prefix, ok := xmpNamespaces[t.Name.Space]; ok {
+				key = prefix + ":" + t.Name.Local
+			}
+			open = append(open, key)
+			text.Reset()
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			if len(open) == 0 {
+				continue
+			}
+			if key := open[len(open)-1]; key != "" {
+				if v := strings.TrimSpace(text.String()); v != "" {
+					props[key] = v
+				}
+			}
+			open = open[:len(open)-1]
+			text.Reset()
+		}
+	}
+}
+
+// catalogXMP returns the properties of the document's XMP metadata
+func catalogXMP(ctx *model.Context) map[string]string {
+	root, err := ctx.Catalog()
+	if err != nil {
+		return nil
+	}
+	sd, _, err := ctx.DereferenceStreamDict(root["Metadata"])
+	if err != nil || sd == nil || sd.Decode() != nil {
+		return nil
+	}
+	return parseXMP(sd.Content)
+}
+
+// detectPDFA returns the PDF/A level a parsed PDF claims, nil if none
+func detectPDFA(ctx *model.Context) *PDFALevel {
+	props := catalogXMP(ctx)
+	part, err := strconv.Atoi(props["pdfaid:part"])
+	if err != nil || part < 1 {
+		return nil
+	}
+	return &PDFALevel{Part: part, Conformance: strings.ToUpper(props["pdfaid:conformance"])}
+}
+
+// pdfaRestriction explains why an anchor would break a PDF/A level, "" if it
+// does not or level is nil
+func pdfaRestriction(level *PDFALevel, anchorName string) string {
+	switch {
+	case level == nil:
+		return ""
+	case anchorName == "Attachment" && level.Part == 1:
+		return "PDF/A-1 forbids embedded files"
+	case anchorName == "Attachment" && !level.embedsAnyFile():
+		return fmt.Sprintf("%s only allows embedded PDF/A files", level)
+	case anchorName == "SMask" && level.Part == 1:
+		return "PDF/A-1 forbids transparency (soft masks)"
+	}
+	return ""
+}
+
+// outputIntentSpace returns the colour space (Gray, RGB or CMYK) of the PDF/A
+// output intent, "" without one
+func outputIntentSpace(ctx *model.Context) string {
+	root, err := ctx.Catalog()
+	if err != nil {
+		return ""
+	}
+	intents, _ := ctx.DereferenceArray(root["OutputIntents"])
+	for _, o := range intents {
+		d, err := ctx.DereferenceDict(o)
+		if err != nil || d == nil || d.NameEntry("S") == nil || *d.NameEntry("S") != "GTS_PDFA1" {
+			continue
+		}
+		profile, _, err := ctx.DereferenceStreamDict(d["DestOutputProfile"])
+		if err != nil || profile == nil {
+			continue
+		}
+		switch n := profile.IntEntry("N"); {
+		case n == nil:
+		case *n == 1:
+			return "Gray"
+		case *n == 3:
+			return "RGB"
+		case *n == 4:
+			return "CMYK"
+		}
+	}
+	return ""
+}
+
+// rgbFill returns the content operator setting an RGB fill colour
+func rgbFill(rgb [3]float64) string {
+	return fmt.Sprintf("%g %g %g rg", rgb[0], rgb[1], rgb[2])
+}
+
+// pdfaVisual adapts a Visual style to a PDF/A document. PDF/A-1 has no
+// transparency, so the stamp is drawn opaque in the colour it shows over white
+// paper. The fill operator uses the colour space of the output intent: grey
+// stays DeviceGray, which every output intent allows.
+func pdfaVisual(ctx *model.Context, level *PDFALevel, style VisualStyle) (VisualStyle, string) {
+	if level.Part == 1 && style.Opacity < 1 {
+		for i, c := range style.Color {
+			style.Color[i] = 1 - style.Opacity*(1-c)
+		}
+		style.Opacity = 1
+	}
+
+	r, g, b := style.Color[0], style.Color[1], style.Color[2]
+	switch space := outputIntentSpace(ctx); {
+	case r == g && g == b:
+		return style, fmt.Sprintf("%g g", r)
+	case space == "Gray":
+		return style, fmt.Sprintf("%.4g g", 0.3*r+0.59*g+0.11*b)
+	case space == "CMYK":
+		k := 1 - max(r, g, b)
+		if k == 1 {
+			return style, "0 0 0 1 k"
+		}
+		return style, fmt.Sprintf("%.4g %.4g %.4g %.4g k", (1-r-k)/(1-k), (1-g-k)/(1-k), (1-b-k)/(1-k), k)
+	}
+	return style, rgbFill(style.Color)
+}
+
+// PDFAReport is the result of CheckPDFA
+type PDFAReport struct {
+	// Level is the claimed conformance, nil if the file claims none
+	Level *PDFALevel
+	// Violations lists the rules the file breaks, sorted
+	Violations []string
+}
+
+// CheckPDFA checks a PDF against the PDF/A level its metadata claims, within
+// DefaultLimits. Only the rules signing can affect are checked: embedded
+// files, transparency (PDF/A-1), embedded fonts for visible text, device
+// colours against the output intent, document information against the XMP
+// metadata and, for PDF/A-1, cross-reference streams.
+func CheckPDFA(filePath string) (*PDFAReport, error) {
+	b := newBudget(DefaultLimits)
+	ctx, err := b.readFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	report := &PDFAReport{Level: detectPDFA(ctx)}
+	if report.Level == nil {
+		return report, nil
+	}
+	if report.Violations, err = pdfaViolations(ctx, *report.Level, b); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// pdfaViolations checks a parsed PDF against level
+func pdfaViolations(ctx *model.Context, level PDFALevel, b *budget) ([]string, error) {
+	found := make(map[string]bool)
+	add := func(format string, args ...interface{}) {
+		found[fmt.Sprintf(format, args...)] = true
+	}
+
+	if level.Part == 1 && (ctx.Read.UsingXRefStreams || ctx.Read.UsingObjectStreams) {
+		add("cross-reference or object streams (PDF/A-1 requires a cross-reference table)")
+	}
+	checkInfoXMP(ctx, level, add)
+
+	// Object numbers of the file specifications associated with the document or its parts
+	associated := make(map[int]bool)
+	for _, e := range ctx.Table {
+		if e == nil || e.Free || e.Object == nil {
+			continue
+		}
+		walkDicts(e.Object, func(d types.Dict) {
+			af, _ := ctx.DereferenceArray(d["AF"])
+			for _, o := range af {
+				if ref, ok := o.(types.IndirectRef); ok {
+					associated[ref.ObjectNumber.Value()] = true
+				}
+			}
+		})
+	}
+
+	for nr, e := range ctx.Table {
+		if e == nil || e.Free || e.Object == nil {
+			continue
+		}
+		walkDicts(e.Object, func(d types.Dict) {
+			if level.Part == 1 {
+				checkTransparency(ctx, d, add)
+			}
+			if _, ok := d["EF"]; ok {
+				checkEmbeddedFile(ctx, level, d, associated[nr], b, add)
+			}
+			if level.Part == 1 {
+				checkCIDSet(ctx, d, add)
+			}
+		})
+	}
+
+	c := &pdfaContentChecker{
+		textExtractor: &textExtractor{ctx: ctx, budget: b, fonts: make(map[int]*shownFont)},
+		intent:        outputIntentSpace(ctx),
+		embedded:      make(map[int]bool),
+		visited:       make(map[int]bool),
+		add:           add,
+	}
+	for pageNr := 1; pageNr <= ctx.PageCount; pageNr++ {
+		if err := b.checkTime(); err != nil {
+			return nil, err
+		}
+		pageDict, _, inhPAttrs, err := ctx.PageDict(pageNr, false)
+		if err != nil || pageDict == nil {
+			continue
+		}
+		content, err := c.pageContent(pageDict)
+		if c.err != nil {
+			return nil, c.err
+		}
+		if err != nil {
+			continue
+		}
+		c.walk(content, inhPAttrs.Resources, 0)
+		if c.err != nil {
+			return nil, c.err
+		}
+	}
+
+	violations := make([]string, 0, len(found))
+	for v := range found {
+		violations = append(violations, v)
+	}
+	sort.Strings(violations)
+	return violations, nil
+}
+
+// walkDicts calls fn for every dictionary within o, including stream
+// dictionaries, without following indirect references
+func walkDicts(o types.Object, fn func(types.Dict)) {
+	switch o := o.(type) {
+	case types.Dict:
+		fn(o)
+		for _, v := range o {
+			walkDicts(v, fn)
+		}
+	case types.StreamDict:
+		walkDicts(o.Dict, fn)
+	case types.Array:
+		for _, v := range o {
+			walkDicts(v, fn)
+		}
+	}
+}
+
+// checkTransparency reports the PDF/A-1 transparency features of a dictionary
+func checkTransparency(ctx *model.Context, d types.Dict, add func(string, ...interface{})) {
+	if st := d.NameEntry("Subtype"); st != nil && *st == "Image" {
+		if _, ok := d["SMask"]; ok {
+			add("image with a soft mask (PDF/A-1 forbids transparency)")
+		}
+	} else if smask, ok := d["SMask"]; ok {
+		if name, isName := smask.(types.Name); !isName || name != "None" {
+			add("soft mask in a graphics state (PDF/A-1 forbids transparency)")
+		}
+	}
+	for _, key := range []string{"CA", "ca"} {
+		if v, ok := d[key]; ok {
+			if f, err := ctx.DereferenceNumber(v); err == nil && f < 1 {
+				add("opacity below 1 (PDF/A-1 forbids transparency)")
+			}
+		}
+	}
+	if bm := d.NameEntry("BM"); bm != nil && *bm != "Normal" && *bm != "Compatible" {
+		add("blend mode %s (PDF/A-1 forbids transparency)", *bm)
+	}
+	if group, err := ctx.DereferenceDict(d["Group"]); err == nil && group != nil {
+		if s := group.NameEntry("S"); s != nil && *s == "Transparency" {
+			add("transparency group (PDF/A-1 forbids transparency)")
+		}
+	}
+}
+
+// checkEmbeddedFile reports the rules a file specification with an embedded file breaks
+func checkEmbeddedFile(ctx *model.Context, level PDFALevel, spec types.Dict, associated bool, b *budget, add func(string, ...interface{})) {
+	name := ""
+	for _, key := range []string{"UF", "F"} {
+		if s, err := ctx.DereferenceStringOrHexLiteral(spec[key], model.V10, nil); err == nil && s != "" {
+			name = s
+			break
+		}
+	}
+	if level.Part == 1 {
+		add("embedded file %q (PDF/A-1 forbids embedded files)", name)
+		return
+	}
+
+	ef, _ := ctx.DereferenceDict(spec["EF"])
+	sd, _, err := ctx.DereferenceStreamDict(ef["F"])
+	if err != nil || sd == nil {
+		return
+	}
+	if !level.embedsAnyFile() {
+		objNr := 0
+		if ref, ok := ef["F"].(types.IndirectRef); ok {
+			objNr = ref.ObjectNumber.Value()
+		}
+		data, err := b.decodeStream(sd, objNr)
+		if err != nil || !bytes.HasPrefix(data, []byte("%PDF-")) {
+			add("embedded file %q is not a PDF/A file (%s only allows embedded PDF/A files)", name, level)
+		}
+		return
+	}
+
+	if spec.NameEntry("AFRelationship") == nil {
+		add("embedded file %q has no AFRelationship", name)
+	}
+	if sd.Dict.NameEntry("Subtype") == nil {
+		add("embedded file %q has no MIME type", name)
+	}
+	if !associated {
+		add("embedded file %q is not associated with the document (AF)", name)
+	}
+}
+
+// checkCIDSet reports CIDFont subsets without the CIDSet PDF/A-1 requires
+func checkCIDSet(ctx *model.Context, d types.Dict, add func(string, ...interface{})) {
+	st := d.NameEntry("Subtype")
+	if st == nil || (*st != "CIDFontType0" && *st != "CIDFontType2") {
+		return
+	}
+	base := d.NameEntry("BaseFont")
+	if base == nil || len(*base) < 7 || (*base)[6] != '+' {
+		return
+	}
+	fd, err := ctx.DereferenceDict(d["FontDescriptor"])
+	if err != nil || fd == nil {
+		return
+	}
+	if _, ok := fd["CIDSet"]; !ok {
+		add("font subset %s has no CIDSet", *base)
+	}
+}
+
+// Document information entries pdfcpu's writer rewrites, with their XMP equivalents
+var infoXMPKeys = []struct{ info, xmp string }{
+	{"Producer", "pdf:Producer"},
+	{"CreationDate", "xmp:CreateDate"},
+	{"ModDate", "xmp:ModifyDate"},
+}
+
+// checkInfoXMP reports document information that does not match the XMP metadata.
+// PDF/A-4 deprecates the document information dictionary: only ModDate may remain.
+func checkInfoXMP(ctx *model.Context, level PDFALevel, add func(string, ...interface{})) {
+	if ctx.Info == nil {
+		return
+	}
+	info, err := ctx.DereferenceDict(*ctx.Info)
+	if err != nil || info == nil {
+		return
+	}
+	if level.Part >= 4 {
+		for key := range info {
+			if key != "ModDate" {
+				add("document information entry %s (PDF/A-4 only allows ModDate)", key)
+			}
+		}
+		return
+	}
+
+	props := catalogXMP(ctx)
+	for _, k := range infoXMPKeys {
+		v, err := ctx.DereferenceStringOrHexLiteral(info[k.info], model.V10, nil)
+		if err != nil || v == "" {
+			continue
+		}
+		x, ok := props[k.xmp]
+		if !ok || !infoMatchesXMP(v, x) {
+			add("document information %s does not match the XMP metadata", k.info)
+		}
+	}
+}
+
+// XMP date layouts (ISO 8601 subsets)
+var xmpDateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// infoMatchesXMP compares a document information value with its XMP equivalent,
+// dates by the instant they denote
+func infoMatchesXMP(info, xmp string) bool {
+	if !strings.HasPrefix(info, "D:") {
+		return info == xmp
+	}
+	t, ok := types.DateTime(info, true)
+	if !ok {
+		return false
+	}
+	for _, layout := range xmpDateLayouts {
+		if x, err := time.Parse(layout, xmp); err == nil {
+			return t.Equal(x)
+		}
+	}
+	return false
+}
+
+// pdfaContentChecker walks page content for visible text in fonts that are
+// not embedded and for device colours the output intent does not allow
+type pdfaContentChecker struct {
+	*textExtractor
+	intent   string       // Output intent colour space
+	embedded map[int]bool // Keyed by font object number
+	visited  map[int]bool // Form XObjects already walked
+	add      func(string, ...interface{})
+}
+
+func (c *pdfaContentChecker) walk(content []byte, resources types.Dict, depth int) {
+	var operands []contentToken
+	render := 0 // Text rendering mode; 3 is invisible
+	var saved []int
+	fontOK, fontName := true, ""
+
+	for _, tok := range tokenizeContent(content) {
+		if c.err != nil {
+			return
+		}
+		if tok.kind != tokOperator {
+			operands = append(operands, tok)
+			continue
+		}
+		n := len(operands)
+		switch tok.text {
+		case "q":
+			saved = append(saved, render)
+		case "Q":
+			if len(saved) > 0 {
+				render, saved = saved[len(saved)-1], saved[:len(saved)-1]
+			}
+		case "Tr":
+			if n > 0 && operands[n-1].kind == tokNumber {
+				render, _ = strconv.Atoi(operands[n-1].text)
+			}
+		case "Tf":
+			if n >= 2 && operands[n-2].kind == tokName {
+				fontOK, fontName = c.fontEmbedded(resources, operands[n-2].text)
+			}
+		case "Tj", "TJ", "'", "\"":
+			// Invisible text needs no font program
+			if render != 3 && !fontOK {
+				c.add("font %s used for visible text is not embedded", fontName)
+			}
+		case "rg", "RG":
+			if c.intent != "RGB" {
+				c.add("DeviceRGB colour without an RGB output intent")
+			}
+		case "k", "K":
+			if c.intent != "CMYK" {
+				c.add("DeviceCMYK colour without a CMYK output intent")
+			}
+		case "g", "G":
+			if c.intent == "" {
+				c.add("DeviceGray colour without an output intent")
+			}
+		case "Do":
+			if n > 0 && operands[n-1].kind == tokName && depth < maxFormDepth {
+				c.walkForm(resources, operands[n-1].text, depth+1)
+			}
+		}
+		operands = operands[:0]
+	}
+}
+
+// walkForm walks a form XObject named in resources
+func (c *pdfaContentChecker) walkForm(resources types.Dict, name string, depth int) {
+	ref, ok := resourceRef(c.ctx, resources, "XObject", name)
+	if !ok || c.visited[ref.ObjectNumber.Value()] {
+		return
+	}
+	c.visited[ref.ObjectNumber.Value()] = true
+	sd, _, err := c.ctx.DereferenceStreamDict(ref)
+	if err != nil || sd == nil || sd.Subtype() == nil || *sd.Subtype() != "Form" {
+		return
+	}
+	content, err := c.decode(sd, ref)
+	if err != nil {
+		return
+	}
+	formResources := resources
+	if d, err := c.ctx.DereferenceDict(sd.Dict["Resources"]); err == nil && d != nil {
+		formResources = d
+	}
+	c.walk(content, formResources, depth)
+}
+
+// fontEmbedded reports whether the font named in resources carries its font
+// program, and its base font name. Fonts that cannot be resolved count as embedded.
+func (c *pdfaContentChecker) fontEmbedded(resources types.Dict, name string) (bool, string) {
+	ref, ok := resourceRef(c.ctx, resources, "Font", name)
+	if !ok {
+		return true, name
+	}
+	d, err := c.ctx.DereferenceDict(ref)
+	if err != nil || d == nil {
+		return true, name
+	}
+	if base := d.NameEntry("BaseFont"); base != nil {
+		name = *base
+	}
+	nr := ref.ObjectNumber.Value()
+	if ok, cached := c.embedded[nr]; cached {
+		return ok, name
+	}
+
+	embedded := false
+	font := d
+	if st := d.NameEntry("Subtype"); st != nil && *st == "Type0" {
+		descendants, _ := c.ctx.DereferenceArray(d["DescendantFonts"])
+		font = nil
+		if len(descendants) > 0 {
+			font, _ = c.ctx.DereferenceDict(descendants[0])
+		}
+	}
+	if st := d.NameEntry("Subtype"); st != nil && *st == "Type3" {
+		// Type 3 glyphs are content streams
+		embedded = true
+	} else if font != nil {
+		if fd, err := c.ctx.DereferenceDict(font["FontDescriptor"]); err == nil && fd != nil {
+			for _, key := range []string{"FontFile", "FontFile2", "FontFile3"} {
+				if _, ok := fd[key]; ok {
+					embedded = true
+				}
+			}
+		}
+	}
+	c.embedded[nr] = embedded
+	return embedded, name
+}
+
+// pdfaSource is what a PDF/A source is checked against after signing
+type pdfaSource struct {
+	level PDFALevel
+	// info is the source's document information, nil without one
+	info types.Dict
+	// violations are the rules the source already breaks
+	violations map[string]bool
+}
+
+// readPDFASource reads the PDF/A claim, document information and violations
+// of a source. It returns nil for sources that claim no PDF/A conformance.
+func readPDFASource(src []byte) (*pdfaSource, error) {
+	// The source is trusted: check it without resource limits
+	b := newBudget(Limits{})
+	ctx, err := b.readContext(bytes.NewReader(src))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read context: %w", err)
+	}
+	level := detectPDFA(ctx)
+	if level == nil {
+		return nil, nil
+	}
+	s := &pdfaSource{level: *level, violations: make(map[string]bool)}
+	if ctx.Info != nil {
+		if info, err := ctx.DereferenceDict(*ctx.Info); err == nil && info != nil {
+			s.info = info.Clone().(types.Dict)
+		}
+	}
+	violations, err := pdfaViolations(ctx, *level, b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check %s conformance: %w", level, err)
+	}
+	for _, v := range violations {
+		s.violations[v] = true
+	}
+	return s, nil
+}
+
+// conform makes the signed copy conform like the source and checks it.
+// pdfcpu's writer stamps its own producer and dates into the document
+// information, which then disagrees with the XMP metadata, and writes object
+// streams, which PDF/A-1 predates. A rewritten copy is therefore written again
+// with a cross-reference table (PDF/A-1) and given the source's document
+// information back in an incremental update. Incremental copies keep both as
+// they were. It returns the conforming copy.
+func (s *pdfaSource) conform(signed []byte, incremental bool) ([]byte, error) {
+	if !incremental {
+		var err error
+		if signed, err = s.restore(signed); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, err := readPDF(signed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signed copy: %w", err)
+	}
+	violations, err := pdfaViolations(ctx, s.level, newBudget(Limits{}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to check %s conformance: %w", s.level, err)
+	}
+	var added []string
+	for _, v := range violations {
+		if !s.violations[v] {
+			added = append(added, v)
+		}
+	}
+	if len(added) > 0 {
+		return nil, fmt.Errorf("%w (%s): %s", ErrPDFAViolation, s.level, strings.Join(added, "; "))
+	}
+	return signed, nil
+}
+
+// restore rewrites a PDF/A-1 copy with a cross-reference table and puts the
+// source's document information back
+func (s *pdfaSource) restore(signed []byte) ([]byte, error) {
+	if s.level.Part == 1 {
+		ctx, err := readPDF(signed)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signed copy: %w", err)
+		}
+		ctx.WriteObjectStream = false
+		ctx.WriteXRefStream = false
+		if signed, err = writePDF(ctx); err != nil {
+			return nil, fmt.Errorf("failed to write signed copy: %w", err)
+		}
+	}
+
+	ctx, digests, err := readForIncrement(signed)
+	if err != nil {
+		return nil, err
+	}
+	if ctx.Info == nil {
+		return signed, nil
+	}
+	entry, ok := ctx.FindTableEntryForIndRef(ctx.Info)
+	if !ok || entry == nil {
+		return signed, nil
+	}
+	// Without source information an empty dictionary has nothing to disagree with
+	info := types.NewDict()
+	if s.info != nil {
+		info = s.info.Clone().(types.Dict)
+	}
+	entry.Object = info
+
+	changed := changedObjects(ctx, digests)
+	if len(changed) == 0 {
+		return signed, nil
+	}
+	var restored bytes.Buffer
+	if err := writeIncrement(ctx, signed, &restored, changed); err != nil {
+		return nil, err
+	}
+	return restored.Bytes(), nil
+}
@@ -0,0 +1,115 @@
+package injector
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// TestParseXMP tests properties written as attributes and as elements
+func TestParseXMP(t *testing.T) {
+	xmp := []byte(`<?xpacket begin="" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about="" xmlns:pdfaid="http://www.aiim.org/pdfa/ns/id/" pdfaid:part="2" pdfaid:conformance="B"/>
+  <rdf:Description rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmlns:pdf="http://ns.adobe.com/pdf/1.3/" xmlns:dc="http://purl.org/dc/elements/1.1/">
+   <xmp:CreateDate>2024-05-01T10:00:00+02:00</xmp:CreateDate>
+   <pdf:Producer> Writer 1.0 </pdf:Producer>
+   <dc:title><rdf:Alt><rdf:li xml:lang="x-default">Title</rdf:li></rdf:Alt></dc:title>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`)
+
+	want := map[string]string{
+		"pdfaid:part":        "2",
+		"pdfaid:conformance": "B",
+		"xmp:CreateDate":     "2024-05-01T10:00:00+02:00",
+		"pdf:Producer":       "Writer 1.0",
+	}
+	if got := parseXMP(xmp); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseXMP = %q, want %q", got, want)
+	}
+	if got := parseXMP([]byte("not xml <")); len(got) != 0 {
+		t.Errorf("parseXMP(garbage) = %q, want none", got)
+	}
+}
+
+// TestPDFARestriction tests which anchors each level allows
+func TestPDFARestriction(t *testing.T) {
+	tests := []struct {
+		level      *PDFALevel
+		attachment bool
+		smask      bool
+	}{
+		{nil, true, true},
+		{&PDFALevel{1, "B"}, false, false},
+		{&PDFALevel{2, "U"}, false, true},
+		{&PDFALevel{3, "B"}, true, true},
+		{&PDFALevel{4, ""}, false, true},
+		{&PDFALevel{4, "F"}, true, true},
+	}
+	for _, tt := range tests {
+		if got := pdfaRestriction(tt.level, "Attachment") == ""; got != tt.attachment {
+			t.Errorf("%v: Attachment allowed = %v, want %v", tt.level, got, tt.attachment)
+		}
+		if got := pdfaRestriction(tt.level, "SMask") == ""; got != tt.smask {
+			t.Errorf("%v: SMask allowed = %v, want %v", tt.level, got, tt.smask)
+		}
+		for _, name := range []string{"Content", "Visual"} {
+			if r := pdfaRestriction(tt.level, name); r != "" {
+				t.Errorf("%v: %s restricted: %s", tt.level, name, r)
+			}
+		}
+	}
+}
+
+// TestPDFAVisual tests flattening opacity for PDF/A-1 and the fill colour space
+func TestPDFAVisual(t *testing.T) {
+	ctx, err := pdfcpu.CreateContextWithXRefTable(nil, types.PaperSize["A4"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	grey := VisualStyle{Color: [3]float64{0.5, 0.5, 0.5}, Opacity: 0.3}
+
+	style, fill := pdfaVisual(ctx, &PDFALevel{1, "B"}, grey)
+	if style.Opacity != 1 || style.Color != [3]float64{0.85, 0.85, 0.85} || fill != "0.85 g" {
+		t.Errorf("PDF/A-1: %+v %q", style, fill)
+	}
+	style, fill = pdfaVisual(ctx, &PDFALevel{2, "B"}, grey)
+	if style != grey || fill != "0.5 g" {
+		t.Errorf("PDF/A-2: %+v %q", style, fill)
+	}
+
+	red := VisualStyle{Color: [3]float64{1, 0, 0}, Opacity: 1}
+	if _, fill := pdfaVisual(ctx, &PDFALevel{2, "B"}, red); fill != "1 0 0 rg" {
+		t.Errorf("No output intent: fill %q", fill)
+	}
+
+	profile, err := ctx.NewStreamDictForBuf([]byte("icc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile.InsertInt("N", 4)
+	if err := profile.Encode(); err != nil {
+		t.Fatal(err)
+	}
+	ref, err := ctx.IndRefForNewObject(*profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := ctx.Catalog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	root["OutputIntents"] = types.Array{types.Dict{
+		"Type":              types.Name("OutputIntent"),
+		"S":                 types.Name("GTS_PDFA1"),
+		"DestOutputProfile": *ref,
+	}}
+	if _, fill := pdfaVisual(ctx, &PDFALevel{2, "B"}, red); fill != "0 1 1 0 k" {
+		t.Errorf("CMYK output intent: fill %q", fill)
+	}
+}
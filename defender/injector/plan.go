@@ -0,0 +1,245 @@
+package injector
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+// Robustness grades how well an anchor survives cleaning
+type Robustness string
+
+const (
+	RobustnessLow    Robustness = "low"
+	RobustnessMedium Robustness = "medium"
+	RobustnessHigh   Robustness = "high"
+)
+
+// anchorRobustness describes what each built-in anchor survives
+var anchorRobustness = map[string]struct {
+	level Robustness
+	note  string
+}{
+	"Attachment":     {RobustnessLow, "removed by attachment stripping and most re-savers"},
+	"SMask":          {RobustnessMedium, "survives attachment stripping, removal of most images and lossless mask recompression; lost when masks are dropped or lossily re-encoded"},
+	"Content":        {RobustnessMedium, "survives attachment and image cleaning and removal of most pages; lost when pages are re-rendered"},
+	AnchorNameVisual: {RobustnessHigh, "survives printing and screenshots; visible and not authenticated"},
+}
+
+// anchorAlternatives lists, per invisible anchor, the anchors that can stand in
+// for it when the PDF cannot carry it. The Visual anchor is never substituted
+// in either direction: it changes what the reader sees.
+var anchorAlternatives = map[string][]string{
+	"Attachment": {"Content", "SMask"},
+	"SMask":      {"Content", "Attachment"},
+	"Content":    {"SMask", "Attachment"},
+}
+
+// unavailableReasons explains why a built-in anchor cannot be used
+var unavailableReasons = map[string]string{
+	"SMask":          "no image XObjects that can carry a soft mask",
+	"Content":        "no pages",
+	AnchorNameVisual: "no pages",
+}
+
+// overheadEstimator is implemented by anchors that can estimate how many bytes
+// they add to a PDF
+type overheadEstimator interface {
+	estimateOverhead(ctx *model.Context, payloadLen int, message string) int
+}
+
+// AnchorEstimate is the planner's view of one anchor for one PDF
+type AnchorEstimate struct {
+	Name      string `json:"name"`
+	Available bool   `json:"available"`
+	// Reason explains why the anchor is unavailable
+	Reason string `json:"reason,omitempty"`
+	// OverheadBytes is the estimated size increase, -1 if unknown
+	OverheadBytes  int        `json:"overhead_bytes"`
+	Robustness     Robustness `json:"robustness,omitempty"`
+	RobustnessNote string     `json:"robustness_note,omitempty"`
+}
+
+// Substitution records an unavailable anchor replaced by an alternative
+type Substitution struct {
+	Requested string `json:"requested"`
+	Used      string `json:"used"`
+}
+
+// Plan is the injection plan for one PDF
+type Plan struct {
+	File       string `json:"file"`
+	FileSize   int64  `json:"file_size"`
+	PageCount  int    `json:"page_count"`
+	ImageCount int    `json:"image_count"`
+	// Requested is the requested anchor list (DefaultAnchors if none was given)
+	Requested []string `json:"requested"`
+	// Estimates covers every registered anchor, in registry order
+	Estimates []AnchorEstimate `json:"estimates"`
+	// Anchors is the injection order after skipping and substitution
+	Anchors       []string       `json:"anchors"`
+	Substitutions []Substitution `json:"substitutions,omitempty"`
+	// Skipped lists requested anchors that are unavailable and have no alternative
+	Skipped []string `json:"skipped,omitempty"`
+	// OverheadBytes is the estimated total size increase of the plan
+	OverheadBytes int `json:"overhead_bytes"`
+	// Incremental is set when the anchors are appended as an incremental update
+	Incremental bool `json:"incremental,omitempty"`
+	// PDFA is the PDF/A level the PDF claims (such as "PDF/A-2b"); anchors
+	// that would break it are unavailable
+	PDFA string `json:"pdfa,omitempty"`
+
+	anchors []Anchor
+}
+
+// PlanSign parses filePath once, evaluates every registered anchor and returns the
+// injection plan Sign would follow. message is only used to size the payload.
+// selectedAnchors: list of anchor names to use. If empty, uses DefaultAnchors.
+func PlanSign(filePath, message string, selectedAnchors []string) (*Plan, error) {
+	return planSign(filePath, message, NewAnchorRegistry().GetAvailableAnchors(), selectedAnchors, false)
+}
+
+// PlanSignIncremental is PlanSign for incremental signing (SignOptions.Incremental):
+// anchors that cannot be applied incrementally are unavailable.
+func PlanSignIncremental(filePath, message string, selectedAnchors []string) (*Plan, error) {
+	return planSign(filePath, message, NewAnchorRegistry().GetAvailableAnchors(), selectedAnchors, true)
+}
+
+func planSign(filePath, message string, allAnchors []Anchor, selectedAnchors []string, incremental bool) (*Plan, error) {
+	src, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	p, err := planBytes(src, message, allAnchors, selectedAnchors, incremental)
+	if err != nil {
+		return nil, err
+	}
+	p.File = filePath
+	return p, nil
+}
+
+// planBytes is planSign for a PDF held in memory
+func planBytes(src []byte, message string, allAnchors []Anchor, selectedAnchors []string, incremental bool) (*Plan, error) {
+	ctx, err := readPDF(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PDF: %w", err)
+	}
+
+	p := planContext(ctx, message, allAnchors, selectedAnchors, incremental)
+	p.FileSize = int64(len(src))
+	return p, nil
+}
+
+// planContext evaluates allAnchors against a parsed PDF and builds the plan
+func planContext(ctx *model.Context, message string, allAnchors []Anchor, selectedAnchors []string, incremental bool) *Plan {
+	requested := selectedAnchors
+	if len(requested) == 0 {
+		requested = DefaultAnchors
+	}
+	p := &Plan{
+		PageCount:   ctx.PageCount,
+		ImageCount:  len(findImageXObjects(ctx)),
+		Requested:   append([]string(nil), requested...),
+		Incremental: incremental,
+	}
+	pdfa := detectPDFA(ctx)
+	if pdfa != nil {
+		p.PDFA = pdfa.String()
+	}
+
+	// Encrypted payload: magic header + nonce + ciphertext + GCM tag
+	payloadLen := len(magicHeader) + nonceSize + len(message) + 16
+
+	byName := make(map[string]Anchor)
+	estimates := make(map[string]AnchorEstimate)
+	for _, a := range allAnchors {
+		e := AnchorEstimate{Name: a.Name(), Available: a.IsAvailable(ctx), OverheadBytes: -1}
+		if r, ok := anchorRobustness[a.Name()]; ok {
+			e.Robustness, e.RobustnessNote = r.level, r.note
+		}
+		if _, ok := a.(contextInjector); incremental && !ok && e.Available {
+			e.Available, e.Reason = false, notIncrementalReason
+		} else if reason := pdfaRestriction(pdfa, a.Name()); reason != "" && e.Available {
+			e.Available, e.Reason = false, reason
+		} else if !e.Available {
+			e.Reason = unavailableReasons[a.Name()]
+			if e.Reason == "" {
+				e.Reason = "not supported by this PDF"
+			}
+		} else if est, ok := a.(overheadEstimator); ok {
+			e.OverheadBytes = est.estimateOverhead(ctx, payloadLen, message)
+		}
+		byName[a.Name()] = a
+		estimates[a.Name()] = e
+		p.Estimates = append(p.Estimates, e)
+	}
+
+	used := make(map[string]bool)
+	for _, name := range requested {
+		used[name] = true
+	}
+	placed := make(map[string]bool)
+	for _, name := range requested {
+		if placed[name] {
+			continue
+		}
+		placed[name] = true
+		a, known := byName[name]
+		if !known {
+			p.Skipped = append(p.Skipped, name)
+			continue
+		}
+		if estimates[name].Available {
+			p.use(a, estimates[name])
+			continue
+		}
+
+		substituted := false
+		for _, alt := range anchorAlternatives[name] {
+			if used[alt] || byName[alt] == nil || !estimates[alt].Available {
+				continue
+			}
+			used[alt] = true
+			p.use(byName[alt], estimates[alt])
+			p.Substitutions = append(p.Substitutions, Substitution{Requested: name, Used: alt})
+			substituted = true
+			break
+		}
+		if !substituted {
+			p.Skipped = append(p.Skipped, name)
+		}
+	}
+	return p
+}
+
+// use appends an anchor to the injection order
+func (p *Plan) use(a Anchor, e AnchorEstimate) {
+	p.anchors = append(p.anchors, a)
+	p.Anchors = append(p.Anchors, a.Name())
+	if e.OverheadBytes > 0 {
+		p.OverheadBytes += e.OverheadBytes
+	}
+}
+
+// Notes describes the skipped and substituted anchors, one line each
+func (p *Plan) Notes() []string {
+	var notes []string
+	for _, s := range p.Substitutions {
+		notes = append(notes, fmt.Sprintf("%s unavailable (%s), using %s instead", s.Requested, p.reason(s.Requested), s.Used))
+	}
+	for _, name := range p.Skipped {
+		notes = append(notes, fmt.Sprintf("%s skipped (%s), no alternative available", name, p.reason(name)))
+	}
+	return notes
+}
+
+// reason returns why an anchor is unavailable
+func (p *Plan) reason(name string) string {
+	for _, e := range p.Estimates {
+		if e.Name == name {
+			return e.Reason
+		}
+	}
+	return "unknown anchor"
+}
@@ -0,0 +1,122 @@
+package injector
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// fakeAnchor is an anchor whose availability is fixed
+type fakeAnchor struct {
+	name      string
+	available bool
+}
+
+func (f *fakeAnchor) Name() string                                           { return f.name }
+func (f *fakeAnchor) Inject(_, _ string, _ []byte) error                     { return nil }
+func (f *fakeAnchor) Extract(_ string) ([]byte, error)                       { return nil, nil }
+func (f *fakeAnchor) IsAvailable(_ *model.Context) bool                      { return f.available }
+func (f *fakeAnchor) estimateOverhead(_ *model.Context, n int, _ string) int { return n }
+
+// fakeContextAnchor is a fakeAnchor that can also sign incrementally
+type fakeContextAnchor struct{ fakeAnchor }
+
+func (f *fakeContextAnchor) injectContext(_ context.Context, _ *model.Context, _ []byte) error {
+	return nil
+}
+
+// TestPlanContext tests skipping and substitution of unavailable anchors
+func TestPlanContext(t *testing.T) {
+	ctx, err := pdfcpu.CreateContextWithXRefTable(nil, types.PaperSize["A4"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	anchors := func(unavailable ...string) []Anchor {
+		var out []Anchor
+		for _, name := range []string{"Attachment", "SMask", "Content", "Visual"} {
+			avail := true
+			for _, u := range unavailable {
+				avail = avail && u != name
+			}
+			out = append(out, &fakeAnchor{name: name, available: avail})
+		}
+		return out
+	}
+
+	tests := []struct {
+		name        string
+		unavailable []string
+		requested   []string
+		want        []string
+		subs        []Substitution
+		skipped     []string
+	}{
+		{"All available", nil, nil, DefaultAnchors, nil, nil},
+		{"Requested alternative already used", []string{"SMask"}, nil, []string{"Attachment", "Content", "Visual"}, nil, []string{"SMask"}},
+		{"Substitute", []string{"SMask"}, []string{"Attachment", "SMask"}, []string{"Attachment", "Content"}, []Substitution{{"SMask", "Content"}}, nil},
+		{"Second alternative", []string{"SMask", "Content"}, []string{"SMask", "Visual"}, []string{"Attachment", "Visual"}, []Substitution{{"SMask", "Attachment"}}, nil},
+		{"Visual never substituted", []string{"Visual"}, []string{"Visual"}, nil, nil, []string{"Visual"}},
+		{"Unknown and duplicate", nil, []string{"Attachment", "Bogus", "Attachment"}, []string{"Attachment"}, nil, []string{"Bogus"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := planContext(ctx, "UserID:1", anchors(tt.unavailable...), tt.requested, false)
+			if !reflect.DeepEqual(p.Anchors, tt.want) {
+				t.Errorf("Anchors = %v, want %v", p.Anchors, tt.want)
+			}
+			if !reflect.DeepEqual(p.Substitutions, tt.subs) {
+				t.Errorf("Substitutions = %v, want %v", p.Substitutions, tt.subs)
+			}
+			if !reflect.DeepEqual(p.Skipped, tt.skipped) {
+				t.Errorf("Skipped = %v, want %v", p.Skipped, tt.skipped)
+			}
+			if len(p.anchors) != len(p.Anchors) {
+				t.Errorf("Resolved %d anchors for %d names", len(p.anchors), len(p.Anchors))
+			}
+			if want := len(p.Anchors) * (len(magicHeader) + nonceSize + len("UserID:1") + 16); p.OverheadBytes != want {
+				t.Errorf("OverheadBytes = %d, want %d", p.OverheadBytes, want)
+			}
+		})
+	}
+
+	p := planContext(ctx, "x", anchors("SMask"), []string{"SMask", "Content", "Attachment"}, false)
+	notes := strings.Join(p.Notes(), "\n")
+	if !strings.Contains(notes, "SMask skipped (no image XObjects that can carry a soft mask)") {
+		t.Errorf("Unexpected notes: %q", notes)
+	}
+}
+
+// TestPlanContextIncremental tests that anchors without a context injection are
+// unavailable for incremental signing and get substituted
+func TestPlanContextIncremental(t *testing.T) {
+	ctx, err := pdfcpu.CreateContextWithXRefTable(nil, types.PaperSize["A4"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	anchors := []Anchor{
+		&fakeContextAnchor{fakeAnchor{name: "Attachment", available: true}},
+		&fakeAnchor{name: "SMask", available: true},
+		&fakeContextAnchor{fakeAnchor{name: "Content", available: true}},
+	}
+
+	p := planContext(ctx, "x", anchors, []string{"SMask", "Attachment"}, false)
+	if want := []string{"SMask", "Attachment"}; !reflect.DeepEqual(p.Anchors, want) {
+		t.Errorf("Full rewrite: Anchors = %v, want %v", p.Anchors, want)
+	}
+
+	p = planContext(ctx, "x", anchors, []string{"SMask", "Attachment"}, true)
+	if want := []string{"Content", "Attachment"}; !reflect.DeepEqual(p.Anchors, want) {
+		t.Errorf("Incremental: Anchors = %v, want %v", p.Anchors, want)
+	}
+	if !p.Incremental {
+		t.Error("Incremental not set")
+	}
+	if notes := strings.Join(p.Notes(), "\n"); !strings.Contains(notes, notIncrementalReason) {
+		t.Errorf("Unexpected notes: %q", notes)
+	}
+}
@@ -0,0 +1,163 @@
+package injector
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// The SMask anchor hides the payload in the pixels of image soft masks: every
+// frame bit is written to the least significant bit of a mask pixel, several
+// times over, at positions scattered across the whole mask. A mask pixel then
+// differs from its intended opacity by at most 1/255, and the payload survives
+// anything that keeps the pixels: decoding the mask and compressing it again
+// keeps every bit, where data appended after the pixels is cut off.
+
+// lsbCopies is how often every frame bit is written; extraction takes the majority
+const lsbCopies = 3
+
+// lsbFrameOverhead is the magic header, 16-bit length and CRC-32 framing a payload
+var lsbFrameOverhead = len(magicHeader) + 2 + crc32.Size
+
+// maxMaskPixels caps the size of a new mask for a large image; the viewer scales
+// the mask to the image
+const maxMaskPixels = 1 << 20
+
+var (
+	errMaskTooSmall = errors.New("mask has too few pixels for the payload")
+	errNoLSBPayload = errors.New("no payload in the mask pixels")
+)
+
+// lsbPixels returns how many mask pixels a payload of n bytes needs
+func lsbPixels(n int) int {
+	return (n + lsbFrameOverhead) * 8 * lsbCopies
+}
+
+// lsbWalk yields the pixel positions of a mask in the order frame bits are
+// written. The start and a stride coprime to the pixel count are derived from
+// the mask size, so the walk covers the mask without repeating a pixel and the
+// extractor can retrace it.
+type lsbWalk struct {
+	pos, stride, n int
+}
+
+func newLSBWalk(width, height int) *lsbWalk {
+	n := width * height
+	sum := sha256.Sum256([]byte(fmt.Sprintf("defender-smask:%dx%d", width, height)))
+	start := int(binary.BigEndian.Uint64(sum[:8]) % uint64(n))
+	// A stride between a quarter and three quarters of the mask spreads
+	// neighbouring bits far apart
+	stride := n/4 + int(binary.BigEndian.Uint64(sum[8:16])%uint64(n/2+1))
+	for stride < 1 || gcd(stride, n) != 1 {
+		stride++
+	}
+	return &lsbWalk{pos: start, stride: stride % n, n: n}
+}
+
+func (w *lsbWalk) next() int {
+	p := w.pos
+	w.pos = (w.pos + w.stride) % w.n
+	return p
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// maskPixelCount returns width*height if the mask dimensions are valid and
+// pixels holds at least that many 8-bit samples
+func maskPixelCount(pixels []byte, width, height int) (int, bool) {
+	if width <= 0 || height <= 0 || width > len(pixels)/height {
+		return 0, false
+	}
+	return width * height, true
+}
+
+// embedLSB writes payload into the least significant bits of an 8-bit mask
+func embedLSB(pixels []byte, width, height int, payload []byte) error {
+	n, ok := maskPixelCount(pixels, width, height)
+	if !ok || len(payload) > 0xFFFF || lsbPixels(len(payload)) > n {
+		return errMaskTooSmall
+	}
+
+	frame := make([]byte, 0, len(payload)+lsbFrameOverhead)
+	frame = append(frame, magicHeader...)
+	frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	frame = append(frame, payload...)
+	frame = binary.BigEndian.AppendUint32(frame, crc32.ChecksumIEEE(payload))
+
+	w := newLSBWalk(width, height)
+	for _, b := range frame {
+		for i := 7; i >= 0; i-- {
+			bit := b >> i & 1
+			for c := 0; c < lsbCopies; c++ {
+				p := w.next()
+				pixels[p] = pixels[p]&^1 | bit
+			}
+		}
+	}
+	return nil
+}
+
+// extractLSB reads a payload written by embedLSB
+func extractLSB(pixels []byte, width, height int) ([]byte, error) {
+	n, ok := maskPixelCount(pixels, width, height)
+	if !ok {
+		return nil, errNoLSBPayload
+	}
+	w := newLSBWalk(width, height)
+	used := 0
+	read := func(count int) ([]byte, bool) {
+		if used+count*8*lsbCopies > n {
+			return nil, false
+		}
+		out := make([]byte, count)
+		for i := range out {
+			for bit := 0; bit < 8; bit++ {
+				ones := 0
+				for c := 0; c < lsbCopies; c++ {
+					ones += int(pixels[w.next()] & 1)
+				}
+				out[i] <<= 1
+				if ones*2 > lsbCopies {
+					out[i] |= 1
+				}
+			}
+		}
+		used += count * 8 * lsbCopies
+		return out, true
+	}
+
+	header, ok := read(len(magicHeader) + 2)
+	if !ok || string(header[:len(magicHeader)]) != string(magicHeader) {
+		return nil, errNoLSBPayload
+	}
+	body, ok := read(int(binary.BigEndian.Uint16(header[len(magicHeader):])) + crc32.Size)
+	if !ok {
+		return nil, fmt.Errorf("%w: truncated frame", errNoLSBPayload)
+	}
+	payload, sum := body[:len(body)-crc32.Size], body[len(body)-crc32.Size:]
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(sum) {
+		return nil, fmt.Errorf("%w: checksum mismatch", errNoLSBPayload)
+	}
+	return payload, nil
+}
+
+// lsbMaskSize returns the size of a new mask for an image: the image's own
+// size, scaled down to at most maxMaskPixels and up to hold the payload
+func lsbMaskSize(imgWidth, imgHeight, payloadLen int) (width, height int) {
+	width, height = max(imgWidth, 1), max(imgHeight, 1)
+	for d := 2; width*height > maxMaskPixels; d++ {
+		width, height = (max(imgWidth, 1)+d-1)/d, (max(imgHeight, 1)+d-1)/d
+	}
+	w0, h0 := width, height
+	for k := 2; width*height < lsbPixels(payloadLen); k++ {
+		width, height = w0*k, h0*k
+	}
+	return width, height
+}
@@ -0,0 +1,124 @@
+package injector
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// TestLSBRoundTrip tests that the payload survives in an opaque and a
+// translucent mask and moves each pixel by at most one level
+func TestLSBRoundTrip(t *testing.T) {
+	payload := []byte("encrypted payload bytes")
+	for _, fill := range []byte{255, 128, 0} {
+		pixels := bytes.Repeat([]byte{fill}, 64*40)
+		if err := embedLSB(pixels, 64, 40, payload); err != nil {
+			t.Fatalf("embedLSB: %v", err)
+		}
+		for i, p := range pixels {
+			if d := int(p) - int(fill); d < -1 || d > 1 {
+				t.Fatalf("Pixel %d changed from %d to %d", i, fill, p)
+			}
+		}
+		got, err := extractLSB(pixels, 64, 40)
+		if err != nil || !bytes.Equal(got, payload) {
+			t.Errorf("Fill %d: got %q, %v", fill, got, err)
+		}
+	}
+}
+
+// TestLSBErrors tests masks that cannot hold or do not carry a payload
+func TestLSBErrors(t *testing.T) {
+	payload := []byte("payload")
+	small := bytes.Repeat([]byte{255}, lsbPixels(len(payload))-1)
+	if err := embedLSB(small, len(small), 1, payload); !errors.Is(err, errMaskTooSmall) {
+		t.Errorf("Too small mask: %v", err)
+	}
+	if err := embedLSB(small, 100, 100, payload); !errors.Is(err, errMaskTooSmall) {
+		t.Errorf("Mask shorter than its size: %v", err)
+	}
+
+	pixels := bytes.Repeat([]byte{255}, 48*48)
+	if _, err := extractLSB(pixels, 48, 48); !errors.Is(err, errNoLSBPayload) {
+		t.Errorf("Opaque mask: %v", err)
+	}
+	if err := embedLSB(pixels, 48, 48, payload); err != nil {
+		t.Fatal(err)
+	}
+	// Another size retraces another walk
+	if _, err := extractLSB(pixels, 24, 96); !errors.Is(err, errNoLSBPayload) {
+		t.Errorf("Wrong mask size: %v", err)
+	}
+}
+
+// TestLSBDamage tests that the majority vote corrects one damaged copy of
+// every bit and that the checksum catches more
+func TestLSBDamage(t *testing.T) {
+	payload := []byte("payload")
+	pixels := bytes.Repeat([]byte{255}, 48*48)
+	if err := embedLSB(pixels, 48, 48, payload); err != nil {
+		t.Fatal(err)
+	}
+
+	damaged := append([]byte(nil), pixels...)
+	w := newLSBWalk(48, 48)
+	for i := 0; i < lsbPixels(len(payload)); i++ {
+		p := w.next()
+		if i%lsbCopies == 0 {
+			damaged[p] ^= 1
+		}
+	}
+	if got, err := extractLSB(damaged, 48, 48); err != nil || !bytes.Equal(got, payload) {
+		t.Errorf("One copy damaged: got %q, %v", got, err)
+	}
+
+	w = newLSBWalk(48, 48)
+	for i := 0; i < (len(magicHeader)+2)*8*lsbCopies; i++ {
+		w.next()
+	}
+	// Two copies of the first payload bit outvote the third
+	damaged = append([]byte(nil), pixels...)
+	damaged[w.next()] ^= 1
+	damaged[w.next()] ^= 1
+	if _, err := extractLSB(damaged, 48, 48); !errors.Is(err, errNoLSBPayload) {
+		t.Errorf("Two copies damaged: %v", err)
+	}
+}
+
+// TestLSBWalk tests that the walk visits every pixel once
+func TestLSBWalk(t *testing.T) {
+	for _, size := range [][2]int{{1, 1}, {48, 48}, {1890, 924}, {7, 11}} {
+		n := size[0] * size[1]
+		seen := make([]bool, n)
+		w := newLSBWalk(size[0], size[1])
+		for i := 0; i < n; i++ {
+			p := w.next()
+			if seen[p] {
+				t.Fatalf("%dx%d: pixel %d visited twice", size[0], size[1], p)
+			}
+			seen[p] = true
+		}
+	}
+}
+
+// TestLSBMaskSize tests the size of new masks for small and large images
+func TestLSBMaskSize(t *testing.T) {
+	tests := []struct {
+		imgWidth, imgHeight, payloadLen int
+		width, height                   int
+	}{
+		{300, 200, 60, 300, 200},
+		{16, 16, 60, 48, 48},
+		{3000, 2000, 60, 1000, 667},
+		{0, 0, 10, 22, 22},
+	}
+	for _, tt := range tests {
+		w, h := lsbMaskSize(tt.imgWidth, tt.imgHeight, tt.payloadLen)
+		if w != tt.width || h != tt.height {
+			t.Errorf("lsbMaskSize(%d, %d, %d) = %dx%d, want %dx%d", tt.imgWidth, tt.imgHeight, tt.payloadLen, w, h, tt.width, tt.height)
+		}
+		if w*h > maxMaskPixels || w*h < lsbPixels(tt.payloadLen) {
+			t.Errorf("%dx%d mask cannot hold %d bytes", w, h, tt.payloadLen)
+		}
+	}
+}
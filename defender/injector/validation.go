@@ -22,7 +22,7 @@ func validateInputs(filePath, message, key string) error {
 
 	// Check if file exists
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		return fmt.Errorf("file does not exist: %s", filePath)
+		return fmt.Errorf("%w: %s", ErrFileNotFound, filePath)
 	}
 
 	// Check if it's a PDF file
@@ -33,6 +33,20 @@ func validateInputs(filePath, message, key string) error {
 	return nil
 }
 
+// validateSignBytesInputs validates the inputs for SignBytes, which has no file to check
+func validateSignBytesInputs(src []byte, message, key string) error {
+	if len(src) == 0 {
+		return errors.New("source PDF cannot be empty")
+	}
+	if message == "" {
+		return errors.New("message cannot be empty")
+	}
+	if len(key) != keySize {
+		return ErrInvalidKeySize
+	}
+	return nil
+}
+
 // validateVerifyInputs validates the inputs for the Verify function
 func validateVerifyInputs(filePath, key string) error {
 	if filePath == "" {
@@ -44,7 +58,7 @@ func validateVerifyInputs(filePath, key string) error {
 
 	// Check if file exists
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		return fmt.Errorf("file does not exist: %s", filePath)
+		return fmt.Errorf("%w: %s", ErrFileNotFound, filePath)
 	}
 
 	return nil
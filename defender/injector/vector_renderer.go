@@ -0,0 +1,351 @@
+package injector
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// Vector watermark rendering for non-ASCII text.
+//
+// Instead of rasterizing (blurry when zoomed, invisible to text search) or
+// embedding the whole ~14MB Unicode font, the glyphs the message uses are
+// subset out of the embedded TTF and embedded as a Type0/CIDFontType2 font
+// with Identity-H encoding and a ToUnicode CMap. Overhead is a few KB.
+
+const (
+	vectorFontResName   = "PhantomWMFont"
+	vectorGStateResName = "PhantomWMGS"
+	vectorBaseFontName  = "GoNotoCurrent-Regular"
+)
+
+// vectorFont is a subset font embedded into a PDF context
+type vectorFont struct {
+	subset *fontSubset
+	ref    types.IndirectRef
+}
+
+// embedVectorFont subsets the embedded Unicode font to the runes of text and
+// writes the Type0 font (with descendant CIDFontType2, descriptor, font file
+// and ToUnicode CMap) into ctx.
+func embedVectorFont(ctx *model.Context, text string) (*vectorFont, error) {
+	subset, err := subsetTTF(goNotoCurrentTTF, []rune(text))
+	if err != nil {
+		return nil, fmt.Errorf("failed to subset font: %w", err)
+	}
+
+	xRefTable := ctx.XRefTable
+	scale := 1000.0 / float64(subset.UnitsPerEm)
+	baseFont := subsetTag(subset.Data) + "+" + vectorBaseFontName
+
+	// FontFile2: the subset TrueType program
+	fontFile, _ := xRefTable.NewStreamDictForBuf(subset.Data)
+	fontFile.InsertInt("Length1", len(subset.Data))
+	if err := fontFile.Encode(); err != nil {
+		return nil, fmt.Errorf("failed to encode font file: %w", err)
+	}
+	fontFileRef, err := xRefTable.IndRefForNewObject(*fontFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create font file object: %w", err)
+	}
+
+	// CIDSet: every CID of the dense subset is present (PDF/A-1 requires it for subsets)
+	cidSet := make([]byte, (len(subset.Advances)+7)/8)
+	for cid := range subset.Advances {
+		cidSet[cid/8] |= 0x80 >> (cid % 8)
+	}
+	cidSetStream, _ := xRefTable.NewStreamDictForBuf(cidSet)
+	if err := cidSetStream.Encode(); err != nil {
+		return nil, fmt.Errorf("failed to encode CIDSet: %w", err)
+	}
+	cidSetRef, err := xRefTable.IndRefForNewObject(*cidSetStream)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CIDSet: %w", err)
+	}
+
+	descriptor := types.Dict{
+		"Type":        types.Name("FontDescriptor"),
+		"FontName":    types.Name(baseFont),
+		"Flags":       types.Integer(4), // Symbolic: glyphs outside the standard Latin set
+		"FontBBox":    types.NewNumberArray(float64(subset.BBox[0])*scale, float64(subset.BBox[1])*scale, float64(subset.BBox[2])*scale, float64(subset.BBox[3])*scale),
+		"ItalicAngle": types.Integer(0),
+		"Ascent":      types.Float(math.Round(float64(subset.Ascent) * scale)),
+		"Descent":     types.Float(math.Round(float64(subset.Descent) * scale)),
+		"CapHeight":   types.Float(math.Round(float64(subset.Ascent) * scale)),
+		"StemV":       types.Integer(80),
+		"FontFile2":   *fontFileRef,
+		"CIDSet":      *cidSetRef,
+	}
+	descriptorRef, err := xRefTable.IndRefForNewObject(descriptor)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create font descriptor: %w", err)
+	}
+
+	// CIDs equal the dense subset glyph IDs, so widths are a single run from CID 0
+	widths := make(types.Array, len(subset.Advances))
+	for i, adv := range subset.Advances {
+		widths[i] = types.Integer(int(math.Round(float64(adv) * scale)))
+	}
+
+	cidFont := types.Dict{
+		"Type":     types.Name("Font"),
+		"Subtype":  types.Name("CIDFontType2"),
+		"BaseFont": types.Name(baseFont),
+		"CIDSystemInfo": types.Dict{
+			"Registry":   types.StringLiteral("Adobe"),
+			"Ordering":   types.StringLiteral("Identity"),
+			"Supplement": types.Integer(0),
+		},
+		"FontDescriptor": *descriptorRef,
+		"DW":             types.Integer(1000),
+		"W":              types.Array{types.Integer(0), widths},
+		"CIDToGIDMap":    types.Name("Identity"),
+	}
+	cidFontRef, err := xRefTable.IndRefForNewObject(cidFont)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CID font: %w", err)
+	}
+
+	toUnicode, _ := xRefTable.NewStreamDictForBuf(toUnicodeCMap(subset.GIDs))
+	if err := toUnicode.Encode(); err != nil {
+		return nil, fmt.Errorf("failed to encode ToUnicode CMap: %w", err)
+	}
+	toUnicodeRef, err := xRefTable.IndRefForNewObject(*toUnicode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ToUnicode CMap: %w", err)
+	}
+
+	type0 := types.Dict{
+		"Type":            types.Name("Font"),
+		"Subtype":         types.Name("Type0"),
+		"BaseFont":        types.Name(baseFont),
+		"Encoding":        types.Name("Identity-H"),
+		"DescendantFonts": types.Array{*cidFontRef},
+		"ToUnicode":       *toUnicodeRef,
+	}
+	type0Ref, err := xRefTable.IndRefForNewObject(type0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Type0 font: %w", err)
+	}
+
+	return &vectorFont{subset: subset, ref: *type0Ref}, nil
+}
+
+// measurer returns a textMeasurer using the subset's own advances, so layout
+// and rendering agree exactly.
+func (vf *vectorFont) measurer() textMeasurer {
+	return func(s string, fontSize int) float64 {
+		var total int
+		for _, r := range s {
+			total += vf.subset.Advances[vf.subset.GIDs[r]]
+		}
+		return float64(total) / float64(vf.subset.UnitsPerEm) * float64(fontSize)
+	}
+}
+
+// subsetTag derives the six-letter subset prefix (e.g. "ABCDEF+") from the font data,
+// so the same glyph set always yields the same name.
+func subsetTag(data []byte) string {
+	sum := sha256.Sum256(data)
+	tag := make([]byte, 6)
+	for i := range tag {
+		tag[i] = 'A' + sum[i]%26
+	}
+	return string(tag)
+}
+
+// toUnicodeCMap builds a ToUnicode CMap mapping 2-byte CIDs back to UTF-16BE text
+func toUnicodeCMap(gids map[rune]uint16) []byte {
+	var sb strings.Builder
+	sb.WriteString("/CIDInit /ProcSet findresource begin\n12 dict begin\nbegincmap\n")
+	sb.WriteString("/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n")
+	sb.WriteString("/CMapName /Adobe-Identity-UCS def\n/CMapType 2 def\n")
+	sb.WriteString("1 begincodespacerange\n<0000> <FFFF>\nendcodespacerange\n")
+
+	// Deterministic order: by CID; if several runes share a glyph, the lowest wins
+	byCID := make(map[uint16]rune, len(gids))
+	for r, gid := range gids {
+		if gid == 0 {
+			continue // .notdef has no meaningful Unicode value
+		}
+		if prev, ok := byCID[gid]; !ok || r < prev {
+			byCID[gid] = r
+		}
+	}
+	cids := make([]int, 0, len(byCID))
+	for cid := range byCID {
+		cids = append(cids, int(cid))
+	}
+	sort.Ints(cids)
+
+	entries := make([]string, 0, len(cids))
+	for _, cid := range cids {
+		var hex strings.Builder
+		for _, u := range utf16.Encode([]rune{byCID[uint16(cid)]}) {
+			fmt.Fprintf(&hex, "%04X", u)
+		}
+		entries = append(entries, fmt.Sprintf("<%04X> <%s>", cid, hex.String()))
+	}
+	// bfchar blocks hold at most 100 entries each
+	for len(entries) > 0 {
+		n := min(len(entries), 100)
+		fmt.Fprintf(&sb, "%d beginbfchar\n%s\nendbfchar\n", n, strings.Join(entries[:n], "\n"))
+		entries = entries[n:]
+	}
+
+	sb.WriteString("endcmap\nCMapName currentdict /CMap defineresource pop\nend\nend\n")
+	return []byte(sb.String())
+}
+
+// stampVectorWatermark draws layout on every page in pages using the embedded
+// subset font and the fill colour operator fill. geom must be the (shared)
+// geometry of those pages. The stamp is wrapped in marks, nil without tamper
+// evidence.
+func stampVectorWatermark(ctx *model.Context, pages types.IntSet, geom pageGeometry, layout watermarkLayout, vf *vectorFont, style VisualStyle, fill string, marks *pageMarks) error {
+	xRefTable := ctx.XRefTable
+
+	gs := types.Dict{
+		"Type": types.Name("ExtGState"),
+		"ca":   types.Float(style.Opacity),
+		"CA":   types.Float(style.Opacity),
+	}
+	gsRef, err := xRefTable.IndRefForNewObject(gs)
+	if err != nil {
+		return fmt.Errorf("failed to create graphics state: %w", err)
+	}
+
+	// Guard the existing content with q ... Q so our stamp starts from a clean state
+	guard, _ := xRefTable.NewStreamDictForBuf([]byte("q\n"))
+	if err := guard.Encode(); err != nil {
+		return fmt.Errorf("failed to encode content stream: %w", err)
+	}
+	guardRef, err := xRefTable.IndRefForNewObject(*guard)
+	if err != nil {
+		return fmt.Errorf("failed to create content stream: %w", err)
+	}
+
+	// Close the guard, then draw the stamp inside a page mark
+	stamp, _ := xRefTable.NewStreamDictForBuf(append([]byte("Q\n"), marks.wrap(vectorWatermarkContent(geom, layout, vf, fill))...))
+	if err := stamp.Encode(); err != nil {
+		return fmt.Errorf("failed to encode content stream: %w", err)
+	}
+	stampRef, err := xRefTable.IndRefForNewObject(*stamp)
+	if err != nil {
+		return fmt.Errorf("failed to create content stream: %w", err)
+	}
+
+	for pageNr := range pages {
+		if !pages[pageNr] {
+			continue
+		}
+		pageDict, _, inhPAttrs, err := ctx.PageDict(pageNr, false)
+		if err != nil {
+			return fmt.Errorf("failed to get page dict for page %d: %w", pageNr, err)
+		}
+		if err := addPageResource(ctx, pageDict, inhPAttrs, "Font", vectorFontResName, vf.ref); err != nil {
+			return fmt.Errorf("page %d: %w", pageNr, err)
+		}
+		if err := addPageResource(ctx, pageDict, inhPAttrs, "ExtGState", vectorGStateResName, *gsRef); err != nil {
+			return fmt.Errorf("page %d: %w", pageNr, err)
+		}
+		if err := wrapPageContents(pageDict, *guardRef, *stampRef); err != nil {
+			return fmt.Errorf("page %d: %w", pageNr, err)
+		}
+	}
+
+	return nil
+}
+
+// vectorWatermarkContent returns the content stream drawing layout centred on
+// the page box. Page /Rotate is compensated so the stamp reads along the
+// diagonal of the page as displayed.
+func vectorWatermarkContent(geom pageGeometry, layout watermarkLayout, vf *vectorFont, fill string) []byte {
+	measure := vf.measurer()
+	size := float64(layout.FontSize)
+	lineHeight := size * wmLineSpacing
+	upem := float64(vf.subset.UnitsPerEm)
+	// Shift baselines so the block is vertically centred on the glyphs' midline
+	midline := size * float64(vf.subset.Ascent+vf.subset.Descent) / (2 * upem)
+
+	angle := (layout.Rotation + float64(geom.Rotate)) * math.Pi / 180
+	sin, cos := math.Sin(angle), math.Cos(angle)
+	cx := (geom.LLX + geom.URX) / 2
+	cy := (geom.LLY + geom.URY) / 2
+
+	var sb strings.Builder
+	sb.WriteString("q\n")
+	fmt.Fprintf(&sb, "/%s gs\n%s\nBT\n/%s %d Tf\n", vectorGStateResName, fill, vectorFontResName, layout.FontSize)
+	n := len(layout.Lines)
+	for i, line := range layout.Lines {
+		x := -measure(line, layout.FontSize) / 2
+		y := (float64(n-1)/2-float64(i))*lineHeight - midline
+		tx := cx + x*cos - y*sin
+		ty := cy + x*sin + y*cos
+		fmt.Fprintf(&sb, "%.4f %.4f %.4f %.4f %.2f %.2f Tm\n<", cos, sin, -sin, cos, tx, ty)
+		for _, r := range line {
+			fmt.Fprintf(&sb, "%04X", vf.subset.GIDs[r])
+		}
+		sb.WriteString("> Tj\n")
+	}
+	sb.WriteString("ET\nQ\n")
+	return []byte(sb.String())
+}
+
+// addPageResource registers ref under /Resources/<category>/<name> of a page.
+// Inherited resources are copied into the page first so siblings are unaffected.
+func addPageResource(ctx *model.Context, pageDict types.Dict, inhPAttrs *model.InheritedPageAttrs, category, name string, ref types.IndirectRef) error {
+	var resDict types.Dict
+	if resObj, ok := pageDict["Resources"]; ok {
+		d, err := ctx.DereferenceDict(resObj)
+		if err != nil {
+			return fmt.Errorf("failed to dereference Resources: %w", err)
+		}
+		resDict = d
+	}
+	if resDict == nil {
+		resDict = types.NewDict()
+		if inhPAttrs != nil && inhPAttrs.Resources != nil {
+			resDict = inhPAttrs.Resources.Clone().(types.Dict)
+		}
+		pageDict["Resources"] = resDict
+	}
+
+	var catDict types.Dict
+	if catObj, ok := resDict[category]; ok {
+		d, err := ctx.DereferenceDict(catObj)
+		if err != nil {
+			return fmt.Errorf("failed to dereference %s dict: %w", category, err)
+		}
+		catDict = d
+	}
+	if catDict == nil {
+		catDict = types.NewDict()
+		resDict[category] = catDict
+	}
+
+	catDict[name] = ref
+	return nil
+}
+
+// wrapPageContents turns the page's /Contents into [prefix, <original...>, suffix]
+func wrapPageContents(pageDict types.Dict, prefix, suffix types.IndirectRef) error {
+	contents := types.Array{prefix}
+	if contentObj, ok := pageDict["Contents"]; ok {
+		switch obj := contentObj.(type) {
+		case types.IndirectRef:
+			contents = append(contents, obj)
+		case types.Array:
+			contents = append(contents, obj...)
+		default:
+			return fmt.Errorf("unsupported Contents type %T", contentObj)
+		}
+	}
+	pageDict["Contents"] = append(contents, suffix)
+	return nil
+}
@@ -0,0 +1,483 @@
+package injector
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// maxFormDepth bounds nested form XObject recursion
+const maxFormDepth = 8
+
+// ExtractShownText returns the text shown by every page and by every form XObject
+// the pages paint, one entry per content stream, with each text-showing operation
+// on its own line. Strings are decoded through the font's ToUnicode CMap when it
+// has one (as the vector Visual watermark does) and as Latin-1 otherwise (as the
+// Helvetica Visual watermark does). Text rasterized into images is not recovered.
+// Streams are decoded within DefaultLimits.
+func ExtractShownText(filePath string) ([]string, error) {
+	return ExtractShownTextWithLimits(filePath, DefaultLimits)
+}
+
+// ExtractShownTextWithLimits is ExtractShownText within limits. A file exceeding
+// them returns a *LimitError and no text.
+func ExtractShownTextWithLimits(filePath string, limits Limits) ([]string, error) {
+	b := newBudget(limits)
+	ctx, err := b.readFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	x := &textExtractor{ctx: ctx, budget: b, fonts: make(map[int]*shownFont), forms: make(map[int]bool)}
+	for pageNr := 1; pageNr <= ctx.PageCount && x.err == nil; pageNr++ {
+		if x.err = b.checkTime(); x.err != nil {
+			break
+		}
+		pageDict, _, inhPAttrs, err := ctx.PageDict(pageNr, false)
+		if err != nil || pageDict == nil {
+			continue
+		}
+		content, err := x.pageContent(pageDict)
+		if err != nil {
+			continue
+		}
+		x.run(content, inhPAttrs.Resources, 0)
+	}
+	if x.err != nil {
+		return nil, x.err
+	}
+	return x.texts, nil
+}
+
+// shownFont decodes strings shown with one font
+type shownFont struct {
+	codeLen   int               // Bytes per character code
+	toUnicode map[uint32]string // nil without a usable ToUnicode CMap
+}
+
+func (f *shownFont) decode(s []byte) string {
+	var sb strings.Builder
+	for i := 0; i+f.codeLen <= len(s); i += f.codeLen {
+		var code uint32
+		for _, b := range s[i : i+f.codeLen] {
+			code = code<<8 | uint32(b)
+		}
+		if f.toUnicode != nil {
+			sb.WriteString(f.toUnicode[code])
+		} else {
+			sb.WriteRune(rune(code))
+		}
+	}
+	return sb.String()
+}
+
+// textExtractor walks content streams collecting shown text
+type textExtractor struct {
+	ctx    *model.Context
+	budget *budget
+	fonts  map[int]*shownFont // Keyed by font object number
+	forms  map[int]bool       // Form XObjects already walked
+	texts  []string
+	err    error // First limit exceeded, which stops the walk
+}
+
+// decode decodes a stream within the budget, recording an exceeded limit
+func (x *textExtractor) decode(sd *types.StreamDict, o types.Object) ([]byte, error) {
+	objNr := 0
+	if ref, ok := o.(types.IndirectRef); ok {
+		objNr = ref.ObjectNumber.Value()
+	}
+	data, err := x.budget.decodeStream(sd, objNr)
+	if errors.Is(err, ErrLimitExceeded) && x.err == nil {
+		x.err = err
+	}
+	return data, err
+}
+
+// pageContent concatenates the decoded content streams of a page
+func (x *textExtractor) pageContent(pageDict types.Dict) ([]byte, error) {
+	contents, found := pageDict.Find("Contents")
+	if !found {
+		return nil, nil
+	}
+	streams := []types.Object{contents}
+	if arr, err := x.ctx.DereferenceArray(contents); err == nil && arr != nil {
+		streams = arr
+	}
+
+	var content []byte
+	for _, o := range streams {
+		sd, _, err := x.ctx.DereferenceStreamDict(o)
+		if err != nil || sd == nil {
+			continue
+		}
+		data, err := x.decode(sd, o)
+		if err != nil {
+			return nil, err
+		}
+		content = append(append(content, data...), '\n')
+	}
+	return content, nil
+}
+
+// run interprets one content stream with the given resources
+func (x *textExtractor) run(content []byte, resources types.Dict, depth int) {
+	var lines []string
+	var font *shownFont
+	var operands []contentToken
+
+	for _, tok := range tokenizeContent(content) {
+		if tok.kind != tokOperator {
+			operands = append(operands, tok)
+			continue
+		}
+		switch tok.text {
+		case "Tf":
+			if len(operands) >= 2 && operands[len(operands)-2].kind == tokName {
+				font = x.font(resources, operands[len(operands)-2].text)
+			}
+		case "Tj", "'", "\"":
+			if n := len(operands); n > 0 && operands[n-1].kind == tokString {
+				lines = append(lines, x.show(font, operands[n-1].data))
+			}
+		case "TJ":
+			var sb strings.Builder
+			for _, op := range operands {
+				if op.kind == tokString {
+					sb.WriteString(x.show(font, op.data))
+				}
+			}
+			lines = append(lines, sb.String())
+		case "Do":
+			if n := len(operands); n > 0 && operands[n-1].kind == tokName && depth < maxFormDepth {
+				x.runForm(resources, operands[n-1].text, depth+1)
+			}
+		}
+		operands = operands[:0]
+	}
+
+	if text := strings.TrimSpace(strings.Join(lines, "\n")); text != "" {
+		x.texts = append(x.texts, text)
+	}
+}
+
+// show decodes a shown string with the current font (Latin-1 without one)
+func (x *textExtractor) show(font *shownFont, s []byte) string {
+	if font == nil {
+		font = &shownFont{codeLen: 1}
+	}
+	return font.decode(s)
+}
+
+// runForm walks a form XObject named in resources
+func (x *textExtractor) runForm(resources types.Dict, name string, depth int) {
+	ref, ok := resourceRef(x.ctx, resources, "XObject", name)
+	if !ok || x.forms[ref.ObjectNumber.Value()] {
+		return
+	}
+	x.forms[ref.ObjectNumber.Value()] = true
+
+	sd, _, err := x.ctx.DereferenceStreamDict(ref)
+	if err != nil || sd == nil || sd.Subtype() == nil || *sd.Subtype() != "Form" {
+		return
+	}
+	content, err := x.decode(sd, ref)
+	if err != nil {
+		return
+	}
+
+	formResources := resources
+	if d, err := x.ctx.DereferenceDict(sd.Dict["Resources"]); err == nil && d != nil {
+		formResources = d
+	}
+	x.run(content, formResources, depth)
+}
+
+// font resolves and caches the font named in resources
+func (x *textExtractor) font(resources types.Dict, name string) *shownFont {
+	ref, ok := resourceRef(x.ctx, resources, "Font", name)
+	if !ok {
+		return nil
+	}
+	if f, cached := x.fonts[ref.ObjectNumber.Value()]; cached {
+		return f
+	}
+
+	f := &shownFont{codeLen: 1}
+	if d, err := x.ctx.DereferenceDict(ref); err == nil && d != nil {
+		if st := d.NameEntry("Subtype"); st != nil && *st == "Type0" {
+			f.codeLen = 2
+		}
+		if tu, _, err := x.ctx.DereferenceStreamDict(d["ToUnicode"]); err == nil && tu != nil {
+			if cmap, err := x.decode(tu, d["ToUnicode"]); err == nil {
+				f.toUnicode = parseToUnicodeCMap(cmap)
+			}
+		}
+	}
+	x.fonts[ref.ObjectNumber.Value()] = f
+	return f
+}
+
+// resourceRef looks up /category/name in resources, requiring an indirect reference
+func resourceRef(ctx *model.Context, resources types.Dict, category, name string) (types.IndirectRef, bool) {
+	if resources == nil {
+		return types.IndirectRef{}, false
+	}
+	catDict, err := ctx.DereferenceDict(resources[category])
+	if err != nil || catDict == nil {
+		return types.IndirectRef{}, false
+	}
+	ref, ok := catDict[name].(types.IndirectRef)
+	return ref, ok
+}
+
+// parseToUnicodeCMap reads the bfchar and bfrange mappings of a ToUnicode CMap
+func parseToUnicodeCMap(data []byte) map[uint32]string {
+	m := make(map[uint32]string)
+	toks := tokenizeContent(data)
+
+	for i := 0; i < len(toks); i++ {
+		if toks[i].kind != tokOperator {
+			continue
+		}
+		switch toks[i].text {
+		case "beginbfchar":
+			for i++; i+1 < len(toks) && toks[i].kind == tokString; i += 2 {
+				m[codeValue(toks[i].data)] = utf16BEString(toks[i+1].data)
+			}
+			i--
+		case "beginbfrange":
+			for i++; i+2 < len(toks) && toks[i].kind == tokString; i += 3 {
+				lo, hi := codeValue(toks[i].data), codeValue(toks[i+1].data)
+				if hi < lo || hi-lo > 0xFFFF {
+					continue
+				}
+				if toks[i+2].kind == tokArrayStart {
+					// <lo> <hi> [<dst> <dst> ...]
+					j := i + 3
+					for code := lo; j < len(toks) && toks[j].kind == tokString; code, j = code+1, j+1 {
+						m[code] = utf16BEString(toks[j].data)
+					}
+					i = j - 2 // Skip the closing bracket on the next step
+					continue
+				}
+				// <lo> <hi> <dst>: the last UTF-16 unit increments across the range
+				dst := []rune(utf16BEString(toks[i+2].data))
+				if len(dst) == 0 {
+					continue
+				}
+				for code := lo; code <= hi; code++ {
+					r := append([]rune(nil), dst...)
+					r[len(r)-1] += rune(code - lo)
+					m[code] = string(r)
+				}
+			}
+			i--
+		}
+	}
+	return m
+}
+
+func codeValue(b []byte) uint32 {
+	var v uint32
+	for _, c := range b {
+		v = v<<8 | uint32(c)
+	}
+	return v
+}
+
+func utf16BEString(b []byte) string {
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+	return string(utf16.Decode(units))
+}
+
+// Content stream tokens
+const (
+	tokOperator = iota
+	tokName
+	tokString
+	tokNumber
+	tokArrayStart
+	tokArrayEnd
+	tokOther
+)
+
+type contentToken struct {
+	kind int
+	text string // Operator, name (without '/') or number
+	data []byte // Decoded string bytes
+	// start and end are the token's byte offsets in the tokenized data
+	start, end int
+}
+
+// tokenizeContent splits a content stream (or CMap) into tokens.
+// Inline image data (BI ... ID <data> EI) is skipped.
+func tokenizeContent(data []byte) []contentToken {
+	var toks []contentToken
+	for i := 0; i < len(data); {
+		c, start, n := data[i], i, len(toks)
+		switch {
+		case isPDFWhitespace(c):
+			i++
+		case c == '%':
+			for i < len(data) && data[i] != '\n' && data[i] != '\r' {
+				i++
+			}
+		case c == '(':
+			s, next := readLiteralString(data, i)
+			toks = append(toks, contentToken{kind: tokString, data: s})
+			i = next
+		case c == '<' && i+1 < len(data) && data[i+1] == '<', c == '>' && i+1 < len(data) && data[i+1] == '>':
+			toks = append(toks, contentToken{kind: tokOther})
+			i += 2
+		case c == '<':
+			end := bytes.IndexByte(data[i:], '>')
+			if end < 0 {
+				return toks
+			}
+			toks = append(toks, contentToken{kind: tokString, data: decodeHexString(data[i+1 : i+end])})
+			i += end + 1
+		case c == '[':
+			toks = append(toks, contentToken{kind: tokArrayStart})
+			i++
+		case c == ']':
+			toks = append(toks, contentToken{kind: tokArrayEnd})
+			i++
+		case c == '{' || c == '}' || c == ')' || c == '>':
+			i++
+		case c == '/':
+			j := i + 1
+			for j < len(data) && !isPDFWhitespace(data[j]) && !isPDFDelimiter(data[j]) {
+				j++
+			}
+			toks = append(toks, contentToken{kind: tokName, text: string(data[i+1 : j])})
+			i = j
+		default:
+			j := i
+			for j < len(data) && !isPDFWhitespace(data[j]) && !isPDFDelimiter(data[j]) {
+				j++
+			}
+			word := string(data[i:j])
+			i = j
+			if c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9') {
+				toks = append(toks, contentToken{kind: tokNumber, text: word})
+				break
+			}
+			toks = append(toks, contentToken{kind: tokOperator, text: word})
+			if word == "ID" {
+				// Skip inline image data up to the EI operator
+				end := bytes.Index(data[i:], []byte("EI"))
+				for end >= 0 {
+					at := i + end
+					if (at == 0 || isPDFWhitespace(data[at-1])) && (at+2 == len(data) || isPDFWhitespace(data[at+2])) {
+						break
+					}
+					next := bytes.Index(data[at+2:], []byte("EI"))
+					if next < 0 {
+						end = -1
+						break
+					}
+					end += 2 + next
+				}
+				if end < 0 {
+					return toks
+				}
+				i += end
+			}
+		}
+		if len(toks) > n {
+			toks[n].start, toks[n].end = start, i
+		}
+	}
+	return toks
+}
+
+// readLiteralString decodes the literal string starting at data[start] == '('
+// and returns it with the index just past the closing parenthesis.
+func readLiteralString(data []byte, start int) ([]byte, int) {
+	var out []byte
+	depth := 0
+	for i := start; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case c == '(':
+			if depth > 0 {
+				out = append(out, c)
+			}
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return out, i + 1
+			}
+			out = append(out, c)
+		case c == '\\' && i+1 < len(data):
+			i++
+			switch e := data[i]; e {
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'b':
+				out = append(out, '\b')
+			case 'f':
+				out = append(out, '\f')
+			case '\r':
+				if i+1 < len(data) && data[i+1] == '\n' {
+					i++
+				}
+			case '\n':
+				// Line continuation
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for k := 0; k < 2 && i+1 < len(data) && data[i+1] >= '0' && data[i+1] <= '7'; k++ {
+						i++
+						v = v*8 + int(data[i]-'0')
+					}
+					out = append(out, byte(v))
+				} else {
+					out = append(out, e)
+				}
+			}
+		default:
+			out = append(out, c)
+		}
+	}
+	return out, len(data)
+}
+
+func decodeHexString(b []byte) []byte {
+	var digits []byte
+	for _, c := range b {
+		if !isPDFWhitespace(c) {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out, err := hex.DecodeString(string(digits))
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+func isPDFWhitespace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isPDFDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
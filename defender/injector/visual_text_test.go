@@ -0,0 +1,71 @@
+package injector
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestTokenizeContent tests strings, names, arrays and inline image skipping
+func TestTokenizeContent(t *testing.T) {
+	content := []byte("BT /F1 12 Tf (a\\(b\\)\\101\\\nc) Tj [<0041> -120 (B)] TJ ET BI /W 1 /H 1 ID \x00EI\xffEI EI /Im0 Do % comment (x) Tj\n")
+	toks := tokenizeContent(content)
+
+	var ops, names, strs []string
+	for _, tok := range toks {
+		switch tok.kind {
+		case tokOperator:
+			ops = append(ops, tok.text)
+		case tokName:
+			names = append(names, tok.text)
+		case tokString:
+			strs = append(strs, string(tok.data))
+		}
+	}
+
+	if want := []string{"BT", "Tf", "Tj", "TJ", "ET", "BI", "ID", "EI", "Do"}; !reflect.DeepEqual(ops, want) {
+		t.Errorf("Operators mismatch: got %q, want %q", ops, want)
+	}
+	if want := []string{"F1", "W", "H", "Im0"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Names mismatch: got %q, want %q", names, want)
+	}
+	if want := []string{"a(b)Ac", "\x00A", "B"}; !reflect.DeepEqual(strs, want) {
+		t.Errorf("Strings mismatch: got %q, want %q", strs, want)
+	}
+}
+
+// TestParseToUnicodeCMap tests bfchar and both bfrange forms, and round-trips
+// the CMap written for vector watermarks
+func TestParseToUnicodeCMap(t *testing.T) {
+	cmap := []byte(`begincmap
+2 beginbfchar
+<0003> <0041>
+<0004> <D83DDE00>
+endbfchar
+2 beginbfrange
+<0010> <0012> <0061>
+<0020> <0021> [<673A> <5BC6>]
+endbfrange
+endcmap`)
+
+	want := map[uint32]string{
+		0x03: "A", 0x04: "😀",
+		0x10: "a", 0x11: "b", 0x12: "c",
+		0x20: "机", 0x21: "密",
+	}
+	if got := parseToUnicodeCMap(cmap); !reflect.DeepEqual(got, want) {
+		t.Errorf("CMap mismatch: got %q, want %q", got, want)
+	}
+
+	gids := map[rune]uint16{'机': 1, '密': 2, 'A': 3, '😀': 4}
+	parsed := parseToUnicodeCMap(toUnicodeCMap(gids))
+	for r, gid := range gids {
+		if parsed[uint32(gid)] != string(r) {
+			t.Errorf("Round trip of %q: got %q", r, parsed[uint32(gid)])
+		}
+	}
+
+	font := &shownFont{codeLen: 2, toUnicode: parsed}
+	if got := font.decode([]byte{0, 1, 0, 2, 0, 3}); got != "机密A" {
+		t.Errorf("Decode mismatch: got %q", got)
+	}
+}
@@ -1,9 +1,16 @@
 package injector
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
+
+	"defender/ledger"
 )
 
 var (
@@ -24,6 +31,18 @@ var (
 	ErrMagicHeaderMismatch = errors.New("magic header mismatch")
 	// ErrAttachmentNotFound indicates the attachment was not found
 	ErrAttachmentNotFound = errors.New("attachment not found")
+	// ErrOutputExists indicates the output file exists and overwriting was not allowed
+	ErrOutputExists = errors.New("output file already exists")
+	// ErrFileNotFound indicates the input file does not exist
+	ErrFileNotFound = errors.New("file does not exist")
+	// ErrNoPayload indicates none of the selected anchors carries a tracking payload
+	ErrNoPayload = errors.New("no tracking payload found")
+	// ErrDecryptFailed indicates a tracking payload was found but could not be
+	// decrypted with the key (wrong key or tampered payload)
+	ErrDecryptFailed = errors.New("tracking payload could not be decrypted")
+	// ErrLedgerRecord indicates the signed copy could not be recorded in the
+	// issuance ledger, so it was not handed out
+	ErrLedgerRecord = errors.New("ledger record failed")
 )
 
 var (
@@ -32,98 +51,331 @@ var (
 	DefaultAnchors = []string{"Attachment", "SMask", "Content", "Visual"}
 )
 
-// Sign embeds an encrypted message into a PDF file using triple-anchor strategy:
-// Anchor 1 (Main): Attachment - Easy to detect but standard-compliant
-// Anchor 2 (Stealth): Image SMask - Highly covert backup signature
-// Anchor 3 (Phase 8): Content Stream Perturbation - Watermark bound to rendering
-// Sign embeds an encrypted message into a PDF file using selected anchor strategies.
-// selectedAnchors: list of anchor names to use. If empty, uses all available anchors.
+// SignResult describes a completed Sign operation
+type SignResult struct {
+	// OutputPath is the path of the signed PDF
+	OutputPath string
+	// Anchors lists the anchors that were successfully embedded, in injection order
+	Anchors []string
+	// Plan is the injection plan the anchors were chosen by
+	Plan *Plan
+	// DigestedPages is the number of page digests sealed into the payload (tamper evidence)
+	DigestedPages int
+	// PDFA is the PDF/A level the signed copy was checked against ("" if the source claims none)
+	PDFA string
+}
+
 // Sign embeds an encrypted message into a PDF file using selected anchor strategies.
-// selectedAnchors: list of anchor names to use. If empty, uses all available anchors.
-func Sign(filePath, message, key string, selectedAnchors []string) error {
+// The signed copy is written next to the input as <name>_signed.pdf, replacing
+// an existing one; the result carries its path.
+// selectedAnchors: list of anchor names to use. If empty, uses DefaultAnchors.
+func Sign(filePath, message, key string, selectedAnchors []string) (*SignResult, error) {
+	outputPath, err := DefaultOutputPath(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return SignTo(filePath, outputPath, message, key, selectedAnchors)
+}
+
+// DefaultOutputPath returns where Sign writes the signed copy of filePath (<name>_signed.pdf)
+func DefaultOutputPath(filePath string) (string, error) {
+	outputPath, err := generateOutputPath(filePath, "_signed")
+	if err != nil {
+		return "", fmt.Errorf("failed to generate output path: %w", err)
+	}
+	return outputPath, nil
+}
+
+// SignOptions configures SignWithOptions
+type SignOptions struct {
+	// Anchors lists the anchor names to use. If empty, uses DefaultAnchors.
+	Anchors []string
+	// Visual is the look of the Visual anchor (DefaultVisualStyle if nil)
+	Visual *VisualStyle
+	// Overwrite allows replacing an existing file at the output path, including
+	// the input itself (in-place signing). Otherwise ErrOutputExists is returned.
+	Overwrite bool
+	// TamperEvidence seals a digest of every page's content into the payload,
+	// so VerifyDetailed can report which pages changed after signing
+	TamperEvidence bool
+	// UserPassword or OwnerPassword opens an encrypted input. The signed copy
+	// is encrypted again with the input's algorithm, permissions and passwords.
+	UserPassword  string
+	OwnerPassword string
+	// Incremental appends the anchors as an incremental update after the
+	// original bytes instead of rewriting the file, so existing digital
+	// signatures stay valid. Anchors that cannot be applied incrementally are
+	// skipped or substituted and reported in the plan. Not supported for
+	// encrypted inputs.
+	Incremental bool
+	// Events receives the progress of signing, if set. Without it the
+	// library prints nothing.
+	Events EventHandler
+	// Ledger records every signed copy, if set. SignContext appends the
+	// record once the copy is written next to the output and only then moves
+	// it into place, so a failed record leaves an existing output untouched;
+	// SignBytes and SignReader append it before handing the copy out. Either
+	// way a failed record returns ErrLedgerRecord.
+	Ledger *ledger.Ledger
+	// Issuance holds the ledger fields only the caller knows: Operator,
+	// Recipient and, to record names other than the paths signed (or, for
+	// SignBytes and SignReader, any names), SourceFile and OutputFile. The
+	// hashes, message, key ID and anchors are filled in.
+	Issuance ledger.Record
+	// DeterministicSeed is for golden-file tests only: the same inputs and seed
+	// give a byte-identical copy. The nonce and file ID are derived from the
+	// seed and the dates are fixed; the copy is otherwise written exactly as
+	// without a seed. Never hand out a copy signed with it: the nonce no
+	// longer comes from a random source. Not supported for encrypted inputs.
+	DeterministicSeed []byte
+}
+
+// SignTo embeds an encrypted message into a PDF file and writes the signed copy to outputPath,
+// replacing an existing file there.
+// selectedAnchors: list of anchor names to use. If empty, uses DefaultAnchors.
+// Returns which anchors were actually embedded.
+func SignTo(filePath, outputPath, message, key string, selectedAnchors []string) (*SignResult, error) {
+	return SignWithOptions(filePath, outputPath, message, key, SignOptions{Anchors: selectedAnchors, Overwrite: true})
+}
+
+// SignWithOptions is SignTo with the full set of signing options.
+// The signed copy only appears at outputPath once it is complete: it is built in
+// memory, written to a temporary file next to it and renamed into place, so
+// signing in place never leaves a truncated input behind.
+func SignWithOptions(filePath, outputPath, message, key string, opts SignOptions) (*SignResult, error) {
+	return SignContext(context.Background(), filePath, outputPath, message, key, opts)
+}
+
+// SignContext is SignWithOptions that stops once c is cancelled or its
+// deadline passes, returning c's error. Cancellation is checked between
+// anchors and pages; parsing and writing the document are not interrupted.
+// Nothing is written to outputPath when signing stops.
+func SignContext(c context.Context, filePath, outputPath, message, key string, opts SignOptions) (*SignResult, error) {
 	// Validate inputs
 	if err := validateInputs(filePath, message, key); err != nil {
-		return fmt.Errorf("validation failed: %w", err)
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+	if outputPath == "" {
+		return nil, fmt.Errorf("validation failed: output path cannot be empty")
+	}
+	if !opts.Overwrite {
+		if _, err := os.Lstat(outputPath); err == nil {
+			return nil, fmt.Errorf("%w: %s", ErrOutputExists, outputPath)
+		}
 	}
 
-	// Create crypto manager and encrypt payload
-	crypto, err := NewCryptoManager([]byte(key))
+	src, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open source PDF: %w", err)
+	}
+	c = withEvents(c, opts.Events, false)
+	signed, result, err := signBytes(c, src, message, key, opts)
 	if err != nil {
-		return fmt.Errorf("failed to create crypto manager: %w", err)
+		return nil, err
+	}
+	if err := c.Err(); err != nil {
+		return nil, err
+	}
+	staged, err := stageOutput(signed, outputPath, opts.Overwrite)
+	if err != nil {
+		return nil, err
+	}
+	defer staged.discard()
+	// Never put a copy in place that the ledger does not know about
+	if err := recordIssuance(opts, src, signed, absPath(filePath), absPath(outputPath), message, key, result); err != nil {
+		return nil, err
+	}
+	if err := staged.commit(); err != nil {
+		return nil, err
 	}
+	reporterFrom(c).written(len(signed))
 
-	payload, err := crypto.Encrypt(message)
+	result.OutputPath = outputPath
+	result.Plan.File = filePath
+	return result, nil
+}
+
+// SignBytes is SignContext for a PDF held in memory: it returns the signed
+// copy instead of writing it. Neither the source, nor the signed copy, nor any
+// intermediate copy is ever written to disk. opts.Overwrite does not apply;
+// SignResult.OutputPath and Plan.File are empty.
+func SignBytes(c context.Context, src []byte, message, key string, opts SignOptions) ([]byte, *SignResult, error) {
+	if err := validateSignBytesInputs(src, message, key); err != nil {
+		return nil, nil, fmt.Errorf("validation failed: %w", err)
+	}
+	signed, result, err := signBytes(withEvents(c, opts.Events, false), src, message, key, opts)
 	if err != nil {
-		return fmt.Errorf("failed to encrypt message: %w", err)
+		return nil, nil, err
 	}
+	if err := recordIssuance(opts, src, signed, "", "", message, key, result); err != nil {
+		return nil, nil, err
+	}
+	return signed, result, nil
+}
 
-	// Get anchor registry
-	registry := NewAnchorRegistry()
-	allAnchors := registry.GetAvailableAnchors()
+// SignReader is SignBytes reading the source from r and writing the signed
+// copy to w. Nothing is written to w if signing fails or is cancelled.
+func SignReader(c context.Context, r io.Reader, w io.Writer, message, key string, opts SignOptions) (*SignResult, error) {
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read source PDF: %w", err)
+	}
+	if err := validateSignBytesInputs(src, message, key); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+	c = withEvents(c, opts.Events, false)
+	signed, result, err := signBytes(c, src, message, key, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Err(); err != nil {
+		return nil, err
+	}
+	if err := recordIssuance(opts, src, signed, "", "", message, key, result); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(signed); err != nil {
+		return nil, fmt.Errorf("failed to write signed PDF: %w", err)
+	}
+	reporterFrom(c).written(len(signed))
+	return result, nil
+}
 
-	anchorsToUse := resolveAnchors(allAnchors, selectedAnchors)
+// signBytes signs src in memory and returns the signed copy. Events go to
+// the reporter of c.
+func signBytes(c context.Context, src []byte, message, key string, opts SignOptions) ([]byte, *SignResult, error) {
+	if err := c.Err(); err != nil {
+		return nil, nil, err
+	}
+	events := reporterFrom(c)
 
-	if len(anchorsToUse) == 0 {
-		return fmt.Errorf("no valid anchors selected")
+	// Create crypto manager and encrypt payload
+	crypto, err := NewCryptoManager([]byte(key))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create crypto manager: %w", err)
+	}
+	if opts.DeterministicSeed != nil {
+		crypto.nonceSeed = opts.DeterministicSeed
+	}
+	stamp, err := newFileStamp(opts.DeterministicSeed)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create file ID: %w", err)
 	}
 
-	// execute injection chain
-	return executeInjectionChain(filePath, message, payload, anchorsToUse)
-}
+	// Anchors are injected into a decrypted copy of an encrypted source
+	source, encryption, err := decryptSource(src, opts.UserPassword, opts.OwnerPassword)
+	if err != nil {
+		return nil, nil, err
+	}
+	if opts.DeterministicSeed != nil && encryption != nil {
+		// pdfcpu encrypts with random IVs
+		return nil, nil, fmt.Errorf("validation failed: deterministic signing of encrypted PDFs is not supported")
+	}
+	if opts.Incremental && encryption != nil {
+		return nil, nil, fmt.Errorf("validation failed: incremental signing of encrypted PDFs is not supported")
+	}
 
-func resolveAnchors(allAnchors []Anchor, selectedAnchors []string) []Anchor {
-	var anchorsToUse []Anchor
-	targetNames := selectedAnchors
-	if len(targetNames) == 0 {
-		targetNames = DefaultAnchors
+	plaintext := []byte(message)
+	var digests []pageDigest
+	if opts.TamperEvidence {
+		// The source is trusted: digest it without resource limits
+		if digests, err = digestPages(bytes.NewReader(source), newBudget(Limits{}).withContext(c), crypto.pageDigestKey(), nil); err != nil {
+			if isCancellation(err) {
+				return nil, nil, err
+			}
+			return nil, nil, fmt.Errorf("failed to digest pages: %w", err)
+		}
+		plaintext = sealPageDigests(message, digests)
+	}
+	payload, err := crypto.seal(plaintext)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encrypt message: %w", err)
+	}
+	if opts.TamperEvidence {
+		// Anchors mark what they add to pages so verification can leave it out
+		c = withPageMarks(c, crypto.pageMarks(payload))
 	}
 
-	for _, name := range targetNames {
+	// Get anchor registry
+	registry := NewAnchorRegistry()
+	allAnchors := registry.GetAvailableAnchors()
+
+	if opts.Visual != nil {
+		if err := opts.Visual.Validate(); err != nil {
+			return nil, nil, fmt.Errorf("validation failed: %w", err)
+		}
 		for _, a := range allAnchors {
-			if a.Name() == name {
-				anchorsToUse = append(anchorsToUse, a)
-				break
+			if v, ok := a.(*VisualAnchor); ok {
+				v.Style = *opts.Visual
 			}
 		}
 	}
-	return anchorsToUse
-}
+	for _, a := range allAnchors {
+		if att, ok := a.(*AttachmentAnchor); ok {
+			att.modTime = stamp.now
+		}
+	}
 
-func executeInjectionChain(filePath, message string, payload []byte, anchorsToUse []Anchor) error {
-	// Generate output file paths
-	suffix := "_signed"
-	tempOutputPath1, err := generateOutputPath(filePath, "_temp1")
+	// Skip anchors this PDF cannot carry and substitute alternatives up front
+	plan, err := planBytes(source, message, allAnchors, opts.Anchors, opts.Incremental)
 	if err != nil {
-		return fmt.Errorf("failed to generate temp1 output path: %w", err)
+		return nil, nil, err
 	}
-	tempOutputPath2, err := generateOutputPath(filePath, "_temp2")
-	if err != nil {
-		return fmt.Errorf("failed to generate temp2 output path: %w", err)
+	for _, note := range plan.Notes() {
+		events.note("Plan: %s", note)
 	}
-	finalOutputPath, err := generateOutputPath(filePath, suffix)
-	if err != nil {
-		return fmt.Errorf("failed to generate output path: %w", err)
+	if len(plan.anchors) == 0 {
+		return nil, nil, fmt.Errorf("no valid anchors selected")
 	}
 
-	anchorCount := 0
-	var anchorNames []string
-	currentInput := filePath
+	// PDF/A sources are checked before and after signing
+	var pdfa *pdfaSource
+	if plan.PDFA != "" && encryption == nil {
+		if pdfa, err = readPDFASource(source); err != nil {
+			return nil, nil, err
+		}
+	}
 
-	// Helper to determine output for current step
-	getOutput := func(step, total int) string {
-		if step == total-1 {
-			return finalOutputPath
+	// execute injection chain
+	var signed []byte
+	var anchorNames []string
+	if opts.Incremental {
+		signed, anchorNames, err = executeIncrementalChain(c, source, message, payload, plan.anchors)
+	} else {
+		signed, anchorNames, err = executeInjectionChain(c, source, message, payload, plan.anchors, encryption)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if pdfa != nil {
+		if signed, err = pdfa.conform(signed, opts.Incremental); err != nil {
+			return nil, nil, err
 		}
-		if step%2 == 0 {
-			return tempOutputPath1
+		events.note("%s conformance preserved", pdfa.level)
+	}
+	if !opts.Incremental && encryption == nil {
+		// Write the rewrite out canonically, seeded or not
+		if signed, err = canonicalize(signed, source, stamp, pdfa != nil); err != nil {
+			return nil, nil, err
 		}
-		return tempOutputPath2
 	}
 
-	for i, anchor := range anchorsToUse {
-		output := getOutput(i, len(anchorsToUse))
+	return signed, &SignResult{Anchors: anchorNames, Plan: plan, DigestedPages: len(digests), PDFA: plan.PDFA}, nil
+}
+
+// executeInjectionChain injects the anchors one after another, each rewriting
+// the document, and returns the signed copy
+func executeInjectionChain(c context.Context, src []byte, message string, payload []byte, anchorsToUse []Anchor, encryption *sourceEncryption) ([]byte, []string, error) {
+	events := reporterFrom(c)
+	anchorCount := 0
+	var anchorNames []string
+	current := src
 
-		fmt.Printf("[*] Injecting Anchor %d/%d: %s...\n", i+1, len(anchorsToUse), anchor.Name())
+	for i, anchor := range anchorsToUse {
+		if err := c.Err(); err != nil {
+			return nil, nil, err
+		}
+		events.started(anchor.Name(), i+1, len(anchorsToUse))
 
 		// Visual anchor displays plaintext; others use encrypted payload
 		injectPayload := payload
@@ -131,64 +383,221 @@ func executeInjectionChain(filePath, message string, payload []byte, anchorsToUs
 			injectPayload = []byte(message)
 		}
 
-		if err := anchor.Inject(currentInput, output, injectPayload); err != nil {
-			fmt.Fprintf(os.Stderr, "⚠ Warning: %s injection failed: %v\n", anchor.Name(), err)
-			// If injection failed, we need to handle the chain continuation or failure
-			if i == len(anchorsToUse)-1 {
-				// If we have a previous temp file, rename it to final
-				// If currentInput is original file (no previous success), we fail
-				if currentInput != filePath {
-					if renameErr := os.Rename(currentInput, finalOutputPath); renameErr != nil {
-						return fmt.Errorf("failed to finalize output: %w", renameErr)
-					}
-				} else {
-					return fmt.Errorf("failed to inject %s and it was the only anchor", anchor.Name())
-				}
+		output, err := injectBytes(c, anchor, current, injectPayload)
+		if err != nil {
+			if isCancellation(err) {
+				return nil, nil, err
 			}
+			events.failed(anchor.Name(), i+1, len(anchorsToUse), err)
 			continue
 		}
 
-		// Injection successful
-		if currentInput != filePath && currentInput != output {
-			os.Remove(currentInput) // Remove previous temp
-		}
-		currentInput = output
+		current = output
 		anchorCount++
 		anchorNames = append(anchorNames, anchor.Name())
-		fmt.Printf("✓ Anchor %s embedded\n", anchor.Name())
+		events.finished(anchor.Name(), i+1, len(anchorsToUse))
 	}
 
-	// Clean up temp files (if any remain)
-	os.Remove(tempOutputPath1)
-	os.Remove(tempOutputPath2)
-
 	if anchorCount == 0 {
-		return fmt.Errorf("failed to inject any anchors")
+		if len(anchorsToUse) == 1 {
+			return nil, nil, fmt.Errorf("failed to inject %s and it was the only anchor", anchorsToUse[0].Name())
+		}
+		return nil, nil, fmt.Errorf("failed to inject any anchors")
+	}
+	if encryption != nil {
+		encrypted, err := encryption.apply(current)
+		if err != nil {
+			return nil, nil, err
+		}
+		current = encrypted
+		events.note("Re-encrypted with the source's security settings")
+	}
+
+	events.note("Signature mode: %d-anchor strategy (%s)", anchorCount, strings.Join(anchorNames, ", "))
+	return current, anchorNames, nil
+}
+
+// injectBytes injects one anchor into a PDF held in memory
+func injectBytes(c context.Context, anchor Anchor, src []byte, payload []byte) ([]byte, error) {
+	ra, ok := anchor.(ReaderAnchor)
+	if !ok {
+		return nil, fmt.Errorf("%s cannot inject in memory", anchor.Name())
+	}
+	var out bytes.Buffer
+	if err := ra.InjectReader(c, bytes.NewReader(src), &out, payload); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// stagedOutput is a signed copy written next to its output path but not yet
+// moved into place
+type stagedOutput struct {
+	dir       string
+	path      string
+	final     string
+	overwrite bool
+}
+
+// stageOutput writes the signed copy to a private temp directory next to
+// finalOutputPath, so the final rename stays on one filesystem. A file it
+// will replace lends it its permissions. Without overwrite an existing output
+// fails with ErrOutputExists.
+func stageOutput(signed []byte, finalOutputPath string, overwrite bool) (*stagedOutput, error) {
+	tempDir, err := os.MkdirTemp(filepath.Dir(finalOutputPath), ".defender_sign_*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	s := &stagedOutput{dir: tempDir, path: filepath.Join(tempDir, "signed.pdf"), final: finalOutputPath, overwrite: overwrite}
+	if err := os.WriteFile(s.path, signed, 0666); err != nil {
+		s.discard()
+		return nil, fmt.Errorf("failed to write output: %w", err)
 	}
 
-	// Report signature mode
-	fmt.Printf("✓ Signature mode: %d-anchor strategy\n", anchorCount)
-	for i, name := range anchorNames {
-		fmt.Printf("  - Anchor %d: %s\n", i+1, name)
+	if info, err := os.Stat(finalOutputPath); err == nil {
+		if !overwrite {
+			s.discard()
+			return nil, fmt.Errorf("%w: %s", ErrOutputExists, finalOutputPath)
+		}
+		if err := os.Chmod(s.path, info.Mode().Perm()); err != nil {
+			s.discard()
+			return nil, fmt.Errorf("failed to finalize output: %w", err)
+		}
 	}
+	return s, nil
+}
 
-	fmt.Printf("✓ Successfully signed PDF: %s\n", finalOutputPath)
+// commit moves the staged copy into place in one atomic step. Without
+// overwrite it fails with ErrOutputExists if the output appeared meanwhile.
+func (s *stagedOutput) commit() error {
+	if !s.overwrite {
+		// A hard link never replaces an existing file; fall back to rename where
+		// the file system has no hard links
+		err := os.Link(s.path, s.final)
+		if errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("%w: %s", ErrOutputExists, s.final)
+		}
+		if err == nil {
+			return nil
+		}
+	}
+	if err := os.Rename(s.path, s.final); err != nil {
+		return fmt.Errorf("failed to finalize output: %w", err)
+	}
 	return nil
 }
 
+// discard removes the temp directory and whatever of the copy is left in it
+func (s *stagedOutput) discard() {
+	os.RemoveAll(s.dir)
+}
+
 // Verify extracts and decrypts the hidden message from a signed PDF file.
 // selectedAnchors: list of anchor names to verify. If empty, verifies all.
 // Returns the extracted message and the name of the anchor that succeeded.
 func Verify(filePath, key string, selectedAnchors []string) (message, anchorName string, err error) {
+	return VerifyWithOptions(filePath, key, VerifyOptions{Anchors: selectedAnchors})
+}
+
+// VerifyOptions configures VerifyWithOptions
+type VerifyOptions struct {
+	// Anchors lists the anchor names to verify. If empty, verifies all.
+	Anchors []string
+	// Limits bounds the resources spent on the file (DefaultLimits if nil)
+	Limits *Limits
+	// UserPassword or OwnerPassword opens an encrypted file. A wrong or missing
+	// password fails with ErrWrongPassword.
+	UserPassword  string
+	OwnerPassword string
+	// Events receives the progress of the verification, if set
+	Events EventHandler
+}
+
+// budget returns the budget of one verification under opts, cancelled with c
+func (opts VerifyOptions) budget(c context.Context) *budget {
+	limits := DefaultLimits
+	if opts.Limits != nil {
+		limits = *opts.Limits
+	}
+	b := newBudget(limits).withContext(c)
+	b.userPW, b.ownerPW = opts.UserPassword, opts.OwnerPassword
+	return b
+}
+
+// VerifyWithOptions is Verify with the full set of verification options.
+// The limits apply to the file as a whole: the time budget covers every anchor.
+// If no anchor verifies and a limit stopped one of them, the error wraps the
+// *LimitError (errors.Is ErrLimitExceeded), since the payload may be in the
+// part of the file that was not examined.
+func VerifyWithOptions(filePath, key string, opts VerifyOptions) (message, anchorName string, err error) {
+	res, err := verify(context.Background(), filePath, key, opts, false)
+	if err != nil {
+		return "", "", err
+	}
+	return res.Message, res.Anchor, nil
+}
+
+// VerifyResult describes a completed verification
+type VerifyResult struct {
+	Message string
+	// Anchor is the anchor the message was recovered from
+	Anchor string
+	// Integrity compares the pages with the digests sealed at signing; nil
+	// when the copy was signed without tamper evidence
+	Integrity *IntegrityReport
+}
+
+// VerifyDetailed is VerifyWithOptions that also checks the integrity of copies
+// signed with tamper evidence. Pages that cannot be digested within the limits
+// are reported in IntegrityReport.Error; the message is still returned.
+func VerifyDetailed(filePath, key string, opts VerifyOptions) (*VerifyResult, error) {
+	return VerifyContext(context.Background(), filePath, key, opts)
+}
+
+// VerifyContext is VerifyDetailed that stops once c is cancelled or its
+// deadline passes; the error then wraps c's error. Unlike Limits.Timeout,
+// which only bounds the anchors, c also bounds the integrity check.
+func VerifyContext(c context.Context, filePath, key string, opts VerifyOptions) (*VerifyResult, error) {
+	return verify(c, filePath, key, opts, true)
+}
+
+// VerifyBytes is VerifyContext for a PDF held in memory. The document is
+// never written to disk.
+func VerifyBytes(c context.Context, data []byte, key string, opts VerifyOptions) (*VerifyResult, error) {
+	return VerifyReader(c, bytes.NewReader(data), key, opts)
+}
+
+// VerifyReader is VerifyContext for a PDF read from r. Every anchor reads r
+// from the start, so it must not change during verification.
+func VerifyReader(c context.Context, r io.ReadSeeker, key string, opts VerifyOptions) (*VerifyResult, error) {
+	if len(key) != keySize {
+		return nil, fmt.Errorf("validation failed: %w", ErrInvalidKeySize)
+	}
+	return verifyReader(c, r, key, opts, true)
+}
+
+func verify(c context.Context, filePath, key string, opts VerifyOptions, checkIntegrity bool) (*VerifyResult, error) {
 	// Validate inputs
 	if validationErr := validateVerifyInputs(filePath, key); validationErr != nil {
-		return "", "", fmt.Errorf("validation failed: %w", validationErr)
+		return nil, fmt.Errorf("validation failed: %w", validationErr)
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open PDF: %w", err)
 	}
+	defer f.Close()
+	return verifyReader(c, f, key, opts, checkIntegrity)
+}
+
+func verifyReader(c context.Context, r io.ReadSeeker, key string, opts VerifyOptions, checkIntegrity bool) (*VerifyResult, error) {
+	c = withEvents(c, opts.Events, true)
+	events := reporterFrom(c)
 
 	// Create crypto manager
 	crypto, err := NewCryptoManager([]byte(key))
 	if err != nil {
-		return "", "", fmt.Errorf("failed to create crypto manager: %w", err)
+		return nil, fmt.Errorf("failed to create crypto manager: %w", err)
 	}
 
 	// Get anchor registry
@@ -197,10 +606,10 @@ func Verify(filePath, key string, selectedAnchors []string) (message, anchorName
 
 	// Filter anchors
 	var anchorsToUse []Anchor
-	if len(selectedAnchors) == 0 {
+	if len(opts.Anchors) == 0 {
 		anchorsToUse = allAnchors
 	} else {
-		for _, name := range selectedAnchors {
+		for _, name := range opts.Anchors {
 			for _, a := range allAnchors {
 				if a.Name() == name {
 					anchorsToUse = append(anchorsToUse, a)
@@ -211,32 +620,75 @@ func Verify(filePath, key string, selectedAnchors []string) (message, anchorName
 	}
 
 	if len(anchorsToUse) == 0 {
-		return "", "", fmt.Errorf("no valid anchors selected")
+		return nil, fmt.Errorf("no valid anchors selected")
 	}
 
+	b := opts.budget(c)
+
 	// Try each anchor in order
-	for _, anchor := range anchorsToUse {
-		fmt.Fprintf(os.Stderr, "[DEBUG] Attempting Anchor: %s...\n", anchor.Name())
+	extracted := false
+	var limitErr error
+	for i, anchor := range anchorsToUse {
+		events.started(anchor.Name(), i+1, len(anchorsToUse))
 
-		payload, extractErr := anchor.Extract(filePath)
+		payload, extractErr := extractReaderWithBudget(anchor, r, b)
+		if errors.Is(extractErr, ErrWrongPassword) {
+			// No anchor can be read without the password
+			return nil, fmt.Errorf("verification failed: %w", ErrWrongPassword)
+		}
+		if isCancellation(extractErr) {
+			return nil, fmt.Errorf("verification failed: %w", extractErr)
+		}
 		if extractErr != nil {
-			fmt.Fprintf(os.Stderr, "[DEBUG] %s: Extraction failed: %v\n", anchor.Name(), extractErr)
+			events.failed(anchor.Name(), i+1, len(anchorsToUse), extractErr)
+			if errors.Is(extractErr, ErrLimitExceeded) {
+				limitErr = extractErr
+				var le *LimitError
+				if errors.As(extractErr, &le) && le.Limit == LimitTime {
+					break
+				}
+			}
 			continue
 		}
 
-		fmt.Fprintf(os.Stderr, "[DEBUG] %s: Extracted %d bytes\n", anchor.Name(), len(payload))
+		extracted = true
 
 		// Decrypt and verify
-		message, decryptErr := crypto.Decrypt(payload)
+		plaintext, decryptErr := crypto.open(payload)
 		if decryptErr == nil {
-			fmt.Printf("✓ Verified via %s\n", anchor.Name())
-			return message, anchor.Name(), nil
+			events.finished(anchor.Name(), i+1, len(anchorsToUse))
+			res := &VerifyResult{Anchor: anchor.Name()}
+			var digests []pageDigest
+			res.Message, digests = splitPageDigests(plaintext)
+			if checkIntegrity && digests != nil {
+				res.Integrity = checkPages(r, digests, b, crypto.pageDigestKey(), crypto.pageMarks(payload))
+				if err := c.Err(); err != nil {
+					return nil, fmt.Errorf("verification failed: %w", err)
+				}
+			}
+			return res, nil
 		}
-		fmt.Fprintf(os.Stderr, "[DEBUG] %s: Decryption failed: %v\n", anchor.Name(), decryptErr)
+		events.failed(anchor.Name(), i+1, len(anchorsToUse), fmt.Errorf("%w: %v", ErrDecryptFailed, decryptErr))
 	}
 
 	// All anchors failed
-	return "", "", fmt.Errorf("verification failed: all selected anchors invalid or missing")
+	if limitErr != nil {
+		return nil, fmt.Errorf("verification failed: %w", limitErr)
+	}
+	if extracted {
+		return nil, fmt.Errorf("verification failed: %w", ErrDecryptFailed)
+	}
+	return nil, fmt.Errorf("verification failed: %w", ErrNoPayload)
+}
+
+// checkPages digests the current pages under key, leaving out the content in
+// valid marks, and compares them with the sealed digests
+func checkPages(r io.ReadSeeker, signed []pageDigest, b *budget, key []byte, marks *pageMarks) *IntegrityReport {
+	current, err := digestPages(r, b, key, marks)
+	if err != nil {
+		return &IntegrityReport{SignedPages: len(signed), Error: err.Error()}
+	}
+	return compareDigests(signed, current)
 }
 
 // Deprecated: Use CryptoManager.Encrypt instead
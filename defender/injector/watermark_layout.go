@@ -0,0 +1,247 @@
+package injector
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// Visual watermark layout parameters (all values in PDF points)
+const (
+	wmMaxFontSize    = 48  // Upper bound, matches the historical single-line size
+	wmMinFontSize    = 8   // Below this the stamp stops being legible when printed
+	wmLineSpacing    = 1.2 // Line height as a multiple of font size
+	wmPageFillFactor = 0.8 // Fraction of the visible page the rotated stamp may cover
+	wmMaxBlockAspect = 0.5 // Text block height may be at most this fraction of its width
+)
+
+// pageViewport describes the visible area of a page as the reader sees it,
+// i.e. the CropBox (falling back to MediaBox) with /Rotate already applied.
+type pageViewport struct {
+	Width  float64
+	Height float64
+}
+
+// watermarkLayout is the result of fitting a message onto a page viewport
+type watermarkLayout struct {
+	Lines    []string
+	FontSize int
+	Rotation float64 // Degrees, counter-clockwise, along the page diagonal
+}
+
+// Text returns the layout lines joined with newlines (pdfcpu's multi-line syntax)
+func (l watermarkLayout) Text() string {
+	return strings.Join(l.Lines, "\n")
+}
+
+// textMeasurer returns the advance width of s in points at the given font size
+type textMeasurer func(s string, fontSize int) float64
+
+// pageGeometry is a page's visible box in user space plus its normalized /Rotate
+// (0, 90, 180 or 270). It is comparable, so pages can be grouped by geometry.
+type pageGeometry struct {
+	LLX, LLY, URX, URY float64
+	Rotate             int
+}
+
+// Viewport returns the visible area as the reader sees it (90/270 swap width and height)
+func (g pageGeometry) Viewport() pageViewport {
+	vp := pageViewport{Width: g.URX - g.LLX, Height: g.URY - g.LLY}
+	if g.Rotate == 90 || g.Rotate == 270 {
+		vp.Width, vp.Height = vp.Height, vp.Width
+	}
+	return vp
+}
+
+// readPageGeometry resolves the visible box of a page, honouring inherited
+// CropBox/MediaBox and the /Rotate attribute.
+func readPageGeometry(ctx *model.Context, pageNr int) (pageGeometry, error) {
+	_, _, inhPAttrs, err := ctx.PageDict(pageNr, false)
+	if err != nil {
+		return pageGeometry{}, fmt.Errorf("failed to get page dict for page %d: %w", pageNr, err)
+	}
+	if inhPAttrs == nil {
+		return pageGeometry{}, fmt.Errorf("missing page attributes for page %d", pageNr)
+	}
+
+	box := inhPAttrs.CropBox
+	if box == nil {
+		box = inhPAttrs.MediaBox
+	}
+	if box == nil {
+		// No boxes at all: assume A4 like most viewers do
+		box = types.RectForFormat("A4")
+	}
+
+	return pageGeometry{
+		LLX:    box.LL.X,
+		LLY:    box.LL.Y,
+		URX:    box.UR.X,
+		URY:    box.UR.Y,
+		Rotate: ((inhPAttrs.Rotate % 360) + 360) % 360,
+	}, nil
+}
+
+// layoutWatermark fits text onto the viewport: it picks the largest font size
+// (between wmMinFontSize and wmMaxFontSize) for which the wrapped text, rotated
+// along the page diagonal, stays inside wmPageFillFactor of the page without
+// breaking any word. The block is kept a stripe rather than a tower
+// (wmMaxBlockAspect). If nothing fits even at the minimum size, words are
+// hard-broken at the minimum size.
+func layoutWatermark(text string, vp pageViewport, measure textMeasurer) watermarkLayout {
+	rotation := 45.0
+	if vp.Width > 0 && vp.Height > 0 {
+		rotation = math.Atan2(vp.Height, vp.Width) * 180 / math.Pi
+	}
+	rad := rotation * math.Pi / 180
+	sin, cos := math.Sin(rad), math.Cos(rad)
+	availW := vp.Width * wmPageFillFactor
+	availH := vp.Height * wmPageFillFactor
+
+	// maxLineWidth returns the widest line that still fits when the block is
+	// blockHeight tall. A block of width L and height H rotated by θ occupies
+	// (L·cosθ + H·sinθ) × (L·sinθ + H·cosθ).
+	maxLineWidth := func(blockHeight float64) float64 {
+		return math.Min((availW-blockHeight*sin)/cos, (availH-blockHeight*cos)/sin)
+	}
+
+	for size := wmMaxFontSize; size >= wmMinFontSize; size-- {
+		lineHeight := float64(size) * wmLineSpacing
+		for n := 1; ; n++ {
+			blockHeight := float64(n) * lineHeight
+			limit := maxLineWidth(blockHeight)
+			if limit <= 0 || blockHeight > limit*wmMaxBlockAspect {
+				break
+			}
+			lines, hardBreaks := wrapText(text, limit, func(s string) float64 { return measure(s, size) })
+			if len(lines) <= n && !hardBreaks {
+				return watermarkLayout{Lines: lines, FontSize: size, Rotation: rotation}
+			}
+		}
+	}
+
+	// Degenerate page or extremely long message: wrap for a single line at min size
+	limit := math.Max(maxLineWidth(float64(wmMinFontSize)*wmLineSpacing), float64(wmMinFontSize))
+	lines, _ := wrapText(text, limit, func(s string) float64 { return measure(s, wmMinFontSize) })
+	return watermarkLayout{Lines: lines, FontSize: wmMinFontSize, Rotation: rotation}
+}
+
+// wrapText breaks text into lines no wider than maxWidth.
+// Latin words wrap at spaces; CJK ideographs, kana and hangul may break between
+// any two characters; closing punctuation never starts a line; words wider than
+// maxWidth are broken by character, which is reported via hardBreaks.
+// Explicit newlines are always honoured.
+func wrapText(text string, maxWidth float64, width func(string) float64) (lines []string, hardBreaks bool) {
+	for _, para := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		paraLines, broken := wrapParagraph(para, maxWidth, width)
+		lines = append(lines, paraLines...)
+		hardBreaks = hardBreaks || broken
+	}
+	return lines, hardBreaks
+}
+
+// wrapToken is an unbreakable unit of text plus whether a space follows it
+type wrapToken struct {
+	text       string
+	spaceAfter bool
+}
+
+func wrapParagraph(para string, maxWidth float64, width func(string) float64) (lines []string, hardBreaks bool) {
+	tokens := tokenizeForWrap(para)
+	if len(tokens) == 0 {
+		return []string{""}, false
+	}
+
+	var cur strings.Builder
+	pendingSpace := false
+
+	for _, tok := range tokens {
+		candidate := tok.text
+		if cur.Len() > 0 && pendingSpace {
+			candidate = " " + candidate
+		}
+		if cur.Len() > 0 && width(cur.String()+candidate) > maxWidth {
+			lines = append(lines, cur.String())
+			cur.Reset()
+			candidate = tok.text
+		}
+
+		if cur.Len() == 0 && width(candidate) > maxWidth {
+			// Overlong token: hard-break by character
+			hardBreaks = true
+			for _, r := range candidate {
+				if cur.Len() > 0 && width(cur.String()+string(r)) > maxWidth {
+					lines = append(lines, cur.String())
+					cur.Reset()
+				}
+				cur.WriteRune(r)
+			}
+		} else {
+			cur.WriteString(candidate)
+		}
+		pendingSpace = tok.spaceAfter
+	}
+
+	if cur.Len() > 0 {
+		lines = append(lines, cur.String())
+	}
+	return lines, hardBreaks
+}
+
+// tokenizeForWrap splits a paragraph into wrap tokens: runs of non-space,
+// non-CJK characters form one token, every CJK character forms its own token,
+// and closing punctuation is glued to the token before it.
+func tokenizeForWrap(para string) []wrapToken {
+	var tokens []wrapToken
+	var word strings.Builder
+
+	endWord := func(spaceAfter bool) {
+		if word.Len() > 0 {
+			tokens = append(tokens, wrapToken{text: word.String(), spaceAfter: spaceAfter})
+			word.Reset()
+		} else if spaceAfter && len(tokens) > 0 {
+			tokens[len(tokens)-1].spaceAfter = true
+		}
+	}
+
+	for _, r := range para {
+		switch {
+		case unicode.IsSpace(r):
+			endWord(true)
+		case isNoBreakBefore(r):
+			if word.Len() > 0 {
+				word.WriteRune(r)
+			} else if len(tokens) > 0 && !tokens[len(tokens)-1].spaceAfter {
+				tokens[len(tokens)-1].text += string(r)
+			} else {
+				word.WriteRune(r)
+			}
+		case isCJK(r):
+			endWord(false)
+			tokens = append(tokens, wrapToken{text: string(r)})
+		default:
+			word.WriteRune(r)
+		}
+	}
+	endWord(false)
+	return tokens
+}
+
+// isCJK reports whether r belongs to a script that wraps between characters
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) ||
+		unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) ||
+		unicode.Is(unicode.Hangul, r) ||
+		(r >= 0x3000 && r <= 0x303F) || // CJK symbols and punctuation
+		(r >= 0xFF00 && r <= 0xFFEF) // Halfwidth and fullwidth forms
+}
+
+// isNoBreakBefore reports whether a line must not start with r (kinsoku shori)
+func isNoBreakBefore(r rune) bool {
+	return strings.ContainsRune("，。、；：！？）」』》】〕〉,.;:!?)]}", r)
+}
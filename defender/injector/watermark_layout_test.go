@@ -0,0 +1,139 @@
+package injector
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+// monoWidth measures every rune as one unit wide (maxWidth is then a rune count)
+func monoWidth(s string) float64 {
+	return float64(len([]rune(s)))
+}
+
+// TestWrapText tests word, CJK and hard wrapping
+func TestWrapText(t *testing.T) {
+	tests := []struct {
+		name       string
+		text       string
+		maxWidth   float64
+		expected   []string
+		hardBreaks bool
+	}{
+		{
+			name:     "Fits on one line",
+			text:     "UserID:12345",
+			maxWidth: 20,
+			expected: []string{"UserID:12345"},
+		},
+		{
+			name:     "Latin wraps at spaces",
+			text:     "Confidential copy for Alice",
+			maxWidth: 12,
+			expected: []string{"Confidential", "copy for", "Alice"},
+		},
+		{
+			name:     "CJK wraps between characters",
+			text:     "机密文件仅供内部审阅",
+			maxWidth: 4,
+			expected: []string{"机密文件", "仅供内部", "审阅"},
+		},
+		{
+			name:     "Closing punctuation never starts a line",
+			text:     "机密文件，仅供审阅",
+			maxWidth: 4,
+			expected: []string{"机密文", "件，仅供", "审阅"},
+		},
+		{
+			name:     "Mixed CJK and Latin",
+			text:     "张三 UserID:42",
+			maxWidth: 9,
+			expected: []string{"张三", "UserID:42"},
+		},
+		{
+			name:     "Explicit newlines are honoured",
+			text:     "Line one\nLine two",
+			maxWidth: 40,
+			expected: []string{"Line one", "Line two"},
+		},
+		{
+			name:       "Overlong word is hard-broken",
+			text:       "abcdefghij",
+			maxWidth:   4,
+			expected:   []string{"abcd", "efgh", "ij"},
+			hardBreaks: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines, hardBreaks := wrapText(tt.text, tt.maxWidth, monoWidth)
+			if !reflect.DeepEqual(lines, tt.expected) {
+				t.Errorf("Lines mismatch: got %q, want %q", lines, tt.expected)
+			}
+			if hardBreaks != tt.hardBreaks {
+				t.Errorf("hardBreaks mismatch: got %v, want %v", hardBreaks, tt.hardBreaks)
+			}
+			for _, line := range lines {
+				if monoWidth(line) > tt.maxWidth {
+					t.Errorf("Line %q exceeds max width %.0f", line, tt.maxWidth)
+				}
+			}
+		})
+	}
+}
+
+// TestLayoutWatermark tests page-adaptive sizing and rotation
+func TestLayoutWatermark(t *testing.T) {
+	// Roughly Helvetica: average glyph is half an em wide
+	measure := func(s string, fontSize int) float64 {
+		return float64(len([]rune(s))) * 0.5 * float64(fontSize)
+	}
+	longMsg := "Confidential - distributed to Alice Example (alice@example.com) on 2026-10-19, do not forward"
+
+	tests := []struct {
+		name string
+		text string
+		vp   pageViewport
+	}{
+		{name: "A4 portrait short", text: "UserID:12345", vp: pageViewport{Width: 595, Height: 842}},
+		{name: "A4 portrait long", text: longMsg, vp: pageViewport{Width: 595, Height: 842}},
+		{name: "Landscape slide long", text: longMsg, vp: pageViewport{Width: 960, Height: 540}},
+		{name: "A5 handout long", text: longMsg, vp: pageViewport{Width: 420, Height: 595}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			layout := layoutWatermark(tt.text, tt.vp, measure)
+
+			if layout.FontSize < wmMinFontSize || layout.FontSize > wmMaxFontSize {
+				t.Fatalf("Font size %d outside [%d, %d]", layout.FontSize, wmMinFontSize, wmMaxFontSize)
+			}
+
+			wantRot := math.Atan2(tt.vp.Height, tt.vp.Width) * 180 / math.Pi
+			if math.Abs(layout.Rotation-wantRot) > 0.01 {
+				t.Errorf("Rotation mismatch: got %.2f, want %.2f", layout.Rotation, wantRot)
+			}
+
+			// The rotated text block must stay within the page fill area
+			var blockW float64
+			for _, line := range layout.Lines {
+				blockW = math.Max(blockW, measure(line, layout.FontSize))
+			}
+			blockH := float64(len(layout.Lines)) * float64(layout.FontSize) * wmLineSpacing
+			rad := layout.Rotation * math.Pi / 180
+			bboxW := blockW*math.Cos(rad) + blockH*math.Sin(rad)
+			bboxH := blockW*math.Sin(rad) + blockH*math.Cos(rad)
+			if bboxW > tt.vp.Width*wmPageFillFactor+0.01 || bboxH > tt.vp.Height*wmPageFillFactor+0.01 {
+				t.Errorf("Stamp %.0fx%.0f does not fit page %.0fx%.0f", bboxW, bboxH, tt.vp.Width, tt.vp.Height)
+			}
+		})
+	}
+
+	// A smaller page must never get a larger stamp
+	a4 := layoutWatermark(longMsg, pageViewport{Width: 595, Height: 842}, measure)
+	a5 := layoutWatermark(longMsg, pageViewport{Width: 420, Height: 595}, measure)
+	if a5.FontSize > a4.FontSize {
+		t.Errorf("A5 font size %d larger than A4 font size %d", a5.FontSize, a4.FontSize)
+	}
+}
@@ -2,12 +2,16 @@ package injector
 
 import (
 	"bytes"
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
 )
 
 // Test constants
@@ -101,6 +105,40 @@ func TestValidateInputs(t *testing.T) {
 	}
 }
 
+// TestSignBytesRoundTrip tests signing and verifying a generated PDF in memory
+func TestSignBytesRoundTrip(t *testing.T) {
+	ctx, err := pdfcpu.CreateContextWithXRefTable(nil, types.PaperSize["A4"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := writePDF(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var signed bytes.Buffer
+	// The generated PDF has no pages: only the attachment can carry the payload
+	res, err := SignReader(context.Background(), bytes.NewReader(src), &signed, testMessage, testKey32, SignOptions{Anchors: []string{"Attachment"}})
+	if err != nil {
+		t.Fatalf("SignReader failed: %v", err)
+	}
+	if strings.Join(res.Anchors, "+") != "Attachment" {
+		t.Errorf("Anchors = %v", res.Anchors)
+	}
+	vres, err := VerifyBytes(context.Background(), signed.Bytes(), testKey32, VerifyOptions{})
+	if err != nil || vres.Message != testMessage || vres.Anchor != "Attachment" {
+		t.Fatalf("VerifyBytes = %+v, %v", vres, err)
+	}
+
+	var failed bytes.Buffer
+	if _, err := SignReader(context.Background(), strings.NewReader("not a PDF"), &failed, testMessage, testKey32, SignOptions{}); err == nil || failed.Len() != 0 {
+		t.Errorf("Invalid source: %v, wrote %d bytes", err, failed.Len())
+	}
+	if _, _, err := SignBytes(context.Background(), src, "", testKey32, SignOptions{}); err == nil || !strings.Contains(err.Error(), "message cannot be empty") {
+		t.Errorf("Empty message: %v", err)
+	}
+}
+
 // TestCreateEncryptedPayload tests the createEncryptedPayload function
 func TestCreateEncryptedPayload(t *testing.T) {
 	tests := []struct {
@@ -354,6 +392,41 @@ func TestEncryptionDecryptionRoundTrip(t *testing.T) {
 	}
 }
 
+// TestDeterministicNonce tests that a nonce seed makes payloads reproducible
+// per message and seed, and that they still decrypt
+func TestDeterministicNonce(t *testing.T) {
+	seal := func(seed []byte, msg string) []byte {
+		cm, err := NewCryptoManager([]byte(testKey32))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cm.nonceSeed = seed
+		payload, err := cm.Encrypt(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := cm.Decrypt(payload); err != nil || got != msg {
+			t.Errorf("Decrypt = %q, %v", got, err)
+		}
+		return payload
+	}
+
+	a := seal([]byte("seed"), "UserID:1")
+	if !bytes.Equal(a, seal([]byte("seed"), "UserID:1")) {
+		t.Error("Same seed and message gave different payloads")
+	}
+	nonce := func(p []byte) []byte { return p[len(magicHeader) : len(magicHeader)+nonceSize] }
+	if bytes.Equal(nonce(a), nonce(seal([]byte("seed"), "UserID:2"))) {
+		t.Error("Different messages share a nonce")
+	}
+	if bytes.Equal(nonce(a), nonce(seal([]byte("other"), "UserID:1"))) {
+		t.Error("Different seeds share a nonce")
+	}
+	if bytes.Equal(seal(nil, "UserID:1"), seal(nil, "UserID:1")) {
+		t.Error("Random nonces repeated")
+	}
+}
+
 // BenchmarkCreateEncryptedPayload benchmarks encryption
 func BenchmarkCreateEncryptedPayload(b *testing.B) {
 	key := []byte(testKey32)
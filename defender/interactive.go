@@ -2,15 +2,19 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"strconv"
 	"strings"
 	"time"
 
 	"defender/injector"
+	"defender/ledger"
 )
 
 // ANSI Colors
@@ -115,13 +119,102 @@ func interactiveProtect(scanner *bufio.Scanner) {
 		fmt.Println(ColorYellow + "[*] Using default message: 'Protected Document'" + ColorReset)
 	}
 
-	// Step 3: Key
-	fmt.Print("\n" + ColorBold + "[Step 3/4] Enter encryption key" + ColorReset + " (32 chars) [Press Enter to auto-generate]:\n> ")
+	// Step 3: Protection profile
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf(ColorRed+"[ERROR] %v\n"+ColorReset, err)
+		waitForEnter(scanner)
+		return
+	}
+	names := cfg.ProfileNames()
+	defaultName := cfg.DefaultProfileName()
+	if signProfile != "" {
+		// phantom-guard --profile <name> preselects a profile
+		if _, err := cfg.Profile(signProfile); err != nil {
+			fmt.Printf(ColorRed+"[ERROR] %v\n"+ColorReset, err)
+			waitForEnter(scanner)
+			return
+		}
+		defaultName = signProfile
+	}
+
+	fmt.Println("\n" + ColorBold + "[Step 3/4] Select Protection Profile:" + ColorReset)
+	// Use fixed width formatting for alignment
+	// %-24s pads string to 24 chars, aligned left
+	for i, name := range names {
+		p, err := cfg.Profile(name)
+		if err != nil {
+			fmt.Printf(ColorRed+"[ERROR] %v\n"+ColorReset, err)
+			waitForEnter(scanner)
+			return
+		}
+		desc := p.Description
+		if name == defaultName {
+			desc += " [Default]"
+		}
+		fmt.Printf("%d. "+ColorGreen+"%-24s"+ColorReset+" - %s\n", i+1, name, desc)
+	}
+	fmt.Printf("%d. "+ColorBlue+"%-24s"+ColorReset+" - Select specific anchors manually\n", len(names)+1, "Custom")
+	fmt.Print("> ")
+
+	if !scanner.Scan() {
+		return
+	}
+	level := strings.TrimSpace(scanner.Text())
+
+	profileName := defaultName
+	custom := false
+	if level != "" {
+		if n, convErr := strconv.Atoi(level); convErr == nil && n >= 1 && n <= len(names) {
+			profileName = names[n-1]
+		} else if n == len(names)+1 {
+			custom = true
+		} else {
+			fmt.Printf(ColorYellow+"[*] Unknown choice, using default profile %s\n"+ColorReset, defaultName)
+		}
+	}
+	profile, err := cfg.Profile(profileName)
+	if err != nil {
+		fmt.Printf(ColorRed+"[ERROR] %v\n"+ColorReset, err)
+		waitForEnter(scanner)
+		return
+	}
+	opts := profile.SignOptions()
+
+	if custom {
+		// Custom selection on top of the default profile
+		fmt.Println("\nAvailable Anchors: Attachment, SMask, Content, Visual")
+		fmt.Print("Enter anchor names separated by comma (e.g. 'Attachment,Visual'):\n> ")
+		if !scanner.Scan() {
+			return
+		}
+		anchors, parseErr := injector.ParseAnchorProfile(scanner.Text())
+		if parseErr != nil {
+			fmt.Printf(ColorRed+"[ERROR] %v\n"+ColorReset, parseErr)
+			waitForEnter(scanner)
+			return
+		}
+		opts.Anchors = anchors
+	} else {
+		fmt.Printf(ColorGreen+"[*] Using profile %s\n"+ColorReset, profile.Name)
+	}
+
+	// Step 4: Key
+	fmt.Print("\n" + ColorBold + "[Step 4/4] Enter encryption key" + ColorReset + " (32 chars) [Press Enter to use the profile/environment key or auto-generate]:\n> ")
 	if !scanner.Scan() {
 		return
 	}
 	key := strings.TrimSpace(scanner.Text())
 
+	if key == "" && profile.HasKey() {
+		key, err = profile.Key()
+		if err != nil {
+			fmt.Printf(ColorRed+"[ERROR] %v\n"+ColorReset, err)
+			waitForEnter(scanner)
+			return
+		}
+		fmt.Printf(ColorGreen+"[*] Using key %q from profile %s\n"+ColorReset, profile.KeyName, profile.Name)
+	}
 	if key == "" {
 		// Try to get from environment first
 		envKey := os.Getenv("DEFAULT_KEY")
@@ -146,73 +239,53 @@ func interactiveProtect(scanner *bufio.Scanner) {
 		return
 	}
 
-	// Step 4: Protection Level
-	fmt.Println("\n" + ColorBold + "[Step 4/4] Select Protection Level:" + ColorReset)
-	// Use fixed width formatting for alignment
-	// %-24s pads string to 24 chars, aligned left
-	fmt.Printf("1. "+ColorGreen+"%-24s"+ColorReset+" - Invisible + Visual Watermark [Default]\n", "All Combined")
-	fmt.Printf("2. "+ColorYellow+"%-24s"+ColorReset+" - Attachment + SMask + Content (Zero Overhead)\n", "Invisible Only")
-	fmt.Printf("3. "+ColorBlue+"%-24s"+ColorReset+" - Select specific anchors manually\n", "Custom")
-	fmt.Print("> ")
-
-	if !scanner.Scan() {
+	outPath, err := profile.OutputPath(path, map[string]string{"msg": msg})
+	if err != nil {
+		fmt.Printf(ColorRed+"[ERROR] %v\n"+ColorReset, err)
+		waitForEnter(scanner)
 		return
 	}
-	level := strings.TrimSpace(scanner.Text())
-
-	var selectedAnchors []string
-
-	if level == "" || level == "1" {
-		fmt.Println(ColorGreen + "[*] Using All Combined Mode (Invisible + Visual)" + ColorReset)
-		selectedAnchors = []string{"Attachment", "SMask", "Content", "Visual"}
-	} else {
-		switch level {
-		case "2":
-			// Invisible Only
-			fmt.Println(ColorYellow + "[*] Using Invisible Mode Only" + ColorReset)
-			selectedAnchors = []string{"Attachment", "SMask", "Content"}
-		case "3":
-			// Custom selection
-			fmt.Println("\nAvailable Anchors: Attachment, SMask, Content, Visual")
-			fmt.Print("Enter anchor names separated by comma (e.g. 'Attachment,Visual'):\n> ")
-			if !scanner.Scan() {
-				return
-			}
-			input := scanner.Text()
-			parts := strings.Split(input, ",")
-			for _, p := range parts {
-				p = strings.TrimSpace(p)
-				if p != "" {
-					selectedAnchors = append(selectedAnchors, p)
-				}
-			}
-		default:
-			fmt.Println(ColorGreen + "[*] Using Invisible Mode" + ColorReset)
-			selectedAnchors = nil
+	if _, statErr := os.Stat(outPath); statErr == nil {
+		fmt.Printf(ColorYellow+"[?] %s already exists. Overwrite? [y/N]: "+ColorReset, outPath)
+		if !scanner.Scan() {
+			return
 		}
+		if answer := strings.ToLower(strings.TrimSpace(scanner.Text())); answer != "y" && answer != "yes" {
+			fmt.Println("[*] Cancelled.")
+			waitForEnter(scanner)
+			return
+		}
+		opts.Overwrite = true
+	}
+
+	issuance, ledgerErr := openLedger()
+	if ledgerErr != nil {
+		fmt.Printf(ColorYellow+"[WARNING] Ledger unavailable, this copy is not recorded: %v\n"+ColorReset, ledgerErr)
 	}
+	opts.Ledger = issuance
+	opts.Issuance = ledger.Record{Operator: currentOperator()}
 
 	fmt.Println("\n" + ColorBlue + "[*] Processing..." + ColorReset)
 
-	// Execute
-	err := injector.Sign(path, msg, key, selectedAnchors)
-	if err != nil {
+	// Execute; Ctrl-C stops signing and returns to the menu
+	bar := newProgressBar(os.Stdout)
+	opts.Events = bar
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	result, err := injector.SignContext(ctx, path, outPath, msg, key, opts)
+	stop()
+	bar.Finish()
+	if errors.Is(err, context.Canceled) {
+		fmt.Println(ColorYellow + "[*] Cancelled." + ColorReset)
+	} else if err != nil {
 		fmt.Printf(ColorRed+"[ERROR] Protection failed: %v\n"+ColorReset, err)
 	} else {
-		// Calculate output path to show user
-		dir := filepath.Dir(path)
-		base := filepath.Base(path)
-		ext := filepath.Ext(base)
-		name := strings.TrimSuffix(base, ext)
-		outPath := filepath.Join(dir, name+"_signed"+ext)
-
 		fmt.Println("\n" + ColorGreen + "[SUCCESS] File protected." + ColorReset)
-		fmt.Printf("[FILE] Output File: %s\n", outPath)
+		fmt.Printf("[FILE] Output File: %s\n", result.OutputPath)
 		fmt.Println(ColorYellow + "--------------------------------------------------" + ColorReset)
 		fmt.Printf("[KEY] Key: "+ColorBold+"%s"+ColorReset+"\n", key)
 		fmt.Println(ColorYellow + "[WARNING] IMPORTANT: Save this key! It is required for verification." + ColorReset)
 		fmt.Println(ColorYellow + "--------------------------------------------------" + ColorReset)
-		lastProtectedOutput = outPath
+		lastProtectedOutput = result.OutputPath
 		lastKey = key
 	}
 
@@ -304,14 +377,23 @@ func interactiveVerify(scanner *bufio.Scanner) {
 		}
 	} else {
 		// Auto mode: stop at first success
-		msg, anchorName, err := injector.Verify(path, key, nil)
-		if err != nil {
+		bar := newProgressBar(os.Stdout)
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		res, err := injector.VerifyContext(ctx, path, key, injector.VerifyOptions{Events: bar})
+		stop()
+		bar.Finish()
+		if errors.Is(err, context.Canceled) {
+			fmt.Println(ColorYellow + "[*] Cancelled." + ColorReset)
+		} else if err != nil {
 			fmt.Printf(ColorRed+"[ERROR] Verification Failed: %v\n"+ColorReset, err)
 			fmt.Println(ColorYellow + "Possible reasons: Wrong key, file tampered, or not protected." + ColorReset)
 		} else {
 			fmt.Println("\n" + ColorGreen + "[SUCCESS] Verification Successful!" + ColorReset)
-			fmt.Printf("Found via: "+ColorBold+"%s"+ColorReset+"\n", anchorName)
-			fmt.Printf("Hidden Message: "+ColorBold+"%s"+ColorReset+"\n", msg)
+			fmt.Printf("Found via: "+ColorBold+"%s"+ColorReset+"\n", res.Anchor)
+			fmt.Printf("Hidden Message: "+ColorBold+"%s"+ColorReset+"\n", res.Message)
+			if res.Integrity != nil {
+				printIntegrity(res.Integrity)
+			}
 		}
 	}
 
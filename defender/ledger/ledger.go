@@ -0,0 +1,267 @@
+// Package ledger implements the local issuance ledger: an append-only JSON Lines
+// file recording every signed copy, so investigators can answer "who received
+// this document?" without relying on the copy itself or any external service.
+package ledger
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileName is the ledger file name inside the default ledger directory
+const FileName = "ledger.jsonl"
+
+// ErrCorrupt indicates a ledger line that is not a valid record
+var ErrCorrupt = errors.New("corrupt ledger record")
+
+// Record describes one signed copy
+type Record struct {
+	Time         time.Time `json:"time"`
+	Operator     string    `json:"operator"`
+	SourceFile   string    `json:"source_file"`
+	SourceSHA256 string    `json:"source_sha256"`
+	OutputFile   string    `json:"output_file"`
+	OutputSHA256 string    `json:"output_sha256"`
+	Recipient    string    `json:"recipient,omitempty"`
+	Message      string    `json:"message"`
+	KeyID        string    `json:"key_id"`
+	Anchors      []string  `json:"anchors"`
+}
+
+// Ledger is an append-only record store backed by a single file.
+// A Ledger is safe for concurrent use; each record is written with a single
+// O_APPEND write, so concurrent processes do not interleave records either.
+type Ledger struct {
+	path string
+	mu   sync.Mutex
+}
+
+// DefaultPath returns $DEFENDER_LEDGER if set, otherwise
+// <user config dir>/defender/ledger.jsonl.
+func DefaultPath() (string, error) {
+	if p := os.Getenv("DEFENDER_LEDGER"); p != "" {
+		return p, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate user config dir: %w", err)
+	}
+	return filepath.Join(dir, "defender", FileName), nil
+}
+
+// Open returns the ledger stored at path, creating its directory if needed.
+// The file itself is created by the first Append.
+func Open(path string) (*Ledger, error) {
+	if path == "" {
+		return nil, errors.New("ledger path cannot be empty")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create ledger directory: %w", err)
+	}
+	return &Ledger{path: path}, nil
+}
+
+// Path returns the ledger file path
+func (l *Ledger) Path() string {
+	return l.path
+}
+
+// Append adds a record to the end of the ledger. Existing records are never rewritten.
+func (l *Ledger) Append(r Record) error {
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	r.Time = r.Time.UTC()
+
+	line, err := json.Marshal(&r)
+	if err != nil {
+		return fmt.Errorf("failed to encode ledger record: %w", err)
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.OpenFile(l.path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open ledger: %w", err)
+	}
+
+	// Terminate a torn final line left by an interrupted append,
+	// so it cannot swallow this record
+	if info, err := f.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			line = append([]byte{'\n'}, line...)
+		}
+	}
+
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to append ledger record: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to sync ledger: %w", err)
+	}
+	return f.Close()
+}
+
+// Records returns the records matching f, oldest first.
+// A missing ledger file yields no records and a torn final line (an interrupted
+// append) is ignored. Other malformed lines are skipped: the valid records are
+// still returned, together with an error wrapping ErrCorrupt naming those lines.
+func (l *Ledger) Records(f Filter) ([]Record, error) {
+	file, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ledger: %w", err)
+	}
+	defer file.Close()
+
+	var records []Record
+	var corrupt []string
+	reader := bufio.NewReader(file)
+	for lineNr := 1; ; lineNr++ {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return nil, fmt.Errorf("failed to read ledger: %w", readErr)
+		}
+		complete := readErr == nil
+
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+			var r Record
+			if err := json.Unmarshal(trimmed, &r); err != nil {
+				if complete {
+					corrupt = append(corrupt, strconv.Itoa(lineNr))
+				}
+			} else if f.Match(&r) {
+				records = append(records, r)
+			}
+		}
+
+		if !complete {
+			break
+		}
+	}
+
+	if len(corrupt) > 0 {
+		return records, fmt.Errorf("%w: %s line(s) %s skipped", ErrCorrupt, l.path, strings.Join(corrupt, ", "))
+	}
+	return records, nil
+}
+
+// Filter selects ledger records. Empty fields match everything; set fields must all match.
+type Filter struct {
+	// SHA256 matches the source or output hash (hex; a prefix is enough)
+	SHA256 string
+	// Message matches records whose message contains this substring (case-insensitive)
+	Message string
+	// Recipient matches records whose recipient contains this substring (case-insensitive)
+	Recipient string
+	// Operator matches the operator exactly (case-insensitive)
+	Operator string
+	// KeyID matches the key ID exactly
+	KeyID string
+	// Since and Until bound the record time (inclusive)
+	Since, Until time.Time
+}
+
+// IsEmpty reports whether the filter matches every record
+func (f Filter) IsEmpty() bool {
+	return f == Filter{}
+}
+
+// Match reports whether r satisfies the filter
+func (f Filter) Match(r *Record) bool {
+	if f.SHA256 != "" {
+		h := strings.ToLower(f.SHA256)
+		if !strings.HasPrefix(r.SourceSHA256, h) && !strings.HasPrefix(r.OutputSHA256, h) {
+			return false
+		}
+	}
+	if f.Message != "" && !containsFold(r.Message, f.Message) {
+		return false
+	}
+	if f.Recipient != "" && !containsFold(r.Recipient, f.Recipient) {
+		return false
+	}
+	if f.Operator != "" && !strings.EqualFold(r.Operator, f.Operator) {
+		return false
+	}
+	if f.KeyID != "" && !strings.EqualFold(r.KeyID, f.KeyID) {
+		return false
+	}
+	if !f.Since.IsZero() && r.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && r.Time.After(f.Until) {
+		return false
+	}
+	return true
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// FileSHA256 returns the hex SHA-256 digest of a file, as recorded in the ledger
+func FileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// SHA256 returns the hex SHA-256 digest of data, as recorded in the ledger
+func SHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// csvHeader lists the columns written by WriteCSV
+var csvHeader = []string{
+	"time", "operator", "source_file", "source_sha256", "output_file",
+	"output_sha256", "recipient", "message", "key_id", "anchors",
+}
+
+// WriteCSV writes records as CSV with a header row. Anchors are joined with '+'.
+func WriteCSV(w io.Writer, records []Record) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, r := range records {
+		row := []string{
+			r.Time.Format(time.RFC3339), r.Operator, r.SourceFile, r.SourceSHA256, r.OutputFile,
+			r.OutputSHA256, r.Recipient, r.Message, r.KeyID, strings.Join(r.Anchors, "+"),
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,178 @@
+package ledger
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testRecord(recipient, message, srcHash, outHash string, at time.Time) Record {
+	return Record{
+		Time:         at,
+		Operator:     "alice",
+		SourceFile:   "/docs/deck_r3.pdf",
+		SourceSHA256: srcHash,
+		OutputFile:   "/out/deck_r3_" + recipient + ".pdf",
+		OutputSHA256: outHash,
+		Recipient:    recipient,
+		Message:      message,
+		KeyID:        "0123456789abcdef",
+		Anchors:      []string{"Attachment", "SMask"},
+	}
+}
+
+// TestLedgerAppendAndSearch tests appending records and filtering them back
+func TestLedgerAppendAndSearch(t *testing.T) {
+	l, err := Open(filepath.Join(t.TempDir(), "sub", FileName))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	// Reading a ledger that has never been written yields nothing
+	records, err := l.Records(Filter{})
+	if err != nil || len(records) != 0 {
+		t.Fatalf("Expected empty ledger, got %v, %v", records, err)
+	}
+
+	day := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	rev2, rev3 := "aaaa1111bbbb2222", "cccc3333dddd4444"
+	appendAll := []Record{
+		testRecord("Bob", "UserID:2", rev2, "out-bob-r2", day),
+		testRecord("Carol", "UserID:3", rev3, "out-carol-r3", day.Add(24*time.Hour)),
+		testRecord("Dave", "UserID:4", rev3, "out-dave-r3", day.Add(48*time.Hour)),
+	}
+	for _, r := range appendAll {
+		if err := l.Append(r); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		filter   Filter
+		expected []string // Recipients, in ledger order
+	}{
+		{name: "Empty filter", filter: Filter{}, expected: []string{"Bob", "Carol", "Dave"}},
+		{name: "Source revision by hash prefix", filter: Filter{SHA256: "CCCC3333"}, expected: []string{"Carol", "Dave"}},
+		{name: "Leaked copy by output hash", filter: Filter{SHA256: "out-dave"}, expected: []string{"Dave"}},
+		{name: "Message substring", filter: Filter{Message: "userid:3"}, expected: []string{"Carol"}},
+		{name: "Time window", filter: Filter{Since: day.Add(time.Hour), Until: day.Add(24 * time.Hour)}, expected: []string{"Carol"}},
+		{name: "Combined filters", filter: Filter{SHA256: rev3, Recipient: "dav"}, expected: []string{"Dave"}},
+		{name: "No match", filter: Filter{Operator: "mallory"}, expected: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := l.Records(tt.filter)
+			if err != nil {
+				t.Fatalf("Records failed: %v", err)
+			}
+			var got []string
+			for _, r := range records {
+				got = append(got, r.Recipient)
+			}
+			if len(got) != len(tt.expected) {
+				t.Fatalf("Recipients mismatch: got %v, want %v", got, tt.expected)
+			}
+			for i := range got {
+				if got[i] != tt.expected[i] {
+					t.Fatalf("Recipients mismatch: got %v, want %v", got, tt.expected)
+				}
+			}
+		})
+	}
+}
+
+// TestLedgerConcurrentAppend tests that concurrent appends never interleave records
+func TestLedgerConcurrentAppend(t *testing.T) {
+	l, err := Open(filepath.Join(t.TempDir(), FileName))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	const writers = 16
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := l.Append(testRecord("R", "UserID", "src", "out", time.Time{})); err != nil {
+				t.Errorf("Append failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	records, err := l.Records(Filter{})
+	if err != nil {
+		t.Fatalf("Records failed: %v", err)
+	}
+	if len(records) != writers {
+		t.Errorf("Expected %d records, got %d", writers, len(records))
+	}
+	if records[0].Time.IsZero() {
+		t.Error("Append did not stamp the record time")
+	}
+}
+
+// TestLedgerCorruption tests torn-tail tolerance and corrupt-line detection
+func TestLedgerCorruption(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	l, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if err := l.Append(testRecord("Bob", "UserID:2", "src", "out", time.Time{})); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+
+	// An interrupted append leaves a torn final line: ignored
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"time":"2026-10-`)
+	f.Close()
+	records, err := l.Records(Filter{})
+	if err != nil || len(records) != 1 {
+		t.Fatalf("Expected torn tail to be ignored, got %d records, %v", len(records), err)
+	}
+
+	// The next append must not be swallowed by the torn line, which is then
+	// reported as corrupt while the valid records are still returned
+	if err := l.Append(testRecord("Carol", "UserID:3", "src", "out", time.Time{})); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	records, err = l.Records(Filter{})
+	if !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Expected ErrCorrupt, got %v", err)
+	}
+	if len(records) != 2 || records[1].Recipient != "Carol" {
+		t.Errorf("Expected Bob and Carol to survive, got %+v", records)
+	}
+}
+
+// TestWriteCSV tests the CSV export layout
+func TestWriteCSV(t *testing.T) {
+	var buf bytes.Buffer
+	r := testRecord("Bob, Jr.", "UserID:2", "src", "out", time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC))
+	if err := WriteCSV(&buf, []Record{r}); err != nil {
+		t.Fatalf("WriteCSV failed: %v", err)
+	}
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("Exported CSV is invalid: %v", err)
+	}
+	if len(rows) != 2 || len(rows[1]) != len(csvHeader) {
+		t.Fatalf("Unexpected CSV shape: %q", rows)
+	}
+	if rows[1][6] != "Bob, Jr." || rows[1][9] != "Attachment+SMask" || rows[1][0] != "2026-10-01T09:00:00Z" {
+		t.Errorf("Unexpected CSV row: %q", rows[1])
+	}
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"defender/ledger"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	ledgerPath   string
+	noLedger     bool
+	ledgerFilter struct {
+		doc, msg, recipient, operator, keyID, since, until string
+	}
+	ledgerLimit  int
+	exportFormat string
+	exportPath   string
+)
+
+// minHashPrefix is the shortest hash prefix accepted by ledger search --doc
+const minHashPrefix = 8
+
+var ledgerCmd = &cobra.Command{
+	Use:   "ledger",
+	Short: "Query the local issuance ledger of signed copies",
+	Long: `Every signed copy is recorded in a local append-only ledger: source and
+output SHA-256, recipient, message, key ID (never the key), anchors, time and
+operator. The ledger lives at $DEFENDER_LEDGER or, by default, in the user
+config directory (defender/ledger.jsonl); --ledger overrides both.
+
+Example:
+  defender ledger search --doc deck_rev3.pdf      # who received revision 3?
+  defender ledger search --doc leaked_copy.pdf    # whose copy leaked?`,
+}
+
+var ledgerListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List ledger records",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		records, err := readLedger(ledger.Filter{})
+		if err != nil {
+			return err
+		}
+		if ledgerLimit > 0 && len(records) > ledgerLimit {
+			records = records[len(records)-ledgerLimit:]
+		}
+		printLedgerRecords(os.Stdout, records)
+		return nil
+	},
+}
+
+var ledgerSearchCmd = &cobra.Command{
+	Use:   "search",
+	Short: "Search ledger records by document, message, recipient, operator or time",
+	Long: `The search command prints the ledger records matching all given filters.
+
+--doc accepts a PDF file (its SHA-256 is matched against both source and output
+hashes) or a hex SHA-256 prefix of at least 8 characters.
+
+Example:
+  defender ledger search --doc deck_rev3.pdf --since 2026-10-01`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filter, err := buildLedgerFilter()
+		if err != nil {
+			return err
+		}
+		if filter.IsEmpty() {
+			return fmt.Errorf("at least one filter is required (see --help)")
+		}
+		records, err := readLedger(filter)
+		if err != nil {
+			return err
+		}
+		printLedgerRecords(os.Stdout, records)
+		return nil
+	},
+}
+
+var ledgerExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export ledger records as JSON or CSV",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filter, err := buildLedgerFilter()
+		if err != nil {
+			return err
+		}
+		records, err := readLedger(filter)
+		if err != nil {
+			return err
+		}
+
+		var w io.Writer = os.Stdout
+		if exportPath != "" {
+			f, err := os.Create(exportPath)
+			if err != nil {
+				return fmt.Errorf("failed to create export file: %w", err)
+			}
+			defer f.Close()
+			w = f
+		}
+
+		switch strings.ToLower(exportFormat) {
+		case "json":
+			if records == nil {
+				records = []ledger.Record{}
+			}
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(records)
+		case "csv":
+			err = ledger.WriteCSV(w, records)
+		default:
+			return fmt.Errorf("unknown export format %q (json|csv)", exportFormat)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to export ledger: %w", err)
+		}
+		if exportPath != "" {
+			fmt.Fprintf(os.Stderr, "📋 Exported %d records to %s\n", len(records), exportPath)
+		}
+		return nil
+	},
+}
+
+// setupLedgerCommands registers the ledger commands and the global ledger flags
+func setupLedgerCommands() {
+	rootCmd.AddCommand(ledgerCmd)
+	ledgerCmd.AddCommand(ledgerListCmd, ledgerSearchCmd, ledgerExportCmd)
+
+	rootCmd.PersistentFlags().StringVar(&ledgerPath, "ledger", "", "Issuance ledger path (default: $DEFENDER_LEDGER or user config dir)")
+	rootCmd.PersistentFlags().BoolVar(&noLedger, "no-ledger", false, "Do not record signed copies in the issuance ledger")
+
+	ledgerListCmd.Flags().IntVarP(&ledgerLimit, "limit", "n", 0, "Show only the last N records")
+
+	for _, c := range []*cobra.Command{ledgerSearchCmd, ledgerExportCmd} {
+		c.Flags().StringVar(&ledgerFilter.doc, "doc", "", "PDF file or SHA-256 prefix matching the source or output document")
+		c.Flags().StringVar(&ledgerFilter.msg, "msg", "", "Message substring")
+		c.Flags().StringVar(&ledgerFilter.recipient, "recipient", "", "Recipient substring")
+		c.Flags().StringVar(&ledgerFilter.operator, "operator", "", "Operator name")
+		c.Flags().StringVar(&ledgerFilter.keyID, "key-id", "", "Key ID")
+		c.Flags().StringVar(&ledgerFilter.since, "since", "", "Only records at or after this time (2006-01-02 or RFC 3339)")
+		c.Flags().StringVar(&ledgerFilter.until, "until", "", "Only records at or before this time (2006-01-02 or RFC 3339)")
+	}
+
+	ledgerExportCmd.Flags().StringVar(&exportFormat, "format", "json", "Export format: json|csv")
+	ledgerExportCmd.Flags().StringVarP(&exportPath, "output", "o", "", "Write to this file instead of stdout")
+}
+
+// openLedger opens the issuance ledger, or returns nil when --no-ledger is set
+func openLedger() (*ledger.Ledger, error) {
+	if noLedger {
+		return nil, nil
+	}
+	path := ledgerPath
+	if path == "" {
+		var err error
+		if path, err = ledger.DefaultPath(); err != nil {
+			return nil, err
+		}
+	}
+	return ledger.Open(path)
+}
+
+// currentOperator returns $DEFENDER_OPERATOR, falling back to the OS user name
+func currentOperator() string {
+	if op := os.Getenv("DEFENDER_OPERATOR"); op != "" {
+		return op
+	}
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return "unknown"
+}
+
+// absPath returns p as an absolute path; - (stdin/stdout) is kept as is
+func absPath(p string) string {
+	if p == stdioPath {
+		return p
+	}
+	if abs, err := filepath.Abs(p); err == nil {
+		return abs
+	}
+	return p
+}
+
+// readLedger opens the ledger and returns the matching records.
+// Corrupt lines are reported as a warning; the remaining records are still returned.
+func readLedger(filter ledger.Filter) ([]ledger.Record, error) {
+	if noLedger {
+		return nil, fmt.Errorf("--no-ledger cannot be used with ledger commands")
+	}
+	l, err := openLedger()
+	if err != nil {
+		return nil, err
+	}
+	records, err := l.Records(filter)
+	if errors.Is(err, ledger.ErrCorrupt) {
+		fmt.Fprintf(os.Stderr, "⚠ Warning: %v\n", err)
+		err = nil
+	}
+	return records, err
+}
+
+// buildLedgerFilter turns the search flags into a ledger.Filter
+func buildLedgerFilter() (ledger.Filter, error) {
+	f := ledger.Filter{
+		Message:   ledgerFilter.msg,
+		Recipient: ledgerFilter.recipient,
+		Operator:  ledgerFilter.operator,
+		KeyID:     ledgerFilter.keyID,
+	}
+
+	if doc := ledgerFilter.doc; doc != "" {
+		if info, err := os.Stat(doc); err == nil && !info.IsDir() {
+			hash, err := ledger.FileSHA256(doc)
+			if err != nil {
+				return f, fmt.Errorf("failed to hash %s: %w", doc, err)
+			}
+			f.SHA256 = hash
+		} else if isHexPrefix(doc) {
+			f.SHA256 = doc
+		} else {
+			return f, fmt.Errorf("--doc %q is neither a file nor a SHA-256 prefix of at least %d hex characters", doc, minHashPrefix)
+		}
+	}
+
+	var err error
+	if f.Since, err = parseLedgerTime(ledgerFilter.since, false); err != nil {
+		return f, fmt.Errorf("invalid --since: %w", err)
+	}
+	if f.Until, err = parseLedgerTime(ledgerFilter.until, true); err != nil {
+		return f, fmt.Errorf("invalid --until: %w", err)
+	}
+	return f, nil
+}
+
+func isHexPrefix(s string) bool {
+	if len(s) < minHashPrefix || len(s) > 64 {
+		return false
+	}
+	for _, r := range strings.ToLower(s) {
+		if (r < '0' || r > '9') && (r < 'a' || r > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// parseLedgerTime parses a date (local midnight; end of day if endOfDay) or an RFC 3339 time
+func parseLedgerTime(s string, endOfDay bool) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected 2006-01-02 or RFC 3339, got %q", s)
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return t, nil
+}
+
+// printLedgerRecords prints records as an aligned table
+func printLedgerRecords(out io.Writer, records []ledger.Record) {
+	if len(records) == 0 {
+		fmt.Fprintln(out, "No matching ledger records.")
+		return
+	}
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tOPERATOR\tRECIPIENT\tMESSAGE\tSOURCE\tOUTPUT\tKEY ID\tANCHORS")
+	for _, r := range records {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			r.Time.Local().Format("2006-01-02 15:04:05"), r.Operator, r.Recipient, r.Message,
+			filepath.Base(r.SourceFile)+"@"+shortHash(r.SourceSHA256),
+			filepath.Base(r.OutputFile)+"@"+shortHash(r.OutputSHA256),
+			r.KeyID, strings.Join(r.Anchors, "+"))
+	}
+	tw.Flush()
+	fmt.Fprintf(out, "\n%d record(s)\n", len(records))
+}
+
+func shortHash(h string) string {
+	if len(h) > 12 {
+		return h[:12]
+	}
+	return h
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"defender/injector"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	maxStreamSizeMB int64
+	maxObjects      int
+	fileTimeout     time.Duration
+)
+
+// addLimitFlags registers the resource limit flags of commands that read untrusted PDFs
+func addLimitFlags(cmd *cobra.Command) {
+	cmd.Flags().Int64Var(&maxStreamSizeMB, "max-stream-size", injector.DefaultLimits.MaxStreamSize>>20, "Maximum decoded size of one PDF stream in MB (0 = unlimited)")
+	cmd.Flags().IntVar(&maxObjects, "max-objects", injector.DefaultLimits.MaxObjects, "Maximum number of objects in one PDF (0 = unlimited)")
+	cmd.Flags().DurationVar(&fileTimeout, "timeout", injector.DefaultLimits.Timeout, "Time budget per file, e.g. 30s (0 = unlimited)")
+}
+
+// limitsFromFlags returns the limits set by addLimitFlags
+func limitsFromFlags() (injector.Limits, error) {
+	if maxStreamSizeMB < 0 || maxObjects < 0 || fileTimeout < 0 {
+		return injector.Limits{}, fmt.Errorf("--max-stream-size, --max-objects and --timeout must not be negative")
+	}
+	return injector.Limits{
+		MaxStreamSize: maxStreamSizeMB << 20,
+		MaxObjects:    maxObjects,
+		Timeout:       fileTimeout,
+	}, nil
+}
@@ -1,14 +1,20 @@
 package main
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
 
 	"defender/injector"
+	"defender/ledger"
+	"defender/server"
 
 	"github.com/spf13/cobra"
 )
@@ -47,41 +53,127 @@ tracking code) into a PDF file as a hidden attachment.
 The original PDF remains fully readable, and the tracking information 
 can only be extracted with the correct decryption key.
 
+Anchors, Visual watermark style, key and output naming come from the signing
+profile (--profile, see 'defender profiles'). --output picks the path instead,
+--in-place replaces the source, and an existing output is only replaced with
+--force. Use - as the file to read stdin; the signed PDF then goes to stdout.
+
 Example:
   defender sign -f report.pdf -m "UserID:12345" -k "MySecretKey32BytesLongString!!"
+  defender sign -f contract.pdf -m "Counterparty:ACME" --profile contract
+  defender sign -f report.pdf -m "UserID:12345" -o out/report.pdf --force
+  cat report.pdf | defender sign -f - -m "UserID:12345" > signed.pdf
 
 Note: The encryption key must be exactly 32 bytes long.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		// Validate required flags
-		if filePath == "" {
-			return fmt.Errorf("required flag --file is missing")
-		}
-		if message == "" {
-			return fmt.Errorf("required flag --msg is missing")
+		if outputFormat == formatJSON && signsToStdout() {
+			return fmt.Errorf("--format json cannot be used while the signed PDF goes to stdout")
 		}
+		res := &cliResult{File: filePath, Message: message}
+		return runFormatted(cmd, res, func() error { return runSign(res) })
+	},
+}
 
-		// Handle Key (Flag -> Env -> Error)
-		if key == "" {
-			key = os.Getenv("DEFAULT_KEY")
-			if key == "" {
-				return fmt.Errorf("required flag --key is missing and DEFAULT_KEY env not set")
-			}
-			fmt.Println("ℹ️  Using key from environment variable DEFAULT_KEY")
+// runSign signs --file as configured by the flags and fills res
+func runSign(res *cliResult) error {
+	// Validate required flags
+	if filePath == "" {
+		return fmt.Errorf("required flag --file is missing")
+	}
+	if message == "" {
+		return fmt.Errorf("required flag --msg is missing")
+	}
+
+	// The signed PDF goes to stdout, so status output moves to stderr
+	if signsToStdout() {
+		if !signForce && isTerminal(os.Stdout) {
+			return fmt.Errorf("refusing to write a PDF to the terminal; redirect stdout or use --force")
 		}
+		defer redirectStatus(os.Stderr)()
+	}
 
-		fmt.Printf("🛡️  Defender Sign Operation\n")
-		fmt.Printf("   File: %s\n", filePath)
-		fmt.Printf("   Message: %s\n", message)
-		fmt.Println()
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	profile, err := cfg.Profile(signProfile)
+	if err != nil {
+		return err
+	}
 
-		err := injector.Sign(filePath, message, key, nil)
-		if err != nil {
-			return fmt.Errorf("sign operation failed: %w", err)
+	// Handle Key (Flag -> Profile -> Env -> Error)
+	resolvedKey, err := resolveProfileKey(key, profile)
+	if err != nil {
+		return err
+	}
+	key = resolvedKey
+	res.Profile = profile.Name
+	res.KeyID = injector.KeyID([]byte(key))
+
+	target, err := newSignTarget(func() (string, error) {
+		return profile.OutputPath(filePath, map[string]string{"msg": message})
+	})
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+	res.Output = target.outputName()
+
+	fmt.Fprintf(status, "🛡️  Defender Sign Operation\n")
+	fmt.Fprintf(status, "   File: %s\n", filePath)
+	fmt.Fprintf(status, "   Output: %s\n", target.outputName())
+	fmt.Fprintf(status, "   Message: %s\n", message)
+	fmt.Fprintf(status, "   Profile: %s\n", profile.Name)
+	fmt.Fprintln(status)
+
+	issuance, err := openLedger()
+	if err != nil {
+		return fmt.Errorf("failed to open ledger: %w", err)
+	}
+
+	opts := profile.SignOptions()
+	opts.Overwrite = target.overwrite
+	opts.TamperEvidence = opts.TamperEvidence || signTamperEvident
+	opts.Incremental = opts.Incremental || signIncremental
+	if signDeterministicSeed != "" {
+		fmt.Fprintf(os.Stderr, "⚠ Warning: --insecure-deterministic-seed is for reproducible tests only; do not hand out this copy\n")
+		opts.DeterministicSeed = []byte(signDeterministicSeed)
+	}
+	opts.UserPassword, opts.OwnerPassword = passwordsFromFlags()
+	opts.Events = consoleEvents{}
+	opts.Ledger = issuance
+	opts.Issuance = ledger.Record{Operator: currentOperator(), SourceFile: absPath(target.sourceName()), OutputFile: absPath(target.outputName())}
+	// Ctrl-C stops signing cleanly, removing the spooled stdin copy
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	result, err := injector.SignContext(ctx, target.input, target.output, message, key, opts)
+	if errors.Is(err, injector.ErrOutputExists) {
+		return fmt.Errorf("%w; use --force to replace it", err)
+	}
+	if err != nil {
+		return fmt.Errorf("sign operation failed: %w", err)
+	}
+	if !target.toStdout {
+		fmt.Fprintf(status, "✓ Successfully signed PDF: %s\n", target.outputName())
+	}
+	res.Anchors = result.Anchors
+	res.Notes = result.Plan.Notes()
+	res.TamperEvident = result.DigestedPages > 0
+	if res.TamperEvident {
+		fmt.Fprintf(status, "🔏 Tamper evidence: %d page digests sealed\n", result.DigestedPages)
+	}
+	res.PDFA = result.PDFA
+	if res.PDFA != "" {
+		fmt.Fprintf(status, "🗄️  Archival: %s conformance checked\n", res.PDFA)
+	}
+	if target.toStdout {
+		if err := target.writeStdout(os.Stdout); err != nil {
+			return fmt.Errorf("failed to write signed PDF to stdout: %w", err)
 		}
+	}
 
-		fmt.Println("\n✅ Sign operation completed successfully!")
-		return nil
-	},
+	fmt.Fprintln(status, "\n✅ Sign operation completed successfully!")
+	return nil
 }
 
 var verifyCmd = &cobra.Command{
@@ -100,112 +192,201 @@ Example:
 
 Note: The decryption key must match the one used during signing.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		// Validate required flags
-		if filePath == "" {
-			return fmt.Errorf("required flag --file is missing")
-		}
+		res := &cliResult{File: filePath}
+		return runFormatted(cmd, res, func() error { return runVerify(res) })
+	},
+}
 
-		// Handle Key (Flag -> Env -> Error)
-		if key == "" {
-			key = os.Getenv("DEFAULT_KEY")
-			if key == "" {
-				return fmt.Errorf("required flag --key is missing and DEFAULT_KEY env not set")
-			}
-			fmt.Println("ℹ️  Using key from environment variable DEFAULT_KEY")
-		}
+// runVerify verifies --file and fills res
+func runVerify(res *cliResult) error {
+	// Validate required flags
+	if filePath == "" {
+		return fmt.Errorf("required flag --file is missing")
+	}
 
-		fmt.Printf("🔍 Defender Verify Operation\n")
-		fmt.Printf("   File: %s\n", filePath)
-		fmt.Println()
+	// Handle Key (Flag -> Env -> Error)
+	resolvedKey, err := resolveKey(key)
+	if err != nil {
+		return err
+	}
+	key = resolvedKey
+	res.KeyID = injector.KeyID([]byte(key))
+	limits, err := limitsFromFlags()
+	if err != nil {
+		return err
+	}
+	opts := injector.VerifyOptions{Limits: &limits}
+	opts.UserPassword, opts.OwnerPassword = passwordsFromFlags()
 
-		if strings.EqualFold(verifyMode, "all") {
-			crypto, err := injector.NewCryptoManager([]byte(key))
-			if err != nil {
-				return fmt.Errorf("failed to create crypto manager: %w", err)
+	// Report unreadable files as I/O errors rather than missing anchors
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	f.Close()
+
+	fmt.Fprintf(status, "🔍 Defender Verify Operation\n")
+	fmt.Fprintf(status, "   File: %s\n", filePath)
+	fmt.Fprintln(status)
+
+	if strings.EqualFold(verifyMode, "all") {
+		crypto, err := injector.NewCryptoManager([]byte(key))
+		if err != nil {
+			return fmt.Errorf("failed to create crypto manager: %w", err)
+		}
+		registry := injector.NewAnchorRegistry()
+		anchors := registry.GetAvailableAnchors()
+		anyDecryptFailed := false
+		var limitErr error
+		for _, a := range anchors {
+			if a.Name() == injector.AnchorNameVisual { // Visual 不支持提取
+				continue
 			}
-			registry := injector.NewAnchorRegistry()
-			anchors := registry.GetAvailableAnchors()
-			anySuccess := false
-			for _, a := range anchors {
-				if a.Name() == injector.AnchorNameVisual { // Visual 不支持提取
-					continue
-				}
-				fmt.Printf(" - Trying %s... ", a.Name())
-				payload, extErr := a.Extract(filePath)
-				if extErr != nil {
-					fmt.Println("extract failed")
-					continue
-				}
-				msg, decErr := crypto.Decrypt(payload)
-				if decErr != nil {
-					fmt.Println("decrypt failed")
-					continue
-				}
-				fmt.Println("OK")
-				fmt.Printf("   Message(%s): %s\n", a.Name(), msg)
-				anySuccess = true
+			fmt.Fprintf(status, " - Trying %s... ", a.Name())
+			payload, extErr := injector.ExtractWithOptions(a, filePath, opts)
+			if errors.Is(extErr, injector.ErrWrongPassword) {
+				fmt.Fprintln(status, "wrong password")
+				return fmt.Errorf("verify operation failed: %w", extErr)
+			}
+			if errors.As(extErr, &res.Limit) {
+				fmt.Fprintln(status, "limit exceeded")
+				res.Results = append(res.Results, anchorResult{Anchor: a.Name(), Status: "limit_exceeded", Message: extErr.Error()})
+				limitErr = extErr
+				continue
 			}
-			if !anySuccess {
-				return fmt.Errorf("verify operation failed: all anchors invalid or missing")
+			if extErr != nil {
+				fmt.Fprintln(status, "extract failed")
+				res.Results = append(res.Results, anchorResult{Anchor: a.Name(), Status: "not_found"})
+				continue
+			}
+			msg, decErr := crypto.Decrypt(payload)
+			if decErr != nil {
+				fmt.Fprintln(status, "decrypt failed")
+				res.Results = append(res.Results, anchorResult{Anchor: a.Name(), Status: "decrypt_failed"})
+				anyDecryptFailed = true
+				continue
+			}
+			fmt.Fprintln(status, "OK")
+			fmt.Fprintf(status, "   Message(%s): %s\n", a.Name(), msg)
+			res.Results = append(res.Results, anchorResult{Anchor: a.Name(), Status: "verified", Message: msg})
+			res.Anchors = append(res.Anchors, a.Name())
+			if res.Message == "" {
+				res.Message = msg
 			}
-			fmt.Println("✅ Verification finished (mode=all).")
-			return nil
 		}
+		if len(res.Anchors) == 0 {
+			if limitErr != nil {
+				return fmt.Errorf("verify operation failed: %w", limitErr)
+			}
+			if anyDecryptFailed {
+				return fmt.Errorf("verify operation failed: %w", injector.ErrDecryptFailed)
+			}
+			return fmt.Errorf("verify operation failed: %w", injector.ErrNoPayload)
+		}
+		fmt.Fprintln(status, "✅ Verification finished (mode=all).")
+		return nil
+	}
 
-		extractedMsg, _, err := injector.Verify(filePath, key, nil)
-		if err != nil {
-			return fmt.Errorf("verify operation failed: %w", err)
+	opts.Events = consoleEvents{}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	result, err := injector.VerifyContext(ctx, filePath, key, opts)
+	if err != nil {
+		errors.As(err, &res.Limit)
+		return fmt.Errorf("verify operation failed: %w", err)
+	}
+	res.Message = result.Message
+	res.Anchors = []string{result.Anchor}
+	res.Integrity = result.Integrity
+
+	fmt.Fprintln(status, "✅ Verification successful!")
+	fmt.Fprintf(status, "📋 Extracted message: \"%s\"\n", result.Message)
+	if result.Integrity != nil {
+		printIntegrity(result.Integrity)
+		if result.Integrity.Error == "" && !result.Integrity.Intact() {
+			return errPagesModified
 		}
+	}
+	return nil
+}
 
-		fmt.Println("✅ Verification successful!")
-		fmt.Printf("📋 Extracted message: \"%s\"\n", extractedMsg)
-		return nil
-	},
+// printIntegrity prints how the pages compare with the digests sealed at signing
+func printIntegrity(r *injector.IntegrityReport) {
+	switch {
+	case r.Error != "":
+		fmt.Fprintf(status, "⚠️  Integrity not checked: %s\n", r.Error)
+		return
+	case r.Intact():
+		fmt.Fprintf(status, "🔏 Integrity: all %d pages unchanged since signing\n", r.SignedPages)
+		return
+	}
+	fmt.Fprintf(status, "🚨 Integrity: document modified after signing (%d pages signed, %d now)\n", r.SignedPages, r.CurrentPages)
+	for _, c := range r.Modified {
+		var parts []string
+		if c.Text {
+			parts = append(parts, "text")
+		}
+		if c.Images {
+			parts = append(parts, "images")
+		}
+		fmt.Fprintf(status, "   - page %d modified (%s), now page %d\n", c.SignedPage, strings.Join(parts, ", "), c.CurrentPage)
+	}
+	for _, p := range r.Removed {
+		fmt.Fprintf(status, "   - page %d removed\n", p)
+	}
+	for _, p := range r.Added {
+		fmt.Fprintf(status, "   - page %d added\n", p)
+	}
 }
 
 var initKeyCmd = &cobra.Command{
 	Use:   "init-key",
 	Short: "Generate initialization key to .env file (silent)",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		// 1. Generate Key (32 chars)
-		k := make([]byte, 16)
-		if _, err := rand.Read(k); err != nil {
-			return err
-		}
-		keyVal := hex.EncodeToString(k)
+		res := &cliResult{}
+		return runFormatted(cmd, res, func() error {
+			// 1. Generate Key (32 chars)
+			k := make([]byte, 16)
+			if _, err := rand.Read(k); err != nil {
+				return err
+			}
+			keyVal := hex.EncodeToString(k)
+			res.KeyID = injector.KeyID([]byte(keyVal))
 
-		// 2. Determine path (Binary directory)
-		exePath, err := os.Executable()
-		if err != nil {
-			return err
-		}
-		envPath := filepath.Join(filepath.Dir(exePath), ".env")
-
-		// 3. Read/Update .env
-		contentByte, _ := os.ReadFile(envPath)
-		content := string(contentByte)
-		newLine := fmt.Sprintf("DEFAULT_KEY=%s", keyVal)
-
-		if strings.Contains(content, "DEFAULT_KEY=") {
-			// Replace existing key
-			lines := strings.Split(content, "\n")
-			for i, line := range lines {
-				if strings.HasPrefix(strings.TrimSpace(line), "DEFAULT_KEY=") {
-					oldVal := strings.TrimPrefix(strings.TrimSpace(line), "DEFAULT_KEY=")
-					fmt.Printf("ℹ️  Overwriting old key: %s\n", oldVal)
-					lines[i] = newLine
-				}
+			// 2. Determine path (Binary directory)
+			exePath, err := os.Executable()
+			if err != nil {
+				return err
 			}
-			content = strings.Join(lines, "\n")
-		} else {
-			// Append new key
-			if len(content) > 0 && !strings.HasSuffix(content, "\n") {
-				content += "\n"
+			envPath := filepath.Join(filepath.Dir(exePath), ".env")
+
+			// 3. Read/Update .env
+			contentByte, _ := os.ReadFile(envPath)
+			content := string(contentByte)
+			newLine := fmt.Sprintf("DEFAULT_KEY=%s", keyVal)
+
+			if strings.Contains(content, "DEFAULT_KEY=") {
+				// Replace existing key
+				lines := strings.Split(content, "\n")
+				for i, line := range lines {
+					if strings.HasPrefix(strings.TrimSpace(line), "DEFAULT_KEY=") {
+						oldVal := strings.TrimPrefix(strings.TrimSpace(line), "DEFAULT_KEY=")
+						fmt.Fprintf(status, "ℹ️  Overwriting old key: %s\n", oldVal)
+						lines[i] = newLine
+					}
+				}
+				content = strings.Join(lines, "\n")
+			} else {
+				// Append new key
+				if len(content) > 0 && !strings.HasSuffix(content, "\n") {
+					content += "\n"
+				}
+				content += newLine + "\n"
 			}
-			content += newLine + "\n"
-		}
 
-		return os.WriteFile(envPath, []byte(content), 0644)
+			res.Output = envPath
+			return os.WriteFile(envPath, []byte(content), 0644)
+		})
 	},
 }
 
@@ -214,11 +395,29 @@ func setupCommands() {
 	rootCmd.AddCommand(signCmd)
 	rootCmd.AddCommand(verifyCmd)
 	rootCmd.AddCommand(initKeyCmd)
+	rootCmd.AddCommand(signBatchCmd)
+	rootCmd.AddCommand(verifyBatchCmd)
+	rootCmd.AddCommand(traceCmd)
+	rootCmd.AddCommand(serveCmd)
+	rootCmd.AddCommand(planCmd)
+	setupLedgerCommands()
+	setupWatchCommand()
+	setupProfileCommands()
 
 	// Sign command flags
 	signCmd.Flags().StringVarP(&filePath, "file", "f", "", "Source PDF file path (required)")
 	signCmd.Flags().StringVarP(&message, "msg", "m", "", "Message to embed, e.g., 'UserID:123' (required)")
-	signCmd.Flags().StringVarP(&key, "key", "k", "", "32-byte encryption key (optional if DEFAULT_KEY env is set)")
+	signCmd.Flags().StringVarP(&key, "key", "k", "", "32-byte encryption key (optional if the profile or DEFAULT_KEY env provides one)")
+	signCmd.Flags().StringVarP(&signProfile, "profile", "p", "", "Signing profile (default: the config's default_profile)")
+	signCmd.Flags().StringVarP(&signOutput, "output", "o", "", "Signed PDF path, - for stdout (default: the profile's output template)")
+	signCmd.Flags().BoolVar(&signInPlace, "in-place", false, "Replace the source file with the signed copy (atomic rename)")
+	signCmd.Flags().BoolVar(&signForce, "force", false, "Overwrite an existing output file (or write a PDF to a terminal)")
+	signCmd.Flags().BoolVar(&signTamperEvident, "tamper-evident", false, "Seal page digests so verify reports pages altered after signing (default: the profile's tamper_evidence)")
+	signCmd.Flags().BoolVar(&signIncremental, "incremental", false, "Append the anchors as an incremental update so existing digital signatures stay valid (default: the profile's incremental)")
+	signCmd.Flags().StringVar(&signDeterministicSeed, "insecure-deterministic-seed", "", "TESTS ONLY: derive the nonce and file ID from this seed and fix the dates so identical inputs give a byte-identical copy")
+	_ = signCmd.Flags().MarkHidden("insecure-deterministic-seed")
+	addPasswordFlags(signCmd)
+	addFormatFlag(signCmd)
 	_ = signCmd.MarkFlagRequired("file")
 	_ = signCmd.MarkFlagRequired("msg")
 
@@ -226,7 +425,65 @@ func setupCommands() {
 	verifyCmd.Flags().StringVarP(&filePath, "file", "f", "", "Target PDF file path (required)")
 	verifyCmd.Flags().StringVarP(&key, "key", "k", "", "32-byte decryption key (optional if DEFAULT_KEY env is set)")
 	verifyCmd.Flags().StringVar(&verifyMode, "mode", "auto", "Verification mode: auto|all")
+	addLimitFlags(verifyCmd)
+	addPasswordFlags(verifyCmd)
+	addFormatFlag(verifyCmd)
+	addFormatFlag(initKeyCmd)
 	_ = verifyCmd.MarkFlagRequired("file")
+
+	// Sign-batch command flags
+	signBatchCmd.Flags().StringVarP(&filePath, "file", "f", "", "Source PDF file path (required)")
+	signBatchCmd.Flags().StringVarP(&recipientsPath, "recipients", "r", "", "Recipients list, CSV or JSON (required)")
+	signBatchCmd.Flags().StringVarP(&key, "key", "k", "", "32-byte encryption key (optional if DEFAULT_KEY env is set)")
+	signBatchCmd.Flags().StringVarP(&outDir, "out-dir", "d", "", "Output directory (default: source file directory)")
+	signBatchCmd.Flags().StringVar(&manifestPath, "manifest", "", "Manifest path (default: <out-dir>/manifest.json)")
+	signBatchCmd.Flags().IntVarP(&signBatchJobs, "jobs", "j", 1, "Number of copies to sign in parallel (0 = one per CPU)")
+	signBatchCmd.Flags().BoolVar(&signBatchForce, "force", false, "Overwrite existing output files")
+	_ = signBatchCmd.MarkFlagRequired("file")
+	_ = signBatchCmd.MarkFlagRequired("recipients")
+
+	// Verify-batch command flags
+	verifyBatchCmd.Flags().StringVarP(&key, "key", "k", "", "32-byte decryption key (optional if DEFAULT_KEY env is set)")
+	verifyBatchCmd.Flags().IntVarP(&verifyBatchJobs, "jobs", "j", 0, "Number of files to verify in parallel (0 = one per CPU)")
+	verifyBatchCmd.Flags().StringVar(&reportPath, "report", "", "Write a JSON report to this path")
+	addLimitFlags(verifyBatchCmd)
+	addPasswordFlags(verifyBatchCmd)
+
+	// Trace command flags
+	traceCmd.Flags().StringVarP(&filePath, "file", "f", "", "Leaked PDF file path (required)")
+	traceCmd.Flags().StringArrayVarP(&traceKeys, "key", "k", nil, "32-byte key to try (repeatable)")
+	traceCmd.Flags().StringVar(&traceKeysFile, "keys-file", "", "File with one key per line (default: $DEFENDER_KEYS_FILE)")
+	addLimitFlags(traceCmd)
+
+	// Plan command flags
+	planCmd.Flags().StringVarP(&filePath, "file", "f", "", "Source PDF file path (required)")
+	planCmd.Flags().StringVarP(&message, "msg", "m", "", "Message to size the payload for (default: a sample message)")
+	planCmd.Flags().StringVarP(&planProfile, "profile", "p", "", "Signing profile whose anchors to plan (default: the config's default_profile)")
+	planCmd.Flags().StringVar(&planAnchors, "anchors", "", "Anchor profile (all|invisible|visual) or anchor list; overrides --profile")
+	planCmd.Flags().BoolVar(&planIncremental, "incremental", false, "Plan an incremental update (sign --incremental)")
+
+	// Serve command flags
+	serveCmd.Flags().StringVar(&serveAddr, "addr", "127.0.0.1:8080", "Listen address")
+	serveCmd.Flags().StringVarP(&key, "key", "k", "", "32-byte key (optional if DEFAULT_KEY env is set)")
+	serveCmd.Flags().Int64Var(&serveMaxSizeMB, "max-size", server.DefaultMaxUploadBytes>>20, "Maximum request size in MB")
+	serveCmd.Flags().IntVar(&serveMaxConcurrent, "max-concurrent", 4, "Maximum simultaneous sign/verify operations (0 = unlimited)")
+	serveCmd.Flags().DurationVar(&serveSignTimeout, "sign-timeout", 0, "Time limit per sign request, e.g. 2m (0 = unlimited)")
+	serveCmd.Flags().DurationVar(&serveReadTimeout, "read-timeout", server.DefaultReadTimeout, "Time limit for receiving a request body, waiting for a slot included")
+	addLimitFlags(serveCmd)
+	_ = traceCmd.MarkFlagRequired("file")
+}
+
+// resolveKey returns the key from the flag, falling back to the DEFAULT_KEY env
+func resolveKey(flagKey string) (string, error) {
+	if flagKey != "" {
+		return flagKey, nil
+	}
+	envKey := os.Getenv("DEFAULT_KEY")
+	if envKey == "" {
+		return "", fmt.Errorf("required flag --key is missing and DEFAULT_KEY env not set")
+	}
+	fmt.Fprintln(status, "ℹ️  Using key from environment variable DEFAULT_KEY")
+	return envKey, nil
 }
 
 func Execute() error {
@@ -269,7 +526,10 @@ func main() {
 	loadEnv()
 	setupCommands()
 	if err := Execute(); err != nil {
-		fmt.Fprintf(os.Stderr, "\n❌ Error: %v\n", err)
-		os.Exit(1)
+		var reported *reportedError
+		if !errors.As(err, &reported) {
+			fmt.Fprintf(os.Stderr, "\n❌ Error: %v\n", err)
+		}
+		os.Exit(exitCode(err))
 	}
 }
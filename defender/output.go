@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+
+	"defender/injector"
+
+	"github.com/spf13/cobra"
+)
+
+// Exit codes of sign, verify and init-key. They are part of the CLI contract.
+const (
+	exitOK = 0
+	// exitError covers usage, configuration and signing errors
+	exitError = 1
+	// exitNoPayload: no anchor carries a tracking payload
+	exitNoPayload = 2
+	// exitDecryptFailed: a payload was found but the key does not decrypt it
+	exitDecryptFailed = 3
+	// exitIOError: a file could not be read or written
+	exitIOError = 4
+	// exitLimitExceeded: the file exceeded a resource limit before it was fully examined
+	exitLimitExceeded = 5
+	// exitModified: the message verified but pages changed since tamper-evident signing
+	exitModified = 6
+)
+
+// errPagesModified reports a tamper-evident copy whose pages changed after signing
+var errPagesModified = errors.New("document was modified after signing")
+
+const (
+	formatText = "text"
+	formatJSON = "json"
+)
+
+var outputFormat string
+
+// cliResult is the JSON object printed by sign, verify and init-key with --format json
+type cliResult struct {
+	Command  string `json:"command"`
+	OK       bool   `json:"ok"`
+	ExitCode int    `json:"exit_code"`
+	File     string `json:"file,omitempty"`
+	// Output is the signed copy (sign) or the updated .env file (init-key)
+	Output  string `json:"output,omitempty"`
+	Profile string `json:"profile,omitempty"`
+	// Anchors lists the anchors injected (sign) or verified (verify)
+	Anchors []string `json:"anchors,omitempty"`
+	Message string   `json:"message,omitempty"`
+	KeyID   string   `json:"key_id,omitempty"`
+	// Notes lists the anchors the injection plan skipped or substituted
+	Notes []string `json:"notes,omitempty"`
+	// Results has one entry per anchor tried by verify --mode all
+	Results []anchorResult `json:"results,omitempty"`
+	// Limit is the resource limit verify stopped at
+	Limit *injector.LimitError `json:"limit,omitempty"`
+	// TamperEvident reports that sign sealed page digests into the payload
+	TamperEvident bool `json:"tamper_evident,omitempty"`
+	// PDFA is the PDF/A level the signed copy was checked against (sign)
+	PDFA string `json:"pdfa,omitempty"`
+	// Integrity compares the pages with the digests sealed at signing (verify)
+	Integrity *injector.IntegrityReport `json:"integrity,omitempty"`
+	Error     string                    `json:"error,omitempty"`
+}
+
+// anchorResult is the outcome of one anchor in verify --mode all
+type anchorResult struct {
+	Anchor string `json:"anchor"`
+	// Status is verified, not_found, decrypt_failed or limit_exceeded
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// reportedError is an error already reported as JSON; main only sets the exit code
+type reportedError struct {
+	err error
+}
+
+func (e *reportedError) Error() string { return e.err.Error() }
+func (e *reportedError) Unwrap() error { return e.err }
+
+// exitCode maps an error to the documented exit codes
+func exitCode(err error) int {
+	var pathErr *fs.PathError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, injector.ErrLimitExceeded):
+		return exitLimitExceeded
+	case errors.Is(err, errPagesModified):
+		return exitModified
+	case errors.Is(err, injector.ErrNoPayload):
+		return exitNoPayload
+	case errors.Is(err, injector.ErrDecryptFailed):
+		return exitDecryptFailed
+	case errors.Is(err, injector.ErrFileNotFound), errors.As(err, &pathErr):
+		return exitIOError
+	default:
+		return exitError
+	}
+}
+
+// addFormatFlag registers --format on cmd. It is not --output because sign's
+// -o/--output already names the signed PDF.
+func addFormatFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&outputFormat, "format", formatText, "Output format: text|json (json prints one object on stdout; --output is the signed PDF path)")
+}
+
+// status receives the progress lines of sign, verify and init-key. It is
+// stderr while stdout carries a signed PDF or a JSON result.
+var status io.Writer = os.Stdout
+
+// redirectStatus sends status output to w and returns a func restoring it
+func redirectStatus(w io.Writer) func() {
+	prev := status
+	status = w
+	return func() { status = prev }
+}
+
+// runFormatted runs a command body. In JSON mode the command's progress lines
+// go to stderr and stdout carries only the JSON result.
+func runFormatted(cmd *cobra.Command, res *cliResult, run func() error) error {
+	switch outputFormat {
+	case formatText:
+		return run()
+	case formatJSON:
+	default:
+		return fmt.Errorf("unknown format %q (use text or json)", outputFormat)
+	}
+
+	cmd.SilenceErrors = true
+	cmd.SilenceUsage = true
+	restore := redirectStatus(os.Stderr)
+	err := run()
+	restore()
+
+	res.Command = cmd.Name()
+	res.ExitCode = exitCode(err)
+	res.OK = err == nil
+	if err != nil {
+		res.Error = err.Error()
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if encErr := enc.Encode(res); encErr != nil {
+		return encErr
+	}
+	if err != nil {
+		return &reportedError{err}
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// Environment variables read when the password flags are not set, so
+// passwords need not appear in the process list or shell history
+const (
+	envUserPassword  = "DEFENDER_USER_PASSWORD"
+	envOwnerPassword = "DEFENDER_OWNER_PASSWORD"
+)
+
+var (
+	userPassword  string
+	ownerPassword string
+)
+
+// addPasswordFlags registers the flags that open encrypted PDFs
+func addPasswordFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&userPassword, "user-password", "", "User (open) password of an encrypted PDF (default: $"+envUserPassword+")")
+	cmd.Flags().StringVar(&ownerPassword, "owner-password", "", "Owner password of an encrypted PDF (default: $"+envOwnerPassword+")")
+}
+
+// passwordsFromFlags returns the passwords set by addPasswordFlags,
+// falling back to the environment
+func passwordsFromFlags() (user, owner string) {
+	user, owner = userPassword, ownerPassword
+	if user == "" {
+		user = os.Getenv(envUserPassword)
+	}
+	if owner == "" {
+		owner = os.Getenv(envOwnerPassword)
+	}
+	return user, owner
+}
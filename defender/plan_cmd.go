@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"defender/injector"
+
+	"github.com/spf13/cobra"
+)
+
+// planSampleMessage sizes the payload when plan is run without --msg
+const planSampleMessage = "UserID:0000000000"
+
+var (
+	planProfile     string
+	planAnchors     string
+	planIncremental bool
+)
+
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Show which anchors a PDF can carry and the resulting injection plan",
+	Long: `The plan command parses the PDF once and evaluates every anchor: whether the
+document can carry it, the estimated size overhead and how robust it is
+against cleaning. It then prints the injection plan sign would follow:
+anchors the PDF cannot carry are skipped, and invisible anchors are replaced
+by an available alternative where possible.
+
+The anchors come from --anchors, else from the signing profile (--profile).
+
+Example:
+  defender plan -f report.pdf
+  defender plan -f slides.pdf -m "UserID:42" --anchors SMask,Visual`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if filePath == "" {
+			return fmt.Errorf("required flag --file is missing")
+		}
+
+		var anchors []string
+		var err error
+		if planAnchors != "" {
+			anchors, err = injector.ParseAnchorProfile(planAnchors)
+		} else {
+			anchors, err = profileAnchors(planProfile)
+		}
+		if err != nil {
+			return err
+		}
+
+		msg := message
+		if msg == "" {
+			msg = planSampleMessage
+		}
+		planSign := injector.PlanSign
+		if planIncremental {
+			planSign = injector.PlanSignIncremental
+		}
+		plan, err := planSign(filePath, msg, anchors)
+		if err != nil {
+			return fmt.Errorf("plan failed: %w", err)
+		}
+		printPlan(plan, message == "")
+		return nil
+	},
+}
+
+// profileAnchors returns the anchors of a signing profile
+func profileAnchors(name string) ([]string, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	profile, err := cfg.Profile(name)
+	if err != nil {
+		return nil, err
+	}
+	return profile.Anchors, nil
+}
+
+// printPlan prints the anchor estimates and the injection plan
+func printPlan(p *injector.Plan, sampleMessage bool) {
+	fmt.Printf("🧭 Defender Injection Plan\n")
+	fmt.Printf("   File: %s (%s)\n", p.File, formatBytes(p.FileSize))
+	fmt.Printf("   Pages: %d, images: %d\n", p.PageCount, p.ImageCount)
+	if p.Incremental {
+		fmt.Printf("   Incremental update: existing bytes and signatures are kept\n")
+	}
+	if p.PDFA != "" {
+		fmt.Printf("   PDF/A: %s claimed; anchors are restricted to compliant ones\n", p.PDFA)
+	}
+	if sampleMessage {
+		fmt.Printf("   Payload sized for a %d-byte message (use --msg for yours)\n", len(planSampleMessage))
+	}
+	fmt.Println()
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ANCHOR\tAVAILABLE\tOVERHEAD\tROBUSTNESS\tNOTE")
+	for _, e := range p.Estimates {
+		available, overhead, note := "yes", "?", e.RobustnessNote
+		if !e.Available {
+			available, overhead, note = "no", "-", e.Reason
+		} else if e.OverheadBytes >= 0 {
+			overhead = "~" + formatBytes(int64(e.OverheadBytes))
+		}
+		robustness := string(e.Robustness)
+		if robustness == "" {
+			robustness = "?"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", e.Name, available, overhead, robustness, note)
+	}
+	tw.Flush()
+
+	fmt.Printf("\nRequested: %s\n", strings.Join(p.Requested, " + "))
+	for _, note := range p.Notes() {
+		fmt.Printf("   Note: %s\n", note)
+	}
+	if len(p.Anchors) == 0 {
+		fmt.Println("Plan: ✗ no requested anchor can be used with this PDF")
+		return
+	}
+	fmt.Printf("Plan: %s (estimated overhead ~%s)\n", strings.Join(p.Anchors, " → "), formatBytes(int64(p.OverheadBytes)))
+}
+
+// formatBytes renders a byte count as B, KB or MB
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
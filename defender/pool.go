@@ -0,0 +1,50 @@
+package main
+
+import (
+	"runtime"
+	"sync"
+)
+
+// workerCount returns how many workers to use for n tasks.
+// jobs <= 0 means one worker per CPU.
+func workerCount(jobs, n int) int {
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+	if jobs > n {
+		jobs = n
+	}
+	if jobs < 1 {
+		jobs = 1
+	}
+	return jobs
+}
+
+// runPool calls fn(i) for every i in [0, n) on at most jobs concurrent workers
+// and returns when all calls have finished.
+func runPool(jobs, n int, fn func(i int)) {
+	workers := workerCount(jobs, n)
+	if workers == 1 {
+		for i := 0; i < n; i++ {
+			fn(i)
+		}
+		return
+	}
+
+	tasks := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range tasks {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		tasks <- i
+	}
+	close(tasks)
+	wg.Wait()
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"defender/config"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	configPath  string
+	signProfile string
+)
+
+var profilesCmd = &cobra.Command{
+	Use:   "profiles",
+	Short: "List the signing profiles of the configuration file",
+	Long: `Signing profiles bundle anchors, Visual watermark style, a key reference
+and output naming under a name that can be passed to sign --profile or picked
+in interactive mode. The built-in profiles stealth, deterrent and contract are
+always available; more are defined in the configuration file at --config,
+$DEFENDER_CONFIG or <user config dir>/defender/config.yaml.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		if cfg.Path != "" {
+			fmt.Printf("Config: %s\n\n", cfg.Path)
+		} else {
+			fmt.Printf("Config: (none, built-in profiles only)\n\n")
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "PROFILE\tANCHORS\tKEY\tOUTPUT\tDESCRIPTION")
+		for _, name := range cfg.ProfileNames() {
+			p, err := cfg.Profile(name)
+			if err != nil {
+				return err
+			}
+			anchors := "default"
+			if len(p.Anchors) > 0 {
+				anchors = strings.Join(p.Anchors, "+")
+			}
+			keyName := p.KeyName
+			if keyName == "" {
+				keyName = "-"
+			}
+			if name == cfg.DefaultProfileName() {
+				name += " (default)"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", name, anchors, keyName, p.Output, p.Description)
+		}
+		return tw.Flush()
+	},
+}
+
+// setupProfileCommands registers the profiles command and the global --config flag
+func setupProfileCommands() {
+	rootCmd.AddCommand(profilesCmd)
+	rootCmd.Flags().StringVarP(&signProfile, "profile", "p", "", "Signing profile preselected in interactive mode")
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", "", "Config file with signing profiles (default: $DEFENDER_CONFIG or user config dir)")
+}
+
+// loadConfig loads the configuration file selected by --config
+func loadConfig() (*config.Config, error) {
+	return config.Load(configPath)
+}
+
+// resolveProfileKey returns the key for signing with profile p:
+// the --key flag, then the profile's key reference, then DEFAULT_KEY
+func resolveProfileKey(flagKey string, p *config.Resolved) (string, error) {
+	if flagKey != "" || !p.HasKey() {
+		return resolveKey(flagKey)
+	}
+	k, err := p.Key()
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(status, "ℹ️  Using key %q from profile %s\n", p.KeyName, p.Name)
+	return k, nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"defender/injector"
+)
+
+// consoleEvents prints the progress of sign and verify as text lines:
+// progress on status, warnings on stderr. Anchors a verification tries
+// without finding the payload are not reported; the result names the one
+// that succeeded.
+type consoleEvents struct{}
+
+func (consoleEvents) HandleEvent(e injector.Event) {
+	switch e.Type {
+	case injector.EventNote:
+		if e.Warning {
+			fmt.Fprintf(os.Stderr, "⚠ Warning: %s\n", e.Message)
+		} else {
+			fmt.Fprintf(status, "[*] %s\n", e.Message)
+		}
+	case injector.EventAnchorStarted:
+		if !e.Verify {
+			fmt.Fprintf(status, "[*] Injecting Anchor %d/%d: %s...\n", e.Index, e.Total, e.Anchor)
+		}
+	case injector.EventAnchorFinished:
+		if e.Verify {
+			fmt.Fprintf(status, "✓ Verified via %s\n", e.Anchor)
+		} else {
+			fmt.Fprintf(status, "✓ Anchor %s embedded\n", e.Anchor)
+		}
+	case injector.EventAnchorFailed:
+		if !e.Verify {
+			fmt.Fprintf(os.Stderr, "⚠ Warning: %s injection failed: %v\n", e.Anchor, e.Err)
+		}
+	}
+}
+
+// progressBarWidth is the number of cells in the interactive progress bar
+const progressBarWidth = 30
+
+// progressBar renders sign and verify events as one updating line, e.g.
+//
+//	[##########--------------------]  33%  Content  page 120/500
+//
+// Notes and failed anchors are printed above it.
+type progressBar struct {
+	w io.Writer
+	// index and total place the running anchor in the chain
+	index, total int
+	anchor       string
+	// done is the fraction of the running anchor's pages done
+	done   float64
+	detail string
+	// line is the line on screen, empty when there is none
+	line string
+}
+
+func newProgressBar(w io.Writer) *progressBar {
+	return &progressBar{w: w}
+}
+
+func (p *progressBar) HandleEvent(e injector.Event) {
+	switch e.Type {
+	case injector.EventAnchorStarted:
+		p.index, p.total, p.anchor = e.Index, e.Total, e.Anchor
+		p.done, p.detail = 0, ""
+	case injector.EventPageProgress:
+		if e.Pages == 0 {
+			return
+		}
+		if e.Anchor == "" {
+			// Page digests are taken before the first anchor or after the last
+			p.anchor = "Digest"
+		}
+		p.done = float64(e.Page) / float64(e.Pages)
+		p.detail = fmt.Sprintf("page %d/%d", e.Page, e.Pages)
+	case injector.EventAnchorFinished:
+		if e.Verify {
+			// One verified anchor ends the verification
+			p.index = p.total
+		}
+		p.done, p.detail = 1, "✓"
+	case injector.EventAnchorFailed:
+		p.println(fmt.Sprintf(ColorYellow+"[WARNING] %s failed: %v"+ColorReset, e.Anchor, e.Err))
+		p.done, p.detail = 1, "✗"
+	case injector.EventNote:
+		if e.Warning {
+			p.println(ColorYellow + "[WARNING] " + e.Message + ColorReset)
+		} else {
+			p.println("[*] " + e.Message)
+		}
+		if p.total == 0 {
+			return
+		}
+	case injector.EventBytesWritten:
+		p.index, p.total, p.done = 1, 1, 1
+		p.anchor, p.detail = "Written", fmt.Sprintf("%d KB", (e.Bytes+1023)/1024)
+	}
+	p.draw()
+}
+
+// percent is the share of the whole chain done
+func (p *progressBar) percent() int {
+	if p.total == 0 {
+		return 0
+	}
+	return int((float64(p.index-1) + p.done) / float64(p.total) * 100)
+}
+
+func (p *progressBar) draw() {
+	pct := p.percent()
+	filled := pct * progressBarWidth / 100
+	line := fmt.Sprintf("[%s%s] %3d%%  %s  %s", strings.Repeat("#", filled), strings.Repeat("-", progressBarWidth-filled), pct, p.anchor, p.detail)
+	if line == p.line {
+		return
+	}
+	// Pad over the rest of a longer previous line
+	pad := len(p.line) - len(line)
+	if pad < 0 {
+		pad = 0
+	}
+	fmt.Fprintf(p.w, "\r%s%s", line, strings.Repeat(" ", pad))
+	p.line = line
+}
+
+// println prints s on a line of its own above the bar
+func (p *progressBar) println(s string) {
+	if p.line != "" {
+		fmt.Fprintf(p.w, "\r%s\r", strings.Repeat(" ", len(p.line)))
+		p.line = ""
+	}
+	fmt.Fprintln(p.w, s)
+}
+
+// Finish ends the bar's line once the operation has returned
+func (p *progressBar) Finish() {
+	if p.line != "" {
+		fmt.Fprintln(p.w)
+		p.line = ""
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"defender/server"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	serveAddr          string
+	serveMaxSizeMB     int64
+	serveMaxConcurrent int
+	serveSignTimeout   time.Duration
+	serveReadTimeout   time.Duration
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve sign and verify over HTTP for document portals",
+	Long: `The serve command starts a local HTTP server:
+
+  POST /sign     multipart: file, message, [recipient], [profile] -> signed PDF
+  POST /verify   multipart: file                                  -> JSON report
+  GET  /healthz                                                   -> ok
+
+The key comes from --key or DEFAULT_KEY only. Requests that carry a key
+(a "key" form field or an X-Defender-Key header) are rejected. Every signed
+copy is recorded in the issuance ledger unless --no-ledger is set.
+
+Example:
+  defender serve --addr 127.0.0.1:8080 --max-size 20
+  curl -F file=@report.pdf -F message=UserID:42 -F recipient=Alice \
+       -o report_signed.pdf http://127.0.0.1:8080/sign`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		resolvedKey, err := resolveKey(key)
+		if err != nil {
+			return err
+		}
+		if serveMaxSizeMB <= 0 {
+			return fmt.Errorf("--max-size must be positive")
+		}
+		if serveSignTimeout < 0 {
+			return fmt.Errorf("--sign-timeout must not be negative")
+		}
+		if serveReadTimeout <= 0 {
+			return fmt.Errorf("--read-timeout must be positive")
+		}
+		limits, err := limitsFromFlags()
+		if err != nil {
+			return err
+		}
+
+		issuance, err := openLedger()
+		if err != nil {
+			return fmt.Errorf("failed to open ledger: %w", err)
+		}
+
+		handler, err := server.New(server.Config{
+			Key:            resolvedKey,
+			MaxUploadBytes: serveMaxSizeMB << 20,
+			Ledger:         issuance,
+			Operator:       currentOperator(),
+			MaxConcurrent:  serveMaxConcurrent,
+			Limits:         &limits,
+			SignTimeout:    serveSignTimeout,
+			ReadTimeout:    serveReadTimeout,
+		})
+		if err != nil {
+			return err
+		}
+
+		srv := &http.Server{
+			Addr:              serveAddr,
+			Handler:           handler,
+			ReadHeaderTimeout: 10 * time.Second,
+			// The handler sets each upload's deadline; this bounds other requests
+			ReadTimeout: serveReadTimeout,
+		}
+
+		fmt.Printf("🌐 Defender HTTP Server\n")
+		fmt.Printf("   Listening: http://%s\n", serveAddr)
+		fmt.Printf("   Max upload: %d MB\n", serveMaxSizeMB)
+		if issuance != nil {
+			fmt.Printf("   Ledger: %s\n", issuance.Path())
+		}
+		fmt.Println()
+
+		errCh := make(chan error, 1)
+		go func() { errCh <- srv.ListenAndServe() }()
+
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(stop)
+
+		select {
+		case err := <-errCh:
+			return fmt.Errorf("server failed: %w", err)
+		case <-stop:
+		}
+
+		log.Printf("Shutting down, waiting for in-flight requests...")
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			return fmt.Errorf("shutdown failed: %w", err)
+		}
+		if err := <-errCh; err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	},
+}
@@ -0,0 +1,74 @@
+//go:build integration
+// +build integration
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"defender/ledger"
+)
+
+const testPDFPath = "../testdata/2511.17467v2.pdf"
+
+// TestSignVerifyRoundTrip signs over HTTP, then verifies the returned copy.
+// Uploads are handled in memory: nothing is written to the temp directory.
+func TestSignVerifyRoundTrip(t *testing.T) {
+	pdf, err := os.ReadFile(testPDFPath)
+	if err != nil {
+		t.Skip("Test PDF not found, skipping integration test")
+	}
+
+	l, err := ledger.Open(filepath.Join(t.TempDir(), ledger.FileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	srv := newTestServer(t, Config{Ledger: l, Operator: "portal", MaxConcurrent: 2})
+
+	body, contentType := multipartBody(t, map[string]string{"message": "UserID:77", "recipient": "Bob", "profile": "invisible"}, pdf)
+	resp, err := http.Post(srv.URL+"/sign", contentType, body)
+	if err != nil {
+		t.Fatalf("Sign request failed: %v", err)
+	}
+	signed, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/pdf" {
+		t.Fatalf("Sign failed: %d %s", resp.StatusCode, signed)
+	}
+	if !bytes.HasPrefix(signed, []byte("%PDF")) {
+		t.Fatal("Response is not a PDF")
+	}
+	if got := resp.Header.Get("X-Defender-Anchors"); got != "Attachment,SMask,Content" {
+		t.Errorf("Anchors header mismatch: %q", got)
+	}
+
+	records, err := l.Records(ledger.Filter{Recipient: "Bob"})
+	if err != nil || len(records) != 1 || records[0].OutputSHA256 != resp.Header.Get("X-Defender-SHA256") || records[0].SourceSHA256 != ledger.SHA256(pdf) || records[0].Operator != "portal" {
+		t.Errorf("Unexpected ledger records: %+v, %v", records, err)
+	}
+
+	body, contentType = multipartBody(t, nil, signed)
+	resp, err = http.Post(srv.URL+"/verify", contentType, body)
+	if err != nil {
+		t.Fatalf("Verify request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var report VerifyReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		t.Fatalf("Invalid verify report: %v", err)
+	}
+	if !report.Verified || report.Message != "UserID:77" || report.SHA256 != ledger.SHA256(signed) {
+		t.Errorf("Unexpected verify report: %+v", report)
+	}
+	if entries, err := os.ReadDir(tmp); err != nil || len(entries) != 0 {
+		t.Errorf("Requests wrote %d files to the temp directory: %v", len(entries), err)
+	}
+}
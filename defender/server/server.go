@@ -0,0 +1,291 @@
+// Package server exposes sign and verify over HTTP for document portals.
+//
+//	POST /sign    multipart: file (PDF), message, [recipient], [profile] -> signed PDF
+//	POST /verify  multipart: file (PDF)                                 -> JSON report
+//	GET  /healthz                                                       -> 200 ok
+//
+// The key always comes from the server configuration; requests carrying a key are rejected.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"defender/injector"
+	"defender/ledger"
+)
+
+// DefaultMaxUploadBytes is the default request size limit (50 MiB)
+const DefaultMaxUploadBytes = 50 << 20
+
+// DefaultReadTimeout is the default time limit for receiving a request body
+const DefaultReadTimeout = 2 * time.Minute
+
+// Config configures the HTTP handler
+type Config struct {
+	// Key is the 32-byte signing and verification key
+	Key string
+	// MaxUploadBytes limits the request body size (DefaultMaxUploadBytes if zero)
+	MaxUploadBytes int64
+	// Ledger records every signed copy (optional)
+	Ledger *ledger.Ledger
+	// Operator is recorded in the ledger for copies signed by this server
+	Operator string
+	// MaxConcurrent limits simultaneous sign/verify operations (unlimited if zero)
+	MaxConcurrent int
+	// ReadTimeout bounds the time from a request's arrival to the end of its
+	// body, waiting for a slot included (DefaultReadTimeout if zero)
+	ReadTimeout time.Duration
+	// Limits bounds the resources verifying one upload may use (injector.DefaultLimits if nil)
+	Limits *injector.Limits
+	// SignTimeout bounds the time signing one upload may take (unlimited if zero)
+	SignTimeout time.Duration
+	// Logger receives one line per request (log.Default() if nil)
+	Logger *log.Logger
+}
+
+// VerifyReport is the JSON body returned by POST /verify
+type VerifyReport struct {
+	File     string `json:"file"`
+	SHA256   string `json:"sha256"`
+	Verified bool   `json:"verified"`
+	Message  string `json:"message,omitempty"`
+	Anchor   string `json:"anchor,omitempty"`
+	Error    string `json:"error,omitempty"`
+	// Limit is set when the upload exceeded a resource limit
+	Limit *injector.LimitError `json:"limit,omitempty"`
+	// Integrity is set for copies signed with tamper evidence
+	Integrity *injector.IntegrityReport `json:"integrity,omitempty"`
+}
+
+// errorBody is the JSON body of every error response
+type errorBody struct {
+	Error string `json:"error"`
+}
+
+type handler struct {
+	cfg   Config
+	slots chan struct{}
+}
+
+// New returns the HTTP handler serving /sign, /verify and /healthz
+func New(cfg Config) (http.Handler, error) {
+	if len(cfg.Key) != 32 {
+		return nil, injector.ErrInvalidKeySize
+	}
+	if cfg.MaxUploadBytes <= 0 {
+		cfg.MaxUploadBytes = DefaultMaxUploadBytes
+	}
+	if cfg.ReadTimeout <= 0 {
+		cfg.ReadTimeout = DefaultReadTimeout
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = log.Default()
+	}
+
+	h := &handler{cfg: cfg}
+	if cfg.MaxConcurrent > 0 {
+		h.slots = make(chan struct{}, cfg.MaxConcurrent)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sign", h.post(h.sign))
+	mux.HandleFunc("/verify", h.post(h.verify))
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(w, "ok\n")
+	})
+	return mux, nil
+}
+
+// post wraps an operation: method check, read deadline, concurrency limit,
+// size limit, multipart parsing, key rejection and reading the upload. Uploads are held in
+// memory and never written to disk.
+func (h *handler) post(op func(w http.ResponseWriter, r *http.Request, upload []byte, name string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			h.fail(w, r, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+
+		// A client sending its body slowly must not hold a slot indefinitely.
+		// Recorders in tests do not support deadlines.
+		rc := http.NewResponseController(w)
+		if err := rc.SetReadDeadline(time.Now().Add(h.cfg.ReadTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			h.fail(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		// Take a slot before reading the body: uploads are held in memory, so
+		// MaxConcurrent also bounds the memory they use
+		if h.slots != nil {
+			select {
+			case h.slots <- struct{}{}:
+				defer func() { <-h.slots }()
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, h.cfg.MaxUploadBytes)
+		// The whole body fits the memory limit, so no part spills to disk
+		if err := r.ParseMultipartForm(h.cfg.MaxUploadBytes); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				h.fail(w, r, http.StatusRequestEntityTooLarge, fmt.Errorf("request exceeds %d bytes", h.cfg.MaxUploadBytes))
+				return
+			}
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				h.fail(w, r, http.StatusRequestTimeout, fmt.Errorf("request body not received within %v", h.cfg.ReadTimeout))
+				return
+			}
+			h.fail(w, r, http.StatusBadRequest, fmt.Errorf("invalid multipart form: %w", err))
+			return
+		}
+		defer r.MultipartForm.RemoveAll()
+
+		if r.MultipartForm.Value["key"] != nil || r.Header.Get("X-Defender-Key") != "" {
+			h.fail(w, r, http.StatusBadRequest, errors.New("keys are configured on the server and must not be sent"))
+			return
+		}
+
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			h.fail(w, r, http.StatusBadRequest, errors.New("missing 'file' part"))
+			return
+		}
+		defer file.Close()
+
+		upload, err := io.ReadAll(file)
+		if err != nil {
+			h.fail(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		op(w, r, upload, uploadName(header))
+	}
+}
+
+// sign handles POST /sign
+func (h *handler) sign(w http.ResponseWriter, r *http.Request, upload []byte, name string) {
+	message := strings.TrimSpace(r.FormValue("message"))
+	if message == "" {
+		h.fail(w, r, http.StatusBadRequest, errors.New("missing 'message' field"))
+		return
+	}
+	recipient := strings.TrimSpace(r.FormValue("recipient"))
+
+	anchors, err := injector.ParseAnchorProfile(r.FormValue("profile"))
+	if err != nil {
+		h.fail(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	// Signing stops when the client goes away or the sign timeout passes
+	ctx := r.Context()
+	if h.cfg.SignTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.cfg.SignTimeout)
+		defer cancel()
+	}
+	opts := injector.SignOptions{
+		Anchors: anchors,
+		Ledger:  h.cfg.Ledger,
+		Issuance: ledger.Record{
+			Operator:   h.cfg.Operator,
+			SourceFile: name,
+			OutputFile: signedName(name),
+			Recipient:  recipient,
+		},
+	}
+	signed, result, err := injector.SignBytes(ctx, upload, message, h.cfg.Key, opts)
+	if errors.Is(err, context.Canceled) {
+		h.cfg.Logger.Printf("%s %s: client went away, signing stopped", r.Method, r.URL.Path)
+		return
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		h.fail(w, r, http.StatusServiceUnavailable, fmt.Errorf("sign failed: took longer than %v", h.cfg.SignTimeout))
+		return
+	}
+	if errors.Is(err, injector.ErrLedgerRecord) {
+		// The copy was not recorded, so it is not handed out
+		h.fail(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	if err != nil {
+		h.fail(w, r, http.StatusUnprocessableEntity, fmt.Errorf("sign failed: %w", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Length", strconv.Itoa(len(signed)))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", signedName(name)))
+	w.Header().Set("X-Defender-Anchors", strings.Join(result.Anchors, ","))
+	w.Header().Set("X-Defender-SHA256", ledger.SHA256(signed))
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(signed); err != nil {
+		h.cfg.Logger.Printf("%s %s: failed to send response: %v", r.Method, r.URL.Path, err)
+		return
+	}
+	h.cfg.Logger.Printf("%s %s 200 %s anchors=%s", r.Method, r.URL.Path, name, strings.Join(result.Anchors, "+"))
+}
+
+// verify handles POST /verify. Files without a valid mark are reported with
+// verified=false and status 200; only malformed requests are errors.
+func (h *handler) verify(w http.ResponseWriter, r *http.Request, upload []byte, name string) {
+	report := VerifyReport{File: name, SHA256: ledger.SHA256(upload)}
+	res, err := injector.VerifyBytes(r.Context(), upload, h.cfg.Key, injector.VerifyOptions{Limits: h.cfg.Limits})
+	if err != nil {
+		report.Error = err.Error()
+		errors.As(err, &report.Limit)
+	} else {
+		report.Verified = true
+		report.Message = res.Message
+		report.Anchor = res.Anchor
+		report.Integrity = res.Integrity
+	}
+
+	writeJSON(w, http.StatusOK, &report)
+	h.cfg.Logger.Printf("%s %s 200 %s verified=%v", r.Method, r.URL.Path, name, report.Verified)
+}
+
+// fail writes a JSON error response and logs it
+func (h *handler) fail(w http.ResponseWriter, r *http.Request, status int, err error) {
+	h.cfg.Logger.Printf("%s %s %d %v", r.Method, r.URL.Path, status, err)
+	writeJSON(w, status, errorBody{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// uploadName returns the client's file name without any directory part
+func uploadName(header *multipart.FileHeader) string {
+	name := filepath.Base(strings.ReplaceAll(header.Filename, "\\", "/"))
+	if name == "." || name == "/" || name == "" {
+		name = "document.pdf"
+	}
+	return name
+}
+
+// signedName returns the download name of a signed copy
+func signedName(name string) string {
+	ext := filepath.Ext(name)
+	return strings.TrimSuffix(name, ext) + "_signed.pdf"
+}
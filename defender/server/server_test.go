@@ -0,0 +1,229 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testKey32 = "12345678901234567890123456789012"
+
+// multipartBody builds a multipart form with the given fields and an optional file part
+func multipartBody(t *testing.T, fields map[string]string, fileData []byte) (io.Reader, string) {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for k, v := range fields {
+		if err := mw.WriteField(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fileData != nil {
+		fw, err := mw.CreateFormFile("file", "report.pdf")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(fileData)
+	}
+	mw.Close()
+	return &buf, mw.FormDataContentType()
+}
+
+func newTestServer(t *testing.T, cfg Config) *httptest.Server {
+	t.Helper()
+	if cfg.Key == "" {
+		cfg.Key = testKey32
+	}
+	cfg.Logger = log.New(io.Discard, "", 0)
+	h, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// TestNewRejectsBadKey tests that the server refuses to start without a valid key
+func TestNewRejectsBadKey(t *testing.T) {
+	if _, err := New(Config{Key: "short"}); err == nil {
+		t.Error("Expected error for short key")
+	}
+}
+
+// TestRequestValidation tests the error responses that need no PDF processing
+func TestRequestValidation(t *testing.T) {
+	srv := newTestServer(t, Config{MaxUploadBytes: 1024})
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		fields   map[string]string
+		file     []byte
+		header   map[string]string
+		status   int
+		errorHas string
+	}{
+		{name: "GET not allowed", method: http.MethodGet, path: "/sign", status: http.StatusMethodNotAllowed},
+		{name: "Missing file", method: http.MethodPost, path: "/verify", fields: map[string]string{"message": "x"}, status: http.StatusBadRequest, errorHas: "file"},
+		{name: "Key in form rejected", method: http.MethodPost, path: "/sign", fields: map[string]string{"message": "x", "key": testKey32}, file: []byte("%PDF"), status: http.StatusBadRequest, errorHas: "must not be sent"},
+		{name: "Key in header rejected", method: http.MethodPost, path: "/verify", file: []byte("%PDF"), header: map[string]string{"X-Defender-Key": testKey32}, status: http.StatusBadRequest, errorHas: "must not be sent"},
+		{name: "Missing message", method: http.MethodPost, path: "/sign", file: []byte("%PDF"), status: http.StatusBadRequest, errorHas: "message"},
+		{name: "Unknown profile", method: http.MethodPost, path: "/sign", fields: map[string]string{"message": "x", "profile": "Bogus"}, file: []byte("%PDF"), status: http.StatusBadRequest, errorHas: "Bogus"},
+		{name: "Too large", method: http.MethodPost, path: "/verify", file: bytes.Repeat([]byte("x"), 4096), status: http.StatusRequestEntityTooLarge},
+		{name: "Not a PDF", method: http.MethodPost, path: "/sign", fields: map[string]string{"message": "x"}, file: []byte("hello"), status: http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, contentType := multipartBody(t, tt.fields, tt.file)
+			req, err := http.NewRequest(tt.method, srv.URL+tt.path, body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", contentType)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.status {
+				t.Fatalf("Status mismatch: got %d, want %d", resp.StatusCode, tt.status)
+			}
+			var e errorBody
+			if err := json.NewDecoder(resp.Body).Decode(&e); err != nil || e.Error == "" {
+				t.Fatalf("Expected JSON error body, got %v", err)
+			}
+			if tt.errorHas != "" && !strings.Contains(e.Error, tt.errorHas) {
+				t.Errorf("Error %q does not mention %q", e.Error, tt.errorHas)
+			}
+		})
+	}
+}
+
+// TestSignTimeout tests that a sign request exceeding SignTimeout is refused
+func TestSignTimeout(t *testing.T) {
+	srv := newTestServer(t, Config{SignTimeout: time.Nanosecond})
+	body, contentType := multipartBody(t, map[string]string{"message": "x"}, []byte("%PDF"))
+	resp, err := http.Post(srv.URL+"/sign", contentType, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("Status mismatch: got %d, want %d", resp.StatusCode, http.StatusServiceUnavailable)
+	}
+	var e errorBody
+	if err := json.NewDecoder(resp.Body).Decode(&e); err != nil || !strings.Contains(e.Error, "took longer") {
+		t.Errorf("Error body = %+v, %v", e, err)
+	}
+}
+
+// readWatcher records whether a request body was read
+type readWatcher struct {
+	io.Reader
+	read bool
+}
+
+func (r *readWatcher) Read(p []byte) (int, error) {
+	r.read = true
+	return r.Reader.Read(p)
+}
+
+// TestConcurrencyLimitBeforeUpload tests that a request waiting for a slot
+// does not read its upload into memory
+func TestConcurrencyLimitBeforeUpload(t *testing.T) {
+	h := &handler{cfg: Config{Key: testKey32, MaxUploadBytes: 1 << 20, Logger: log.New(io.Discard, "", 0)}, slots: make(chan struct{}, 1)}
+	h.slots <- struct{}{} // every slot is taken
+
+	fields, contentType := multipartBody(t, map[string]string{"message": "x"}, []byte("%PDF"))
+	body := &readWatcher{Reader: fields}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req := httptest.NewRequest(http.MethodPost, "/sign", body).WithContext(ctx)
+	req.Header.Set("Content-Type", contentType)
+
+	called := false
+	h.post(func(http.ResponseWriter, *http.Request, []byte, string) { called = true })(httptest.NewRecorder(), req)
+	if called || body.read {
+		t.Errorf("Waiting request ran=%v, read its body=%v", called, body.read)
+	}
+}
+
+// TestStalledUploadReleasesSlot tests that a client that stops sending its
+// body is answered 408 and frees its slot for the next request
+func TestStalledUploadReleasesSlot(t *testing.T) {
+	srv := newTestServer(t, Config{MaxConcurrent: 1, ReadTimeout: 200 * time.Millisecond})
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprintf(conn, "POST /verify HTTP/1.1\r\nHost: test\r\nContent-Type: multipart/form-data; boundary=x\r\nContent-Length: 1000\r\n\r\n--x\r\n")
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("Stalled request got no response: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestTimeout {
+		t.Errorf("Stalled request: status %d, want %d", resp.StatusCode, http.StatusRequestTimeout)
+	}
+
+	body, contentType := multipartBody(t, nil, []byte("%PDF"))
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err = client.Post(srv.URL+"/verify", contentType, body)
+	if err != nil {
+		t.Fatalf("Next request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Next request: status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+}
+
+// TestHealthz tests the health endpoint
+func TestHealthz(t *testing.T) {
+	srv := newTestServer(t, Config{})
+	resp, err := http.Get(srv.URL + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Status mismatch: got %d", resp.StatusCode)
+	}
+}
+
+// TestUploadName tests that client paths are stripped from file names
+func TestUploadName(t *testing.T) {
+	for in, want := range map[string]string{
+		"report.pdf":            "report.pdf",
+		"../../etc/passwd":      "passwd",
+		`C:\Users\bob\deck.pdf`: "deck.pdf",
+		"":                      "document.pdf",
+	} {
+		if got := uploadName(&multipart.FileHeader{Filename: in}); got != want {
+			t.Errorf("uploadName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
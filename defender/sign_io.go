@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// stdioPath selects stdin for --file and stdout for --output
+const stdioPath = "-"
+
+var (
+	signOutput        string
+	signInPlace       bool
+	signForce         bool
+	signTamperEvident bool
+	signIncremental   bool
+	// signDeterministicSeed makes the signed copy reproducible (tests only)
+	signDeterministicSeed string
+)
+
+// signTarget is where sign reads its input and writes the signed copy
+type signTarget struct {
+	// input is the PDF to sign (a spooled copy when reading stdin)
+	input string
+	// output is where the library writes (a temp file when writing stdout)
+	output string
+	// overwrite allows replacing an existing output (--force or --in-place)
+	overwrite bool
+	toStdout  bool
+	// tempDir holds the spooled stdin and the stdout copy
+	tempDir string
+}
+
+// newSignTarget validates the output flags and prepares stdin/stdout spooling.
+// defaultOutput is called when neither --output nor --in-place decides the path.
+func newSignTarget(defaultOutput func() (string, error)) (*signTarget, error) {
+	t := &signTarget{input: filePath, output: signOutput, overwrite: signForce || signInPlace}
+	fromStdin := filePath == stdioPath
+	t.toStdout = signsToStdout()
+
+	switch {
+	case signInPlace && signOutput != "":
+		return nil, fmt.Errorf("--in-place cannot be combined with --output")
+	case signInPlace && fromStdin:
+		return nil, fmt.Errorf("--in-place needs a file, not stdin")
+	}
+
+	if fromStdin || t.toStdout {
+		dir, err := os.MkdirTemp("", "defender-sign-*")
+		if err != nil {
+			return nil, err
+		}
+		t.tempDir = dir
+	}
+	if fromStdin {
+		t.input = filepath.Join(t.tempDir, "stdin.pdf")
+		if err := spool(os.Stdin, t.input); err != nil {
+			t.Close()
+			return nil, fmt.Errorf("failed to read stdin: %w", err)
+		}
+	}
+
+	switch {
+	case t.toStdout:
+		t.output = filepath.Join(t.tempDir, "signed.pdf")
+	case signInPlace:
+		t.output = filePath
+	case signOutput == "":
+		out, err := defaultOutput()
+		if err != nil {
+			t.Close()
+			return nil, err
+		}
+		t.output = out
+	}
+
+	if !signInPlace && !t.toStdout && sameFile(t.input, t.output) {
+		t.Close()
+		return nil, fmt.Errorf("output %s is the input file; use --in-place to sign it in place", t.output)
+	}
+	return t, nil
+}
+
+// signsToStdout reports whether the signed PDF is written to stdout: with
+// --output - or, by default, when reading stdin
+func signsToStdout() bool {
+	return signOutput == stdioPath || (signOutput == "" && filePath == stdioPath && !signInPlace)
+}
+
+// sourceName is the source file as recorded in the ledger
+func (t *signTarget) sourceName() string {
+	if filePath == stdioPath {
+		return stdioPath
+	}
+	return t.input
+}
+
+// outputName is the signed copy as shown to the user and recorded in the ledger
+func (t *signTarget) outputName() string {
+	if t.toStdout {
+		return stdioPath
+	}
+	return t.output
+}
+
+// writeStdout copies the signed PDF to w
+func (t *signTarget) writeStdout(w io.Writer) error {
+	f, err := os.Open(t.output)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// Close removes the spooled files
+func (t *signTarget) Close() {
+	if t.tempDir != "" {
+		os.RemoveAll(t.tempDir)
+	}
+}
+
+// spool copies r into a new file at path
+func spool(r io.Reader, path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// sameFile reports whether a and b name the same existing file
+func sameFile(a, b string) bool {
+	ia, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	ib, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(ia, ib)
+}
+
+// isTerminal reports whether f is a character device such as a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestSignStdoutWithProfileKey tests that status lines, including the profile
+// key notice, stay out of a signed PDF or JSON result written to stdout
+func TestSignStdoutWithProfileKey(t *testing.T) {
+	src := filepath.Join("testdata", "2511.17467v2.pdf")
+	if _, err := os.Stat(src); err != nil {
+		t.Skip("Test PDF not found")
+	}
+	dir := t.TempDir()
+	cfg := filepath.Join(dir, "config.yaml")
+	yaml := "keys:\n  legal:\n    env: PG_TEST_PROFILE_KEY\nprofiles:\n  legal:\n    anchors: Attachment\n    key: legal\n"
+	if err := os.WriteFile(cfg, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PG_TEST_PROFILE_KEY", "12345678901234567890123456789012")
+
+	// run signs with stdin, stdout and stderr redirected to files, status
+	// starting on stdout as it does in the binary
+	run := func(t *testing.T, format, file, output string) []byte {
+		prevIn, prevOut, prevErr := os.Stdin, os.Stdout, os.Stderr
+		prevFile, prevOutput, prevMsg, prevKey := filePath, signOutput, message, key
+		prevProfile, prevConfig, prevNoLedger, prevFormat := signProfile, configPath, noLedger, outputFormat
+		t.Cleanup(func() {
+			os.Stdin, os.Stdout, os.Stderr = prevIn, prevOut, prevErr
+			filePath, signOutput, message, key = prevFile, prevOutput, prevMsg, prevKey
+			signProfile, configPath, noLedger, outputFormat = prevProfile, prevConfig, prevNoLedger, prevFormat
+		})
+
+		in, err := os.Open(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer in.Close()
+		stdout, err := os.Create(filepath.Join(t.TempDir(), "stdout"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer stdout.Close()
+		stderr, err := os.Create(filepath.Join(t.TempDir(), "stderr"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer stderr.Close()
+		os.Stdin, os.Stdout, os.Stderr = in, stdout, stderr
+		defer redirectStatus(stdout)()
+
+		filePath, signOutput, message, key = file, output, "UserID:1", ""
+		signProfile, configPath, noLedger, outputFormat = "legal", cfg, true, format
+		res := &cliResult{File: filePath, Message: message}
+		if err := runFormatted(signCmd, res, func() error { return runSign(res) }); err != nil {
+			t.Fatalf("sign failed: %v", err)
+		}
+		out, err := os.ReadFile(stdout.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	t.Run("PDF", func(t *testing.T) {
+		out := run(t, formatText, stdioPath, "")
+		if !bytes.HasPrefix(out, []byte("%PDF-")) {
+			t.Errorf("stdout starts with %q, want a PDF", out[:min(len(out), 40)])
+		}
+	})
+	t.Run("JSON", func(t *testing.T) {
+		out := run(t, formatJSON, src, filepath.Join(dir, "signed.pdf"))
+		var res cliResult
+		if err := json.Unmarshal(out, &res); err != nil || !res.OK || res.Profile != "legal" {
+			t.Errorf("stdout is not the JSON result (%v):\n%s", err, out)
+		}
+	})
+}
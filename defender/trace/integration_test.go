@@ -0,0 +1,82 @@
+//go:build integration
+// +build integration
+
+package trace
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"defender/injector"
+	"defender/ledger"
+)
+
+const (
+	testPDFPath = "../testdata/2511.17467v2.pdf"
+	testKey32   = "12345678901234567890123456789012"
+	otherKey32  = "abcdefghijklmnopqrstuvwxyz012345"
+)
+
+// TestTraceEndToEnd signs copies, records them and traces them back
+func TestTraceEndToEnd(t *testing.T) {
+	// Skip if test PDF doesn't exist
+	if _, err := os.Stat(testPDFPath); os.IsNotExist(err) {
+		t.Skip("Test PDF not found, skipping integration test")
+	}
+
+	dir := t.TempDir()
+	l, err := ledger.Open(filepath.Join(dir, ledger.FileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sign := func(name, msg string, anchors []string) string {
+		out := filepath.Join(dir, name)
+		res, err := injector.SignTo(testPDFPath, out, msg, testKey32, anchors)
+		if err != nil {
+			t.Fatalf("Sign failed: %v", err)
+		}
+		hash, _ := ledger.FileSHA256(out)
+		if err := l.Append(ledger.Record{Recipient: name, Message: msg, OutputFile: out, OutputSHA256: hash, KeyID: injector.KeyID([]byte(testKey32)), Anchors: res.Anchors}); err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+	bob := sign("bob.pdf", "UserID:2", []string{"Attachment", "Content", "Visual"})
+	carol := sign("carol.pdf", "UserID:3", []string{"Visual"})
+
+	// The right key is found among several
+	v, err := Trace(bob, Options{Keys: []string{otherKey32, testKey32}, Ledger: l})
+	if err != nil {
+		t.Fatalf("Trace failed: %v", err)
+	}
+	if v.Status != StatusAttributed || v.Message != "UserID:2" || v.Confidence != ConfidenceHigh {
+		t.Errorf("Unexpected verdict: %+v", v)
+	}
+	kinds := make(map[string]bool)
+	for _, e := range v.Candidates[0].Evidence {
+		kinds[e.Kind] = true
+	}
+	if !kinds[EvidenceHash] || !kinds[EvidenceDecrypted] || !kinds[EvidenceVisual] {
+		t.Errorf("Expected hash, decrypted and visual evidence, got %+v", v.Candidates[0].Evidence)
+	}
+
+	// Without the key, payloads are reported locked; Visual text still points at Carol
+	v, err = Trace(carol, Options{Keys: []string{otherKey32}, Ledger: l})
+	if err != nil {
+		t.Fatalf("Trace failed: %v", err)
+	}
+	if v.Status != StatusAttributed || len(v.Recipients) != 1 || v.Recipients[0] != "carol.pdf" {
+		t.Errorf("Unexpected verdict: %+v", v)
+	}
+
+	// The unsigned source is unattributed
+	v, err = Trace(testPDFPath, Options{Keys: []string{testKey32}, Ledger: l})
+	if err != nil {
+		t.Fatalf("Trace failed: %v", err)
+	}
+	if v.Status != StatusUnattributed {
+		t.Errorf("Expected unattributed source, got %+v", v)
+	}
+}
@@ -0,0 +1,365 @@
+// Package trace attributes a leaked PDF to a recipient. It tries every configured
+// key against every extractable anchor, looks for surviving Visual watermark text,
+// and correlates what it recovers with the issuance ledger into a single verdict.
+package trace
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"defender/injector"
+	"defender/ledger"
+)
+
+// Confidence grades an attribution verdict
+type Confidence string
+
+const (
+	// ConfidenceHigh: the exact issued file, two independent channels agree, or an
+	// authenticated payload matches an issuance record
+	ConfidenceHigh Confidence = "high"
+	// ConfidenceMedium: one authenticated payload without an issuance record
+	ConfidenceMedium Confidence = "medium"
+	// ConfidenceLow: only forgeable evidence (Visual text), or conflicting marks
+	ConfidenceLow Confidence = "low"
+	// ConfidenceNone: nothing attributable was found
+	ConfidenceNone Confidence = "none"
+)
+
+// Status is the outcome of a trace
+type Status string
+
+const (
+	StatusAttributed   Status = "attributed"
+	StatusConflict     Status = "conflict"
+	StatusUnattributed Status = "unattributed"
+)
+
+// Evidence kinds
+const (
+	// EvidenceDecrypted: an anchor payload decrypted (and authenticated) with a configured key
+	EvidenceDecrypted = "decrypted"
+	// EvidenceLocked: an anchor payload was found but no configured key decrypts it
+	EvidenceLocked = "locked"
+	// EvidenceVisual: a known message appears in the shown page text
+	EvidenceVisual = "visual"
+	// EvidenceHash: the file is byte-identical to an issued copy
+	EvidenceHash = "hash"
+)
+
+// Evidence is one observation supporting (or failing to support) an attribution
+type Evidence struct {
+	Kind    string `json:"kind"`
+	Source  string `json:"source"` // Anchor name, "Visual" or "Ledger"
+	Message string `json:"message,omitempty"`
+	KeyID   string `json:"key_id,omitempty"`
+}
+
+// Candidate is one message found in the file, with its evidence and issuance records
+type Candidate struct {
+	Message  string          `json:"message"`
+	Evidence []Evidence      `json:"evidence"`
+	Records  []ledger.Record `json:"records,omitempty"`
+}
+
+// Verdict is the attribution result for one file
+type Verdict struct {
+	File       string      `json:"file"`
+	SHA256     string      `json:"sha256"`
+	Status     Status      `json:"status"`
+	Confidence Confidence  `json:"confidence"`
+	Message    string      `json:"message,omitempty"`
+	Recipients []string    `json:"recipients,omitempty"`
+	Candidates []Candidate `json:"candidates,omitempty"`
+	Locked     []Evidence  `json:"locked,omitempty"`
+	Notes      []string    `json:"notes,omitempty"`
+}
+
+// Options configures a trace
+type Options struct {
+	// Keys is the key set to try; every key must be 32 bytes
+	Keys []string
+	// Ledger is the issuance ledger to correlate with (optional)
+	Ledger *ledger.Ledger
+	// Limits bounds each anchor and text extraction (injector.DefaultLimits if nil)
+	Limits *injector.Limits
+}
+
+// Trace attributes filePath. It never modifies the file.
+func Trace(filePath string, opts Options) (*Verdict, error) {
+	hash, err := ledger.FileSHA256(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash file: %w", err)
+	}
+
+	var records []ledger.Record
+	var notes []string
+	if opts.Ledger != nil {
+		records, err = opts.Ledger.Records(ledger.Filter{})
+		if errors.Is(err, ledger.ErrCorrupt) {
+			notes = append(notes, err.Error())
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read ledger: %w", err)
+		}
+	}
+
+	managers := make([]*injector.CryptoManager, 0, len(opts.Keys))
+	keyIDs := make([]string, 0, len(opts.Keys))
+	for _, k := range opts.Keys {
+		cm, err := injector.NewCryptoManager([]byte(k))
+		if err != nil {
+			return nil, err
+		}
+		managers = append(managers, cm)
+		keyIDs = append(keyIDs, injector.KeyID([]byte(k)))
+	}
+
+	limits := injector.DefaultLimits
+	if opts.Limits != nil {
+		limits = *opts.Limits
+	}
+
+	var evidence []Evidence
+
+	// Byte-identical issued copy
+	isSource := false
+	for _, r := range records {
+		if r.OutputSHA256 == hash {
+			evidence = append(evidence, Evidence{Kind: EvidenceHash, Source: "Ledger", Message: r.Message, KeyID: r.KeyID})
+		}
+		isSource = isSource || r.SourceSHA256 == hash
+	}
+	if isSource {
+		notes = append(notes, "file is identical to an unsigned source document in the ledger")
+	}
+
+	// Every key against every extractable anchor
+	for _, anchor := range injector.NewAnchorRegistry().GetAvailableAnchors() {
+		if anchor.Name() == injector.AnchorNameVisual {
+			continue
+		}
+		payload, err := injector.ExtractWithLimits(anchor, filePath, limits)
+		if errors.Is(err, injector.ErrLimitExceeded) {
+			notes = append(notes, fmt.Sprintf("%s not examined: %v", anchor.Name(), err))
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		decrypted := false
+		for i, cm := range managers {
+			if msg, err := cm.Decrypt(payload); err == nil {
+				evidence = append(evidence, Evidence{Kind: EvidenceDecrypted, Source: anchor.Name(), Message: msg, KeyID: keyIDs[i]})
+				decrypted = true
+				break
+			}
+		}
+		if !decrypted {
+			evidence = append(evidence, Evidence{Kind: EvidenceLocked, Source: anchor.Name()})
+		}
+	}
+
+	// Surviving Visual text, matched against every message we know of
+	texts, err := injector.ExtractShownTextWithLimits(filePath, limits)
+	if err != nil {
+		notes = append(notes, fmt.Sprintf("visual text not readable: %v", err))
+	}
+	known := make([]string, 0, len(records)+len(evidence))
+	for _, r := range records {
+		known = append(known, r.Message)
+	}
+	for _, e := range evidence {
+		known = append(known, e.Message)
+	}
+	for _, msg := range matchVisualText(texts, known) {
+		evidence = append(evidence, Evidence{Kind: EvidenceVisual, Source: injector.AnchorNameVisual, Message: msg})
+	}
+
+	v := decide(evidence, records)
+	v.File = filePath
+	v.SHA256 = hash
+	v.Notes = append(notes, v.Notes...)
+	return v, nil
+}
+
+// decide turns evidence into a verdict, attaching the issuance records of each message
+func decide(evidence []Evidence, records []ledger.Record) *Verdict {
+	v := &Verdict{}
+
+	byMessage := make(map[string]*Candidate)
+	var order []string
+	for _, e := range evidence {
+		if e.Kind == EvidenceLocked {
+			v.Locked = append(v.Locked, e)
+			continue
+		}
+		c, ok := byMessage[e.Message]
+		if !ok {
+			c = &Candidate{Message: e.Message}
+			byMessage[e.Message] = c
+			order = append(order, e.Message)
+		}
+		c.Evidence = append(c.Evidence, e)
+	}
+
+	for _, msg := range order {
+		c := byMessage[msg]
+		c.Records = issuanceRecords(records, c)
+		v.Candidates = append(v.Candidates, *c)
+	}
+	// Strongest candidate first
+	sort.SliceStable(v.Candidates, func(i, j int) bool {
+		return rank(&v.Candidates[i]) > rank(&v.Candidates[j])
+	})
+
+	if len(v.Locked) > 0 {
+		v.Notes = append(v.Notes, fmt.Sprintf("%d anchor payload(s) found that no configured key decrypts", len(v.Locked)))
+	}
+
+	switch len(v.Candidates) {
+	case 0:
+		v.Status = StatusUnattributed
+		v.Confidence = ConfidenceNone
+	case 1:
+		c := &v.Candidates[0]
+		v.Status = StatusAttributed
+		v.Confidence = confidence(c)
+		v.Message = c.Message
+		v.Recipients = recipients(c.Records)
+		if len(c.Records) == 0 {
+			v.Notes = append(v.Notes, "no issuance record for this message in the ledger")
+		}
+	default:
+		v.Status = StatusConflict
+		v.Confidence = ConfidenceLow
+		v.Notes = append(v.Notes, "marks of several messages are present: possible collusion, a mixed or re-signed copy")
+	}
+	return v
+}
+
+// confidence grades a single candidate
+func confidence(c *Candidate) Confidence {
+	channels := make(map[string]bool)
+	authenticated := false
+	for _, e := range c.Evidence {
+		switch e.Kind {
+		case EvidenceHash:
+			return ConfidenceHigh
+		case EvidenceDecrypted:
+			authenticated = true
+		}
+		channels[e.Source] = true
+	}
+	switch {
+	case authenticated && (len(channels) >= 2 || len(c.Records) > 0):
+		return ConfidenceHigh
+	case authenticated:
+		return ConfidenceMedium
+	default:
+		return ConfidenceLow
+	}
+}
+
+// rank orders candidates by evidence strength
+func rank(c *Candidate) int {
+	score := 0
+	for _, e := range c.Evidence {
+		switch e.Kind {
+		case EvidenceHash:
+			score += 100
+		case EvidenceDecrypted:
+			score += 10
+		case EvidenceVisual:
+			score++
+		}
+	}
+	return score
+}
+
+// issuanceRecords returns the ledger records for the candidate's message, restricted
+// to the keys its payloads were decrypted with when any were
+func issuanceRecords(records []ledger.Record, c *Candidate) []ledger.Record {
+	keys := make(map[string]bool)
+	for _, e := range c.Evidence {
+		if e.KeyID != "" {
+			keys[e.KeyID] = true
+		}
+	}
+	var out []ledger.Record
+	for _, r := range records {
+		if r.Message == c.Message && (len(keys) == 0 || keys[r.KeyID]) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// recipients lists the distinct recipients of records (the message when unnamed)
+func recipients(records []ledger.Record) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, r := range records {
+		name := r.Recipient
+		if name == "" {
+			name = r.Message
+		}
+		if !seen[name] {
+			seen[name] = true
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// matchVisualText returns the known messages shown in texts, ignoring whitespace
+// (watermarks are wrapped across lines). A message that is only found as part of
+// a longer matching message (UserID:1 inside UserID:12) is not reported.
+func matchVisualText(texts, known []string) []string {
+	shown := make([]string, len(texts))
+	for i, t := range texts {
+		shown[i] = stripSpace(t)
+	}
+
+	seen := make(map[string]bool)
+	var matched []string
+	for _, msg := range known {
+		norm := stripSpace(msg)
+		if norm == "" || seen[msg] {
+			continue
+		}
+		seen[msg] = true
+		for _, s := range shown {
+			if strings.Contains(s, norm) {
+				matched = append(matched, msg)
+				break
+			}
+		}
+	}
+
+	var out []string
+	for _, m := range matched {
+		shadowed := false
+		for _, other := range matched {
+			if other != m && strings.Contains(stripSpace(other), stripSpace(m)) {
+				shadowed = true
+				break
+			}
+		}
+		if !shadowed {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+func stripSpace(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
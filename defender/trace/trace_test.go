@@ -0,0 +1,112 @@
+package trace
+
+import (
+	"reflect"
+	"testing"
+
+	"defender/ledger"
+)
+
+// TestDecide tests verdicts and confidence grading
+func TestDecide(t *testing.T) {
+	records := []ledger.Record{
+		{Recipient: "Bob", Message: "UserID:2", KeyID: "k1"},
+		{Recipient: "Carol", Message: "UserID:3", KeyID: "k1"},
+		{Recipient: "Bob (old key)", Message: "UserID:2", KeyID: "k0"},
+	}
+	decrypted := func(anchor, msg string) Evidence {
+		return Evidence{Kind: EvidenceDecrypted, Source: anchor, Message: msg, KeyID: "k1"}
+	}
+	visual := func(msg string) Evidence {
+		return Evidence{Kind: EvidenceVisual, Source: "Visual", Message: msg}
+	}
+
+	tests := []struct {
+		name       string
+		evidence   []Evidence
+		records    []ledger.Record
+		status     Status
+		confidence Confidence
+		recipients []string
+	}{
+		{
+			name:       "Nothing found",
+			evidence:   []Evidence{{Kind: EvidenceLocked, Source: "SMask"}},
+			records:    records,
+			status:     StatusUnattributed,
+			confidence: ConfidenceNone,
+		},
+		{
+			name:       "Authenticated payload with issuance record",
+			evidence:   []Evidence{decrypted("Attachment", "UserID:2")},
+			records:    records,
+			status:     StatusAttributed,
+			confidence: ConfidenceHigh,
+			recipients: []string{"Bob"}, // The k0 record is excluded by key ID
+		},
+		{
+			name:       "Authenticated payload without ledger",
+			evidence:   []Evidence{decrypted("Content", "UserID:9")},
+			status:     StatusAttributed,
+			confidence: ConfidenceMedium,
+		},
+		{
+			name:       "Two channels without ledger",
+			evidence:   []Evidence{decrypted("Content", "UserID:9"), visual("UserID:9")},
+			status:     StatusAttributed,
+			confidence: ConfidenceHigh,
+		},
+		{
+			name:       "Visual text only",
+			evidence:   []Evidence{visual("UserID:3")},
+			records:    records,
+			status:     StatusAttributed,
+			confidence: ConfidenceLow,
+			recipients: []string{"Carol"},
+		},
+		{
+			name:       "Byte-identical issued copy",
+			evidence:   []Evidence{{Kind: EvidenceHash, Source: "Ledger", Message: "UserID:3", KeyID: "k1"}},
+			records:    records,
+			status:     StatusAttributed,
+			confidence: ConfidenceHigh,
+			recipients: []string{"Carol"},
+		},
+		{
+			name:       "Conflicting marks",
+			evidence:   []Evidence{decrypted("Attachment", "UserID:2"), visual("UserID:3")},
+			records:    records,
+			status:     StatusConflict,
+			confidence: ConfidenceLow,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := decide(tt.evidence, tt.records)
+			if v.Status != tt.status || v.Confidence != tt.confidence {
+				t.Errorf("Verdict mismatch: got %s/%s, want %s/%s", v.Status, v.Confidence, tt.status, tt.confidence)
+			}
+			if !reflect.DeepEqual(v.Recipients, tt.recipients) {
+				t.Errorf("Recipients mismatch: got %v, want %v", v.Recipients, tt.recipients)
+			}
+		})
+	}
+
+	// Conflicts list the strongest candidate first
+	v := decide([]Evidence{visual("UserID:3"), decrypted("Attachment", "UserID:2")}, records)
+	if len(v.Candidates) != 2 || v.Candidates[0].Message != "UserID:2" {
+		t.Errorf("Expected authenticated candidate first, got %+v", v.Candidates)
+	}
+}
+
+// TestMatchVisualText tests whitespace-insensitive matching and prefix shadowing
+func TestMatchVisualText(t *testing.T) {
+	texts := []string{"Body text of the page", "UserID:12\nalice@example.com"}
+	known := []string{"UserID:1", "UserID:12 alice@example.com", "UserID:3", "UserID:12 alice@example.com"}
+
+	got := matchVisualText(texts, known)
+	if want := []string{"UserID:12 alice@example.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Matches mismatch: got %q, want %q", got, want)
+	}
+}
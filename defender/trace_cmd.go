@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"defender/injector"
+	"defender/trace"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	traceKeys     []string
+	traceKeysFile string
+)
+
+var traceCmd = &cobra.Command{
+	Use:   "trace",
+	Short: "Attribute a leaked PDF to a recipient",
+	Long: `The trace command tries every key in the key set against every anchor,
+looks for surviving Visual watermark text, and correlates everything it
+recovers with the issuance ledger into a single attribution verdict with a
+confidence level and the supporting evidence.
+
+The key set is the union of:
+  - every --key flag (repeatable)
+  - every line of --keys-file, or of $DEFENDER_KEYS_FILE ('#' starts a comment)
+  - the DEFAULT_KEY environment variable
+
+Example:
+  defender trace -f leaked.pdf --keys-file keys.txt`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if filePath == "" {
+			return fmt.Errorf("required flag --file is missing")
+		}
+
+		keys, err := resolveKeySet(traceKeys, traceKeysFile)
+		if err != nil {
+			return err
+		}
+		limits, err := limitsFromFlags()
+		if err != nil {
+			return err
+		}
+
+		issuance, err := openLedger()
+		if err != nil {
+			return fmt.Errorf("failed to open ledger: %w", err)
+		}
+
+		fmt.Printf("🔎 Defender Trace Operation\n")
+		fmt.Printf("   File: %s\n", filePath)
+		fmt.Printf("   Keys: %d\n", len(keys))
+		if issuance != nil {
+			fmt.Printf("   Ledger: %s\n", issuance.Path())
+		}
+		fmt.Println()
+
+		verdict, err := trace.Trace(filePath, trace.Options{Keys: keys, Ledger: issuance, Limits: &limits})
+		if err != nil {
+			return fmt.Errorf("trace failed: %w", err)
+		}
+		printVerdict(verdict)
+		return nil
+	},
+}
+
+// resolveKeySet collects the keys from flags, a keys file and DEFAULT_KEY,
+// dropping duplicates. Keys of the wrong length are rejected.
+func resolveKeySet(flagKeys []string, keysFile string) ([]string, error) {
+	var keys []string
+	seen := make(map[string]bool)
+	add := func(k, origin string) error {
+		if k == "" || seen[k] {
+			return nil
+		}
+		if len(k) != 32 {
+			return fmt.Errorf("key from %s (ID %s) is %d bytes, must be 32", origin, injector.KeyID([]byte(k)), len(k))
+		}
+		seen[k] = true
+		keys = append(keys, k)
+		return nil
+	}
+
+	for _, k := range flagKeys {
+		if err := add(k, "--key"); err != nil {
+			return nil, err
+		}
+	}
+
+	if keysFile == "" {
+		keysFile = os.Getenv("DEFENDER_KEYS_FILE")
+	}
+	if keysFile != "" {
+		f, err := os.Open(keysFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open keys file: %w", err)
+		}
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for lineNr := 1; scanner.Scan(); lineNr++ {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			if err := add(line, fmt.Sprintf("%s:%d", keysFile, lineNr)); err != nil {
+				return nil, err
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read keys file: %w", err)
+		}
+	}
+
+	if err := add(os.Getenv("DEFAULT_KEY"), "DEFAULT_KEY"); err != nil {
+		return nil, err
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no keys configured: use --key, --keys-file or DEFAULT_KEY")
+	}
+	return keys, nil
+}
+
+// printVerdict prints the evidence and the attribution verdict
+func printVerdict(v *trace.Verdict) {
+	fmt.Println("Evidence:")
+	if len(v.Candidates) == 0 && len(v.Locked) == 0 {
+		fmt.Println("  (none)")
+	}
+	for _, c := range v.Candidates {
+		for _, e := range c.Evidence {
+			switch e.Kind {
+			case trace.EvidenceHash:
+				fmt.Printf("  ✓ %-10s file is byte-identical to the copy issued for %q\n", e.Source, e.Message)
+			case trace.EvidenceDecrypted:
+				fmt.Printf("  ✓ %-10s payload decrypted with key %s: %q\n", e.Source, e.KeyID, e.Message)
+			case trace.EvidenceVisual:
+				fmt.Printf("  ✓ %-10s watermark text shows %q\n", e.Source, e.Message)
+			}
+		}
+	}
+	for _, e := range v.Locked {
+		fmt.Printf("  ✗ %-10s payload found, no configured key decrypts it\n", e.Source)
+	}
+
+	fmt.Printf("\nVerdict: %s (confidence: %s)\n", strings.ToUpper(string(v.Status)), v.Confidence)
+	switch v.Status {
+	case trace.StatusAttributed:
+		fmt.Printf("   Message: %s\n", v.Message)
+		if len(v.Recipients) > 0 {
+			fmt.Printf("   Recipient(s): %s\n", strings.Join(v.Recipients, ", "))
+		}
+		for _, r := range v.Candidates[0].Records {
+			fmt.Printf("   Issued: %s by %s -> %s\n", r.Time.Local().Format("2006-01-02 15:04:05"), r.Operator, r.OutputFile)
+		}
+	case trace.StatusConflict:
+		for _, c := range v.Candidates {
+			fmt.Printf("   Candidate: %q (%d evidence, %d issuance record(s))\n", c.Message, len(c.Evidence), len(c.Records))
+		}
+	}
+	for _, note := range v.Notes {
+		fmt.Printf("   Note: %s\n", note)
+	}
+}
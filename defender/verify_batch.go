@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"defender/injector"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	reportPath      string
+	verifyBatchJobs int
+)
+
+// verifyReport records the outcome of a verify-batch run
+type verifyReport struct {
+	Version   string         `json:"version"`
+	CreatedAt time.Time      `json:"created_at"`
+	Results   []verifyResult `json:"results"`
+}
+
+// verifyResult describes one verified file
+type verifyResult struct {
+	File    string `json:"file"`
+	Message string `json:"message,omitempty"`
+	Anchor  string `json:"anchor,omitempty"`
+	Error   string `json:"error,omitempty"`
+	// Limit is set when the file exceeded a resource limit
+	Limit *injector.LimitError `json:"limit,omitempty"`
+	// Integrity is set for copies signed with tamper evidence
+	Integrity *injector.IntegrityReport `json:"integrity,omitempty"`
+}
+
+var verifyBatchCmd = &cobra.Command{
+	Use:   "verify-batch [paths...]",
+	Short: "Verify many PDF files or whole directories in parallel",
+	Long: `The verify-batch command verifies every given PDF file and every PDF found
+(recursively) under the given directories, using up to -j workers.
+
+Files without a valid tracking message are reported, not treated as errors.
+
+Example:
+  defender verify-batch -j 8 /mnt/share/reports --report leaks.json`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		resolvedKey, err := resolveKey(key)
+		if err != nil {
+			return err
+		}
+		limits, err := limitsFromFlags()
+		if err != nil {
+			return err
+		}
+		opts := injector.VerifyOptions{Limits: &limits}
+		opts.UserPassword, opts.OwnerPassword = passwordsFromFlags()
+
+		files, err := collectPDFs(args)
+		if err != nil {
+			return fmt.Errorf("failed to collect files: %w", err)
+		}
+		if len(files) == 0 {
+			return fmt.Errorf("no PDF files found")
+		}
+
+		fmt.Printf("🔍 Defender Batch Verify Operation\n")
+		fmt.Printf("   Files: %d\n", len(files))
+		fmt.Printf("   Workers: %d\n", workerCount(verifyBatchJobs, len(files)))
+		fmt.Println()
+
+		report := verifyReport{
+			Version:   version,
+			CreatedAt: time.Now().UTC(),
+			Results:   runVerifyBatch(files, resolvedKey, opts, verifyBatchJobs),
+		}
+
+		fmt.Println()
+		verified := 0
+		for _, r := range report.Results {
+			if r.Error == "" {
+				verified++
+				fmt.Printf("✓ %s: %q (%s)\n", r.File, r.Message, r.Anchor)
+				if r.Integrity != nil && r.Integrity.Error == "" && !r.Integrity.Intact() {
+					fmt.Printf("  🚨 modified after signing: %d modified, %d added, %d removed pages\n",
+						len(r.Integrity.Modified), len(r.Integrity.Added), len(r.Integrity.Removed))
+				}
+			} else {
+				fmt.Printf("✗ %s: %s\n", r.File, r.Error)
+			}
+		}
+
+		if reportPath != "" {
+			data, err := json.MarshalIndent(&report, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to encode report: %w", err)
+			}
+			if err := os.WriteFile(reportPath, append(data, '\n'), 0644); err != nil {
+				return fmt.Errorf("failed to write report: %w", err)
+			}
+			fmt.Printf("\n📋 Report written: %s\n", reportPath)
+		}
+
+		fmt.Printf("\n✅ Batch verify completed: %d of %d files carry a valid tracking message\n", verified, len(files))
+		return nil
+	},
+}
+
+// runVerifyBatch verifies files on up to jobs workers; results keep the input order
+func runVerifyBatch(files []string, key string, opts injector.VerifyOptions, jobs int) []verifyResult {
+	results := make([]verifyResult, len(files))
+	runPool(jobs, len(files), func(i int) {
+		results[i].File = files[i]
+		res, err := injector.VerifyDetailed(files[i], key, opts)
+		if err != nil {
+			results[i].Error = err.Error()
+			errors.As(err, &results[i].Limit)
+			return
+		}
+		results[i].Message = res.Message
+		results[i].Anchor = res.Anchor
+		results[i].Integrity = res.Integrity
+	})
+	return results
+}
+
+// collectPDFs expands paths into PDF files, walking directories recursively.
+// Explicitly named files are kept whatever their extension.
+func collectPDFs(paths []string) ([]string, error) {
+	var files []string
+	seen := make(map[string]bool)
+	add := func(p string) {
+		if !seen[p] {
+			seen[p] = true
+			files = append(files, p)
+		}
+	}
+
+	for _, root := range paths {
+		info, err := os.Stat(root)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			add(root)
+			continue
+		}
+		err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && strings.EqualFold(filepath.Ext(p), ".pdf") {
+				add(p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
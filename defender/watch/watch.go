@@ -0,0 +1,416 @@
+// Package watch implements the watch-folder daemon: PDFs dropped into an inbox
+// are signed into an outbox and the originals are moved to an archive.
+//
+// The recipient of a file is the name of its first-level subfolder:
+//
+//	inbox/Alice/report.pdf -> outbox/Alice/report_signed.pdf, archive/Alice/report.pdf
+//
+// Files dropped directly into the inbox use Config.DefaultRecipient, or are left
+// alone when it is empty. A file is only picked up once its size and modification
+// time are unchanged across two scans and it is older than Config.Settle, so copies
+// still being written are never signed. Failed files are retried with backoff and
+// moved to Config.Failed after Config.MaxAttempts.
+package watch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"defender/injector"
+	"defender/ledger"
+)
+
+// DefaultMessage is the default message template
+const DefaultMessage = "Recipient:{recipient}"
+
+// Defaults for the zero values of Config
+const (
+	DefaultInterval    = 2 * time.Second
+	DefaultSettle      = 2 * time.Second
+	DefaultMaxAttempts = 3
+)
+
+// Config configures a Watcher
+type Config struct {
+	// Inbox, Outbox and Archive are the watched, output and processed-originals directories
+	Inbox, Outbox, Archive string
+	// Failed receives originals that could not be signed (Archive/_failed if empty)
+	Failed string
+	// Key is the 32-byte signing key
+	Key string
+	// Message is the message template; {recipient}, {file} (base name without
+	// extension) and {date} (YYYY-MM-DD) are replaced (DefaultMessage if empty)
+	Message string
+	// Anchors selects the anchors (all if empty)
+	Anchors []string
+	// DefaultRecipient is used for files directly in the inbox; they are skipped if empty
+	DefaultRecipient string
+	// Interval is the time between scans (DefaultInterval if zero)
+	Interval time.Duration
+	// Settle is the minimum age of a file before it is picked up (DefaultSettle if zero)
+	Settle time.Duration
+	// MaxAttempts is how often signing a file is tried (DefaultMaxAttempts if zero)
+	MaxAttempts int
+	// Ledger records every signed copy (optional)
+	Ledger *ledger.Ledger
+	// Operator is recorded in the ledger
+	Operator string
+	// Logger receives one line per action (log.Default() if nil)
+	Logger *log.Logger
+}
+
+// Watcher processes the inbox of a Config
+type Watcher struct {
+	cfg   Config
+	files map[string]*fileState
+	now   func() time.Time
+	sign  func(src, dst, message string, opts injector.SignOptions) (*injector.SignResult, error)
+}
+
+// fileState tracks a file between scans
+type fileState struct {
+	size     int64
+	modTime  time.Time
+	attempts int
+	retryAt  time.Time
+	skipped  bool // already logged as skipped
+}
+
+// New validates cfg, creates the output directories and returns a Watcher
+func New(cfg Config) (*Watcher, error) {
+	if len(cfg.Key) != 32 {
+		return nil, injector.ErrInvalidKeySize
+	}
+	if cfg.Inbox == "" || cfg.Outbox == "" || cfg.Archive == "" {
+		return nil, errors.New("inbox, outbox and archive directories are required")
+	}
+	if cfg.Failed == "" {
+		cfg.Failed = filepath.Join(cfg.Archive, "_failed")
+	}
+	if cfg.Message == "" {
+		cfg.Message = DefaultMessage
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultInterval
+	}
+	if cfg.Settle <= 0 {
+		cfg.Settle = DefaultSettle
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = DefaultMaxAttempts
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = log.Default()
+	}
+
+	info, err := os.Stat(cfg.Inbox)
+	if err != nil {
+		return nil, fmt.Errorf("inbox: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("inbox %s is not a directory", cfg.Inbox)
+	}
+	inbox, _ := filepath.Abs(cfg.Inbox)
+	for _, dir := range []string{cfg.Outbox, cfg.Archive, cfg.Failed} {
+		abs, _ := filepath.Abs(dir)
+		if abs == inbox || strings.HasPrefix(abs, inbox+string(filepath.Separator)) {
+			return nil, fmt.Errorf("%s must not be inside the inbox", dir)
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	w := &Watcher{cfg: cfg, files: make(map[string]*fileState), now: time.Now}
+	w.sign = func(src, dst, message string, opts injector.SignOptions) (*injector.SignResult, error) {
+		return injector.SignWithOptions(src, dst, message, cfg.Key, opts)
+	}
+	return w, nil
+}
+
+// Run scans the inbox every Interval until ctx is cancelled
+func (w *Watcher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		if err := w.Scan(); err != nil {
+			w.cfg.Logger.Printf("scan failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Drain scans until no file is waiting to settle or to be retried, then returns.
+// Files directly in the inbox without a default recipient are not waited for.
+func (w *Watcher) Drain(ctx context.Context) error {
+	for {
+		if err := w.Scan(); err != nil {
+			return err
+		}
+		if w.Pending() == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(w.cfg.Interval):
+		}
+	}
+}
+
+// Pending returns the number of files still waiting to be processed
+func (w *Watcher) Pending() int {
+	n := 0
+	for _, st := range w.files {
+		if !st.skipped {
+			n++
+		}
+	}
+	return n
+}
+
+// Scan makes one pass over the inbox, processing every file that is ready
+func (w *Watcher) Scan() error {
+	now := w.now()
+	seen := make(map[string]bool)
+	var ready []string
+
+	err := filepath.WalkDir(w.cfg.Inbox, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == w.cfg.Inbox {
+				return err
+			}
+			w.cfg.Logger.Printf("cannot read %s: %v", path, err)
+			return nil
+		}
+		if ignored(d.Name()) && path != w.cfg.Inbox {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !strings.EqualFold(filepath.Ext(path), ".pdf") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil // removed since listed
+		}
+
+		seen[path] = true
+		st, ok := w.files[path]
+		if !ok {
+			st = &fileState{size: info.Size(), modTime: info.ModTime()}
+			w.files[path] = st
+			return nil
+		}
+		if st.size != info.Size() || !st.modTime.Equal(info.ModTime()) {
+			// Still being written
+			st.size, st.modTime = info.Size(), info.ModTime()
+			return nil
+		}
+		if st.skipped || now.Sub(st.modTime) < w.cfg.Settle || now.Before(st.retryAt) {
+			return nil
+		}
+		ready = append(ready, path)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for path := range w.files {
+		if !seen[path] {
+			delete(w.files, path)
+		}
+	}
+
+	sort.Strings(ready)
+	for _, path := range ready {
+		w.process(path, now)
+	}
+	return nil
+}
+
+// process signs one settled file and moves the original
+func (w *Watcher) process(path string, now time.Time) {
+	st := w.files[path]
+	rel, _ := filepath.Rel(w.cfg.Inbox, path)
+	recipient, sub := w.recipient(rel)
+	if recipient == "" {
+		w.cfg.Logger.Printf("skip %s: no recipient subfolder and no default recipient", rel)
+		st.skipped = true
+		return
+	}
+
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	message := expand(w.cfg.Message, recipient, base, now)
+
+	output, err := w.signFile(path, filepath.Join(w.cfg.Outbox, sub), base, recipient, message)
+	if err != nil {
+		st.attempts++
+		if st.attempts < w.cfg.MaxAttempts {
+			delay := w.cfg.Interval << (st.attempts - 1)
+			st.retryAt = now.Add(delay)
+			w.cfg.Logger.Printf("retry %s (attempt %d/%d in %s): %v", rel, st.attempts, w.cfg.MaxAttempts, delay, err)
+			return
+		}
+		w.cfg.Logger.Printf("FAILED %s after %d attempts: %v", rel, st.attempts, err)
+		if dst, err := moveUnique(path, filepath.Join(w.cfg.Failed, sub), filepath.Base(path)); err != nil {
+			w.cfg.Logger.Printf("cannot move %s to failed: %v", rel, err)
+			st.skipped = true
+		} else {
+			w.cfg.Logger.Printf("moved %s -> %s", rel, dst)
+			delete(w.files, path)
+		}
+		return
+	}
+	w.cfg.Logger.Printf("signed %s for %q -> %s", rel, recipient, output)
+
+	archived, err := moveUnique(path, filepath.Join(w.cfg.Archive, sub), filepath.Base(path))
+	if err != nil {
+		// The signed copy exists; never sign this file again
+		w.cfg.Logger.Printf("cannot archive %s: %v", rel, err)
+		st.skipped = true
+		return
+	}
+	w.cfg.Logger.Printf("archived %s -> %s", rel, archived)
+	delete(w.files, path)
+}
+
+// signFile signs src into dir as <base>_signed.pdf, or <base>_signed-2.pdf, ...
+// when that exists. The injector records the copy in the ledger and only
+// renames it into place once complete, so the outbox only ever shows
+// complete, recorded signed files.
+func (w *Watcher) signFile(src, dir, base, recipient, message string) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	opts := injector.SignOptions{
+		Anchors:  w.cfg.Anchors,
+		Ledger:   w.cfg.Ledger,
+		Issuance: ledger.Record{Operator: w.cfg.Operator, Recipient: recipient},
+	}
+	for i := 1; ; i++ {
+		output := filepath.Join(dir, uniqueName(base+"_signed.pdf", i))
+		if _, err := os.Lstat(output); err == nil {
+			continue
+		}
+		_, err := w.sign(src, output, message, opts)
+		if errors.Is(err, injector.ErrOutputExists) {
+			continue // Taken while signing
+		}
+		if err != nil {
+			return "", err
+		}
+		return output, nil
+	}
+}
+
+// recipient derives the recipient and the subfolder (relative to inbox, outbox
+// and archive) of a file from its path relative to the inbox
+func (w *Watcher) recipient(rel string) (recipient, sub string) {
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	if len(parts) == 1 {
+		return w.cfg.DefaultRecipient, ""
+	}
+	return parts[0], filepath.Join(parts[:len(parts)-1]...)
+}
+
+// expand fills in a message template
+func expand(template, recipient, file string, now time.Time) string {
+	return strings.NewReplacer(
+		"{recipient}", recipient,
+		"{file}", file,
+		"{date}", now.Format("2006-01-02"),
+	).Replace(template)
+}
+
+// ignored reports whether a file or directory name is hidden or a known
+// partial-download name
+func ignored(name string) bool {
+	if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "~$") {
+		return true
+	}
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".part", ".partial", ".crdownload", ".tmp", ".download":
+		return true
+	}
+	return false
+}
+
+// reserveUnique creates an empty file named name in dir, or name-2, name-3, ...
+// when it exists, and returns its path
+func reserveUnique(dir, name string) (string, error) {
+	for i := 1; ; i++ {
+		path := filepath.Join(dir, uniqueName(name, i))
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		f.Close()
+		return path, nil
+	}
+}
+
+// uniqueName returns the i-th choice for name: name itself, then name-2, name-3, ...
+func uniqueName(name string, i int) string {
+	if i == 1 {
+		return name
+	}
+	ext := filepath.Ext(name)
+	return fmt.Sprintf("%s-%d%s", strings.TrimSuffix(name, ext), i, ext)
+}
+
+// moveUnique moves src into dir without overwriting, copying when a rename is
+// not possible (another file system)
+func moveUnique(src, dir, name string) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	dst, err := reserveUnique(dir, name)
+	if err != nil {
+		return "", err
+	}
+	if err := os.Rename(src, dst); err == nil {
+		return dst, nil
+	}
+	if err := copyFile(src, dst); err != nil {
+		os.Remove(dst)
+		return "", err
+	}
+	return dst, os.Remove(src)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
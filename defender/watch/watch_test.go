@@ -0,0 +1,255 @@
+package watch
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"defender/injector"
+	"defender/ledger"
+)
+
+const testKey32 = "12345678901234567890123456789012"
+
+// testWatcher returns a Watcher over a temp tree whose signer copies the source
+// and prefixes the message, and whose clock only moves when advanced
+func testWatcher(t *testing.T, cfg Config) (*Watcher, string, *time.Time, *bytes.Buffer) {
+	t.Helper()
+	root := t.TempDir()
+	cfg.Inbox = filepath.Join(root, "inbox")
+	cfg.Outbox = filepath.Join(root, "outbox")
+	cfg.Archive = filepath.Join(root, "archive")
+	cfg.Key = testKey32
+	cfg.Interval = time.Second
+	cfg.Settle = 5 * time.Second
+	var logs bytes.Buffer
+	cfg.Logger = log.New(&logs, "", 0)
+	if err := os.MkdirAll(cfg.Inbox, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	now := time.Now().Add(time.Minute)
+	w.now = func() time.Time { return now }
+	// Like the injector, record the copy in the ledger the options name
+	w.sign = func(src, dst, message string, opts injector.SignOptions) (*injector.SignResult, error) {
+		data, err := os.ReadFile(src)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(dst, append([]byte(message+"\n"), data...), 0644); err != nil {
+			return nil, err
+		}
+		if opts.Ledger != nil {
+			rec := opts.Issuance
+			rec.SourceFile, rec.OutputFile, rec.Message = src, dst, message
+			if err := opts.Ledger.Append(rec); err != nil {
+				return nil, err
+			}
+		}
+		return &injector.SignResult{OutputPath: dst, Anchors: []string{"Attachment"}}, nil
+	}
+	return w, root, &now, &logs
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func scan(t *testing.T, w *Watcher) {
+	t.Helper()
+	if err := w.Scan(); err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// TestWatchSignsAndArchives tests the inbox -> outbox/archive flow and recipient derivation
+func TestWatchSignsAndArchives(t *testing.T) {
+	l, err := ledger.Open(filepath.Join(t.TempDir(), ledger.FileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, root, _, _ := testWatcher(t, Config{Message: "UserID:{recipient}/{file}", Ledger: l, Operator: "watch"})
+	writeFile(t, filepath.Join(root, "inbox", "Alice", "report.pdf"), "pdf-a")
+	writeFile(t, filepath.Join(root, "inbox", "Bob", "q3", "deck.PDF"), "pdf-b")
+	writeFile(t, filepath.Join(root, "inbox", "Alice", "notes.txt"), "not a pdf")
+
+	scan(t, w) // first sighting
+	if exists(filepath.Join(root, "outbox", "Alice")) {
+		t.Fatal("File signed on first sighting")
+	}
+	scan(t, w)
+
+	signed, err := os.ReadFile(filepath.Join(root, "outbox", "Alice", "report_signed.pdf"))
+	if err != nil || !strings.HasPrefix(string(signed), "UserID:Alice/report\n") {
+		t.Errorf("Unexpected signed copy: %q, %v", signed, err)
+	}
+	if !exists(filepath.Join(root, "outbox", "Bob", "q3", "deck_signed.pdf")) {
+		t.Error("Nested file not signed into matching outbox subfolder")
+	}
+	if !exists(filepath.Join(root, "archive", "Alice", "report.pdf")) || exists(filepath.Join(root, "inbox", "Alice", "report.pdf")) {
+		t.Error("Original not moved to archive")
+	}
+	if !exists(filepath.Join(root, "inbox", "Alice", "notes.txt")) {
+		t.Error("Non-PDF file was touched")
+	}
+	if w.Pending() != 0 {
+		t.Errorf("Pending = %d, want 0", w.Pending())
+	}
+
+	records, err := l.Records(ledger.Filter{Recipient: "Bob"})
+	if err != nil || len(records) != 1 || records[0].Message != "UserID:Bob/deck" || records[0].Operator != "watch" {
+		t.Errorf("Unexpected ledger records: %+v, %v", records, err)
+	}
+
+	// Same name again: nothing is overwritten
+	writeFile(t, filepath.Join(root, "inbox", "Alice", "report.pdf"), "pdf-a2")
+	scan(t, w)
+	scan(t, w)
+	if !exists(filepath.Join(root, "outbox", "Alice", "report_signed-2.pdf")) || !exists(filepath.Join(root, "archive", "Alice", "report-2.pdf")) {
+		t.Error("Name collision not resolved with a suffix")
+	}
+}
+
+// TestWatchPartialFiles tests that growing, young and temporary files are not picked up
+func TestWatchPartialFiles(t *testing.T) {
+	w, root, now, _ := testWatcher(t, Config{})
+	path := filepath.Join(root, "inbox", "Carol", "big.pdf")
+	writeFile(t, path, "part")
+	writeFile(t, filepath.Join(root, "inbox", "Carol", "big.pdf.part"), "x")
+	writeFile(t, filepath.Join(root, "inbox", "Carol", ".hidden.pdf"), "x")
+	scan(t, w)
+
+	// Still growing
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString("more")
+	f.Close()
+	scan(t, w)
+	if exists(filepath.Join(root, "outbox", "Carol", "big_signed.pdf")) {
+		t.Fatal("Growing file was signed")
+	}
+
+	// Unchanged but younger than Settle
+	*now = time.Now()
+	scan(t, w)
+	if exists(filepath.Join(root, "outbox", "Carol", "big_signed.pdf")) {
+		t.Fatal("File younger than Settle was signed")
+	}
+
+	*now = time.Now().Add(time.Minute)
+	scan(t, w)
+	if !exists(filepath.Join(root, "outbox", "Carol", "big_signed.pdf")) {
+		t.Fatal("Settled file was not signed")
+	}
+	entries, _ := os.ReadDir(filepath.Join(root, "outbox", "Carol"))
+	if len(entries) != 1 {
+		t.Errorf("Outbox has %d entries, want only the signed copy", len(entries))
+	}
+	if !exists(filepath.Join(root, "inbox", "Carol", "big.pdf.part")) || !exists(filepath.Join(root, "inbox", "Carol", ".hidden.pdf")) {
+		t.Error("Temporary or hidden file was touched")
+	}
+}
+
+// TestWatchRetries tests the retry backoff and the move to the failed directory
+func TestWatchRetries(t *testing.T) {
+	w, root, now, logs := testWatcher(t, Config{MaxAttempts: 2})
+	calls := 0
+	w.sign = func(src, dst, message string, opts injector.SignOptions) (*injector.SignResult, error) {
+		calls++
+		return nil, errors.New("encrypted PDF")
+	}
+	writeFile(t, filepath.Join(root, "inbox", "Dave", "locked.pdf"), "x")
+
+	scan(t, w)
+	scan(t, w)
+	if calls != 1 {
+		t.Fatalf("Sign calls = %d, want 1", calls)
+	}
+	scan(t, w) // backoff not elapsed
+	if calls != 1 {
+		t.Fatalf("Retried before backoff elapsed")
+	}
+
+	*now = now.Add(2 * time.Second)
+	scan(t, w)
+	if calls != 2 {
+		t.Fatalf("Sign calls = %d, want 2", calls)
+	}
+	if !exists(filepath.Join(root, "archive", "_failed", "Dave", "locked.pdf")) {
+		t.Error("Failed file not moved to failed directory")
+	}
+	if entries, _ := os.ReadDir(filepath.Join(root, "outbox", "Dave")); len(entries) != 0 {
+		t.Errorf("Outbox not cleaned up: %v", entries)
+	}
+	if !strings.Contains(logs.String(), "FAILED Dave/locked.pdf after 2 attempts") {
+		t.Errorf("Missing failure log line:\n%s", logs)
+	}
+}
+
+// TestWatchTopLevel tests files dropped directly into the inbox
+func TestWatchTopLevel(t *testing.T) {
+	w, root, _, logs := testWatcher(t, Config{})
+	writeFile(t, filepath.Join(root, "inbox", "loose.pdf"), "x")
+	scan(t, w)
+	scan(t, w)
+	scan(t, w)
+	if !exists(filepath.Join(root, "inbox", "loose.pdf")) || w.Pending() != 0 {
+		t.Error("File without recipient should be left alone and not pending")
+	}
+	if n := strings.Count(logs.String(), "skip loose.pdf"); n != 1 {
+		t.Errorf("Skip logged %d times, want 1", n)
+	}
+
+	w2, root2, _, _ := testWatcher(t, Config{DefaultRecipient: "Everyone"})
+	w2.cfg.Logger.SetOutput(io.Discard)
+	writeFile(t, filepath.Join(root2, "inbox", "loose.pdf"), "x")
+	scan(t, w2)
+	scan(t, w2)
+	if !exists(filepath.Join(root2, "outbox", "loose_signed.pdf")) {
+		t.Error("Default recipient not applied")
+	}
+}
+
+// TestNewValidation tests the configuration checks
+func TestNewValidation(t *testing.T) {
+	root := t.TempDir()
+	inbox := filepath.Join(root, "inbox")
+	os.MkdirAll(inbox, 0755)
+
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{"Short key", Config{Key: "short", Inbox: inbox, Outbox: root + "/out", Archive: root + "/arc"}},
+		{"Missing archive", Config{Key: testKey32, Inbox: inbox, Outbox: root + "/out"}},
+		{"Missing inbox", Config{Key: testKey32, Inbox: root + "/nope", Outbox: root + "/out", Archive: root + "/arc"}},
+		{"Outbox inside inbox", Config{Key: testKey32, Inbox: inbox, Outbox: inbox + "/out", Archive: root + "/arc"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.cfg); err == nil {
+				t.Error("Expected error")
+			}
+		})
+	}
+}
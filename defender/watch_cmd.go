@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"defender/injector"
+	"defender/watch"
+
+	"github.com/spf13/cobra"
+)
+
+var watchOpts struct {
+	inbox, outbox, archive, failed string
+	message, anchors, recipient    string
+	logPath                        string
+	interval, settle               time.Duration
+	attempts                       int
+	once                           bool
+}
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Watch an inbox folder and sign every PDF dropped into it",
+	Long: `The watch command monitors an inbox directory. Every PDF dropped into
+a subfolder is signed for the recipient named by that subfolder, written to
+the outbox and the original is moved to the archive:
+
+  inbox/Alice/report.pdf -> outbox/Alice/report_signed.pdf
+                            archive/Alice/report.pdf
+
+Files still being written (size or time still changing, younger than
+--settle, or named *.part, *.crdownload, *.tmp or .*) are left alone until
+they settle. Failed files are retried --retries times with backoff, then
+moved to --failed. Every action is logged, and every signed copy is
+recorded in the issuance ledger.
+
+The message template may use {recipient}, {file} and {date}.
+
+Example:
+  defender watch --inbox ~/Protect/In --outbox ~/Protect/Out --archive ~/Protect/Done
+  defender watch --inbox in --outbox out --archive done -m "UserID:{recipient} {date}" --once`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		resolvedKey, err := resolveKey(key)
+		if err != nil {
+			return err
+		}
+		anchors, err := injector.ParseAnchorProfile(watchOpts.anchors)
+		if err != nil {
+			return err
+		}
+		issuance, err := openLedger()
+		if err != nil {
+			return fmt.Errorf("failed to open ledger: %w", err)
+		}
+
+		var logOut io.Writer = os.Stderr
+		if watchOpts.logPath != "" {
+			f, err := os.OpenFile(watchOpts.logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+			if err != nil {
+				return fmt.Errorf("failed to open log file: %w", err)
+			}
+			defer f.Close()
+			logOut = io.MultiWriter(os.Stderr, f)
+		}
+
+		w, err := watch.New(watch.Config{
+			Inbox:            watchOpts.inbox,
+			Outbox:           watchOpts.outbox,
+			Archive:          watchOpts.archive,
+			Failed:           watchOpts.failed,
+			Key:              resolvedKey,
+			Message:          watchOpts.message,
+			Anchors:          anchors,
+			DefaultRecipient: watchOpts.recipient,
+			Interval:         watchOpts.interval,
+			Settle:           watchOpts.settle,
+			MaxAttempts:      watchOpts.attempts,
+			Ledger:           issuance,
+			Operator:         currentOperator(),
+			Logger:           log.New(logOut, "", log.LstdFlags),
+		})
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		fmt.Printf("👀 Defender Watch\n")
+		fmt.Printf("   Inbox: %s\n", watchOpts.inbox)
+		fmt.Printf("   Outbox: %s\n", watchOpts.outbox)
+		fmt.Printf("   Archive: %s\n", watchOpts.archive)
+		if issuance != nil {
+			fmt.Printf("   Ledger: %s\n", issuance.Path())
+		}
+		fmt.Println()
+
+		if watchOpts.once {
+			return w.Drain(ctx)
+		}
+		return w.Run(ctx)
+	},
+}
+
+// setupWatchCommand registers the watch command and its flags
+func setupWatchCommand() {
+	rootCmd.AddCommand(watchCmd)
+
+	f := watchCmd.Flags()
+	f.StringVar(&watchOpts.inbox, "inbox", "", "Directory to watch (required)")
+	f.StringVar(&watchOpts.outbox, "outbox", "", "Directory for signed copies (required)")
+	f.StringVar(&watchOpts.archive, "archive", "", "Directory for processed originals (required)")
+	f.StringVar(&watchOpts.failed, "failed", "", "Directory for originals that could not be signed (default: <archive>/_failed)")
+	f.StringVarP(&key, "key", "k", "", "32-byte encryption key (optional if DEFAULT_KEY env is set)")
+	f.StringVarP(&watchOpts.message, "msg", "m", watch.DefaultMessage, "Message template: {recipient}, {file}, {date}")
+	f.StringVar(&watchOpts.anchors, "anchors", "", "Anchor profile (all|invisible|visual) or comma-separated anchor list")
+	f.StringVar(&watchOpts.recipient, "recipient", "", "Recipient for files dropped directly into the inbox (default: leave them alone)")
+	f.DurationVar(&watchOpts.interval, "interval", watch.DefaultInterval, "Time between inbox scans")
+	f.DurationVar(&watchOpts.settle, "settle", watch.DefaultSettle, "Minimum file age before it is signed")
+	f.IntVar(&watchOpts.attempts, "retries", watch.DefaultMaxAttempts, "Attempts per file before it is moved to --failed")
+	f.StringVar(&watchOpts.logPath, "log", "", "Also append the action log to this file")
+	f.BoolVar(&watchOpts.once, "once", false, "Process the current inbox contents and exit")
+	_ = watchCmd.MarkFlagRequired("inbox")
+	_ = watchCmd.MarkFlagRequired("outbox")
+	_ = watchCmd.MarkFlagRequired("archive")
+}
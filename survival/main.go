@@ -0,0 +1,171 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"defender/injector"
+	"survival/matrix"
+)
+
+// combosFlag collects repeated -combo values
+type combosFlag []matrix.Combination
+
+func (c *combosFlag) String() string {
+	names := make([]string, len(*c))
+	for i, combo := range *c {
+		names[i] = combo.Name
+	}
+	return strings.Join(names, ",")
+}
+
+func (c *combosFlag) Set(v string) error {
+	anchors, err := injector.ParseAnchorProfile(v)
+	if err != nil {
+		return err
+	}
+	*c = append(*c, matrix.Combination{Name: strings.Join(anchors, "+"), Anchors: anchors})
+	return nil
+}
+
+func main() {
+	var combos combosFlag
+	mdPath := flag.String("md", "", "Write the Markdown matrix to this file (default: stdout)")
+	jsonPath := flag.String("json", "", "Write the JSON matrix with every cell to this file")
+	attackList := flag.String("attacks", "", "Comma-separated attacks to run (default: all)")
+	key := flag.String("k", matrix.DefaultKey, "32-byte signing key")
+	msg := flag.String("m", matrix.DefaultMessage, "Message to embed")
+	verbose := flag.Bool("v", false, "Show signer and cleaner output on stderr")
+	flag.Var(&combos, "combo", "Anchor combination to sign with, e.g. SMask+Content (repeatable; default: each anchor alone, each invisible anchor with Visual and every anchor profile)")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: survival [flags] <pdf|dir>...\n\n")
+		fmt.Fprintf(os.Stderr, "Signs every PDF with each anchor combination, runs every attacker cleaner\n")
+		fmt.Fprintf(os.Stderr, "and prints which anchors survive as an anchor × attack matrix.\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	if err := run(flag.Args(), combos, *attackList, *key, *msg, *mdPath, *jsonPath, *verbose); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(paths []string, combos combosFlag, attackList, key, msg, mdPath, jsonPath string, verbose bool) error {
+	corpus, err := collectPDFs(paths)
+	if err != nil {
+		return err
+	}
+	if len(corpus) == 0 {
+		return fmt.Errorf("no PDF files found")
+	}
+	attacks, err := selectAttacks(attackList)
+	if err != nil {
+		return err
+	}
+
+	// Signer and cleaners print progress on stdout; keep it for the matrix
+	stdout := os.Stdout
+	if verbose {
+		os.Stdout = os.Stderr
+	} else if devNull, err := os.Open(os.DevNull); err == nil {
+		os.Stdout = devNull
+		defer devNull.Close()
+	}
+	stderr := os.Stderr
+	if !verbose {
+		// The signer's debug lines go to stderr
+		os.Stderr = os.Stdout
+	}
+	m, err := matrix.Run(matrix.Config{
+		Corpus:       corpus,
+		Combinations: combos,
+		Attacks:      attacks,
+		Key:          key,
+		Message:      msg,
+		Progress:     stderr,
+	})
+	os.Stdout, os.Stderr = stdout, stderr
+	if err != nil {
+		return err
+	}
+
+	if jsonPath != "" {
+		data, err := m.JSON()
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(jsonPath, data, 0644); err != nil {
+			return err
+		}
+	}
+	var out io.Writer = os.Stdout
+	if mdPath != "" {
+		f, err := os.Create(mdPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	_, err = io.WriteString(out, m.Markdown())
+	return err
+}
+
+// selectAttacks returns the attacks named in a comma-separated list, or all of them
+func selectAttacks(list string) ([]matrix.Attack, error) {
+	all := matrix.Attacks()
+	if list == "" {
+		return all, nil
+	}
+	byName := make(map[string]matrix.Attack, len(all))
+	for _, a := range all {
+		byName[strings.ToLower(a.Name)] = a
+	}
+	var attacks []matrix.Attack
+	for _, name := range strings.Split(list, ",") {
+		a, ok := byName[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("unknown attack %q", name)
+		}
+		attacks = append(attacks, a)
+	}
+	return attacks, nil
+}
+
+// collectPDFs expands paths into PDF files, walking directories recursively
+func collectPDFs(paths []string) ([]string, error) {
+	var files []string
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		err = filepath.WalkDir(p, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && strings.EqualFold(filepath.Ext(path), ".pdf") {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
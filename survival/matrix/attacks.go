@@ -0,0 +1,85 @@
+package matrix
+
+import (
+	"attacker/core"
+)
+
+// heuristicThreshold is the attacker CLI's default frequency threshold
+const heuristicThreshold = 0.8
+
+// Attack is one attacker cleaner applied to a signed PDF
+type Attack struct {
+	Name string
+	// Run cleans the PDF at path and returns the path of the cleaned copy,
+	// which the cleaners write next to the input
+	Run func(path string) (string, error)
+}
+
+// Attacks returns every attacker/core cleaner, preceded by the no-op control
+func Attacks() []Attack {
+	return []Attack{
+		{"None", func(path string) (string, error) { return path, nil }},
+		{"CleanPDF", func(path string) (string, error) {
+			out, _, err := core.CleanPDF(path)
+			return out, err
+		}},
+		{"SanitizeGaps", func(path string) (string, error) {
+			out, _, err := core.SanitizeGaps(path)
+			return out, err
+		}},
+		{"PruneZombies", func(path string) (string, error) {
+			out, _, err := core.PruneZombies(path)
+			return out, err
+		}},
+		{"RollbackPDF", func(path string) (string, error) {
+			out, _, err := core.RollbackPDF(path)
+			return out, err
+		}},
+		{"StreamCleaner", core.StreamCleaner},
+		{"HeuristicClean", func(path string) (string, error) {
+			out, _, err := core.HeuristicClean(path, heuristicThreshold)
+			return out, err
+		}},
+		{"ComprehensiveClean", func(path string) (string, error) {
+			return core.ComprehensiveClean(path, heuristicThreshold)
+		}},
+		{"RemoveSuspiciousAttachments", func(path string) (string, error) {
+			out, _, err := core.RemoveSuspiciousAttachments(path)
+			return out, err
+		}},
+		{"RemoveSuspiciousContentOnly", func(path string) (string, error) {
+			out, _, err := core.RemoveSuspiciousContentOnly(path)
+			return out, err
+		}},
+		{"RemoveSpecificWatermark", func(path string) (string, error) {
+			out, _, err := core.RemoveSpecificWatermark(path)
+			return out, err
+		}},
+		{"SimpleIncrementalClean", core.SimpleIncrementalClean},
+		{"SignatureCleaner", signatureCleaner((*core.SignatureCleaner).CleanSignature)},
+		{"SignatureCleaner.Minimal", signatureCleaner((*core.SignatureCleaner).CleanMinimal)},
+		{"SignatureCleaner.EmbeddedFile", signatureCleaner((*core.SignatureCleaner).CleanEmbeddedFileOnly)},
+		{"SafeCleaner.StreamContent", safeCleaner((*core.SafeCleaner).CleanStreamContent)},
+		{"SafeCleaner.EmbeddedFilesRef", safeCleaner((*core.SafeCleaner).RemoveEmbeddedFilesRef)},
+	}
+}
+
+func signatureCleaner(clean func(*core.SignatureCleaner) (string, error)) func(string) (string, error) {
+	return func(path string) (string, error) {
+		sc, err := core.NewSignatureCleaner(path)
+		if err != nil {
+			return "", err
+		}
+		return clean(sc)
+	}
+}
+
+func safeCleaner(clean func(*core.SafeCleaner) (string, error)) func(string) (string, error) {
+	return func(path string) (string, error) {
+		sc, err := core.NewSafeCleaner(path)
+		if err != nil {
+			return "", err
+		}
+		return clean(sc)
+	}
+}
@@ -0,0 +1,42 @@
+//go:build integration
+// +build integration
+
+package matrix
+
+import (
+	"os"
+	"testing"
+)
+
+const (
+	testPDFPath = "../../defender/testdata/2511.17467v2.pdf"
+)
+
+// TestSurvivalMatrix runs every attack against every default combination of the
+// sample PDF and logs the matrix (go test -tags integration -v)
+func TestSurvivalMatrix(t *testing.T) {
+	if _, err := os.Stat(testPDFPath); os.IsNotExist(err) {
+		t.Skip("Test PDF not found, skipping integration test")
+	}
+
+	m, err := Run(Config{Corpus: []string{testPDFPath}, WorkDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if want := len(DefaultCombinations()) * len(Attacks()); len(m.Cells) != want {
+		t.Fatalf("Expected %d cells, got %d", want, len(m.Cells))
+	}
+	for _, c := range m.Cells {
+		if c.SignError != "" {
+			t.Errorf("Signing with %s failed: %s", c.Combination, c.SignError)
+		}
+	}
+
+	// The control attack leaves every anchor in place
+	for _, anchor := range m.Anchors {
+		if ok, total := m.AnchorSurvival(anchor, "None"); total == 0 || ok != total {
+			t.Errorf("%s did not survive the control: %d/%d", anchor, ok, total)
+		}
+	}
+	t.Log("\n" + m.Markdown())
+}
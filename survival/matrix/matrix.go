@@ -0,0 +1,320 @@
+// Package matrix measures which defender anchors survive which attacker cleaners.
+// It signs corpus PDFs with each anchor combination, runs every attacker/core
+// cleaner on a private copy of each signed PDF and verifies every embedded anchor
+// on the result, producing an anchor × attack survival matrix.
+package matrix
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"defender/injector"
+)
+
+const (
+	// DefaultKey is the signing key used when Config.Key is empty
+	DefaultKey = "12345678901234567890123456789012"
+	// DefaultMessage is the embedded message used when Config.Message is empty
+	DefaultMessage = "Survival:Matrix"
+	// CombinationAll names the combination of the "all" anchor profile, every
+	// default anchor
+	CombinationAll = "All"
+)
+
+// Combination is a named set of anchors a corpus PDF is signed with
+type Combination struct {
+	Name    string   `json:"name"`
+	Anchors []string `json:"anchors"`
+}
+
+// DefaultCombinations signs with each default anchor alone, with each
+// invisible anchor backing the visible watermark (e.g. Attachment+Visual) and
+// with every anchor profile (All, Invisible, ...), the sets sign is used with.
+// A set of anchors already listed is not repeated under another name.
+func DefaultCombinations() []Combination {
+	var combos []Combination
+	seen := make(map[string]bool)
+	add := func(name string, anchors []string) {
+		set := slices.Clone(anchors)
+		sort.Strings(set)
+		if key := strings.Join(set, "+"); !seen[key] {
+			seen[key] = true
+			combos = append(combos, Combination{Name: name, Anchors: slices.Clone(anchors)})
+		}
+	}
+
+	for _, a := range injector.DefaultAnchors {
+		add(a, []string{a})
+	}
+	for _, visible := range injector.AnchorProfiles["visual"] {
+		for _, a := range injector.AnchorProfiles["invisible"] {
+			add(a+"+"+visible, []string{a, visible})
+		}
+	}
+	profiles := make([]string, 0, len(injector.AnchorProfiles))
+	for name := range injector.AnchorProfiles {
+		profiles = append(profiles, name)
+	}
+	sort.Strings(profiles)
+	for _, name := range profiles {
+		add(strings.ToUpper(name[:1])+name[1:], injector.AnchorProfiles[name])
+	}
+	return combos
+}
+
+// Config configures Run
+type Config struct {
+	// Corpus lists the PDFs to sign
+	Corpus []string
+	// Combinations defaults to DefaultCombinations
+	Combinations []Combination
+	// Attacks defaults to Attacks
+	Attacks []Attack
+	Key     string
+	Message string
+	// WorkDir is where the temporary copies live (default: the system temp dir)
+	WorkDir string
+	// Progress, if set, receives one line per signed copy
+	Progress io.Writer
+}
+
+// Cell is the outcome of one attack on one signed copy
+type Cell struct {
+	File        string `json:"file"`
+	Combination string `json:"combination"`
+	Attack      string `json:"attack"`
+	// Embedded lists the anchors Sign actually injected
+	Embedded []string `json:"embedded"`
+	// Survived lists the embedded anchors still verifiable after the attack
+	Survived []string `json:"survived"`
+	// Intact reports whether the attacked PDF can still be parsed, telling
+	// anchors that were stripped from anchors lost with a broken document
+	Intact      bool   `json:"intact"`
+	SignError   string `json:"sign_error,omitempty"`
+	AttackError string `json:"attack_error,omitempty"`
+}
+
+// failed reports whether the cell has no result
+func (c *Cell) failed() bool {
+	return c.SignError != "" || c.AttackError != ""
+}
+
+// Matrix is the result of a Run
+type Matrix struct {
+	CreatedAt    time.Time     `json:"created_at"`
+	Message      string        `json:"message"`
+	Files        []string      `json:"files"`
+	Anchors      []string      `json:"anchors"`
+	Combinations []Combination `json:"combinations"`
+	Attacks      []string      `json:"attacks"`
+	Cells        []Cell        `json:"cells"`
+}
+
+// Run signs every corpus PDF with every combination, applies every attack and
+// records which anchors survive. Failures of single signs or attacks are
+// recorded in their cells; only a setup failure is returned as an error.
+func Run(cfg Config) (*Matrix, error) {
+	if len(cfg.Corpus) == 0 {
+		return nil, errors.New("corpus is empty")
+	}
+	if cfg.Combinations == nil {
+		cfg.Combinations = DefaultCombinations()
+	}
+	if cfg.Attacks == nil {
+		cfg.Attacks = Attacks()
+	}
+	if cfg.Key == "" {
+		cfg.Key = DefaultKey
+	}
+	if cfg.Message == "" {
+		cfg.Message = DefaultMessage
+	}
+
+	work, err := os.MkdirTemp(cfg.WorkDir, "survival-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(work)
+
+	m := &Matrix{
+		CreatedAt:    time.Now().UTC(),
+		Message:      cfg.Message,
+		Files:        cfg.Corpus,
+		Combinations: cfg.Combinations,
+	}
+	seen := make(map[string]bool)
+	for _, c := range cfg.Combinations {
+		for _, a := range c.Anchors {
+			if !seen[a] {
+				seen[a] = true
+				m.Anchors = append(m.Anchors, a)
+			}
+		}
+	}
+	for _, a := range cfg.Attacks {
+		m.Attacks = append(m.Attacks, a.Name)
+	}
+
+	for fi, file := range cfg.Corpus {
+		for ci, combo := range cfg.Combinations {
+			dir := filepath.Join(work, fmt.Sprintf("f%d-c%d", fi, ci))
+			if err := os.Mkdir(dir, 0700); err != nil {
+				return nil, err
+			}
+			signed := filepath.Join(dir, "signed.pdf")
+			result, signErr := injector.SignTo(file, signed, cfg.Message, cfg.Key, combo.Anchors)
+			if cfg.Progress != nil {
+				status := "ok"
+				if signErr != nil {
+					status = signErr.Error()
+				}
+				fmt.Fprintf(cfg.Progress, "[*] %s signed with %s: %s\n", file, combo.Name, status)
+			}
+
+			for ai, attack := range cfg.Attacks {
+				cell := Cell{File: file, Combination: combo.Name, Attack: attack.Name}
+				if signErr != nil {
+					cell.SignError = signErr.Error()
+				} else {
+					cell.Embedded = result.Anchors
+					cell.Survived, cell.Intact, err = runCell(attack, signed, filepath.Join(dir, fmt.Sprintf("a%d", ai)), result.Anchors, cfg)
+					if err != nil {
+						cell.AttackError = err.Error()
+					}
+				}
+				m.Cells = append(m.Cells, cell)
+			}
+			os.RemoveAll(dir)
+		}
+	}
+	return m, nil
+}
+
+// runCell attacks a private copy of signed in dir and returns the surviving
+// anchors and whether the attacked PDF is still intact
+func runCell(attack Attack, signed, dir string, embedded []string, cfg Config) ([]string, bool, error) {
+	if err := os.Mkdir(dir, 0700); err != nil {
+		return nil, false, err
+	}
+	defer os.RemoveAll(dir)
+	target := filepath.Join(dir, "signed.pdf")
+	if err := copyFile(signed, target); err != nil {
+		return nil, false, err
+	}
+
+	cleaned, err := runAttack(attack, target)
+	if err != nil {
+		return nil, false, err
+	}
+
+	survived := []string{}
+	for _, anchor := range embedded {
+		if anchorSurvives(cleaned, anchor, cfg.Key, cfg.Message) {
+			survived = append(survived, anchor)
+		}
+	}
+	_, err = injector.ExtractShownText(cleaned)
+	return survived, err == nil, nil
+}
+
+// runAttack runs one cleaner, turning a panic into an error
+func runAttack(attack Attack, path string) (cleaned string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return attack.Run(path)
+}
+
+// anchorSurvives reports whether anchor still carries message in path. Hidden
+// anchors must decrypt; the Visual anchor must still show the message text.
+func anchorSurvives(path, anchor, key, message string) bool {
+	if anchor != injector.AnchorNameVisual {
+		msg, _, err := injector.Verify(path, key, []string{anchor})
+		return err == nil && msg == message
+	}
+
+	texts, err := injector.ExtractShownText(path)
+	if err != nil {
+		return false
+	}
+	want := strings.Join(strings.Fields(message), "")
+	for _, text := range texts {
+		if strings.Contains(strings.Join(strings.Fields(text), ""), want) {
+			return true
+		}
+	}
+	return false
+}
+
+// AnchorSurvival counts the copies carrying anchor on which attack ran, and how
+// many of them still carry it afterwards
+func (m *Matrix) AnchorSurvival(anchor, attack string) (survived, total int) {
+	for i := range m.Cells {
+		c := &m.Cells[i]
+		if c.Attack != attack || c.failed() || !contains(c.Embedded, anchor) {
+			continue
+		}
+		total++
+		if contains(c.Survived, anchor) {
+			survived++
+		}
+	}
+	return survived, total
+}
+
+// Traceable counts the copies signed with combination on which attack ran, and
+// how many of them keep at least one anchor
+func (m *Matrix) Traceable(combination, attack string) (traceable, total int) {
+	for i := range m.Cells {
+		c := &m.Cells[i]
+		if c.Attack != attack || c.Combination != combination || c.failed() {
+			continue
+		}
+		total++
+		if len(c.Survived) > 0 {
+			traceable++
+		}
+	}
+	return traceable, total
+}
+
+// Intact counts the copies attack ran on, and how many of them still parse
+func (m *Matrix) Intact(attack string) (intact, total int) {
+	for i := range m.Cells {
+		c := &m.Cells[i]
+		if c.Attack != attack || c.failed() {
+			continue
+		}
+		total++
+		if c.Intact {
+			intact++
+		}
+	}
+	return intact, total
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func copyFile(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, 0600)
+}
@@ -0,0 +1,137 @@
+package matrix
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"defender/injector"
+)
+
+// testMatrix has two copies, one signed with Attachment and one with all anchors
+func testMatrix() *Matrix {
+	return &Matrix{
+		Message: DefaultMessage,
+		Files:   []string{"a.pdf"},
+		Anchors: []string{"Attachment", "SMask"},
+		Combinations: []Combination{
+			{Name: "Attachment", Anchors: []string{"Attachment"}},
+			{Name: CombinationAll, Anchors: []string{"Attachment", "SMask"}},
+		},
+		Attacks: []string{"None", "Strip", "Broken"},
+		Cells: []Cell{
+			{Combination: "Attachment", Attack: "None", Embedded: []string{"Attachment"}, Survived: []string{"Attachment"}, Intact: true},
+			{Combination: "Attachment", Attack: "Strip", Embedded: []string{"Attachment"}, Survived: []string{}, Intact: true},
+			{Combination: "Attachment", Attack: "Broken", Embedded: []string{"Attachment"}, AttackError: "no gaps"},
+			{Combination: CombinationAll, Attack: "None", Embedded: []string{"Attachment", "SMask"}, Survived: []string{"Attachment", "SMask"}, Intact: true},
+			{Combination: CombinationAll, Attack: "Strip", Embedded: []string{"Attachment", "SMask"}, Survived: []string{"SMask"}, Intact: true},
+			{Combination: CombinationAll, Attack: "Broken", Embedded: []string{"Attachment", "SMask"}, AttackError: "no gaps"},
+		},
+	}
+}
+
+// TestDefaultCombinations tests that the default combinations cover single
+// anchors, the profiles and invisible anchors paired with Visual, each set once
+func TestDefaultCombinations(t *testing.T) {
+	combos := DefaultCombinations()
+	byName := make(map[string][]string)
+	sets := make(map[string]bool)
+	for _, c := range combos {
+		byName[c.Name] = c.Anchors
+		set := append([]string(nil), c.Anchors...)
+		sort.Strings(set)
+		if key := strings.Join(set, "+"); sets[key] {
+			t.Errorf("Anchor set %s listed twice", key)
+		} else {
+			sets[key] = true
+		}
+	}
+	for _, name := range []string{"Attachment", "SMask", "Content", "Visual", "Attachment+Visual", "SMask+Visual", "Content+Visual", "Invisible", CombinationAll} {
+		if byName[name] == nil {
+			t.Errorf("Missing combination %s in %v", name, combos)
+		}
+	}
+	for name, anchors := range injector.AnchorProfiles {
+		set := append([]string(nil), anchors...)
+		sort.Strings(set)
+		if !sets[strings.Join(set, "+")] {
+			t.Errorf("Profile %s is not covered", name)
+		}
+	}
+	if !reflect.DeepEqual(byName[CombinationAll], injector.AnchorProfiles["all"]) {
+		t.Errorf("%s = %v", CombinationAll, byName[CombinationAll])
+	}
+}
+
+// TestCounts tests the anchor, combination and integrity aggregation
+func TestCounts(t *testing.T) {
+	m := testMatrix()
+	tests := []struct {
+		name      string
+		got       func() (int, int)
+		wantOK    int
+		wantTotal int
+	}{
+		{"Attachment/None", func() (int, int) { return m.AnchorSurvival("Attachment", "None") }, 2, 2},
+		{"Attachment/Strip", func() (int, int) { return m.AnchorSurvival("Attachment", "Strip") }, 0, 2},
+		{"SMask/Strip", func() (int, int) { return m.AnchorSurvival("SMask", "Strip") }, 1, 1},
+		{"Failed attack", func() (int, int) { return m.AnchorSurvival("Attachment", "Broken") }, 0, 0},
+		{"Traceable All/Strip", func() (int, int) { return m.Traceable(CombinationAll, "Strip") }, 1, 1},
+		{"Traceable Attachment/Strip", func() (int, int) { return m.Traceable("Attachment", "Strip") }, 0, 1},
+		{"Intact Strip", func() (int, int) { return m.Intact("Strip") }, 2, 2},
+	}
+	for _, tt := range tests {
+		ok, total := tt.got()
+		if ok != tt.wantOK || total != tt.wantTotal {
+			t.Errorf("%s: got %d/%d, want %d/%d", tt.name, ok, total, tt.wantOK, tt.wantTotal)
+		}
+	}
+}
+
+// TestMarkdown tests the rendered tables
+func TestMarkdown(t *testing.T) {
+	md := testMatrix().Markdown()
+	for _, want := range []string{
+		"| Attack | Attachment | SMask | PDF intact |",
+		"| None | ✓ | ✓ | ✓ |",
+		"| Strip | ✗ | ✓ | ✓ |",
+		"| Broken | n/a | n/a | n/a |",
+		"| Attack | Attachment | All |",
+		"| Strip | ✗ | ✓ |",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("Markdown missing %q:\n%s", want, md)
+		}
+	}
+}
+
+// TestJSON tests that the JSON report keeps every cell
+func TestJSON(t *testing.T) {
+	data, err := testMatrix().JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Matrix
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Cells) != 6 || decoded.Cells[2].AttackError != "no gaps" {
+		t.Errorf("Cells not preserved: %+v", decoded.Cells)
+	}
+}
+
+// TestSymbol tests the cell notation
+func TestSymbol(t *testing.T) {
+	for _, tt := range []struct {
+		survived, total int
+		want            string
+	}{
+		{0, 0, "n/a"}, {3, 3, "✓"}, {0, 3, "✗"}, {1, 3, "1/3"},
+	} {
+		if got := symbol(tt.survived, tt.total); got != tt.want {
+			t.Errorf("symbol(%d, %d) = %q, want %q", tt.survived, tt.total, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package matrix
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// intactColumn heads the document integrity column of the anchor table
+const intactColumn = "PDF intact"
+
+// JSON encodes the matrix with every cell
+func (m *Matrix) JSON() ([]byte, error) {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// Markdown renders the anchor × attack and combination × attack tables
+func (m *Matrix) Markdown() string {
+	var b strings.Builder
+	b.WriteString("# Anchor Survival Matrix\n\n")
+	fmt.Fprintf(&b, "Corpus: %d file(s), message %q, generated %s.\n\n",
+		len(m.Files), m.Message, m.CreatedAt.Format("2006-01-02 15:04 MST"))
+
+	b.WriteString("## Anchor × attack\n\n")
+	b.WriteString("Whether each anchor can still be verified after the attack, over every signed copy that carries it.\n")
+	b.WriteString("The last column shows whether the attacked PDF still parses at all.\n\n")
+	columns := append(append([]string(nil), m.Anchors...), intactColumn)
+	writeTable(&b, m.Attacks, columns, func(name, attack string) (int, int) {
+		if name == intactColumn {
+			return m.Intact(attack)
+		}
+		return m.AnchorSurvival(name, attack)
+	})
+
+	names := make([]string, len(m.Combinations))
+	for i, c := range m.Combinations {
+		names[i] = c.Name
+	}
+	b.WriteString("\n## Combination × attack\n\n")
+	b.WriteString("Whether copies signed with each combination still carry at least one anchor after the attack.\n\n")
+	writeTable(&b, m.Attacks, names, m.Traceable)
+
+	b.WriteString("\n✓ all copies, ✗ none, k/n some; n/a: the attack or signing failed on every copy.\n")
+	return b.String()
+}
+
+// writeTable writes one row per attack and one column per name
+func writeTable(b *strings.Builder, attacks, names []string, count func(name, attack string) (int, int)) {
+	b.WriteString("| Attack |")
+	for _, n := range names {
+		fmt.Fprintf(b, " %s |", n)
+	}
+	b.WriteString("\n|---|")
+	for range names {
+		b.WriteString("---|")
+	}
+	b.WriteString("\n")
+
+	for _, attack := range attacks {
+		fmt.Fprintf(b, "| %s |", attack)
+		for _, n := range names {
+			fmt.Fprintf(b, " %s |", symbol(count(n, attack)))
+		}
+		b.WriteString("\n")
+	}
+}
+
+// symbol renders a survived/total count
+func symbol(survived, total int) string {
+	switch {
+	case total == 0:
+		return "n/a"
+	case survived == total:
+		return "✓"
+	case survived == 0:
+		return "✗"
+	default:
+		return fmt.Sprintf("%d/%d", survived, total)
+	}
+}